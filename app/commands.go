@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"stravach/app/storage"
+	"stravach/app/strava"
+	"stravach/app/strava/fakestrava"
+	"strconv"
+	"time"
+)
+
+const (
+	subscriptionsUsage = "usage: stravach subscriptions list|create|delete <id>"
+	fakeStravaUsage    = "usage: stravach fake-strava [addr]"
+	migrateUsage       = "usage: stravach migrate status|up [version]|down [steps]"
+	rotateKeysUsage    = "usage: stravach rotate-keys"
+	backupUsage        = "usage: stravach backup [dir]"
+	restoreUsage       = "usage: stravach restore <backup file>"
+	defaultBackupDir   = "db/backups"
+	defaultBackupKeep  = 7
+	fakeStravaAddr     = ":8081"
+	fakeStravaAthlete  = 1
+)
+
+// runCommand executes a one-off CLI subcommand instead of starting the server.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "subscriptions":
+		return subscriptionsCommand(args[1:])
+	case "fake-strava":
+		return fakeStravaCommand(args[1:])
+	case "migrate":
+		return migrateCommand(args[1:])
+	case "rotate-keys":
+		return rotateKeysCommand(args[1:])
+	case "backup":
+		return backupCommand(args[1:])
+	case "restore":
+		return restoreCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// subscriptionsCommand manages the Strava webhook push subscription of the app.
+func subscriptionsCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(subscriptionsUsage)
+	}
+	client := strava.NewStravaClient()
+	switch args[0] {
+	case "list":
+		subscriptions, err := client.ListSubscriptions()
+		if err != nil {
+			return err
+		}
+		if len(subscriptions) == 0 {
+			fmt.Println("no push subscriptions")
+		}
+		for _, s := range subscriptions {
+			fmt.Printf("%d\t%s\t%s\n", s.Id, s.CallbackUrl, s.CreatedAt)
+		}
+		return nil
+	case "create":
+		url := os.Getenv("URL")
+		if url == "" {
+			return errors.New("URL environment variable is not set")
+		}
+		subscription, err := client.CreateSubscription(strava.WebhookCallbackUrl(url), os.Getenv("STRAVA_CHALLENGE_TOKEN"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created push subscription %d for %s\n", subscription.Id, subscription.CallbackUrl)
+		return nil
+	case "delete":
+		if len(args) != 2 {
+			return errors.New(subscriptionsUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid subscription id %q", args[1])
+		}
+		err = client.DeleteSubscription(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted push subscription %d\n", id)
+		return nil
+	default:
+		return errors.New(subscriptionsUsage)
+	}
+}
+
+// fakeStravaCommand serves an in-memory Strava API for local development.
+// Point the bot at it with STRAVA_BASE_URL=http://localhost:8081.
+func fakeStravaCommand(args []string) error {
+	addr := fakeStravaAddr
+	switch len(args) {
+	case 0:
+	case 1:
+		addr = args[0]
+	default:
+		return errors.New(fakeStravaUsage)
+	}
+	fake := fakestrava.New(os.Getenv("STRAVA_CLIENT_ID"), os.Getenv("STRAVA_CLIENT_SECRET"))
+	fake.AddAthlete(fakestrava.Athlete{Id: fakeStravaAthlete, Username: "demo"})
+	now := time.Now().UTC()
+	fake.AddActivity(fakeStravaAthlete, fakestrava.Activity{Name: "Morning Run", Type: "Run", Distance: 8200, MovingTime: 2700, ElapsedTime: 2820, StartDate: now.Add(-48 * time.Hour)})
+	fake.AddActivity(fakeStravaAthlete, fakestrava.Activity{Name: "Afternoon Ride", Type: "Ride", Distance: 42000, MovingTime: 5400, ElapsedTime: 6000, StartDate: now.Add(-24 * time.Hour)})
+	slog.Info("fake strava listening", "addr", addr, "athlete", fakeStravaAthlete)
+	slog.Info("POST activity JSON to /fake/athletes/{id}/activities to simulate an upload")
+	return http.ListenAndServe(addr, fake)
+}
+
+// migrateCommand shows and changes the schema version of the DATABASE_URL database.
+func migrateCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+	number := 0
+	if len(args) == 2 {
+		var err error
+		number, err = strconv.Atoi(args[1])
+		if err != nil || number < 1 {
+			return errors.New(migrateUsage)
+		}
+	}
+	migrator, err := storage.NewMigrator(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer migrator.DB.Close()
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt > 0 {
+				state = "applied " + time.Unix(s.AppliedAt, 0).UTC().Format(time.RFC3339)
+			}
+			if !s.Known {
+				state += ", unknown to this build"
+			}
+			fmt.Printf("%04d\t%s\t%s\n", s.Version, s.Name, state)
+		}
+		return nil
+	case "up":
+		applied, err := migrator.Up(number)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		reverted, err := migrator.Down(number)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// rotateKeysCommand re-encrypts stored Strava tokens with the first key of TOKEN_ENCRYPTION_KEYS.
+// Run it after adding a new key in front, then drop the old key once it reports nothing left.
+func rotateKeysCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New(rotateKeysUsage)
+	}
+	if os.Getenv("TOKEN_ENCRYPTION_KEYS") == "" {
+		return errors.New("TOKEN_ENCRYPTION_KEYS environment variable is not set")
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	rotated, err := storage.RotateKeys(store)
+	fmt.Printf("re-encrypted tokens of %d users\n", rotated)
+	return err
+}
+
+// backupOptions reads the backup settings: BACKUP_DIR (default db/backups), BACKUP_GZIP
+// (default true) and BACKUP_KEEP, the number of snapshots kept (default 7, 0 keeps all).
+func backupOptions() (storage.BackupOptions, error) {
+	opts := storage.BackupOptions{Dir: os.Getenv("BACKUP_DIR"), Gzip: os.Getenv("BACKUP_GZIP") != "false", Keep: defaultBackupKeep}
+	if opts.Dir == "" {
+		opts.Dir = defaultBackupDir
+	}
+	if keep := os.Getenv("BACKUP_KEEP"); keep != "" {
+		var err error
+		if opts.Keep, err = strconv.Atoi(keep); err != nil || opts.Keep < 0 {
+			return opts, fmt.Errorf("invalid BACKUP_KEEP %q", keep)
+		}
+	}
+	return opts, nil
+}
+
+// backupCommand snapshots the DATABASE_URL SQLite database while the service keeps running.
+func backupCommand(args []string) error {
+	if len(args) > 1 {
+		return errors.New(backupUsage)
+	}
+	opts, err := backupOptions()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		opts.Dir = args[0]
+	}
+	store, err := storage.OpenSQLite(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer store.DB.Close()
+	path, err := store.Backup(opts, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("backed up to %s\n", path)
+	return nil
+}
+
+// restoreCommand replaces the DATABASE_URL SQLite database with a snapshot of backupCommand.
+// Stop the service first; it migrates an older snapshot on the next start.
+func restoreCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New(restoreUsage)
+	}
+	replaced, err := storage.RestoreSQLite(os.Getenv("DATABASE_URL"), args[0], time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s\n", args[0])
+	if replaced != "" {
+		fmt.Printf("the previous database was moved to %s\n", replaced)
+	}
+	return nil
+}
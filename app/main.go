@@ -6,8 +6,11 @@ import (
 	"os"
 	"os/signal"
 	"stravach/app/server"
+	"stravach/app/storage"
 	"stravach/app/tg"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,46 +19,156 @@ var (
 	srv      *server.HttpHandler
 	telegram *tg.Telegram
 	env      string
+	// demo serves seeded in-memory data with the dev login and without the bot.
+	demo bool
 )
 
+// shutdownTimeout is how long the bot gets to finish the running updates when stopping.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-	sigCh := make(chan os.Signal)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	ctx := context.Background()
-	go srv.Start()
-	if env != "DEV" {
-		go telegram.Start(ctx)
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1:])
+		if err != nil {
+			slog.Error("command failed", "err", err)
+			os.Exit(1)
+		}
+		return
 	}
+	serve()
+}
+
+func serve() {
+	setup()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// the bot and the backups stop only after the server drained, so updates posted to the
+	// Telegram webhook while shutting down are still handled
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	if env != "DEV" && !demo {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			telegram.Start(workersCtx)
+		}()
+	}
+	scheduleBackups(workersCtx)
 
 	slog.Info("press CTRL+C to stop program\n")
-	<-sigCh
+	err := srv.Start(ctx)
 	slog.Info("Shutting down\n")
-	os.Exit(0)
+	stopWorkers()
+	waitTimeout(&workers, shutdownTimeout)
+	if err != nil {
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+// waitTimeout waits for wg, giving up after timeout.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("shutdown timed out, exiting with work still running", "timeout", timeout)
+	}
 }
 
 func init() {
 	err := godotenv.Load()
 	env = os.Getenv("ENV")
+	demo = os.Getenv("DEMO") == "true"
 	if err != nil && env != "PROD" {
 		slog.Error("error while initializing godotenv")
 		os.Exit(1)
 	}
-	srv = &server.HttpHandler{}
 	slog.SetLogLoggerLevel(slog.LevelDebug.Level())
+}
+
+func setup() {
+	srv = &server.HttpHandler{}
+
+	db, err := openStore()
+	if err != nil {
+		slog.Error("error while connecting to DB")
+		panic(err)
+	}
 
 	tgApiKey := os.Getenv("TELEGRAM_API_KEY")
-	telegram, err = tg.NewTelegramClient(tgApiKey)
+	telegram = tg.NewTelegramClient(tgApiKey, db, db)
+	telegram.Webhook, err = tg.WebhookConfigFromEnv()
 	if err != nil {
-		slog.Error("error while initializing telegram")
+		slog.Error("invalid telegram update mode", "err", err)
 		panic(err)
 	}
 
-	activitiesChannel := make(chan tg.ActivityForUpdate)
 	broadCastChannel := make(chan tg.BroadcastMessage)
-	srv.ActivitiesChannel = activitiesChannel
+	notificationsChannel := make(chan tg.Notification, 10)
+	srv.Renames = telegram.Renames
 	srv.BroadcastChannel = broadCastChannel
-	telegram.ActivitiesChannel = activitiesChannel
+	srv.NotificationsChannel = notificationsChannel
 	telegram.BroadcastChannel = broadCastChannel
+	telegram.NotificationsChannel = notificationsChannel
+
+	srv.Init(db)
+	if telegram.Webhook != nil && env != "DEV" && !demo {
+		if err = telegram.Connect(); err != nil {
+			slog.Error("error while connecting to telegram")
+			panic(err)
+		}
+		srv.TelegramWebhook = telegram.WebhookHandler()
+	}
+	if demo {
+		slog.Warn("DEMO is enabled, serving seeded data that is lost on exit, anyone can log in as the demo user")
+		srv.DevLogin = true
+	}
+}
+
+// openStore connects to DATABASE_URL with the token keys from TOKEN_ENCRYPTION_KEYS.
+// In demo mode it returns a seeded in-memory store instead.
+func openStore() (storage.Store, error) {
+	if demo {
+		store := storage.NewMemoryStore()
+		return store, storage.SeedDemo(context.Background(), store, time.Now())
+	}
+	keys, err := storage.NewKeyring(os.Getenv("TOKEN_ENCRYPTION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		slog.Warn("TOKEN_ENCRYPTION_KEYS is not set, Strava tokens are stored in plaintext")
+	}
+	return storage.NewStore(os.Getenv("DATABASE_URL"), keys)
+}
 
-	srv.Init()
+// scheduleBackups starts backing up a SQLite store every BACKUP_INTERVAL, e.g. 24h,
+// with the options of the backup command. It does nothing when the interval is unset.
+func scheduleBackups(ctx context.Context) {
+	interval := os.Getenv("BACKUP_INTERVAL")
+	if interval == "" {
+		return
+	}
+	every, err := time.ParseDuration(interval)
+	if err != nil || every <= 0 {
+		slog.Error("invalid BACKUP_INTERVAL, backups are off", "interval", interval)
+		return
+	}
+	store, ok := srv.DB.(*storage.SQLiteStore)
+	if !ok {
+		slog.Warn("BACKUP_INTERVAL is set but the store is not SQLite, backups are off")
+		return
+	}
+	opts, err := backupOptions()
+	if err != nil {
+		slog.Error("invalid backup settings, backups are off", "err", err)
+		return
+	}
+	slog.Info("scheduled backups", "every", every, "dir", opts.Dir, "keep", opts.Keep)
+	go storage.ScheduleBackups(ctx, store, every, opts)
 }
@@ -84,10 +84,22 @@ func (ai *OpenAI) IsActivityNameSuggestion(message string) (bool, error) {
 	return strings.HasPrefix(answer, "yes"), nil
 }
 
-func (ai *OpenAI) GenerateBetterNames(activity models.UserActivity, language string) (string, error) {
-	prompt := fmt.Sprintf("Generate a several, new-line separated funny names for the following activity: %s, of type %s, in %s language. "+
+// namingStyles describe the names of every models.NamingStyles in the prompt.
+var namingStyles = map[string]string{
+	models.NamingStyleFunny:   "funny",
+	models.NamingStyleSerious: "serious, descriptive",
+	models.NamingStylePoetic:  "poetic",
+	models.NamingStyleShort:   "short, at most three words long,",
+}
+
+func (ai *OpenAI) GenerateBetterNames(activity models.UserActivity, language string, style string) (string, error) {
+	description, ok := namingStyles[style]
+	if !ok {
+		description = namingStyles[models.NamingStyleFunny]
+	}
+	prompt := fmt.Sprintf("Generate a several, new-line separated %s names for the following activity: %s, of type %s, in %s language. "+
 		"This is for my Strava. Try to be original. Return ONLY names",
-		activity.Name, activity.ActivityType, language)
+		description, activity.Name, activity.ActivityType, language)
 	return ai.sendRequest(prompt)
 }
 
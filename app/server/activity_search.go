@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"stravach/app/storage"
+	"strconv"
+	"time"
+)
+
+// searchActivitiesHandler returns a page of the user's activities matching the query parameters:
+// type, from and to (RFC 3339 or YYYY-MM-DD, to is exclusive), min_distance and max_distance
+// in meters, min_duration and max_duration in seconds of moving time, renamed, q, cursor and limit.
+func (h *HttpHandler) searchActivitiesHandler(w http.ResponseWriter, r *http.Request) {
+	usr, _ := userFromContext(r.Context())
+	query, err := parseActivityQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.UserID = usr.ID
+
+	page, err := h.DB.QueryActivities(r.Context(), query)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("failed to query activities", "error", err, "userId", usr.ID)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query activities")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		slog.Error("error while writing to response", "err", err)
+	}
+}
+
+func parseActivityQuery(values url.Values) (storage.ActivityQuery, error) {
+	q := storage.ActivityQuery{
+		Type:   values.Get("type"),
+		Text:   values.Get("q"),
+		Cursor: values.Get("cursor"),
+	}
+	var err error
+	if q.From, err = parseQueryTime(values, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseQueryTime(values, "to"); err != nil {
+		return q, err
+	}
+	if q.MinDistance, err = parseQueryFloat(values, "min_distance"); err != nil {
+		return q, err
+	}
+	if q.MaxDistance, err = parseQueryFloat(values, "max_distance"); err != nil {
+		return q, err
+	}
+	if q.MinDuration, err = parseQueryInt(values, "min_duration"); err != nil {
+		return q, err
+	}
+	if q.MaxDuration, err = parseQueryInt(values, "max_duration"); err != nil {
+		return q, err
+	}
+	limit, err := parseQueryInt(values, "limit")
+	if err != nil {
+		return q, err
+	}
+	if limit > storage.MaxActivityQueryLimit {
+		return q, fmt.Errorf("limit must be at most %d", storage.MaxActivityQueryLimit)
+	}
+	q.Limit = int(limit)
+	if v := values.Get("renamed"); v != "" {
+		renamed, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid renamed %q", v)
+		}
+		q.Renamed = &renamed
+	}
+	return q, nil
+}
+
+func parseQueryTime(values url.Values, key string) (time.Time, error) {
+	v := values.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q, expected RFC 3339 or YYYY-MM-DD", key, v)
+	}
+	return t, nil
+}
+
+func parseQueryFloat(values url.Values, key string) (float64, error) {
+	v := values.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return f, nil
+}
+
+func parseQueryInt(values url.Values, key string) (int64, error) {
+	v := values.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
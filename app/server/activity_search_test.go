@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"stravach/app/storage"
+	"stravach/app/storage/models"
+	"stravach/app/utils"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchActivities_PassesFilters(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+	mockDB.On("QueryActivities", mock.Anything, mock.MatchedBy(func(q storage.ActivityQuery) bool {
+		return q.UserID == 1 && q.Type == "Run" && q.Text == "river loop" &&
+			q.From.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) && q.To.IsZero() &&
+			q.MinDistance == 5000 && q.MaxDuration == 3600 && q.Renamed != nil && *q.Renamed &&
+			q.Cursor == "abc" && q.Limit == 10
+	})).Return(&storage.ActivityPage{
+		Activities: []models.UserActivity{{ID: 7, UserID: 1, Name: "River Loop"}},
+		NextCursor: "next",
+	}, nil)
+
+	req := newAuthRequest(t, h, http.MethodGet,
+		"/api/activities?type=Run&q=river+loop&from=2024-05-01&min_distance=5000&max_duration=3600&renamed=true&cursor=abc&limit=10", 1)
+	rec := httptest.NewRecorder()
+	h.withAuth(h.searchActivitiesHandler)(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"River Loop"`)
+	assert.Contains(t, rec.Body.String(), `"next_cursor":"next"`)
+	mockDB.AssertExpectations(t)
+}
+
+func TestSearchActivities_RejectsInvalidParameters(t *testing.T) {
+	for _, query := range []string{"from=yesterday", "min_distance=-1", "max_duration=1h", "renamed=maybe", "limit=1000"} {
+		t.Run(query, func(t *testing.T) {
+			mockDB := new(mocks.Store)
+			h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+			mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+
+			req := newAuthRequest(t, h, http.MethodGet, "/api/activities?"+query, 1)
+			rec := httptest.NewRecorder()
+			h.withAuth(h.searchActivitiesHandler)(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			mockDB.AssertNotCalled(t, "QueryActivities", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSearchActivities_InvalidCursor(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+	mockDB.On("QueryActivities", mock.Anything, mock.Anything).Return(nil, storage.ErrInvalidCursor)
+
+	req := newAuthRequest(t, h, http.MethodGet, "/api/activities?cursor=garbage", 1)
+	rec := httptest.NewRecorder()
+	h.withAuth(h.searchActivitiesHandler)(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid cursor")
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"stravach/app/storage/models"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// withAuth resolves the user from the auth_token cookie and puts it into the request context.
+// Requests without a valid token are rejected with 401.
+func (h *HttpHandler) withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("auth_token")
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "missing auth_token")
+			return
+		}
+		userIdPtr, err := h.JWT.GetChatIdFromToken(cookie.Value)
+		if err != nil || userIdPtr == nil {
+			writeJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		usr, err := h.DB.GetUserById(r.Context(), *userIdPtr)
+		if err != nil || usr == nil {
+			slog.Debug("user from token not found", "userId", *userIdPtr, "err", err)
+			writeJSONError(w, http.StatusUnauthorized, "user not found")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, usr)))
+	}
+}
+
+// withAdmin only lets authenticated admins through. It must be wrapped by withAuth.
+func (h *HttpHandler) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr, ok := userFromContext(r.Context())
+		if !ok || !usr.IsAdmin {
+			writeJSONError(w, http.StatusForbidden, "admin only")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// userFromContext returns the user injected by withAuth.
+func userFromContext(ctx context.Context) (*models.User, bool) {
+	usr, ok := ctx.Value(userContextKey).(*models.User)
+	return usr, ok && usr != nil
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(`{"error": "` + msg + `"}`))
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"stravach/app/storage/models"
+	"stravach/app/strava"
+	"stravach/app/tg"
+	"stravach/app/utils"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newCallbackHandler() (*HttpHandler, *mocks.Store, *mocks.StravaService, chan tg.Notification) {
+	mockDB := new(mocks.Store)
+	mockStrava := &mocks.StravaService{}
+	notifications := make(chan tg.Notification, 1)
+	h := &HttpHandler{
+		DB:                   mockDB,
+		Strava:               mockStrava,
+		JWT:                  &utils.JWT{Key: []byte("secret")},
+		NotificationsChannel: notifications,
+	}
+	return h, mockDB, mockStrava, notifications
+}
+
+// callbackRequest returns a callback request of the browser that started the flow of chat 456.
+func callbackRequest(t *testing.T, h *HttpHandler, query string) *http.Request {
+	state, err := h.JWT.GenerateOAuthState(456, "nonce", time.Hour)
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/api/auth-callback?state="+state+query, nil)
+	r.AddCookie(&http.Cookie{Name: oauthNonceCookie, Value: "nonce"})
+	return r
+}
+
+func TestAuthHandler_RedirectsWithState(t *testing.T) {
+	h, _, mockStrava, _ := newCallbackHandler()
+	h.Url = "https://stravabot.pro"
+	link, err := h.JWT.GenerateOAuthState(456, "", time.Hour)
+	require.NoError(t, err)
+	var state string
+	mockStrava.On("AuthorizationUrl", "https://stravabot.pro/api/auth-callback", stravaScopes, mock.Anything).
+		Run(func(args mock.Arguments) { state = args.String(2) }).
+		Return("https://strava.test/oauth/authorize")
+
+	rec := httptest.NewRecorder()
+	h.authHandler(rec, httptest.NewRequest(http.MethodGet, "/api/auth?state="+link, nil))
+
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "https://strava.test/oauth/authorize", rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, oauthNonceCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+	chatId, err := h.JWT.GetChatIdFromOAuthState(state, cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, int64(456), chatId)
+}
+
+func TestAuthCallbackHandler_InvalidState(t *testing.T) {
+	h, mockDB, mockStrava, _ := newCallbackHandler()
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/auth-callback?state=456&code=abc&scope=read,activity:write", nil)
+	r.AddCookie(&http.Cookie{Name: oauthNonceCookie, Value: "nonce"})
+	h.authCallbackHandler(rec, r)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockDB.AssertNotCalled(t, "GetUserByChatId", mock.Anything, mock.Anything)
+	mockStrava.AssertNotCalled(t, "Authorize", mock.Anything)
+}
+
+func TestAuthCallbackHandler_RequiresBrowserOfTheFlow(t *testing.T) {
+	h, _, _, _ := newCallbackHandler()
+	link, err := h.JWT.GenerateOAuthState(456, "", time.Hour)
+	require.NoError(t, err)
+	bound, err := h.JWT.GenerateOAuthState(456, "nonce", time.Hour)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		state  string
+		cookie string
+	}{
+		{name: "no cookie", state: bound},
+		{name: "other browser", state: bound, cookie: "other"},
+		{name: "link of the bot", state: link, cookie: "nonce"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(mocks.Store)
+			mockStrava := &mocks.StravaService{}
+			h.DB, h.Strava = mockDB, mockStrava
+			r := httptest.NewRequest(http.MethodGet, "/api/auth-callback?state="+tt.state+"&code=abc&scope=read,activity:write", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: oauthNonceCookie, Value: tt.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+			h.authCallbackHandler(rec, r)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			mockDB.AssertNotCalled(t, "GetUserByChatId", mock.Anything, mock.Anything)
+			mockStrava.AssertNotCalled(t, "Authorize", mock.Anything)
+		})
+	}
+}
+
+func TestAuthCallbackHandler_AccessDenied(t *testing.T) {
+	h, _, mockStrava, notifications := newCallbackHandler()
+	rec := httptest.NewRecorder()
+	h.authCallbackHandler(rec, callbackRequest(t, h, "&error=access_denied"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	n := <-notifications
+	assert.Equal(t, int64(456), n.ChatId)
+	assert.Equal(t, stravaAccessDeniedMessage, n.Text)
+	mockStrava.AssertNotCalled(t, "Authorize", mock.Anything)
+}
+
+func TestAuthCallbackHandler_MissingWriteScope(t *testing.T) {
+	h, _, mockStrava, notifications := newCallbackHandler()
+	rec := httptest.NewRecorder()
+	h.authCallbackHandler(rec, callbackRequest(t, h, "&code=abc&scope=read,activity:read_all"))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	n := <-notifications
+	assert.Equal(t, stravaMissingScopeMessage, n.Text)
+	mockStrava.AssertNotCalled(t, "Authorize", mock.Anything)
+}
+
+func TestAuthCallbackHandler_Success(t *testing.T) {
+	h, mockDB, mockStrava, _ := newCallbackHandler()
+	mockDB.On("GetUserByChatId", mock.Anything, int64(456)).Return(&models.User{ID: 1, TelegramChatId: 456}, nil)
+	mockStrava.On("Authorize", "abc").Return(&strava.AuthResp{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: 1700000000, Athlete: strava.AthleteInfo{Id: 42}}, nil)
+	mockDB.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.StravaAccessToken == "access" && *u.StravaId == 42 && *u.TokenExpiresAt == 1700000000
+	})).Return(nil)
+
+	rec := httptest.NewRecorder()
+	h.authCallbackHandler(rec, callbackRequest(t, h, "&code=abc&scope=read,activity:write,activity:read_all"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockDB.AssertExpectations(t)
+	mockStrava.AssertExpectations(t)
+}
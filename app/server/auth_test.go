@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"stravach/app/storage/models"
+	"stravach/app/tg"
+	"stravach/app/utils"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newAuthRequest(t *testing.T, h *HttpHandler, method, target string, userId int64) *http.Request {
+	token, err := h.JWT.GenerateJWTForUser(userId)
+	require.NoError(t, err)
+	req := httptest.NewRequest(method, target, nil)
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: token.Value})
+	return req
+}
+
+func TestWithAuth_MissingCookie(t *testing.T) {
+	h := &HttpHandler{DB: new(mocks.Store), JWT: &utils.JWT{Key: []byte("secret")}}
+	called := false
+	handler := h.withAuth(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/me", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.False(t, called)
+}
+
+func TestWithAuth_ForgedToken(t *testing.T) {
+	h := &HttpHandler{DB: new(mocks.Store), JWT: &utils.JWT{Key: []byte("secret")}}
+	forger := &HttpHandler{JWT: &utils.JWT{Key: []byte("not-the-secret")}}
+	handler := h.withAuth(func(w http.ResponseWriter, r *http.Request) { t.Fatal("handler should not be called") })
+
+	rec := httptest.NewRecorder()
+	handler(rec, newAuthRequest(t, forger, http.MethodGet, "/api/me", 1))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestWithAuth_InjectsUser(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1, TelegramChatId: 456}, nil)
+
+	var got *models.User
+	handler := h.withAuth(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = userFromContext(r.Context())
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, newAuthRequest(t, h, http.MethodGet, "/api/me", 1))
+
+	require.NotNil(t, got)
+	assert.Equal(t, int64(456), got.TelegramChatId)
+	mockDB.AssertExpectations(t)
+}
+
+func TestWithAuth_PassesRequestContextToStore(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	type ctxKey struct{}
+	mockDB.On("GetUserById", mock.MatchedBy(func(ctx context.Context) bool {
+		return ctx.Value(ctxKey{}) == "request"
+	}), int64(1)).Return(&models.User{ID: 1}, nil)
+
+	req := newAuthRequest(t, h, http.MethodGet, "/api/me", 1)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+	h.withAuth(func(w http.ResponseWriter, r *http.Request) {})(httptest.NewRecorder(), req)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWithAdmin_RejectsRegularUser(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+	handler := h.withAuth(h.withAdmin(func(w http.ResponseWriter, r *http.Request) { t.Fatal("handler should not be called") }))
+
+	rec := httptest.NewRecorder()
+	handler(rec, newAuthRequest(t, h, http.MethodPost, "/api/broadcast", 1))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestUpdateActivity_ForbiddenForOtherUsersActivity(t *testing.T) {
+	mockDB := new(mocks.Store)
+	renames, activitiesChannel := testRenames(t)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}, Renames: renames}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1, TelegramChatId: 456}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{ID: 99, UserID: 2}, nil)
+
+	req := newAuthRequest(t, h, http.MethodPost, "/api/activities/99/rename", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.updateActivity)(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, activitiesChannel)
+}
+
+func TestUpdateActivity_OwnActivity(t *testing.T) {
+	mockDB := new(mocks.Store)
+	renames, activitiesChannel := testRenames(t)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}, Renames: renames}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1, TelegramChatId: 456}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{ID: 99, UserID: 1}, nil)
+
+	req := newAuthRequest(t, h, http.MethodPost, "/api/activities/99/rename", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.updateActivity)(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	afu := <-activitiesChannel
+	assert.Equal(t, int64(456), afu.ChatId)
+}
+
+func TestUpdateActivity_RenameQueueFull(t *testing.T) {
+	mockDB := new(mocks.Store)
+	renames := tg.NewRenamePool(nil)
+	renames.MaxQueuedPerChat = 1
+	require.NoError(t, renames.Submit(tg.ActivityForUpdate{Activity: models.UserActivity{ID: 98}, ChatId: 456}))
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}, Renames: renames}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1, TelegramChatId: 456}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{ID: 99, UserID: 1}, nil)
+
+	req := newAuthRequest(t, h, http.MethodPost, "/api/activities/99/rename", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.updateActivity)(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+func TestRevertActivity_RestoresPreviousName(t *testing.T) {
+	mockDB := new(mocks.Store)
+	mockStrava := &mocks.StravaService{}
+	h := &HttpHandler{DB: mockDB, Strava: mockStrava, JWT: &utils.JWT{Key: []byte("secret")}}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1, StravaAccessToken: "access", TokenExpiresAt: &expiresAt}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{ID: 99, UserID: 1, Name: "Sunrise Tempo"}, nil)
+	mockDB.On("GetLastNameChange", mock.Anything, int64(1), int64(99)).Return(&models.NameChange{ID: 3, ActivityID: 99, UserID: 1, OldName: "Morning Run", NewName: "Sunrise Tempo"}, nil)
+	mockStrava.On("UpdateActivity", "access", mock.MatchedBy(func(a models.UserActivity) bool { return a.Name == "Morning Run" })).Return(&models.UserActivity{}, nil)
+	mockDB.On("UpdateUserActivity", mock.Anything, mock.MatchedBy(func(a *models.UserActivity) bool { return a.Name == "Morning Run" })).Return(nil)
+	mockDB.On("MarkNameChangeReverted", mock.Anything, int64(3), mock.Anything).Return(nil)
+	mockDB.On("AddNameChange", mock.Anything, mock.MatchedBy(func(c *models.NameChange) bool {
+		return c.OldName == "Sunrise Tempo" && c.NewName == "Morning Run" && c.Source == models.NameSourceRevert
+	})).Return(nil)
+
+	req := newAuthRequest(t, h, http.MethodPost, "/api/activities/99/revert", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.revertActivityHandler)(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Morning Run")
+	mockDB.AssertExpectations(t)
+	mockStrava.AssertExpectations(t)
+}
+
+func TestRevertActivity_NothingToRevert(t *testing.T) {
+	mockDB := new(mocks.Store)
+	mockStrava := &mocks.StravaService{}
+	h := &HttpHandler{DB: mockDB, Strava: mockStrava, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{ID: 99, UserID: 1, Name: "Morning Run"}, nil)
+	mockDB.On("GetLastNameChange", mock.Anything, int64(1), int64(99)).Return(nil, nil)
+
+	req := newAuthRequest(t, h, http.MethodPost, "/api/activities/99/revert", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.revertActivityHandler)(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockStrava.AssertNotCalled(t, "UpdateActivity", mock.Anything, mock.Anything)
+}
+
+func TestGetActivity_ReturnsDetails(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserById", mock.Anything, int64(1)).Return(&models.User{ID: 1}, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(99)).Return(&models.UserActivity{
+		ID: 99, UserID: 1, Name: "Morning Run", TotalElevationGain: 312.5, StartLatLng: []float64{46.55, 7.98},
+		Map: models.ActivityMap{SummaryPolyline: "u{~vFvyys@fS]"}, DeviceName: "Garmin Fenix 7",
+	}, nil)
+
+	req := newAuthRequest(t, h, http.MethodGet, "/api/activities/99", 1)
+	req.SetPathValue("id", "99")
+	rec := httptest.NewRecorder()
+	h.withAuth(h.getActivity)(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `"total_elevation_gain":312.5`)
+	assert.Contains(t, body, `"start_latlng":[46.55,7.98]`)
+	assert.Contains(t, body, `"summary_polyline":"u{~vFvyys@fS]"`)
+	assert.Contains(t, body, `"device_name":"Garmin Fenix 7"`)
+}
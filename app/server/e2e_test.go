@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"stravach/app/storage"
+	"stravach/app/storage/models"
+	"stravach/app/strava"
+	"stravach/app/strava/fakestrava"
+	"stravach/app/tg"
+	"stravach/app/utils"
+	"stravach/mocks"
+)
+
+type sentMessage struct {
+	ChatId      int64
+	Text        string
+	ReplyMarkup string
+}
+
+// fakeTelegram is a minimal Telegram Bot API: it serves queued updates to getUpdates
+// and records sendMessage calls.
+type fakeTelegram struct {
+	mu       sync.Mutex
+	updateId int64
+	updates  []map[string]any
+	sent     []sentMessage
+	// webhook is the form of the last setWebhook call.
+	webhook map[string]string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch path.Base(r.URL.Path) {
+	case "getUpdates":
+		f.mu.Lock()
+		updates := f.updates
+		f.updates = nil
+		f.mu.Unlock()
+		if len(updates) == 0 {
+			time.Sleep(20 * time.Millisecond)
+			updates = []map[string]any{}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": updates})
+	case "sendMessage":
+		_ = r.ParseMultipartForm(1 << 20)
+		chatId, _ := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		f.mu.Lock()
+		f.sent = append(f.sent, sentMessage{ChatId: chatId, Text: r.FormValue("text"), ReplyMarkup: r.FormValue("reply_markup")})
+		messageId := len(f.sent)
+		f.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": map[string]any{
+			"message_id": messageId, "date": time.Now().Unix(), "chat": map[string]any{"id": chatId, "type": "private"},
+		}})
+	case "setWebhook":
+		_ = r.ParseMultipartForm(1 << 20)
+		f.mu.Lock()
+		f.webhook = map[string]string{"url": r.FormValue("url"), "secret_token": r.FormValue("secret_token")}
+		f.mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	default:
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (f *fakeTelegram) pressButton(chatId int64, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updateId++
+	f.updates = append(f.updates, map[string]any{
+		"update_id": f.updateId,
+		"callback_query": map[string]any{
+			"id":            fmt.Sprintf("cb%d", f.updateId),
+			"from":          map[string]any{"id": chatId, "is_bot": false, "first_name": "Runner"},
+			"chat_instance": "1",
+			"data":          data,
+		},
+	})
+}
+
+// messages returns the texts sent to the chat.
+func (f *fakeTelegram) messages(chatId int64) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var texts []string
+	for _, m := range f.sent {
+		if m.ChatId == chatId {
+			texts = append(texts, m.Text)
+		}
+	}
+	return texts
+}
+
+// keyboard returns the last message sent to the chat with an inline keyboard.
+func (f *fakeTelegram) keyboard(chatId int64) (sentMessage, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.sent) - 1; i >= 0; i-- {
+		if f.sent[i].ChatId == chatId && f.sent[i].ReplyMarkup != "" {
+			return f.sent[i], true
+		}
+	}
+	return sentMessage{}, false
+}
+
+// TestEndToEnd_WebhookToRename drives OAuth, a Strava push event, name generation,
+// the Telegram button press and the rename on Strava without leaving the process.
+func TestEndToEnd_WebhookToRename(t *testing.T) {
+	const (
+		chatId    = int64(555)
+		athleteId = int64(101)
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := fakestrava.New("client", "secret")
+	fake.AddAthlete(fakestrava.Athlete{Id: athleteId, Username: "runner"})
+	stravaSrv := httptest.NewServer(fake)
+	defer stravaSrv.Close()
+	stravaClient := &strava.Client{ClientId: "client", ClientSecret: "secret", BaseUrl: stravaSrv.URL, HTTP: stravaSrv.Client()}
+
+	telegramApi := &fakeTelegram{}
+	telegramSrv := httptest.NewServer(telegramApi)
+	defer telegramSrv.Close()
+
+	db := &storage.SQLiteStore{Path: filepath.Join(t.TempDir(), "stravach.db")}
+	require.NoError(t, db.Connect())
+	defer db.DB.Close()
+	require.NoError(t, db.CreateUser(ctx, &models.User{TelegramChatId: chatId, Username: "runner", Language: "English"}))
+
+	ai := &mocks.AI{}
+	ai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return("Sunrise Tempo\nLakeside Loop\nCity Lights", nil)
+
+	telegram := &tg.Telegram{
+		APIKey:               "123:test",
+		DB:                   db,
+		Strava:               stravaClient,
+		AI:                   ai,
+		Renames:              tg.NewRenamePool(nil),
+		BroadcastChannel:     make(chan tg.BroadcastMessage),
+		NotificationsChannel: make(chan tg.Notification, 10),
+		Conversations:        db,
+		BotOptions:           []bot.Option{bot.WithServerURL(telegramSrv.URL), bot.WithSkipGetMe()},
+	}
+	go telegram.Start(ctx)
+
+	h := &HttpHandler{
+		StravaToken:          "verify",
+		Strava:               stravaClient,
+		DB:                   db,
+		JWT:                  &utils.JWT{Key: []byte("secret")},
+		Renames:              telegram.Renames,
+		NotificationsChannel: telegram.NotificationsChannel,
+	}
+	h.WebhookQueue = NewWebhookQueue(db, h.processWebhookEvent)
+	h.WebhookQueue.PollInterval = 50 * time.Millisecond
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+	h.Url = srv.URL
+	h.WebhookQueue.Start(ctx)
+
+	// OAuth: the bot link goes through /api/auth, the fake approves and redirects back.
+	state, err := h.JWT.GenerateOAuthState(chatId, "", time.Hour)
+	require.NoError(t, err)
+	browser := srv.Client()
+	browser.Jar, err = cookiejar.New(nil)
+	require.NoError(t, err)
+	resp, err := browser.Get(srv.URL + "/api/auth?state=" + state)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	usr, err := db.GetUserByChatId(ctx, chatId)
+	require.NoError(t, err)
+	require.NotNil(t, usr.StravaId)
+	require.Equal(t, athleteId, *usr.StravaId)
+
+	_, err = stravaClient.CreateSubscription(strava.WebhookCallbackUrl(srv.URL), "verify")
+	require.NoError(t, err)
+
+	activity := fake.AddActivity(athleteId, fakestrava.Activity{Name: "Morning Run", Type: "Run", Distance: 10000})
+	require.NoError(t, fake.PushEvent(fakestrava.Event{ObjectType: "activity", ObjectId: activity.Id, AspectType: "create", OwnerId: athleteId}))
+
+	var keyboard sentMessage
+	require.Eventually(t, func() bool {
+		var ok bool
+		keyboard, ok = telegramApi.keyboard(chatId)
+		return ok
+	}, 5*time.Second, 20*time.Millisecond)
+	button := fmt.Sprintf("activity:%d:2", activity.Id)
+	require.Contains(t, keyboard.ReplyMarkup, button)
+
+	telegramApi.pressButton(chatId, button)
+	require.Eventually(t, func() bool {
+		renamed, _ := fake.Activity(activity.Id)
+		return renamed.Name == "Lakeside Loop"
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Eventually(t, func() bool {
+		stored, err := db.GetActivityById(ctx, activity.Id)
+		return err == nil && stored.IsUpdated && stored.Name == "Lakeside Loop"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+// TestEndToEnd_TelegramWebhook registers the webhook and delivers an update through the
+// server route, the way Telegram does in webhook mode.
+func TestEndToEnd_TelegramWebhook(t *testing.T) {
+	const chatId = int64(555)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	telegramApi := &fakeTelegram{}
+	telegramSrv := httptest.NewServer(telegramApi)
+	defer telegramSrv.Close()
+
+	h := &HttpHandler{DB: storage.NewMemoryStore()}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	telegram := &tg.Telegram{
+		APIKey:        "123:test",
+		DB:            h.DB,
+		Conversations: h.DB,
+		Webhook:       &tg.WebhookConfig{URL: srv.URL + tg.WebhookPath, Secret: "webhook-secret"},
+		BotOptions:    []bot.Option{bot.WithServerURL(telegramSrv.URL), bot.WithSkipGetMe()},
+	}
+	require.NoError(t, telegram.Connect())
+	h.TelegramWebhook = telegram.WebhookHandler()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		telegram.Start(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		telegramApi.mu.Lock()
+		defer telegramApi.mu.Unlock()
+		return telegramApi.webhook != nil
+	}, 5*time.Second, 20*time.Millisecond)
+	telegramApi.mu.Lock()
+	require.Equal(t, map[string]string{"url": srv.URL + tg.WebhookPath, "secret_token": "webhook-secret"}, telegramApi.webhook)
+	telegramApi.mu.Unlock()
+
+	postUpdate := func(secret string) int {
+		update := fmt.Sprintf(`{"update_id":1,"message":{"message_id":1,"date":%d,"chat":{"id":%d,"type":"private"},"text":"hello"}}`, time.Now().Unix(), chatId)
+		req, err := http.NewRequest(http.MethodPost, srv.URL+tg.WebhookPath, strings.NewReader(update))
+		require.NoError(t, err)
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusUnauthorized, postUpdate("guessed"))
+	require.Equal(t, http.StatusOK, postUpdate("webhook-secret"))
+	require.Eventually(t, func() bool {
+		return len(telegramApi.messages(chatId)) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Contains(t, telegramApi.messages(chatId)[0], "no activity waiting for a name")
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bot did not stop")
+	}
+}
@@ -1,8 +1,14 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"html"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -15,22 +21,43 @@ import (
 	"stravach/app/utils"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type HttpHandler struct {
-	Url               string
-	Port              string
-	StravaToken       string
-	TgApiKey          string
-	StaticDir         string
-	Strava            strava.StravaService
-	DB                storage.Store
-	AI                *openai.OpenAI
-	ActivitiesChannel chan tg.ActivityForUpdate
-	BroadcastChannel  chan tg.BroadcastMessage
-	JWT               *utils.JWT
+	Url                  string
+	Port                 string
+	StravaToken          string
+	TgApiKey             string
+	DevLogin             bool
+	StaticDir            string
+	Strava               strava.StravaService
+	DB                   storage.Store
+	AI                   *openai.OpenAI
+	BroadcastChannel     chan tg.BroadcastMessage
+	NotificationsChannel chan tg.Notification
+	WebhookQueue         *WebhookQueue
+	JWT                  *utils.JWT
+	// TelegramWebhook receives the bot updates in webhook mode, nil when the bot polls.
+	TelegramWebhook http.HandlerFunc
+	// Renames takes the activities the bot offers names for.
+	Renames *tg.RenamePool
 }
 
+const (
+	stravaScopes              = "read_all,activity:write,activity:read_all"
+	stravaDeauthorizedMessage = "Strava access was revoked, activities won't be renamed anymore. Send /start to connect your Strava account again."
+	stravaAccessDeniedMessage = "Strava authorization was cancelled. Send /start to try again."
+	stravaMissingScopeMessage = "Strava is connected without permission to edit activities, so I can't rename them. Send /start and allow access to your activities."
+)
+
+const (
+	// oauthNonceCookie holds the nonce that binds a Strava OAuth flow to the browser that started it.
+	oauthNonceCookie = "strava_oauth_nonce"
+	// oauthFlowTTL is how long the user has to authorize the bot on Strava.
+	oauthFlowTTL = 10 * time.Minute
+)
+
 type UpdateActivityRequest struct {
 	ID         int    `json:"id"`
 	UpdateType string `json:"updateType"`
@@ -43,25 +70,41 @@ type TgUser struct {
 	Username  string `json:"username"`
 }
 
+// TgPayload is sent by the client after a Telegram login. User holds the Login Widget
+// data as is, InitData the raw initData string when the client runs as a Telegram Mini App.
 type TgPayload struct {
-	User TgUser `json:"user"`
+	User     map[string]any `json:"user"`
+	InitData string         `json:"init_data"`
 }
 
-func (h *HttpHandler) Init() {
+// shutdownTimeout is how long Start waits for running requests when stopping.
+const shutdownTimeout = 15 * time.Second
+
+// sendTimeout is how long a request waits for the bot to take a broadcast or notification.
+const sendTimeout = 5 * time.Second
+
+// errBotBusy is returned by sendToBot when the bot doesn't take the message within sendTimeout.
+var errBotBusy = errors.New("telegram bot is busy")
+
+// tgAuthMaxAge is how long Telegram login data is accepted after auth_date.
+const tgAuthMaxAge = 24 * time.Hour
+
+// Init configures the handler from the environment. db is shared with the bot.
+func (h *HttpHandler) Init(db storage.Store) {
 	h.StravaToken = os.Getenv("STRAVA_CHALLENGE_TOKEN")
 	h.Port = os.Getenv("PORT")
 	h.Url = os.Getenv("URL")
 	h.TgApiKey = os.Getenv("TELEGRAM_API_KEY")
+	h.DevLogin = os.Getenv("DEV_LOGIN") == "true"
+	if h.DevLogin {
+		slog.Warn("DEV_LOGIN is enabled, anyone can log in as user 1")
+	}
 	h.Strava = strava.NewStravaClient()
-	h.DB = &storage.SQLiteStore{}
+	h.DB = db
 	h.AI = openai.NewClient()
 	h.JWT = &utils.JWT{Key: []byte(os.Getenv("JWT_KEY"))}
 	h.StaticDir = "./client/dist"
-	err := h.DB.Connect()
-	if err != nil {
-		slog.Error("error while connecting to DB")
-		panic(err)
-	}
+	h.WebhookQueue = NewWebhookQueue(h.DB, h.processWebhookEvent)
 }
 
 // activitiesPageHandler is deprecated. All frontend routing is now handled by React SPA.
@@ -72,48 +115,15 @@ func (h *HttpHandler) getTelegramClient() (*tg.Telegram, bool) {
 	if h.TgApiKey == "" {
 		return nil, false
 	}
-	tgClient, err := tg.NewTelegramClient(h.TgApiKey)
-	if err != nil {
-		return nil, false
-	}
-	return tgClient, true
+	return tg.NewTelegramClient(h.TgApiKey, h.DB, h.DB), true
 }
 
 // broadcastHandler allows an admin to send a message to all users via Telegram
 func (h *HttpHandler) broadcastHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		w.Write([]byte(`{"error": "POST required"}`))
-		return
-	}
-	cookie, err := r.Cookie("auth_token")
-	if err != nil {
-		slog.Debug(fmt.Sprintf("error while getting cookie: %s, request is: %+v", err, r))
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error": "missing auth_token"}`))
-		return
-	}
-	userIdPtr, err := h.JWT.GetChatIdFromToken(cookie.Value)
-	if err != nil || userIdPtr == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error": "invalid token"}`))
-		return
-	}
-	usr, err := h.DB.GetUserById(*userIdPtr)
-	if err != nil || usr == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error": "user not found"}`))
-		return
-	}
-	if !usr.IsAdmin {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte(`{"error": "admin only"}`))
-		return
-	}
 	var req struct {
 		Message string `json:"message"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil || req.Message == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(`{"error": "invalid message"}`))
@@ -125,70 +135,35 @@ func (h *HttpHandler) broadcastHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"error": "broadcast channel unavailable"}`))
 		return
 	}
-	h.BroadcastChannel <- tg.BroadcastMessage{Text: req.Message}
+	if err = sendToBot(r.Context(), h.BroadcastChannel, tg.BroadcastMessage{Text: req.Message}); err != nil {
+		slog.Error("failed to queue broadcast", "err", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": "bot is busy, try again later"}`))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"sent": "queued"}`))
 }
 
 // userInfoHandler returns the current user's info as JSON, including is_admin
 func (h *HttpHandler) userInfoHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("auth_token")
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error": "missing auth_token"}`))
-		return
-	}
-	userIdPtr, err := h.JWT.GetChatIdFromToken(cookie.Value)
-	if err != nil || userIdPtr == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error": "invalid token"}`))
-		return
-	}
-	usr, err := h.DB.GetUserById(*userIdPtr)
-	if err != nil || usr == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"error": "user not found"}`))
-		return
-	}
+	usr, _ := userFromContext(r.Context())
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(usr)
 }
 
 // refreshLast10ActivitiesHandler refreshes the last 10 activities from Strava for a user and saves them to the DB.
 func (h *HttpHandler) refreshLast10ActivitiesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		_, _ = w.Write([]byte("Method not allowed"))
-		return
-	}
-	usrChatIdStr := strings.TrimPrefix(r.URL.Path, "/api/activities-refresh-last-10/")
-	usrChatId, err := strconv.ParseInt(usrChatIdStr, 10, 64)
-	if err != nil {
-		slog.Error("invalid user id", "error", err)
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write([]byte("Invalid user id"))
-		return
-	}
-	usr, err := h.DB.GetUserByChatId(usrChatId)
-	if err != nil || usr == nil {
-		slog.Error("failed to get user", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("Failed to get user"))
-		return
-	}
-	// Refresh token if needed
-	err = RefreshStravaTokenIfNeeded(h.Strava, h.DB, usr)
-	if err != nil {
-		slog.Error("failed to refresh Strava token", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("Failed to refresh Strava token"))
-		return
-	}
-	activities, err := h.Strava.GetLatestActivities(usr.StravaAccessToken, 10)
+	usr, _ := userFromContext(r.Context())
+	var activities []models.UserActivity
+	err := strava.WithToken(r.Context(), h.Strava, h.DB, usr, func(accessToken string) error {
+		var err error
+		activities, err = h.Strava.GetLatestActivities(r.Context(), accessToken, 10)
+		return err
+	})
 	if err != nil {
-		slog.Error("failed to fetch activities from Strava", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("Failed to fetch activities from Strava"))
+		slog.Error("failed to fetch activities from Strava", "error", err, "kind", strava.ErrorKind(err))
+		writeStravaError(w, err, "failed to fetch activities from strava")
 		return
 	}
 	if len(activities) == 0 {
@@ -202,7 +177,7 @@ func (h *HttpHandler) refreshLast10ActivitiesHandler(w http.ResponseWriter, r *h
 		activities[i].UserID = usr.ID
 		activityPtrs = append(activityPtrs, &activities[i])
 	}
-	err = h.DB.CreateUserActivities(activityPtrs)
+	err = h.DB.CreateUserActivities(r.Context(), activityPtrs)
 	if err != nil {
 		slog.Error("failed to save activities to DB", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -213,70 +188,136 @@ func (h *HttpHandler) refreshLast10ActivitiesHandler(w http.ResponseWriter, r *h
 	_, _ = w.Write([]byte("Last 10 activities refreshed successfully"))
 }
 
+// authHandler starts the Strava OAuth flow. The state query parameter is issued by the bot
+// for the chat that requested the link. It is exchanged for a state bound to this browser by a
+// nonce cookie, which Strava passes back to authCallbackHandler.
 func (h *HttpHandler) authHandler(w http.ResponseWriter, r *http.Request) {
-	chatId := strings.Split(r.URL.Path, "/")[3] // /api/auth/:chatId
-	redirectUrl := fmt.Sprintf("https://www.strava.com/oauth/authorize?client_id=37166&response_type=code&"+
-		"redirect_uri=%s/api/auth-callback/%s&approval_prompt=force&scope=read_all,activity:write,activity:read_all", h.Url, chatId)
-	http.Redirect(w, r, redirectUrl, http.StatusTemporaryRedirect)
+	chatId, err := h.JWT.GetChatIdFromOAuthState(r.URL.Query().Get("state"), "")
+	if err != nil {
+		slog.Warn("invalid oauth state in auth request", "err", err)
+		writeAuthPage(w, http.StatusBadRequest, "Link expired", "This link is invalid or expired. Send /start to the bot to get a new one.")
+		return
+	}
+	nonce, err := utils.NewOAuthNonce()
+	if err != nil {
+		slog.Error("error while generating oauth nonce", "err", err)
+		writeAuthPage(w, http.StatusInternalServerError, "Authorization failed", "Error occured during authorization")
+		return
+	}
+	state, err := h.JWT.GenerateOAuthState(chatId, nonce, oauthFlowTTL)
+	if err != nil {
+		slog.Error("error while generating oauth state", "err", err)
+		writeAuthPage(w, http.StatusInternalServerError, "Authorization failed", "Error occured during authorization")
+		return
+	}
+	h.setOAuthNonceCookie(w, nonce, int(oauthFlowTTL.Seconds()))
+	http.Redirect(w, r, h.Strava.AuthorizationUrl(h.Url+"/api/auth-callback", stravaScopes, state), http.StatusTemporaryRedirect)
+}
+
+// setOAuthNonceCookie sets the nonce cookie for maxAge seconds, or deletes it when maxAge is negative.
+func (h *HttpHandler) setOAuthNonceCookie(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthNonceCookie,
+		Value:    nonce,
+		Path:     "/api/auth-callback",
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(h.Url, "https://"),
+		HttpOnly: true,
+		// sent on the top-level redirect back from Strava
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
 func (h *HttpHandler) authCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	// Expect path: /api/auth-callback/:chatId
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 4 {
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = fmt.Fprintf(w, "Invalid callback URL")
+	query := r.URL.Query()
+	cookie, err := r.Cookie(oauthNonceCookie)
+	if err != nil || cookie.Value == "" {
+		slog.Warn("oauth callback without nonce cookie")
+		writeAuthPage(w, http.StatusBadRequest, "Link expired", "Please open the link from the bot again in this browser. Send /start to the bot to get a new one.")
 		return
 	}
-	chatId, err := strconv.ParseInt(parts[3], 10, 64)
+	chatId, err := h.JWT.GetChatIdFromOAuthState(query.Get("state"), cookie.Value)
 	if err != nil {
-		slog.Error("error while parsing chatId from URL: " + r.URL.Path)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = fmt.Fprintf(w, "Error occured during callback")
+		slog.Warn("invalid oauth state in auth callback", "err", err)
+		writeAuthPage(w, http.StatusBadRequest, "Link expired", "This link is invalid or expired. Send /start to the bot to get a new one.")
+		return
+	}
+	h.setOAuthNonceCookie(w, "", -1)
+
+	if query.Get("error") != "" {
+		slog.Info("user denied strava access", "chatId", chatId, "error", query.Get("error"))
+		h.notify(r.Context(), chatId, stravaAccessDeniedMessage)
+		writeAuthPage(w, http.StatusOK, "Authorization cancelled", "Strava access was not granted. Send /start to the bot to try again.")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		writeAuthPage(w, http.StatusBadRequest, "Authorization failed", "Strava did not return an authorization code. Send /start to the bot to try again.")
 		return
 	}
-	stravaAccessCode := utils.GetCodeFromUrl(r.URL.RawQuery)
-	slog.Info(fmt.Sprintf("Updating info for user: %d", chatId))
 
-	usr, err := h.DB.GetUserByChatId(chatId)
+	if !hasScope(query.Get("scope"), "activity:write") {
+		slog.Info("user didn't grant activity:write scope", "chatId", chatId, "scope", query.Get("scope"))
+		h.notify(r.Context(), chatId, stravaMissingScopeMessage)
+		writeAuthPage(w, http.StatusForbidden, "Missing permission", "Please allow the bot to edit your activities, it can't rename them otherwise. Send /start to the bot to try again.")
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Updating info for user: %d", chatId))
+	usr, err := h.DB.GetUserByChatId(r.Context(), chatId)
 	if err != nil {
 		slog.Error("error while getting user from chatId", "err", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = fmt.Fprintf(w, "Error occured during callback")
+		writeAuthPage(w, http.StatusInternalServerError, "Authorization failed", "Error occured during callback")
 		return
 	}
-	usr.StravaAccessCode = stravaAccessCode
+	usr.StravaAccessCode = code
 	authData, err := h.Strava.Authorize(usr.StravaAccessCode)
 	if err != nil {
 		slog.Error("error while authorizing new user", "err", err.Error())
+		writeAuthPage(w, http.StatusBadGateway, "Authorization failed", "Strava authorization failed, please try again later.")
 		return
 	}
 
 	usr.StravaAccessToken = authData.AccessToken
 	usr.StravaRefreshToken = authData.RefreshToken
+	usr.TokenExpiresAt = &authData.ExpiresAt
 	usr.StravaId = &authData.Athlete.Id
 	slog.Debug("updating user in auth callback")
-	err = h.DB.UpdateUser(usr)
+	err = h.DB.UpdateUser(r.Context(), usr)
 	if err != nil {
 		slog.Error(fmt.Sprintf("error while updating user from chatId %s", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeAuthPage(w, http.StatusInternalServerError, "Authorization failed", "Error occured during callback")
 		return
 	}
 
-	resp := `<!DOCTYPE html>
+	writeAuthPage(w, http.StatusOK, "Authentication successful!", "You may now close this window.")
+}
+
+// hasScope reports whether the comma separated scope list returned by Strava contains scope.
+func hasScope(scopes string, scope string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		if strings.TrimSpace(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAuthPage(w http.ResponseWriter, status int, title string, message string) {
+	resp := fmt.Sprintf(`<!DOCTYPE html>
 		<html lang="en">
-		<head><meta charset="UTF-8"><title>Auth Success</title></head>
+		<head><meta charset="UTF-8"><title>%[1]s</title></head>
 		<body>
-		<h2>Authentication successful!</h2>
-		<p>You may now close this window.</p>
+		<h2>%[1]s</h2>
+		<p>%[2]s</p>
 		</body>
-		</html>`
+		</html>`, html.EscapeString(title), html.EscapeString(message))
 	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte(resp))
+	w.WriteHeader(status)
+	_, err := w.Write([]byte(resp))
 	if err != nil {
 		slog.Error("error while writing to response", "err", err)
-		return
 	}
 }
 
@@ -289,23 +330,10 @@ func (h *HttpHandler) tgAuthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Localhost/dev shortcut: if request is from localhost, log in user ID 1
-	isLocal := func() bool {
-		host := r.Host
-		remote := r.RemoteAddr
-		origin := r.Header.Get("Origin")
-		referer := r.Header.Get("Referer")
-		for _, v := range []string{host, remote, origin, referer} {
-			if strings.Contains(v, "localhost") || strings.Contains(v, "127.0.0.1") {
-				return true
-			}
-		}
-		return false
-	}()
-
-	if isLocal {
+	// Dev shortcut: log in user ID 1 without Telegram, only when explicitly enabled
+	if h.DevLogin {
 		slog.Info("Local dev login")
-		usr, err := h.DB.GetUserById(1)
+		usr, err := h.DB.GetUserById(r.Context(), 1)
 		if err != nil || usr == nil {
 			slog.Error("Local dev login failed: user 1 not found", "err", err)
 			http.Error(w, "Local dev login failed: user 1 not found", http.StatusInternalServerError)
@@ -331,15 +359,24 @@ func (h *HttpHandler) tgAuthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var payload TgPayload
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	err := decoder.Decode(&payload)
 	if err != nil {
 		slog.Error("error decoding request body", "error", err)
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
 
-	slog.Debug("got payload", "%+v", payload.User.Id)
-	usr, err := h.DB.GetUserByChatId(payload.User.Id)
+	chatId, err := h.verifyTgPayload(payload)
+	if err != nil {
+		slog.Warn("telegram auth verification failed", "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	slog.Debug("got verified tg auth", "chatId", chatId)
+	usr, err := h.DB.GetUserByChatId(r.Context(), chatId)
 	if err != nil {
 		slog.Error("error fetching user from database", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -372,24 +409,44 @@ func (h *HttpHandler) tgAuthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *HttpHandler) getActivities(w http.ResponseWriter, r *http.Request) {
-	slog.Debug("got getActivities request")
-	usrChatIdStr := strings.TrimPrefix(r.URL.Path, "/api/activities/")
-	usrChatId, err := strconv.ParseInt(usrChatIdStr, 10, 64)
-	if err != nil {
-		slog.Error(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// verifyTgPayload checks the signature of Telegram login data and returns the chat id of the user.
+func (h *HttpHandler) verifyTgPayload(payload TgPayload) (int64, error) {
+	if payload.InitData != "" {
+		data, err := utils.VerifyTelegramWebAppInitData(payload.InitData, h.TgApiKey, tgAuthMaxAge, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		var user TgUser
+		err = json.Unmarshal([]byte(data["user"]), &user)
+		if err != nil {
+			return 0, fmt.Errorf("invalid user in init data: %w", err)
+		}
+		return user.Id, nil
+	}
+
+	data := make(map[string]string, len(payload.User))
+	for k, v := range payload.User {
+		switch v := v.(type) {
+		case json.Number:
+			data[k] = v.String()
+		case string:
+			data[k] = v
+		case bool:
+			data[k] = strconv.FormatBool(v)
+		}
 	}
-
-	usr, err := h.DB.GetUserByChatId(usrChatId)
+	err := utils.VerifyTelegramLogin(data, h.TgApiKey, tgAuthMaxAge, time.Now())
 	if err != nil {
-		slog.Error(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return 0, err
 	}
+	return strconv.ParseInt(data["id"], 10, 64)
+}
+
+func (h *HttpHandler) getActivities(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("got getActivities request")
+	usr, _ := userFromContext(r.Context())
 
-	userActivities, err := h.DB.GetUserActivities(usr.ID, 30)
+	userActivities, err := h.DB.GetUserActivities(r.Context(), usr.ID, 30)
 	if err != nil {
 		slog.Error(err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
@@ -405,27 +462,24 @@ func (h *HttpHandler) getActivities(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *HttpHandler) updateActivity(w http.ResponseWriter, r *http.Request) {
-	slog.Debug("got updateActivity request")
-	activityIdStr := strings.TrimPrefix(r.URL.Path, "/api/activity/")
-	activityId, err := strconv.ParseInt(activityIdStr, 10, 64)
-	if err != nil {
-		slog.Error("invalid activity id", "error", err)
-		http.Error(w, "Invalid Activity ID", http.StatusBadRequest)
+// getActivity returns one activity of the user with all its details.
+func (h *HttpHandler) getActivity(w http.ResponseWriter, r *http.Request) {
+	usr, _ := userFromContext(r.Context())
+	activity, ok := h.ownedActivity(w, r, usr)
+	if !ok {
 		return
 	}
-
-	activity, err := h.DB.GetActivityById(activityId)
-	if err != nil {
-		slog.Error("failed to fetch activity", "error", err)
-		http.Error(w, "Failed to fetch activity", http.StatusInternalServerError)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(activity); err != nil {
+		slog.Error("error while writing to response", "err", err)
 	}
+}
 
-	usr, err := h.DB.GetUserById(activity.UserID)
-	if err != nil || usr == nil {
-		slog.Error("error while getting user from DB", "err", err)
-		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+func (h *HttpHandler) updateActivity(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("got updateActivity request")
+	usr, _ := userFromContext(r.Context())
+	activity, ok := h.ownedActivity(w, r, usr)
+	if !ok {
 		return
 	}
 
@@ -434,17 +488,113 @@ func (h *HttpHandler) updateActivity(w http.ResponseWriter, r *http.Request) {
 		ChatId:   usr.TelegramChatId,
 	}
 
-	h.ActivitiesChannel <- afu
-	slog.Info("activity sent to channel", "activityId", activity.ID)
+	if err := h.Renames.Submit(afu); err != nil {
+		w.Header().Set("Retry-After", "60")
+		writeJSONError(w, http.StatusServiceUnavailable, "too many names are being generated, try again later")
+		return
+	}
+	slog.Info("activity queued for renaming", "activityId", activity.ID)
 
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write([]byte("Activity sent to the channel successfully"))
+	_, err := w.Write([]byte("Activity sent to the channel successfully"))
 	if err != nil {
 		slog.Error("error while writing to response", "err", err)
 		return
 	}
 }
 
+// revertActivityHandler renames the activity back to the name its latest rename replaced,
+// on Strava and locally, and responds with the activity.
+func (h *HttpHandler) revertActivityHandler(w http.ResponseWriter, r *http.Request) {
+	usr, _ := userFromContext(r.Context())
+	activity, ok := h.ownedActivity(w, r, usr)
+	if !ok {
+		return
+	}
+	change, err := h.DB.GetLastNameChange(r.Context(), usr.ID, activity.ID)
+	if err != nil {
+		slog.Error("failed to fetch last name change", "error", err, "activityId", activity.ID)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch name history")
+		return
+	}
+	if change == nil {
+		writeJSONError(w, http.StatusNotFound, "no rename to revert")
+		return
+	}
+
+	currentName := activity.Name
+	activity.Name = change.OldName
+	err = strava.WithToken(r.Context(), h.Strava, h.DB, usr, func(accessToken string) error {
+		_, err := h.Strava.UpdateActivity(accessToken, *activity)
+		return err
+	})
+	if err != nil {
+		slog.Error("failed to revert activity name on strava", "error", err, "kind", strava.ErrorKind(err), "activityId", activity.ID)
+		writeStravaError(w, err, "failed to rename activity on strava")
+		return
+	}
+	err = h.DB.UpdateUserActivity(r.Context(), activity)
+	if err != nil {
+		slog.Error("failed to save reverted activity", "error", err, "activityId", activity.ID)
+		writeJSONError(w, http.StatusInternalServerError, "activity renamed on strava, but saving it failed")
+		return
+	}
+
+	now := time.Now().Unix()
+	// a change that isn't marked reverted would be reverted again, so the revert isn't recorded either
+	if err = h.DB.MarkNameChangeReverted(r.Context(), change.ID, now); err != nil {
+		slog.Error("failed to mark name change reverted", "error", err, "id", change.ID)
+		writeJSONError(w, http.StatusInternalServerError, "activity renamed on strava, but saving the name history failed")
+		return
+	}
+	err = h.DB.AddNameChange(r.Context(), &models.NameChange{
+		ActivityID: activity.ID,
+		UserID:     usr.ID,
+		OldName:    currentName,
+		NewName:    activity.Name,
+		Source:     models.NameSourceRevert,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		slog.Error("failed to record revert", "error", err, "activityId", activity.ID)
+	}
+	slog.Info("activity name reverted", "activityId", activity.ID, "name", activity.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(activity); err != nil {
+		slog.Error("error while writing to response", "err", err)
+	}
+}
+
+// ownedActivity loads the activity from the {id} path value and makes sure it belongs to usr.
+// It writes the error response itself and returns false if the request can't proceed.
+func (h *HttpHandler) ownedActivity(w http.ResponseWriter, r *http.Request, usr *models.User) (*models.UserActivity, bool) {
+	activityId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		slog.Error("invalid activity id", "error", err)
+		http.Error(w, "Invalid Activity ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	activity, err := h.DB.GetActivityById(r.Context(), activityId)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("failed to fetch activity", "error", err)
+		http.Error(w, "Failed to fetch activity", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if activity.UserID != usr.ID {
+		slog.Warn("user tried to access someone else's activity", "userId", usr.ID, "activityId", activity.ID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return activity, true
+}
+
 func (h *HttpHandler) webhookVerify(w http.ResponseWriter, r *http.Request) {
 	vals := r.URL.Query()
 	mode := vals.Get("hub.mode")
@@ -473,27 +623,150 @@ func (h *HttpHandler) webhookVerify(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *HttpHandler) webhookActivity(w http.ResponseWriter, r *http.Request) {
-	type webhookBody struct {
-		ObjectId int64 `json:"object_id"`
-		OwnerId  int64 `json:"owner_id"`
-	}
-	var wBody webhookBody
-	err := json.NewDecoder(r.Body).Decode(&wBody)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		slog.Error("error while reading request body", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	slog.Info("got webhookBody" + fmt.Sprintf("%+v", wBody))
-	usr, err := h.DB.GetUserByStravaId(wBody.OwnerId)
+	var event strava.WebhookEvent
+	err = json.Unmarshal(body, &event)
 	if err != nil {
-		slog.Error(err.Error())
+		slog.Error("error while decoding webhook event", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	slog.Info("got webhook event", "object_type", event.ObjectType, "aspect_type", event.AspectType, "object_id", event.ObjectId, "owner_id", event.OwnerId)
+	err = h.WebhookQueue.Enqueue(r.Context(), event, body)
+	if err != nil {
+		slog.Error("error while enqueueing webhook event", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	err = h.processActivity(wBody.ObjectId, usr)
+	w.WriteHeader(http.StatusOK)
+}
+
+// processWebhookEvent is called by the webhook queue for every stored event.
+func (h *HttpHandler) processWebhookEvent(ctx context.Context, event strava.WebhookEvent) error {
+	usr, err := h.DB.GetUserByStravaId(ctx, event.OwnerId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: no user of athlete %d", errUnprocessable, event.OwnerId)
+	}
 	if err != nil {
-		slog.Error("error while processing activity", "err", err)
+		return err
+	}
+	return h.handleWebhookEvent(ctx, event, usr)
+}
+
+// handleWebhookEvent dispatches a Strava push event to the handler for its object and aspect type.
+func (h *HttpHandler) handleWebhookEvent(ctx context.Context, event strava.WebhookEvent, usr *models.User) error {
+	switch event.ObjectType {
+	case strava.ObjectTypeAthlete:
+		if event.IsDeauthorization() {
+			return h.deauthorizeUser(ctx, usr)
+		}
+		slog.Debug("ignoring athlete update", "owner_id", event.OwnerId, "updates", event.Updates)
+		return nil
+	case strava.ObjectTypeActivity:
+		switch event.AspectType {
+		case strava.AspectTypeCreate:
+			return h.processActivity(ctx, event.ObjectId, usr)
+		case strava.AspectTypeUpdate:
+			return h.syncActivityUpdate(ctx, event, usr)
+		case strava.AspectTypeDelete:
+			return h.deleteActivity(ctx, event.ObjectId, usr)
+		}
+	}
+	return fmt.Errorf("%w: unsupported webhook event %s/%s", errUnprocessable, event.ObjectType, event.AspectType)
+}
+
+// deleteActivity deletes the stored activity deleted on Strava, if it is one of usr's.
+func (h *HttpHandler) deleteActivity(ctx context.Context, activityId int64, usr *models.User) error {
+	activity, err := h.DB.GetActivityById(ctx, activityId)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("got delete for unknown activity", "activityId", activityId)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if activity.UserID != usr.ID {
+		slog.Warn("got delete for someone else's activity", "userId", usr.ID, "activityId", activityId)
+		return nil
+	}
+	slog.Info("deleting activity", "activityId", activityId, "userId", usr.ID)
+	return h.DB.DeleteUserActivity(ctx, activityId)
+}
+
+// syncActivityUpdate applies title and type changes made outside the bot to the stored activity.
+func (h *HttpHandler) syncActivityUpdate(ctx context.Context, event strava.WebhookEvent, usr *models.User) error {
+	exists, err := h.DB.IsActivityExists(ctx, event.ObjectId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		slog.Info("got update for unknown activity, processing it as new", "activityId", event.ObjectId)
+		return h.processActivity(ctx, event.ObjectId, usr)
+	}
+
+	activity, err := h.DB.GetActivityById(ctx, event.ObjectId)
+	if err != nil {
+		return err
+	}
+	changed := false
+	if title, ok := event.Updates["title"]; ok && title != activity.Name {
+		activity.Name = title
+		changed = true
+	}
+	if activityType, ok := event.Updates["type"]; ok && activityType != activity.ActivityType {
+		activity.ActivityType = activityType
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	slog.Info("syncing activity update from strava", "activityId", activity.ID, "updates", event.Updates)
+	return h.DB.UpdateUserActivity(ctx, activity)
+}
+
+// deauthorizeUser wipes Strava credentials of an athlete who revoked access and lets them know in Telegram.
+func (h *HttpHandler) deauthorizeUser(ctx context.Context, usr *models.User) error {
+	slog.Info("athlete deauthorized the app", "userId", usr.ID)
+	usr.StravaAccessToken = ""
+	usr.StravaRefreshToken = ""
+	usr.StravaAccessCode = ""
+	usr.TokenExpiresAt = nil
+	err := h.DB.UpdateUser(ctx, usr)
+	if err != nil {
+		return err
+	}
+	h.notify(ctx, usr.TelegramChatId, stravaDeauthorizedMessage)
+	return nil
+}
+
+// notify sends a text message to a single Telegram chat, dropping it when the bot is busy.
+func (h *HttpHandler) notify(ctx context.Context, chatId int64, text string) {
+	if h.NotificationsChannel == nil {
+		slog.Warn("notifications channel unavailable, dropping message", "chatId", chatId)
+		return
+	}
+	if err := sendToBot(ctx, h.NotificationsChannel, tg.Notification{ChatId: chatId, Text: text}); err != nil {
+		slog.Warn("failed to queue notification, dropping message", "chatId", chatId, "err", err)
+	}
+}
+
+// sendToBot sends msg to the bot unless ctx is done first or the bot doesn't take it within
+// sendTimeout.
+func sendToBot[T any](ctx context.Context, ch chan<- T, msg T) error {
+	timer := time.NewTimer(sendTimeout)
+	defer timer.Stop()
+	select {
+	case ch <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return errBotBusy
 	}
 }
 
@@ -508,9 +781,9 @@ func (h *HttpHandler) webhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *HttpHandler) processActivity(activityId int64, user *models.User) error {
+func (h *HttpHandler) processActivity(ctx context.Context, activityId int64, user *models.User) error {
 	var activity *models.UserActivity
-	exists, err := h.DB.IsActivityExists(activityId)
+	exists, err := h.DB.IsActivityExists(ctx, activityId)
 
 	if err != nil {
 		return err
@@ -518,29 +791,24 @@ func (h *HttpHandler) processActivity(activityId int64, user *models.User) error
 
 	if exists {
 		slog.Info("activity exists already, probably just got updated")
-		activity, err = h.DB.GetActivityById(activityId)
+		activity, err = h.DB.GetActivityById(ctx, activityId)
 		if err != nil {
 			return err
 		}
 	} else {
-		if user.AuthRequired() {
-			authData, err := h.Strava.RefreshAccessToken(user.StravaRefreshToken)
-			if err != nil {
-				return err
-			}
-			user.StravaAccessToken = authData.AccessToken
-		}
-
-		activity, err = h.Strava.GetActivity(user.StravaAccessToken, activityId)
+		err = strava.WithToken(ctx, h.Strava, h.DB, user, func(accessToken string) error {
+			activity, err = h.Strava.GetActivity(accessToken, activityId)
+			return err
+		})
 		if err != nil {
 			return err
 		}
-		err = h.DB.CreateUserActivity(activity, user.ID)
+		err = h.DB.CreateUserActivity(ctx, activity, user.ID)
 		if err != nil {
 			return err
 		}
 		slog.Debug("updating user in webhook")
-		err = h.DB.UpdateUser(user)
+		err = h.DB.UpdateUser(ctx, user)
 		if err != nil {
 			slog.Error("error while updating user", "err", err)
 			return err
@@ -550,33 +818,84 @@ func (h *HttpHandler) processActivity(activityId int64, user *models.User) error
 	slog.Debug(fmt.Sprintf("%+v", activity))
 
 	if activity != nil && !activity.IsUpdated {
+		settings, err := h.DB.GetUserSettings(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !settings.Renames(activity) {
+			slog.Info("activity left as is by user settings", "activityId", activity.ID, "type", activity.ActivityType, "distance", activity.Distance)
+			return nil
+		}
+		if until, quiet := settings.QuietUntil(time.Now()); quiet {
+			return &deferredError{Until: until, Reason: "quiet hours of the user"}
+		}
 		afu := tg.ActivityForUpdate{
 			Activity: *activity,
 			ChatId:   user.TelegramChatId,
 		}
 
-		h.ActivitiesChannel <- afu
+		// a full queue fails the event, the webhook queue retries it later
+		return h.Renames.Submit(afu)
 	}
 
 	return nil
 }
 
-func (h *HttpHandler) Start() {
-	http.HandleFunc("/api/broadcast", h.broadcastHandler)
-	http.HandleFunc("/api/user-info", h.userInfoHandler)
-	// API routes
-	http.HandleFunc("/api/activities/", h.getActivities)
-	http.HandleFunc("/api/activities-refresh-last-10/", h.refreshLast10ActivitiesHandler) // NEW
-	http.HandleFunc("/api/activity/", h.updateActivity)
-	http.HandleFunc("/api/auth/", h.authHandler)
-	http.HandleFunc("/api/auth-callback/", h.authCallbackHandler)
-	http.HandleFunc("/api/tg-auth", h.tgAuthHandler)
-	http.HandleFunc("/api/webhook", h.webhook)
-	// tmp solution, can't delete old webhook subscription
-	http.HandleFunc("/webhook", h.webhook)
+// Start serves the routes on Port and processes webhook events until ctx is done. It then
+// stops accepting requests and waits up to shutdownTimeout for the running ones.
+func (h *HttpHandler) Start(ctx context.Context) error {
+	h.WebhookQueue.Start(ctx)
+
+	server := &http.Server{Addr: ":" + h.Port, Handler: h.Routes()}
+	served := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server on port " + h.Port)
+		served <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		slog.Error("wasn't able to start the server", "err", err)
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// telegramWebhook passes the updates Telegram posts in webhook mode to the bot.
+func (h *HttpHandler) telegramWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.TelegramWebhook == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.TelegramWebhook(w, r)
+}
+
+// Routes returns the mux with all API routes and the static frontend.
+func (h *HttpHandler) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	// API routes, authenticated with the auth_token cookie
+	mux.HandleFunc("POST /api/broadcast", h.withAuth(h.withAdmin(h.broadcastHandler)))
+	mux.HandleFunc("GET /debug/vars", h.withAuth(h.withAdmin(expvar.Handler().ServeHTTP)))
+	mux.HandleFunc("GET /api/me", h.withAuth(h.userInfoHandler))
+	mux.HandleFunc("GET /api/me/activities", h.withAuth(h.getActivities))
+	mux.HandleFunc("GET /api/me/settings", h.withAuth(h.getSettingsHandler))
+	mux.HandleFunc("PATCH /api/me/settings", h.withAuth(h.patchSettingsHandler))
+	mux.HandleFunc("POST /api/me/activities/refresh", h.withAuth(h.refreshLast10ActivitiesHandler))
+	mux.HandleFunc("GET /api/activities", h.withAuth(h.searchActivitiesHandler))
+	mux.HandleFunc("GET /api/activities/{id}", h.withAuth(h.getActivity))
+	mux.HandleFunc("POST /api/activities/{id}/rename", h.withAuth(h.updateActivity))
+	mux.HandleFunc("POST /api/activities/{id}/revert", h.withAuth(h.revertActivityHandler))
+	// public routes
+	mux.HandleFunc("GET /api/auth", h.authHandler)
+	mux.HandleFunc("GET /api/auth-callback", h.authCallbackHandler)
+	mux.HandleFunc("/api/tg-auth", h.tgAuthHandler)
+	mux.HandleFunc("/api/webhook", h.webhook)
+	mux.HandleFunc("POST "+tg.WebhookPath, h.telegramWebhook)
 
 	fs := http.FileServer(http.Dir(h.StaticDir))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Serve static files if they exist
 		path := filepath.Join(h.StaticDir, r.URL.Path)
 		if info, err := os.Stat(path); err == nil && !info.IsDir() {
@@ -586,11 +905,5 @@ func (h *HttpHandler) Start() {
 		// Otherwise, serve index.html for React Router
 		http.ServeFile(w, r, filepath.Join(h.StaticDir, "index.html"))
 	})
-
-	slog.Info("Starting server on port " + h.Port)
-	err := http.ListenAndServe(":"+h.Port, nil)
-	if err != nil {
-		slog.Error("wasn't able to start the server")
-		panic(err)
-	}
+	return mux
 }
@@ -1,35 +1,41 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"stravach/app/storage/models"
 	"stravach/app/strava"
 	"stravach/app/tg"
 	"stravach/mocks"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestProcessActivity_ActivityExists(t *testing.T) {
+	ctx := context.Background()
 	mockDB := new(mocks.Store)
 	mockStrava := &mocks.StravaService{}
-	activitiesChannel := make(chan tg.ActivityForUpdate, 1)
+	renames, activitiesChannel := testRenames(t)
 
 	h := &HttpHandler{
-		DB:                mockDB,
-		Strava:            mockStrava,
-		ActivitiesChannel: activitiesChannel,
+		DB:      mockDB,
+		Strava:  mockStrava,
+		Renames: renames,
 	}
 
 	existingActivity := &models.UserActivity{ID: 123, IsUpdated: true}
-	mockDB.On("IsActivityExists", int64(123)).Return(true, nil)
-	mockDB.On("GetActivityById", int64(123)).Return(existingActivity, nil)
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(true, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(existingActivity, nil)
 
 	user := &models.User{StravaAccessToken: "access-token"}
 
-	err := h.processActivity(123, user)
+	err := h.processActivity(ctx, 123, user)
 	assert.NoError(t, err)
 	assert.Empty(t, activitiesChannel)
 
@@ -38,25 +44,27 @@ func TestProcessActivity_ActivityExists(t *testing.T) {
 }
 
 func TestProcessActivity_NewActivity(t *testing.T) {
+	ctx := context.Background()
 	mockDB := new(mocks.Store)
 	mockStrava := &mocks.StravaService{}
-	activitiesChannel := make(chan tg.ActivityForUpdate, 1)
+	renames, activitiesChannel := testRenames(t)
 
 	h := &HttpHandler{
-		DB:                mockDB,
-		Strava:            mockStrava,
-		ActivitiesChannel: activitiesChannel,
+		DB:      mockDB,
+		Strava:  mockStrava,
+		Renames: renames,
 	}
 
-	mockDB.On("IsActivityExists", int64(123)).Return(false, nil)
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(false, nil)
 	mockStrava.On("GetActivity", "access-token", int64(123)).Return(&models.UserActivity{ID: 123}, nil)
 	mockStrava.On("RefreshAccessToken", "refresh-token").Return(&strava.AuthResp{AccessToken: "access-token"}, nil)
-	mockDB.On("CreateUserActivity", &models.UserActivity{ID: 123}, int64(1)).Return(nil)
-	mockDB.On("UpdateUser", mock.Anything).Return(nil)
+	mockDB.On("CreateUserActivity", mock.Anything, &models.UserActivity{ID: 123}, int64(1)).Return(nil)
+	mockDB.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(models.DefaultUserSettings(1), nil)
 
 	user := &models.User{ID: 1, StravaAccessToken: "access-token", StravaRefreshToken: "refresh-token", TelegramChatId: 456}
 
-	err := h.processActivity(123, user)
+	err := h.processActivity(ctx, 123, user)
 	afu := <-activitiesChannel
 	assert.NoError(t, err)
 
@@ -68,21 +76,23 @@ func TestProcessActivity_NewActivity(t *testing.T) {
 }
 
 func TestProcessActivity_UserAuthRequired(t *testing.T) {
+	ctx := context.Background()
 	mockDB := new(mocks.Store)
 	mockStrava := &mocks.StravaService{}
-	activitiesChannel := make(chan tg.ActivityForUpdate, 1)
+	renames, activitiesChannel := testRenames(t)
 
 	h := &HttpHandler{
-		DB:                mockDB,
-		Strava:            mockStrava,
-		ActivitiesChannel: activitiesChannel,
+		DB:      mockDB,
+		Strava:  mockStrava,
+		Renames: renames,
 	}
 
-	mockDB.On("IsActivityExists", int64(123)).Return(false, nil)
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(false, nil)
 	mockStrava.On("RefreshAccessToken", "refresh-token").Return(&strava.AuthResp{AccessToken: "new-access-token"}, nil)
 	mockStrava.On("GetActivity", "new-access-token", int64(123)).Return(&models.UserActivity{ID: 123}, nil)
-	mockDB.On("CreateUserActivity", &models.UserActivity{ID: 123}, int64(1)).Return(nil)
-	mockDB.On("UpdateUser", mock.Anything).Return(nil)
+	mockDB.On("CreateUserActivity", mock.Anything, &models.UserActivity{ID: 123}, int64(1)).Return(nil)
+	mockDB.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(models.DefaultUserSettings(1), nil)
 
 	user := &models.User{
 		ID:                 1,
@@ -90,9 +100,8 @@ func TestProcessActivity_UserAuthRequired(t *testing.T) {
 		TelegramChatId:     456,
 	}
 
-	err := h.processActivity(123, user)
+	err := h.processActivity(ctx, 123, user)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, activitiesChannel)
 
 	afu := <-activitiesChannel
 	assert.Equal(t, int64(123), afu.Activity.ID)
@@ -103,26 +112,249 @@ func TestProcessActivity_UserAuthRequired(t *testing.T) {
 }
 
 func TestProcessActivity_StravaFetchError(t *testing.T) {
+	ctx := context.Background()
 	mockDB := new(mocks.Store)
 	mockStrava := &mocks.StravaService{}
-	activitiesChannel := make(chan tg.ActivityForUpdate, 1)
+	renames, activitiesChannel := testRenames(t)
 
 	h := &HttpHandler{
-		DB:                mockDB,
-		Strava:            mockStrava,
-		ActivitiesChannel: activitiesChannel,
+		DB:      mockDB,
+		Strava:  mockStrava,
+		Renames: renames,
 	}
 
-	mockDB.On("IsActivityExists", int64(123)).Return(false, nil)
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(false, nil)
 	mockStrava.On("RefreshAccessToken", "refresh-token").Return(&strava.AuthResp{AccessToken: "access-token"}, nil)
 	mockStrava.On("GetActivity", "access-token", int64(123)).Return(&models.UserActivity{}, errors.New("strava error"))
+	mockDB.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
 
 	user := &models.User{ID: 1, StravaAccessToken: "access-token", StravaRefreshToken: "refresh-token", TelegramChatId: 456}
 
-	err := h.processActivity(123, user)
+	err := h.processActivity(ctx, 123, user)
 	assert.Error(t, err)
 	assert.Empty(t, activitiesChannel)
 
 	mockDB.AssertExpectations(t)
 	mockStrava.AssertExpectations(t)
 }
+
+func TestProcessActivity_RefreshesRejectedToken(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	mockStrava := &mocks.StravaService{}
+	renames, activitiesChannel := testRenames(t)
+
+	h := &HttpHandler{
+		DB:      mockDB,
+		Strava:  mockStrava,
+		Renames: renames,
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(false, nil)
+	mockStrava.On("GetActivity", "revoked-token", int64(123)).Return(nil, &strava.APIError{StatusCode: 401}).Once()
+	mockStrava.On("RefreshAccessToken", "refresh-token").Return(&strava.AuthResp{AccessToken: "new-access-token", RefreshToken: "refresh-token", ExpiresAt: expiresAt}, nil).Once()
+	mockStrava.On("GetActivity", "new-access-token", int64(123)).Return(&models.UserActivity{ID: 123}, nil).Once()
+	mockDB.On("CreateUserActivity", mock.Anything, &models.UserActivity{ID: 123}, int64(1)).Return(nil)
+	mockDB.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(models.DefaultUserSettings(1), nil)
+
+	user := &models.User{ID: 1, StravaAccessToken: "revoked-token", StravaRefreshToken: "refresh-token", TokenExpiresAt: &expiresAt, TelegramChatId: 456}
+
+	err := h.processActivity(ctx, 123, user)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-access-token", user.StravaAccessToken)
+	assert.Equal(t, int64(123), (<-activitiesChannel).Activity.ID)
+
+	mockDB.AssertExpectations(t)
+	mockStrava.AssertExpectations(t)
+}
+
+func TestProcessActivity_RenameQueueFull(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	renames := tg.NewRenamePool(nil)
+	renames.MaxQueued = 0
+	h := &HttpHandler{DB: mockDB, Renames: renames}
+
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(true, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123}, nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(models.DefaultUserSettings(1), nil)
+
+	err := h.processActivity(ctx, 123, &models.User{ID: 1, TelegramChatId: 456})
+	assert.ErrorIs(t, err, tg.ErrRenameQueueFull)
+	assert.False(t, permanentError(err))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessActivity_SkipsActivityFilteredBySettings(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	renames, activitiesChannel := testRenames(t)
+	h := &HttpHandler{DB: mockDB, Renames: renames}
+
+	settings := models.DefaultUserSettings(1)
+	settings.ActivityTypes = []string{"Run"}
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(true, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123, ActivityType: "Walk"}, nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(settings, nil)
+
+	err := h.processActivity(ctx, 123, &models.User{ID: 1, TelegramChatId: 456})
+	assert.NoError(t, err)
+	assert.Empty(t, activitiesChannel)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestProcessActivity_DefersDuringQuietHours(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	renames, activitiesChannel := testRenames(t)
+	h := &HttpHandler{DB: mockDB, Renames: renames}
+
+	settings := models.DefaultUserSettings(1)
+	settings.QuietHoursStart = time.Now().UTC().Hour()
+	settings.QuietHoursEnd = (settings.QuietHoursStart + 2) % 24
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(true, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123}, nil)
+	mockDB.On("GetUserSettings", mock.Anything, int64(1)).Return(settings, nil)
+
+	err := h.processActivity(ctx, 123, &models.User{ID: 1, TelegramChatId: 456})
+	var deferred *deferredError
+	assert.ErrorAs(t, err, &deferred)
+	assert.Equal(t, settings.QuietHoursEnd, deferred.Until.UTC().Hour())
+	assert.Empty(t, activitiesChannel)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleWebhookEvent_Delete(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB}
+
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123, UserID: 1}, nil)
+	mockDB.On("DeleteUserActivity", mock.Anything, int64(123)).Return(nil)
+
+	event := strava.WebhookEvent{ObjectType: strava.ObjectTypeActivity, AspectType: strava.AspectTypeDelete, ObjectId: 123}
+	err := h.handleWebhookEvent(ctx, event, &models.User{ID: 1})
+	assert.NoError(t, err)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleWebhookEvent_DeleteKeepsOtherUsersActivity(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB}
+
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123, UserID: 2}, nil)
+
+	event := strava.WebhookEvent{ObjectType: strava.ObjectTypeActivity, AspectType: strava.AspectTypeDelete, ObjectId: 123}
+	err := h.handleWebhookEvent(ctx, event, &models.User{ID: 1})
+	assert.NoError(t, err)
+
+	mockDB.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "DeleteUserActivity", mock.Anything, mock.Anything)
+}
+
+func TestHandleWebhookEvent_UpdateSyncsTitleAndType(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	renames, activitiesChannel := testRenames(t)
+	h := &HttpHandler{DB: mockDB, Renames: renames}
+
+	mockDB.On("IsActivityExists", mock.Anything, int64(123)).Return(true, nil)
+	mockDB.On("GetActivityById", mock.Anything, int64(123)).Return(&models.UserActivity{ID: 123, Name: "Morning Run", ActivityType: "Run"}, nil)
+	mockDB.On("UpdateUserActivity", mock.Anything, &models.UserActivity{ID: 123, Name: "Hill Repeats", ActivityType: "Hike"}).Return(nil)
+
+	event := strava.WebhookEvent{
+		ObjectType: strava.ObjectTypeActivity,
+		AspectType: strava.AspectTypeUpdate,
+		ObjectId:   123,
+		Updates:    map[string]string{"title": "Hill Repeats", "type": "Hike"},
+	}
+	err := h.handleWebhookEvent(ctx, event, &models.User{ID: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, activitiesChannel)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestHandleWebhookEvent_Deauthorization(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	notificationsChannel := make(chan tg.Notification, 1)
+	h := &HttpHandler{DB: mockDB, NotificationsChannel: notificationsChannel}
+
+	expiresAt := int64(1700000000)
+	user := &models.User{
+		ID:                 1,
+		TelegramChatId:     456,
+		StravaAccessToken:  "access-token",
+		StravaRefreshToken: "refresh-token",
+		StravaAccessCode:   "code",
+		TokenExpiresAt:     &expiresAt,
+	}
+	mockDB.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.StravaAccessToken == "" && u.StravaRefreshToken == "" && u.StravaAccessCode == "" && u.TokenExpiresAt == nil
+	})).Return(nil)
+
+	event := strava.WebhookEvent{
+		ObjectType: strava.ObjectTypeAthlete,
+		AspectType: strava.AspectTypeUpdate,
+		ObjectId:   42,
+		Updates:    map[string]string{"authorized": "false"},
+	}
+	err := h.handleWebhookEvent(ctx, event, user)
+	assert.NoError(t, err)
+
+	notification := <-notificationsChannel
+	assert.Equal(t, int64(456), notification.ChatId)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestTelegramWebhook_NotFoundWhenPolling(t *testing.T) {
+	h := &HttpHandler{DB: new(mocks.Store)}
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tg.WebhookPath, strings.NewReader(`{"update_id":1}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNotify_DropsMessageWhenBotIsBusy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h := &HttpHandler{NotificationsChannel: make(chan tg.Notification)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.notify(ctx, 456, "hello")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("notify blocked on a busy bot")
+	}
+}
+
+// testRenames returns a running rename pool that passes the activities it gets to the channel.
+func testRenames(t *testing.T) (*tg.RenamePool, chan tg.ActivityForUpdate) {
+	renamed := make(chan tg.ActivityForUpdate, 10)
+	renames := tg.NewRenamePool(func(_ context.Context, activity *tg.ActivityForUpdate) {
+		renamed <- *activity
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		renames.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return renames, renamed
+}
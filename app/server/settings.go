@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"stravach/app/storage/models"
+	"time"
+)
+
+// maxSettingsBody bounds the body of PATCH /api/me/settings.
+const maxSettingsBody = 64 << 10
+
+// getSettingsHandler returns the settings of the user.
+func (h *HttpHandler) getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	usr, _ := userFromContext(r.Context())
+	settings, err := h.DB.GetUserSettings(r.Context(), usr.ID)
+	if err != nil {
+		slog.Error("failed to fetch user settings", "error", err, "userId", usr.ID)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch settings")
+		return
+	}
+	writeSettings(w, settings)
+}
+
+// patchSettingsHandler changes the settings given in the body, e.g. {"units": "imperial"}, and
+// returns all settings. Unknown or invalid settings are rejected and nothing is changed.
+func (h *HttpHandler) patchSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	usr, _ := userFromContext(r.Context())
+	settings, err := h.DB.GetUserSettings(r.Context(), usr.ID)
+	if err != nil {
+		slog.Error("failed to fetch user settings", "error", err, "userId", usr.ID)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch settings")
+		return
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBody))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(settings); err != nil {
+		slog.Warn("invalid settings body", "error", err, "userId", usr.ID)
+		writeJSONError(w, http.StatusBadRequest, "invalid settings")
+		return
+	}
+	// not settings the user can change
+	settings.UserID = usr.ID
+	settings.UpdatedAt = time.Now().Unix()
+	if settings.ActivityTypes == nil {
+		settings.ActivityTypes = []string{}
+	}
+	if err = settings.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = h.DB.SaveUserSettings(r.Context(), settings); err != nil {
+		slog.Error("failed to save user settings", "error", err, "userId", usr.ID)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save settings")
+		return
+	}
+	slog.Info("user settings changed", "userId", usr.ID)
+	writeSettings(w, settings)
+}
+
+func writeSettings(w http.ResponseWriter, settings *models.UserSettings) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		slog.Error("error while writing to response", "err", err)
+	}
+}
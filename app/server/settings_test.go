@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stravach/app/storage"
+	"stravach/app/storage/models"
+	"stravach/app/utils"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func settingsTestHandler(t *testing.T) (*HttpHandler, *storage.MemoryStore, *models.User) {
+	store := storage.NewMemoryStore()
+	usr := &models.User{TelegramChatId: 456, Username: "runner", Language: "German"}
+	require.NoError(t, store.CreateUser(context.Background(), usr))
+	return &HttpHandler{DB: store, JWT: &utils.JWT{Key: []byte("secret")}}, store, usr
+}
+
+func patchSettings(t *testing.T, h *HttpHandler, userId int64, body string) *httptest.ResponseRecorder {
+	req := newAuthRequest(t, h, http.MethodPatch, "/api/me/settings", userId)
+	req.Body = io.NopCloser(strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.withAuth(h.patchSettingsHandler)(rec, req)
+	return rec
+}
+
+func TestGetSettings_ReturnsDefaults(t *testing.T) {
+	h, _, usr := settingsTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.withAuth(h.getSettingsHandler)(rec, newAuthRequest(t, h, http.MethodGet, "/api/me/settings", usr.ID))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var settings models.UserSettings
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&settings))
+	want := models.DefaultUserSettings(usr.ID)
+	want.Language = "German"
+	assert.Equal(t, *want, settings)
+}
+
+func TestPatchSettings_ChangesGivenSettings(t *testing.T) {
+	h, store, usr := settingsTestHandler(t)
+
+	rec := patchSettings(t, h, usr.ID, `{"units":"imperial","activity_types":["Run","Ride"],"quiet_hours_start":22,"quiet_hours_end":7,"timezone":"Europe/Berlin","language":"French","user_id":99}`)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	settings, err := store.GetUserSettings(context.Background(), usr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, usr.ID, settings.UserID)
+	assert.Equal(t, models.UnitsImperial, settings.Units)
+	assert.Equal(t, []string{"Run", "Ride"}, settings.ActivityTypes)
+	assert.Equal(t, 22, settings.QuietHoursStart)
+	assert.Equal(t, "Europe/Berlin", settings.Timezone)
+	assert.Equal(t, models.NamingStyleFunny, settings.NamingStyle, "settings not in the body are kept")
+	assert.NotZero(t, settings.UpdatedAt)
+	stored, err := store.GetUserById(context.Background(), usr.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "French", stored.Language)
+	assert.Contains(t, rec.Body.String(), `"units":"imperial"`)
+}
+
+func TestPatchSettings_RejectsInvalidSettings(t *testing.T) {
+	for _, body := range []string{
+		`{"language":"Klingon"}`,
+		`{"units":"furlongs"}`,
+		`{"rename_mode":"auto","rename_timeout":0}`,
+		`{"min_distance":-5}`,
+		`{"quiet_hours_start":25}`,
+		`{"timezone":"Mars/Olympus"}`,
+		`{"colour":"blue"}`,
+		`not json`,
+	} {
+		t.Run(body, func(t *testing.T) {
+			h, store, usr := settingsTestHandler(t)
+
+			rec := patchSettings(t, h, usr.ID, body)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			settings, err := store.GetUserSettings(context.Background(), usr.ID)
+			require.NoError(t, err)
+			assert.Zero(t, settings.UpdatedAt, "settings were saved")
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"stravach/app/strava"
+	"strconv"
+)
+
+// writeStravaError maps a failed Strava call to the response status of an API request.
+func writeStravaError(w http.ResponseWriter, err error, fallback string) {
+	var rateErr *strava.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(rateErr.RetryAfter.Seconds())))
+		writeJSONError(w, http.StatusTooManyRequests, "strava rate limit reached, try again later")
+	case errors.Is(err, strava.ErrUnauthorized):
+		writeJSONError(w, http.StatusUnauthorized, "strava authorization expired, reconnect with /start in the bot")
+	case errors.Is(err, strava.ErrForbidden):
+		writeJSONError(w, http.StatusForbidden, "strava permission missing, reconnect with /start in the bot")
+	case errors.Is(err, strava.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "not found on strava")
+	case errors.Is(err, strava.ErrServer):
+		writeJSONError(w, http.StatusBadGateway, "strava is unavailable")
+	default:
+		writeJSONError(w, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"stravach/app/storage/models"
+	"stravach/app/utils"
+	"stravach/mocks"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testBotToken = "123456:test-bot-token"
+
+func signedLoginBody(id int64, authDate time.Time) string {
+	fields := map[string]string{
+		"id":         strconv.FormatInt(id, 10),
+		"first_name": "Dev",
+		"auth_date":  strconv.FormatInt(authDate.Unix(), 10),
+	}
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := []string{}
+	for _, k := range keys {
+		lines = append(lines, k+"="+fields[k])
+	}
+	secret := sha256.Sum256([]byte(testBotToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return `{"user":{"id":` + fields["id"] + `,"first_name":"Dev","auth_date":` + fields["auth_date"] +
+		`,"hash":"` + hex.EncodeToString(mac.Sum(nil)) + `"}}`
+}
+
+func TestTgAuthHandler_ValidLogin(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, TgApiKey: testBotToken, JWT: &utils.JWT{Key: []byte("secret")}}
+	mockDB.On("GetUserByChatId", mock.Anything, int64(212439945)).Return(&models.User{ID: 7, TelegramChatId: 212439945}, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/tg-auth", strings.NewReader(signedLoginBody(212439945, time.Now())))
+	h.tgAuthHandler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Set-Cookie"), "auth_token=")
+	mockDB.AssertExpectations(t)
+}
+
+func TestTgAuthHandler_RejectsUnsignedPayload(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, TgApiKey: testBotToken, JWT: &utils.JWT{Key: []byte("secret")}}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/tg-auth", strings.NewReader(`{"user":{"id":212439945,"first_name":"Dev"}}`))
+	req.Header.Set("Origin", "http://localhost:5173")
+	h.tgAuthHandler(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	mockDB.AssertNotCalled(t, "GetUserByChatId", mock.Anything)
+	mockDB.AssertNotCalled(t, "GetUserById", mock.Anything)
+}
+
+func TestTgAuthHandler_RejectsStaleLogin(t *testing.T) {
+	mockDB := new(mocks.Store)
+	h := &HttpHandler{DB: mockDB, TgApiKey: testBotToken, JWT: &utils.JWT{Key: []byte("secret")}}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/tg-auth", strings.NewReader(signedLoginBody(212439945, time.Now().Add(-48*time.Hour))))
+	h.tgAuthHandler(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
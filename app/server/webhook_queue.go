@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravach/app/storage"
+	"stravach/app/storage/models"
+	"stravach/app/strava"
+	"time"
+)
+
+// WebhookQueue persists Strava webhook events and processes them in the background,
+// so the webhook endpoint can acknowledge Strava right away.
+type WebhookQueue struct {
+	DB           storage.Store
+	Handle       func(ctx context.Context, event strava.WebhookEvent) error
+	Workers      int
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Lease        time.Duration
+	wake         chan struct{}
+}
+
+func NewWebhookQueue(db storage.Store, handle func(ctx context.Context, event strava.WebhookEvent) error) *WebhookQueue {
+	return &WebhookQueue{
+		DB:           db,
+		Handle:       handle,
+		Workers:      4,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: 5 * time.Second,
+		Lease:        5 * time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores the event with its raw payload. Redelivered events are dropped silently.
+func (q *WebhookQueue) Enqueue(ctx context.Context, event strava.WebhookEvent, payload []byte) error {
+	now := time.Now().Unix()
+	inserted, err := q.DB.EnqueueWebhookEvent(ctx, &models.WebhookEvent{
+		ObjectType:    event.ObjectType,
+		ObjectId:      event.ObjectId,
+		AspectType:    event.AspectType,
+		OwnerId:       event.OwnerId,
+		EventTime:     event.EventTime,
+		Payload:       string(payload),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		slog.Info("webhook event already queued", "object_id", event.ObjectId, "aspect_type", event.AspectType, "event_time", event.EventTime)
+		return nil
+	}
+	q.Wake()
+	return nil
+}
+
+// Wake signals an idle worker that new events are available.
+func (q *WebhookQueue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the workers until ctx is cancelled.
+func (q *WebhookQueue) Start(ctx context.Context) {
+	slog.Info("starting webhook queue", "workers", q.Workers)
+	for i := 0; i < q.Workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+func (q *WebhookQueue) work(ctx context.Context) {
+	for {
+		if q.processNext(ctx) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.PollInterval):
+		}
+	}
+}
+
+// processNext handles a single due event and reports whether there was one.
+func (q *WebhookQueue) processNext(ctx context.Context) bool {
+	now := time.Now()
+	event, err := q.DB.ClaimWebhookEvent(ctx, now.Unix(), now.Add(q.Lease).Unix())
+	if err != nil {
+		slog.Error("error while claiming webhook event", "err", err)
+		return false
+	}
+	if event == nil {
+		return false
+	}
+
+	var stravaEvent strava.WebhookEvent
+	err = json.Unmarshal([]byte(event.Payload), &stravaEvent)
+	if err == nil {
+		err = q.Handle(ctx, stravaEvent)
+	}
+	// the outcome is recorded even when the queue is stopping, so the event isn't retried
+	// only because its lease ran out
+	q.finish(context.WithoutCancel(ctx), event, err)
+	return true
+}
+
+func (q *WebhookQueue) finish(ctx context.Context, event *models.WebhookEvent, err error) {
+	var rateErr *strava.RateLimitError
+	var deferred *deferredError
+	switch {
+	case err == nil:
+		event.Status = models.WebhookEventDone
+		event.LastError = ""
+	case errors.As(err, &rateErr):
+		// Being throttled says nothing about the event, so it doesn't use up an attempt.
+		slog.Warn("webhook event rate limited, will retry", "id", event.ID, "retryIn", rateErr.RetryAfter)
+		event.Status = models.WebhookEventPending
+		event.Attempts--
+		event.NextAttemptAt = time.Now().Add(rateErr.RetryAfter).Unix()
+		event.LastError = err.Error()
+	case errors.As(err, &deferred):
+		slog.Info("webhook event deferred", "id", event.ID, "until", deferred.Until, "reason", deferred.Reason)
+		event.Status = models.WebhookEventPending
+		event.Attempts--
+		event.NextAttemptAt = deferred.Until.Unix()
+		event.LastError = err.Error()
+	case permanentError(err):
+		slog.Error("webhook event failed permanently", "id", event.ID, "kind", strava.ErrorKind(err), "err", err)
+		event.Status = models.WebhookEventDead
+		event.LastError = err.Error()
+	case event.Attempts >= q.MaxAttempts:
+		slog.Error("webhook event moved to dead letter", "id", event.ID, "attempts", event.Attempts, "err", err)
+		event.Status = models.WebhookEventDead
+		event.LastError = err.Error()
+	default:
+		retryIn := q.backoff(event.Attempts)
+		slog.Warn("webhook event failed, will retry", "id", event.ID, "attempts", event.Attempts, "retryIn", retryIn, "err", err)
+		event.Status = models.WebhookEventPending
+		event.NextAttemptAt = time.Now().Add(retryIn).Unix()
+		event.LastError = err.Error()
+	}
+	if err := q.DB.UpdateWebhookEvent(ctx, event); err != nil {
+		slog.Error("error while updating webhook event", "id", event.ID, "err", err)
+	}
+}
+
+// deferredError holds an event back until Until without using up an attempt, e.g. during
+// the quiet hours of the user.
+type deferredError struct {
+	Until  time.Time
+	Reason string
+}
+
+func (e *deferredError) Error() string {
+	return fmt.Sprintf("deferred until %s: %s", e.Until.Format(time.RFC3339), e.Reason)
+}
+
+// errUnprocessable marks events that no retry can process, e.g. of an athlete who isn't a user.
+var errUnprocessable = errors.New("webhook event can't be processed")
+
+// permanentError reports errors that a retry won't fix: the event can't be processed, the
+// activity is gone, or the athlete revoked access or permissions.
+func permanentError(err error) bool {
+	return errors.Is(err, errUnprocessable) || errors.Is(err, strava.ErrNotFound) ||
+		errors.Is(err, strava.ErrForbidden) || errors.Is(err, strava.ErrUnauthorized)
+}
+
+// backoff returns the delay before the given attempt is retried, doubling with every attempt.
+func (q *WebhookQueue) backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := q.BaseBackoff << (attempts - 1)
+	if d <= 0 || d > q.MaxBackoff {
+		return q.MaxBackoff
+	}
+	return d
+}
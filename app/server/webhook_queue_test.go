@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"stravach/app/storage/models"
+	"stravach/app/strava"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const createEventPayload = `{"object_type":"activity","object_id":123,"aspect_type":"create","owner_id":42,"event_time":1700000000}`
+
+func TestWebhookQueue_ProcessNextSuccess(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	var handled strava.WebhookEvent
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		handled = event
+		return nil
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: 1}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.ID == 1 && e.Status == models.WebhookEventDone
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+	assert.Equal(t, int64(123), handled.ObjectId)
+	assert.Equal(t, strava.AspectTypeCreate, handled.AspectType)
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_RecordsOutcomeWhenStopping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(ctx context.Context, event strava.WebhookEvent) error {
+		cancel()
+		return ctx.Err()
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: 1}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() == nil }), mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventPending && e.LastError == context.Canceled.Error()
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		return errors.New("strava is down")
+	})
+
+	before := time.Now().Unix()
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: 2}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventPending && e.LastError == "strava is down" &&
+			e.NextAttemptAt >= before+int64(q.BaseBackoff.Seconds())*2
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		return errors.New("strava is down")
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: q.MaxAttempts}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventDead
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextRateLimitedKeepsAttempt(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		return &strava.RateLimitError{RetryAfter: 10 * time.Minute}
+	})
+
+	before := time.Now().Unix()
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: q.MaxAttempts}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventPending && e.Attempts == q.MaxAttempts-1 &&
+			e.NextAttemptAt >= before+600
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextDeferredKeepsAttempt(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	until := time.Now().Add(3 * time.Hour)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		return &deferredError{Until: until, Reason: "quiet hours of the user"}
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: q.MaxAttempts}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventPending && e.Attempts == q.MaxAttempts-1 &&
+			e.NextAttemptAt == until.Unix()
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextPermanentError(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		return &strava.APIError{StatusCode: 404, Message: "Record Not Found"}
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: createEventPayload, Attempts: 1}, nil)
+	mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+		return e.Status == models.WebhookEventDead
+	})).Return(nil)
+
+	assert.True(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_ProcessNextUnprocessableEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		user    *models.User
+		userErr error
+	}{
+		{name: "unknown athlete", payload: createEventPayload, userErr: sql.ErrNoRows},
+		{name: "unsupported object", payload: `{"object_type":"club","object_id":7,"aspect_type":"create","owner_id":42}`, user: &models.User{ID: 1}},
+		{name: "unsupported aspect", payload: `{"object_type":"activity","object_id":123,"aspect_type":"archive","owner_id":42}`, user: &models.User{ID: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockDB := new(mocks.Store)
+			h := &HttpHandler{DB: mockDB}
+			q := NewWebhookQueue(mockDB, h.processWebhookEvent)
+
+			mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(&models.WebhookEvent{ID: 1, Payload: tt.payload, Attempts: 1}, nil)
+			mockDB.On("GetUserByStravaId", mock.Anything, int64(42)).Return(tt.user, tt.userErr)
+			mockDB.On("UpdateWebhookEvent", mock.Anything, mock.MatchedBy(func(e *models.WebhookEvent) bool {
+				return e.Status == models.WebhookEventDead
+			})).Return(nil).Once()
+
+			assert.True(t, q.processNext(ctx))
+
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWebhookQueue_ProcessNextEmpty(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(mocks.Store)
+	q := NewWebhookQueue(mockDB, func(_ context.Context, event strava.WebhookEvent) error {
+		t.Fatal("handler should not be called")
+		return nil
+	})
+
+	mockDB.On("ClaimWebhookEvent", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	assert.False(t, q.processNext(ctx))
+
+	mockDB.AssertExpectations(t)
+}
+
+func TestWebhookQueue_Backoff(t *testing.T) {
+	q := NewWebhookQueue(nil, nil)
+
+	assert.Equal(t, q.BaseBackoff, q.backoff(1))
+	assert.Equal(t, 4*q.BaseBackoff, q.backoff(3))
+	assert.Equal(t, q.MaxBackoff, q.backoff(30))
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"stravach/app/storage/models"
+	"strconv"
+	"strings"
+)
+
+// activityColumnNames are the user_activities columns in the order of activityValues and scanActivity.
+var activityColumnNames = []string{
+	"id", "user_id", "name", "distance", "moving_time", "elapsed_time", "type", "start_date",
+	"average_heartrate", "average_speed", "is_updated", "description", "sport_type",
+	"total_elevation_gain", "elev_high", "elev_low", "start_lat", "start_lng", "end_lat", "end_lng",
+	"summary_polyline", "max_speed", "max_heartrate", "average_cadence", "average_watts",
+	"weighted_average_watts", "kilojoules", "calories", "gear_id", "device_name", "timezone",
+	"trainer", "commute", "manual", "private",
+}
+
+var activityColumns = strings.Join(activityColumnNames, ", ")
+
+// ActivityRepo keeps the Strava activities of the users.
+type ActivityRepo interface {
+	GetActivityById(ctx context.Context, activityId int64) (*models.UserActivity, error)
+	IsActivityExists(ctx context.Context, activityId int64) (bool, error)
+	// GetUserActivities returns the newest limit activities of the user.
+	GetUserActivities(ctx context.Context, userId int64, limit int) ([]models.UserActivity, error)
+	QueryActivities(ctx context.Context, query ActivityQuery) (*ActivityPage, error)
+	CreateUserActivity(ctx context.Context, activity *models.UserActivity, userId int64) error
+	// CreateUserActivities upserts the activities in one transaction. They are summaries from
+	// Strava's activity lists, so the details and the is_updated flag of stored ones are kept.
+	CreateUserActivities(ctx context.Context, activities []*models.UserActivity) error
+	UpsertActivities(ctx context.Context, activities []*models.UserActivity, opts BatchOptions) error
+	UpdateUserActivity(ctx context.Context, activity *models.UserActivity) error
+	DeleteUserActivity(ctx context.Context, activityId int64) error
+}
+
+func sqlitePlaceholder(int) string { return "?" }
+
+func postgresPlaceholder(n int) string { return "$" + strconv.Itoa(n) }
+
+// activityValues returns the column values of a for userId.
+func activityValues(a *models.UserActivity, userId int64) []any {
+	startLat, startLng := latLngValues(a.StartLatLng)
+	endLat, endLng := latLngValues(a.EndLatLng)
+	return []any{
+		a.ID, userId, a.Name, a.Distance, a.MovingTime, a.ElapsedTime, a.ActivityType, a.StartDate,
+		a.AverageHeartrate, a.AverageSpeed, a.IsUpdated, a.Description, a.SportType,
+		a.TotalElevationGain, a.ElevHigh, a.ElevLow, startLat, startLng, endLat, endLng,
+		a.Map.SummaryPolyline, a.MaxSpeed, a.MaxHeartrate, a.AverageCadence, a.AverageWatts,
+		a.WeightedAverageWatts, a.Kilojoules, a.Calories, a.GearID, a.DeviceName, a.Timezone,
+		a.Trainer, a.Commute, a.Manual, a.Private,
+	}
+}
+
+// latLngValues splits a Strava [lat, lng] pair into nullable columns.
+func latLngValues(latLng []float64) (sql.NullFloat64, sql.NullFloat64) {
+	if len(latLng) != 2 {
+		return sql.NullFloat64{}, sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: latLng[0], Valid: true}, sql.NullFloat64{Float64: latLng[1], Valid: true}
+}
+
+func latLng(lat sql.NullFloat64, lng sql.NullFloat64) []float64 {
+	if !lat.Valid || !lng.Valid {
+		return nil
+	}
+	return []float64{lat.Float64, lng.Float64}
+}
+
+func scanActivity(row interface{ Scan(...any) error }) (*models.UserActivity, error) {
+	a := &models.UserActivity{}
+	var startLat, startLng, endLat, endLng sql.NullFloat64
+	err := row.Scan(
+		&a.ID, &a.UserID, &a.Name, &a.Distance, &a.MovingTime, &a.ElapsedTime, &a.ActivityType, &a.StartDate,
+		&a.AverageHeartrate, &a.AverageSpeed, &a.IsUpdated, &a.Description, &a.SportType,
+		&a.TotalElevationGain, &a.ElevHigh, &a.ElevLow, &startLat, &startLng, &endLat, &endLng,
+		&a.Map.SummaryPolyline, &a.MaxSpeed, &a.MaxHeartrate, &a.AverageCadence, &a.AverageWatts,
+		&a.WeightedAverageWatts, &a.Kilojoules, &a.Calories, &a.GearID, &a.DeviceName, &a.Timezone,
+		&a.Trainer, &a.Commute, &a.Manual, &a.Private,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a.StartLatLng = latLng(startLat, startLng)
+	a.EndLatLng = latLng(endLat, endLng)
+	return a, nil
+}
+
+// summaryMissingColumns are the columns Strava only returns for a single activity, not in its
+// activity lists, with the value summaries carry for them.
+var summaryMissingColumns = map[string]string{"description": "''", "calories": "0", "device_name": "''"}
+
+// upsertActivityQuery inserts all activity columns and updates them when the activity exists.
+// A merge, for the summaries of Strava's activity lists, keeps is_updated once it is set and
+// the stored values of summaryMissingColumns the summary has none for.
+func upsertActivityQuery(placeholder func(int) string, merge bool) string {
+	placeholders := make([]string, len(activityColumnNames))
+	var set []string
+	for i, column := range activityColumnNames {
+		placeholders[i] = placeholder(i + 1)
+		summaryValue, detailOnly := summaryMissingColumns[column]
+		switch {
+		case column == "id" || column == "is_updated":
+		case merge && detailOnly:
+			set = append(set, fmt.Sprintf("%[1]s = COALESCE(NULLIF(excluded.%[1]s, %[2]s), user_activities.%[1]s)", column, summaryValue))
+		default:
+			set = append(set, column+" = excluded."+column)
+		}
+	}
+	if merge {
+		set = append(set, "is_updated = user_activities.is_updated OR excluded.is_updated")
+	} else {
+		set = append(set, "is_updated = excluded.is_updated")
+	}
+	return `INSERT INTO user_activities (` + activityColumns + `) VALUES (` + strings.Join(placeholders, ", ") + `)
+    ON CONFLICT(id) DO UPDATE SET ` + strings.Join(set, ", ")
+}
+
+// updateActivityQuery sets all columns but id and user_id of the activity with the id of the last placeholder.
+// Its arguments are updateActivityValues.
+func updateActivityQuery(placeholder func(int) string) string {
+	var set []string
+	for _, column := range activityColumnNames[2:] {
+		set = append(set, column+" = "+placeholder(len(set)+1))
+	}
+	return `UPDATE user_activities SET ` + strings.Join(set, ", ") + ` WHERE id = ` + placeholder(len(set)+1)
+}
+
+func updateActivityValues(a *models.UserActivity) []any {
+	values := activityValues(a, a.UserID)[2:]
+	return append(values, a.ID)
+}
+
+// DefaultActivityBatchSize is the chunk size of UpsertActivities when BatchOptions has none.
+const DefaultActivityBatchSize = 500
+
+// BatchOptions configures UpsertActivities.
+type BatchOptions struct {
+	// ChunkSize is how many activities are written per transaction, DefaultActivityBatchSize when 0.
+	ChunkSize int
+	// Progress, when set, is called after every committed chunk with the number of activities
+	// written so far and the total.
+	Progress func(written int, total int)
+}
+
+func (o BatchOptions) chunkSize() int {
+	if o.ChunkSize <= 0 {
+		return DefaultActivityBatchSize
+	}
+	return o.ChunkSize
+}
+
+// upsertActivities runs query, an upsertActivityQuery, for every activity with one prepared
+// statement per chunk. Each chunk is a transaction, so a failure keeps the chunks committed
+// before it and rolls back the rest of its own chunk.
+func upsertActivities(ctx context.Context, db *sql.DB, query string, activities []*models.UserActivity, opts BatchOptions) error {
+	size := opts.chunkSize()
+	for written := 0; written < len(activities); {
+		chunk := activities[written:min(written+size, len(activities))]
+		if err := upsertActivityChunk(ctx, db, query, chunk); err != nil {
+			slog.Error("error while upserting activities", "err", err, "written", written, "total", len(activities))
+			return fmt.Errorf("upserting activities %d-%d of %d: %w", written+1, written+len(chunk), len(activities), err)
+		}
+		written += len(chunk)
+		if opts.Progress != nil {
+			opts.Progress(written, len(activities))
+		}
+	}
+	return nil
+}
+
+func upsertActivityChunk(ctx context.Context, db *sql.DB, query string, activities []*models.UserActivity) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, a := range activities {
+		if _, err = stmt.ExecContext(ctx, activityValues(a, a.UserID)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
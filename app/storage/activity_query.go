@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravach/app/storage/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultActivityQueryLimit = 30
+	MaxActivityQueryLimit     = 100
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued by QueryActivities.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ActivityQuery selects activities of a user, newest first. Zero values don't filter.
+type ActivityQuery struct {
+	UserID int64
+	// Type matches the type or the sport type, e.g. Run or TrailRun.
+	Type string
+	// From and To bound the start date, To is exclusive.
+	From time.Time
+	To   time.Time
+	// MinDistance and MaxDistance are meters.
+	MinDistance float64
+	MaxDistance float64
+	// MinDuration and MaxDuration are moving time seconds.
+	MinDuration int64
+	MaxDuration int64
+	// Renamed keeps only activities renamed by the bot when true, only the others when false.
+	Renamed *bool
+	// Text matches all its words in the name or description.
+	Text string
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// Limit is the page size, DefaultActivityQueryLimit when 0 and at most MaxActivityQueryLimit.
+	Limit int
+}
+
+// ActivityPage is a page of QueryActivities. NextCursor is empty on the last page.
+type ActivityPage struct {
+	Activities []models.UserActivity `json:"activities"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// activityCursor is the position after the last activity of a page in start_date, id order.
+type activityCursor struct {
+	StartDate time.Time
+	ID        int64
+}
+
+func encodeActivityCursor(a models.UserActivity) string {
+	raw := strconv.FormatInt(a.StartDate.UnixNano(), 10) + ":" + strconv.FormatInt(a.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeActivityCursor(cursor string) (*activityCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	startDate, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(startDate, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &activityCursor{StartDate: time.Unix(0, nanos).UTC()}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// searchWords splits free text into the words QueryActivities matches.
+func searchWords(text string) []string {
+	return strings.Fields(text)
+}
+
+// activityQueryBuilder collects the conditions and arguments of a dialect.
+type activityQueryBuilder struct {
+	placeholder func(int) string
+	conditions  []string
+	args        []any
+}
+
+// arg adds an argument and returns its placeholder.
+func (b *activityQueryBuilder) arg(value any) string {
+	b.args = append(b.args, value)
+	return b.placeholder(len(b.args))
+}
+
+func (b *activityQueryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// buildActivityQuery returns the SELECT of q and its arguments. textCondition adds the
+// condition matching the free text words in the dialect. It fetches one activity more
+// than the limit to tell whether there is a next page.
+func buildActivityQuery(q ActivityQuery, placeholder func(int) string, textCondition func(b *activityQueryBuilder, words []string)) (string, []any, error) {
+	b := &activityQueryBuilder{placeholder: placeholder}
+	b.where("user_id = " + b.arg(q.UserID))
+	if q.Type != "" {
+		b.where("(type = " + b.arg(q.Type) + " OR sport_type = " + b.arg(q.Type) + ")")
+	}
+	if !q.From.IsZero() {
+		b.where("start_date >= " + b.arg(q.From.UTC()))
+	}
+	if !q.To.IsZero() {
+		b.where("start_date < " + b.arg(q.To.UTC()))
+	}
+	if q.MinDistance > 0 {
+		b.where("distance >= " + b.arg(q.MinDistance))
+	}
+	if q.MaxDistance > 0 {
+		b.where("distance <= " + b.arg(q.MaxDistance))
+	}
+	if q.MinDuration > 0 {
+		b.where("moving_time >= " + b.arg(q.MinDuration))
+	}
+	if q.MaxDuration > 0 {
+		b.where("moving_time <= " + b.arg(q.MaxDuration))
+	}
+	if q.Renamed != nil {
+		b.where("is_updated = " + b.arg(*q.Renamed))
+	}
+	if words := searchWords(q.Text); len(words) > 0 {
+		textCondition(b, words)
+	}
+	if q.Cursor != "" {
+		c, err := decodeActivityCursor(q.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		b.where(fmt.Sprintf("(start_date < %s OR (start_date = %s AND id < %s))", b.arg(c.StartDate), b.arg(c.StartDate), b.arg(c.ID)))
+	}
+	query := `SELECT ` + activityColumns + ` FROM user_activities WHERE ` + strings.Join(b.conditions, " AND ") +
+		` ORDER BY start_date DESC, id DESC LIMIT ` + b.arg(activityQueryLimit(q.Limit)+1)
+	return query, b.args, nil
+}
+
+func activityQueryLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultActivityQueryLimit
+	}
+	return min(limit, MaxActivityQueryLimit)
+}
+
+// likeWordsCondition matches every word as a substring of the name or description.
+func likeWordsCondition(b *activityQueryBuilder, words []string, like string) {
+	for _, word := range words {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(word) + "%"
+		b.where(fmt.Sprintf(`(COALESCE(name, '') %s %s ESCAPE '\' OR description %s %s ESCAPE '\')`, like, b.arg(pattern), like, b.arg(pattern)))
+	}
+}
+
+// queryActivityPage runs a query of buildActivityQuery and turns the extra activity into NextCursor.
+func queryActivityPage(ctx context.Context, db *sql.DB, query string, args []any, limit int) (*ActivityPage, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	activities := []models.UserActivity{}
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, *activity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return newActivityPage(activities, limit), nil
+}
+
+// newActivityPage cuts activities, fetched up to one past the limit, to a page.
+func newActivityPage(activities []models.UserActivity, limit int) *ActivityPage {
+	page := &ActivityPage{Activities: activities}
+	limit = activityQueryLimit(limit)
+	if len(page.Activities) > limit {
+		page.Activities = page.Activities[:limit]
+		page.NextCursor = encodeActivityCursor(page.Activities[limit-1])
+	}
+	return page
+}
+
+// setupActivityFTS creates the FTS5 index over activity names and descriptions, kept in
+// sync by triggers. It reports false when SQLite was built without FTS5, i.e. without the
+// sqlite_fts5 build tag.
+func setupActivityFTS(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil || !enabled {
+		return false, err
+	}
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'user_activities_fts'`).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return true, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.Exec(`
+    CREATE VIRTUAL TABLE IF NOT EXISTS user_activities_fts USING fts5(name, description, content='user_activities', content_rowid='id');
+    CREATE TRIGGER IF NOT EXISTS user_activities_fts_insert AFTER INSERT ON user_activities BEGIN
+      INSERT INTO user_activities_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+    END;
+    CREATE TRIGGER IF NOT EXISTS user_activities_fts_delete AFTER DELETE ON user_activities BEGIN
+      INSERT INTO user_activities_fts(user_activities_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+    END;
+    CREATE TRIGGER IF NOT EXISTS user_activities_fts_update AFTER UPDATE ON user_activities BEGIN
+      INSERT INTO user_activities_fts(user_activities_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+      INSERT INTO user_activities_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+    END;
+    INSERT INTO user_activities_fts(user_activities_fts) VALUES ('rebuild');
+  `)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ftsMatchQuery turns words into an FTS5 query matching all of them as prefixes.
+func ftsMatchQuery(words []string) string {
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchesWithFTS sets up the full-text index on first use and reports whether it is available.
+func (s *SQLiteStore) searchesWithFTS() bool {
+	s.ftsOnce.Do(func() {
+		var err error
+		s.fts, err = setupActivityFTS(s.DB)
+		if err != nil {
+			slog.Warn("activity full-text search is unavailable, matching text with LIKE", "err", err)
+		}
+	})
+	return s.fts
+}
+
+// QueryActivities returns a page of the activities matching q. Text is matched with FTS5
+// when SQLite has it, otherwise with LIKE.
+func (s *SQLiteStore) QueryActivities(ctx context.Context, q ActivityQuery) (*ActivityPage, error) {
+	fts := s.searchesWithFTS()
+	query, args, err := buildActivityQuery(q, sqlitePlaceholder, func(b *activityQueryBuilder, words []string) {
+		if fts {
+			b.where("id IN (SELECT rowid FROM user_activities_fts WHERE user_activities_fts MATCH " + b.arg(ftsMatchQuery(words)) + ")")
+			return
+		}
+		likeWordsCondition(b, words, "LIKE")
+	})
+	if err != nil {
+		return nil, err
+	}
+	page, err := queryActivityPage(ctx, s.DB, query, args, q.Limit)
+	if err != nil {
+		slog.Error("error while querying user activities", "userId", q.UserID)
+	}
+	return page, err
+}
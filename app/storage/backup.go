@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405Z"
+
+var backupFileName = regexp.MustCompile(`^stravach-\d{8}T\d{6}Z\.db(\.gz)?$`)
+
+// ErrNotSQLite is returned for backups of a Postgres DATABASE_URL, which pg_dump covers.
+var ErrNotSQLite = errors.New("backups need a SQLite database, use pg_dump for Postgres")
+
+// BackupOptions configures SQLiteStore.Backup.
+type BackupOptions struct {
+	// Dir receives the snapshots, it is created when missing.
+	Dir string
+	// Gzip compresses snapshots to .db.gz files.
+	Gzip bool
+	// Keep is how many snapshots are kept in Dir, older ones are deleted. 0 keeps all.
+	Keep int
+}
+
+// OpenSQLite opens the SQLite database selected by dsn like NewStore, without migrating it.
+func OpenSQLite(dsn string) (*SQLiteStore, error) {
+	store, ok := storeForDSN(dsn, nil).(*SQLiteStore)
+	if !ok {
+		return nil, ErrNotSQLite
+	}
+	if err := store.open(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Backup writes a consistent snapshot of the database, taken with VACUUM INTO while the
+// database stays in use, to opts.Dir as stravach-<UTC time of now>.db[.gz] and applies the
+// retention. It returns the snapshot path.
+func (s *SQLiteStore) Backup(opts BackupOptions, now time.Time) (string, error) {
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return "", err
+	}
+	name := "stravach-" + now.UTC().Format(backupTimeFormat) + ".db"
+	if opts.Gzip {
+		name += ".gz"
+	}
+	path := filepath.Join(opts.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+
+	snapshot := filepath.Join(opts.Dir, "."+name+".tmp")
+	defer os.Remove(snapshot)
+	if _, err := s.DB.Exec(`VACUUM INTO ?`, snapshot); err != nil {
+		return "", fmt.Errorf("snapshotting database: %w", err)
+	}
+	if opts.Gzip {
+		compressed := snapshot + ".gz"
+		defer os.Remove(compressed)
+		if err := gzipFile(snapshot, compressed); err != nil {
+			return "", err
+		}
+		snapshot = compressed
+	}
+	if err := os.Rename(snapshot, path); err != nil {
+		return "", err
+	}
+	slog.Info("database backed up", "path", path)
+	return path, pruneBackups(opts.Dir, opts.Keep)
+}
+
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// ListBackups returns the snapshots in dir, oldest first.
+func ListBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() && backupFileName.MatchString(entry.Name()) {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	// the timestamp makes the names sort by age
+	slices.SortFunc(backups, func(a, b string) int {
+		return strings.Compare(strings.TrimSuffix(a, ".gz"), strings.TrimSuffix(b, ".gz"))
+	})
+	return backups, nil
+}
+
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err = os.Remove(backups[0]); err != nil {
+			return err
+		}
+		slog.Info("old backup deleted", "path", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// ScheduleBackups backs the store up every interval until ctx is done. Failures are logged
+// and retried on the next tick.
+func ScheduleBackups(ctx context.Context, store *SQLiteStore, interval time.Duration, opts BackupOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := store.Backup(opts, now); err != nil {
+				slog.Error("scheduled backup failed", "err", err, "dir", opts.Dir)
+			}
+		}
+	}
+}
+
+// RestoreSQLite replaces the SQLite database selected by dsn with the snapshot at backup,
+// a .db or .db.gz file of Backup. The snapshot must pass an integrity check and have a
+// schema this build can migrate. The replaced database, with its WAL files, is kept next to
+// it with a .before-restore-<time> suffix. The service must be stopped while restoring.
+func RestoreSQLite(dsn string, backup string, now time.Time) (string, error) {
+	store, ok := storeForDSN(dsn, nil).(*SQLiteStore)
+	if !ok {
+		return "", ErrNotSQLite
+	}
+	path := store.path()
+
+	restored := path + ".restore.tmp"
+	defer removeSQLiteFiles(restored)
+	if err := copyBackup(backup, restored); err != nil {
+		return "", err
+	}
+	version, err := checkBackup(restored)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", backup, err)
+	}
+
+	replaced := ""
+	if _, err = os.Stat(path); err == nil {
+		replaced = path + ".before-restore-" + now.UTC().Format(backupTimeFormat)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err = os.Rename(path+suffix, replaced+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+	if err = os.Rename(restored, path); err != nil {
+		return "", err
+	}
+	slog.Info("database restored", "path", path, "backup", backup, "version", version, "replaced", replaced)
+	return replaced, nil
+}
+
+// removeSQLiteFiles removes a database file with its -wal and -shm files.
+func removeSQLiteFiles(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		_ = os.Remove(path + suffix)
+	}
+}
+
+// copyBackup copies a snapshot to dst, decompressing .gz files.
+func copyBackup(backup string, dst string) error {
+	in, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var src io.Reader = in
+	if strings.HasSuffix(backup, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", backup, err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, src); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// checkBackup returns the schema version of the snapshot at path, failing when it is damaged,
+// isn't a stravach database or was migrated by a newer build.
+func checkBackup(path string) (int, error) {
+	// snapshots of a WAL database are WAL databases too, switching the copy to a rollback
+	// journal leaves no -wal and -shm files behind
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=DELETE")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var integrity string
+	if err = db.QueryRow(`PRAGMA integrity_check`).Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("not a SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", integrity)
+	}
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, errors.New("not a stravach database, it has no schema_migrations table")
+	}
+	var version int
+	if err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	migrations, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		return 0, err
+	}
+	if latest := migrations[len(migrations)-1].Version; version > latest {
+		return 0, fmt.Errorf("%w: backup is at version %d, this build knows up to %d", ErrSchemaTooNew, version, latest)
+	}
+	return version, nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"stravach/app/storage/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteFileStore(t *testing.T, path string) *SQLiteStore {
+	store := &SQLiteStore{Path: path}
+	require.NoError(t, store.Connect())
+	t.Cleanup(func() { _ = store.DB.Close() })
+	return store
+}
+
+func TestSQLiteStore_BackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	for _, compress := range []bool{false, true} {
+		t.Run(map[bool]string{false: "plain", true: "gzip"}[compress], func(t *testing.T) {
+			dir := t.TempDir()
+			dsn := filepath.Join(dir, "stravach.db")
+			store := newSQLiteFileStore(t, dsn)
+			user := createTestUser(t, store, 555)
+			require.NoError(t, store.CreateUserActivity(ctx, &models.UserActivity{ID: 1, Name: "Morning Run", StartDate: time.Now()}, user.ID))
+
+			now := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+			backup, err := store.Backup(BackupOptions{Dir: filepath.Join(dir, "backups"), Gzip: compress}, now)
+			require.NoError(t, err)
+			want := "stravach-20240501T073000Z.db"
+			if compress {
+				want += ".gz"
+			}
+			require.Equal(t, want, filepath.Base(backup))
+
+			// changes after the backup are lost by the restore
+			require.NoError(t, store.DeleteUserActivity(ctx, 1))
+			require.NoError(t, store.DB.Close())
+
+			replaced, err := RestoreSQLite(dsn, backup, now.Add(time.Hour))
+			require.NoError(t, err)
+			require.Equal(t, dsn+".before-restore-20240501T083000Z", replaced)
+			require.FileExists(t, replaced)
+
+			restored := newSQLiteFileStore(t, dsn)
+			activity, err := restored.GetActivityById(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, "Morning Run", activity.Name)
+		})
+	}
+}
+
+func TestSQLiteStore_BackupRetention(t *testing.T) {
+	dir := t.TempDir()
+	store := newSQLiteFileStore(t, filepath.Join(dir, "stravach.db"))
+	backups := filepath.Join(dir, "backups")
+	require.NoError(t, os.MkdirAll(backups, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(backups, "notes.txt"), nil, 0o600))
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for day := 0; day < 4; day++ {
+		_, err := store.Backup(BackupOptions{Dir: backups, Gzip: day%2 == 0, Keep: 2}, start.AddDate(0, 0, day))
+		require.NoError(t, err)
+	}
+
+	kept, err := ListBackups(backups)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(backups, "stravach-20240503T000000Z.db.gz"),
+		filepath.Join(backups, "stravach-20240504T000000Z.db"),
+	}, kept)
+	require.FileExists(t, filepath.Join(backups, "notes.txt"))
+
+	_, err = store.Backup(BackupOptions{Dir: backups}, start.AddDate(0, 0, 3))
+	require.ErrorContains(t, err, "already exists")
+}
+
+func TestRestoreSQLite_RejectsInvalidBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "stravach.db")
+	store := newSQLiteFileStore(t, dsn)
+	createTestUser(t, store, 555)
+
+	notSQLite := filepath.Join(dir, "garbage.db")
+	require.NoError(t, os.WriteFile(notSQLite, []byte("not a database at all, just some bytes"), 0o600))
+	_, err := RestoreSQLite(dsn, notSQLite, time.Now())
+	require.ErrorContains(t, err, "not a SQLite database")
+
+	otherApp := newSQLiteFileStore(t, filepath.Join(dir, "other.db"))
+	_, err = otherApp.DB.Exec(`DROP TABLE schema_migrations`)
+	require.NoError(t, err)
+	require.NoError(t, otherApp.DB.Close())
+	_, err = RestoreSQLite(dsn, filepath.Join(dir, "other.db"), time.Now())
+	require.ErrorContains(t, err, "not a stravach database")
+
+	newer := newSQLiteFileStore(t, filepath.Join(dir, "newer.db"))
+	_, err = newer.DB.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'from_the_future', 0)`)
+	require.NoError(t, err)
+	require.NoError(t, newer.DB.Close())
+	_, err = RestoreSQLite(dsn, filepath.Join(dir, "newer.db"), time.Now())
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+
+	// the database is left alone
+	exists, err := store.IsUserExistsByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.True(t, exists)
+	matches, err := filepath.Glob(dsn + ".*")
+	require.NoError(t, err)
+	for _, match := range matches {
+		require.NotContains(t, match, "before-restore")
+		require.NotContains(t, match, "restore.tmp")
+	}
+}
+
+func TestOpenSQLite_RejectsPostgres(t *testing.T) {
+	_, err := OpenSQLite("postgres://db/stravach")
+	require.ErrorIs(t, err, ErrNotSQLite)
+	_, err = RestoreSQLite("postgres://db/stravach", "backup.db", time.Now())
+	require.ErrorIs(t, err, ErrNotSQLite)
+}
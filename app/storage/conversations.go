@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// ConversationRepo keeps the rename dialogs of the bot, so button presses and replies
+// still work after a restart and on another replica. Expired entries are not returned.
+type ConversationRepo interface {
+	// GetConversation returns the dialog of the chat, nil when there is none or it expired at now.
+	GetConversation(ctx context.Context, chatId int64, now int64) (*models.Conversation, error)
+	SaveConversation(ctx context.Context, conversation *models.Conversation) error
+	// GetNameOptions returns the names offered for the activity, nil when there are none or they expired at now.
+	GetNameOptions(ctx context.Context, chatId int64, activityId int64, now int64) (*models.NameOptions, error)
+	SaveNameOptions(ctx context.Context, options *models.NameOptions) error
+	DeleteNameOptions(ctx context.Context, chatId int64, activityId int64) error
+	// TakeDueNameOptions removes and returns the unexpired name options whose AutoApplyAt
+	// passed at now, so each of them is applied once even with several replicas.
+	TakeDueNameOptions(ctx context.Context, now int64) ([]models.NameOptions, error)
+	// DeleteExpiredConversations removes dialogs and name options that expired at now.
+	DeleteExpiredConversations(ctx context.Context, now int64) error
+}
+
+func (s *SQLiteStore) GetConversation(ctx context.Context, chatId int64, now int64) (*models.Conversation, error) {
+	query := `SELECT chat_id, activity_id, awaiting_prompt, expires_at, updated_at FROM conversations WHERE chat_id = ? AND expires_at > ?`
+	c := &models.Conversation{}
+	err := s.DB.QueryRowContext(ctx, query, chatId, now).Scan(&c.ChatID, &c.ActivityID, &c.AwaitingPrompt, &c.ExpiresAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching conversation", "chatId", chatId)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) SaveConversation(ctx context.Context, c *models.Conversation) error {
+	query := `
+    INSERT INTO conversations (chat_id, activity_id, awaiting_prompt, expires_at, updated_at)
+    VALUES (?, ?, ?, ?, ?)
+    ON CONFLICT(chat_id) DO UPDATE SET
+        activity_id = excluded.activity_id,
+        awaiting_prompt = excluded.awaiting_prompt,
+        expires_at = excluded.expires_at,
+        updated_at = excluded.updated_at
+  `
+	_, err := s.DB.ExecContext(ctx, query, c.ChatID, c.ActivityID, c.AwaitingPrompt, c.ExpiresAt, c.UpdatedAt)
+	if err != nil {
+		slog.Error("error while saving conversation", "chatId", c.ChatID)
+	}
+	return err
+}
+
+func (s *SQLiteStore) GetNameOptions(ctx context.Context, chatId int64, activityId int64, now int64) (*models.NameOptions, error) {
+	query := `SELECT names, source, expires_at, auto_apply_at FROM name_options WHERE chat_id = ? AND activity_id = ? AND expires_at > ?`
+	return scanNameOptions(s.DB.QueryRowContext(ctx, query, chatId, activityId, now), chatId, activityId)
+}
+
+func scanNameOptions(row *sql.Row, chatId int64, activityId int64) (*models.NameOptions, error) {
+	options := &models.NameOptions{ChatID: chatId, ActivityID: activityId}
+	var names string
+	err := row.Scan(&names, &options.Source, &options.ExpiresAt, &options.AutoApplyAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching name options", "chatId", chatId, "activityId", activityId)
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(names), &options.Names); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (s *SQLiteStore) SaveNameOptions(ctx context.Context, options *models.NameOptions) error {
+	names, err := json.Marshal(options.Names)
+	if err != nil {
+		return err
+	}
+	query := `
+    INSERT INTO name_options (chat_id, activity_id, names, source, expires_at, auto_apply_at)
+    VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT(chat_id, activity_id) DO UPDATE SET
+        names = excluded.names,
+        source = excluded.source,
+        expires_at = excluded.expires_at,
+        auto_apply_at = excluded.auto_apply_at
+  `
+	_, err = s.DB.ExecContext(ctx, query, options.ChatID, options.ActivityID, string(names), options.Source, options.ExpiresAt, options.AutoApplyAt)
+	if err != nil {
+		slog.Error("error while saving name options", "chatId", options.ChatID, "activityId", options.ActivityID)
+	}
+	return err
+}
+
+func (s *SQLiteStore) DeleteNameOptions(ctx context.Context, chatId int64, activityId int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM name_options WHERE chat_id = ? AND activity_id = ?`, chatId, activityId)
+	if err != nil {
+		slog.Error("error while deleting name options", "chatId", chatId, "activityId", activityId)
+	}
+	return err
+}
+
+func (s *SQLiteStore) TakeDueNameOptions(ctx context.Context, now int64) ([]models.NameOptions, error) {
+	query := `
+    DELETE FROM name_options WHERE auto_apply_at > 0 AND auto_apply_at <= ? AND expires_at > ?
+    RETURNING chat_id, activity_id, names, source, expires_at, auto_apply_at
+  `
+	return queryDueNameOptions(ctx, s.DB, query, now)
+}
+
+func queryDueNameOptions(ctx context.Context, db *sql.DB, query string, now int64) ([]models.NameOptions, error) {
+	rows, err := db.QueryContext(ctx, query, now, now)
+	if err != nil {
+		slog.Error("error while taking due name options")
+		return nil, err
+	}
+	defer rows.Close()
+	var due []models.NameOptions
+	for rows.Next() {
+		var options models.NameOptions
+		var names string
+		err = rows.Scan(&options.ChatID, &options.ActivityID, &names, &options.Source, &options.ExpiresAt, &options.AutoApplyAt)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(names), &options.Names); err != nil {
+			return nil, err
+		}
+		due = append(due, options)
+	}
+	return due, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteExpiredConversations(ctx context.Context, now int64) error {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM conversations WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM name_options WHERE expires_at <= ?`, now)
+	return err
+}
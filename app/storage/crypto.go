@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"stravach/app/storage/models"
+	"strings"
+)
+
+// encryptedPrefix marks sealed values. Values without it are plaintext written before
+// encryption was enabled; they are still read and rewritten by rotate-keys.
+const encryptedPrefix = "enc1"
+
+const dataKeySize = 32
+
+var keyIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var encoding = base64.RawURLEncoding
+
+// Keyring seals the Strava tokens of users with envelope encryption: every value gets
+// its own AES-256-GCM data key, which is wrapped with the primary key of the ring.
+// The wrapping key id is kept next to the value, so older keys can still open it.
+// A nil Keyring stores tokens as they are.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring parses "id:base64key,id:base64key". Keys are 32 bytes and the first one
+// is primary. An empty spec returns nil, which disables encryption.
+func NewKeyring(spec string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	k := &Keyring{keys: map[string]cipher.AEAD{}}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || !keyIdPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key entry %q, want id:base64key", id)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %q must be %d base64 encoded bytes", id, dataKeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.primary == "" {
+			k.primary = id
+		}
+	}
+	return k, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func unseal(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Encrypt seals value as enc1.<key id>.<wrapped data key>.<ciphertext>. Empty values stay empty.
+func (k *Keyring) Encrypt(value string) (string, error) {
+	if k == nil || value == "" {
+		return value, nil
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{encryptedPrefix, k.primary, encoding.EncodeToString(wrappedKey), encoding.EncodeToString(ciphertext)}, "."), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with any key of the ring. Plaintext values are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 || parts[0] != encryptedPrefix {
+		return value, nil
+	}
+	if k == nil {
+		return "", errors.New("token is encrypted but no encryption keys are configured")
+	}
+	kek, ok := k.keys[parts[1]]
+	if !ok {
+		return "", fmt.Errorf("token is encrypted with unknown key %q", parts[1])
+	}
+	wrappedKey, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := encoding.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := unseal(kek, wrappedKey, []byte(parts[1]))
+	if err != nil {
+		return "", fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := unseal(aead, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt token: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is not sealed with the primary key yet.
+func (k *Keyring) NeedsRotation(value string) bool {
+	if k == nil || value == "" {
+		return false
+	}
+	parts := strings.Split(value, ".")
+	return len(parts) != 4 || parts[0] != encryptedPrefix || parts[1] != k.primary
+}
+
+// userTokens are the three token columns of a user as stored.
+type userTokens struct {
+	RefreshToken string
+	AccessToken  string
+	AccessCode   string
+}
+
+func (k *Keyring) sealUser(u *models.User) (userTokens, error) {
+	var t userTokens
+	var err error
+	if t.RefreshToken, err = k.Encrypt(u.StravaRefreshToken); err != nil {
+		return t, err
+	}
+	if t.AccessToken, err = k.Encrypt(u.StravaAccessToken); err != nil {
+		return t, err
+	}
+	t.AccessCode, err = k.Encrypt(u.StravaAccessCode)
+	return t, err
+}
+
+func (k *Keyring) openUser(u *models.User) error {
+	var err error
+	if u.StravaRefreshToken, err = k.Decrypt(u.StravaRefreshToken); err != nil {
+		return err
+	}
+	if u.StravaAccessToken, err = k.Decrypt(u.StravaAccessToken); err != nil {
+		return err
+	}
+	u.StravaAccessCode, err = k.Decrypt(u.StravaAccessCode)
+	return err
+}
+
+// RotateKeys re-encrypts the tokens of store that aren't sealed with the primary key,
+// including plaintext ones, and returns the number of updated users.
+func RotateKeys(store Store) (int, error) {
+	rotator, ok := store.(interface{ RotateKeys() (int, error) })
+	if !ok {
+		return 0, errors.New("store does not support key rotation")
+	}
+	return rotator.RotateKeys()
+}
+
+// rotateKeys implements RotateKeys for the SQL stores. update sets the refresh token,
+// access token and access code of the user with the given id, guarded by their old
+// values, so tokens refreshed in the meantime are not overwritten.
+func rotateKeys(db *sql.DB, keys *Keyring, update string) (int, error) {
+	if keys == nil {
+		return 0, errors.New("no encryption keys are configured")
+	}
+	rows, err := db.Query(`SELECT id, strava_refresh_token, strava_access_token, strava_access_code FROM users`)
+	if err != nil {
+		return 0, err
+	}
+	type storedTokens struct {
+		id int64
+		userTokens
+	}
+	var stale []storedTokens
+	for rows.Next() {
+		var t storedTokens
+		if err = rows.Scan(&t.id, &t.RefreshToken, &t.AccessToken, &t.AccessCode); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if keys.NeedsRotation(t.RefreshToken) || keys.NeedsRotation(t.AccessToken) || keys.NeedsRotation(t.AccessCode) {
+			stale = append(stale, t)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, t := range stale {
+		user := &models.User{ID: t.id, StravaRefreshToken: t.RefreshToken, StravaAccessToken: t.AccessToken, StravaAccessCode: t.AccessCode}
+		if err = keys.openUser(user); err != nil {
+			return rotated, fmt.Errorf("user %d: %w", t.id, err)
+		}
+		sealed, err := keys.sealUser(user)
+		if err != nil {
+			return rotated, err
+		}
+		result, err := db.Exec(update, sealed.RefreshToken, sealed.AccessToken, sealed.AccessCode, t.id, t.RefreshToken, t.AccessToken, t.AccessCode)
+		if err != nil {
+			return rotated, fmt.Errorf("user %d: %w", t.id, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"stravach/app/storage/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(t *testing.T) string {
+	key := make([]byte, dataKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestNewKeyring(t *testing.T) {
+	keys, err := NewKeyring("")
+	require.NoError(t, err)
+	require.Nil(t, keys)
+
+	key := testKey(t)
+	for _, spec := range []string{"nokey", "bad id:" + key, "1:not-base64", "1:" + base64.StdEncoding.EncodeToString([]byte("short")), "1:" + key + ",1:" + key} {
+		_, err = NewKeyring(spec)
+		require.Error(t, err, spec)
+	}
+
+	keys, err = NewKeyring("2024-06:" + testKey(t) + ", 2024-01:" + key)
+	require.NoError(t, err)
+	require.Equal(t, "2024-06", keys.primary)
+	require.Len(t, keys.keys, 2)
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	oldRing, err := NewKeyring("old:" + oldKey)
+	require.NoError(t, err)
+	rotated, err := NewKeyring("new:" + newKey + ",old:" + oldKey)
+	require.NoError(t, err)
+
+	sealed, err := oldRing.Encrypt("access-token")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(sealed, "enc1.old."))
+	require.NotContains(t, sealed, "access-token")
+	again, err := oldRing.Encrypt("access-token")
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again)
+
+	plain, err := rotated.Decrypt(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "access-token", plain)
+	require.True(t, rotated.NeedsRotation(sealed))
+	require.False(t, oldRing.NeedsRotation(sealed))
+
+	resealed, err := rotated.Encrypt(plain)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(resealed, "enc1.new."))
+	_, err = oldRing.Decrypt(resealed)
+	require.ErrorContains(t, err, "unknown key")
+	_, err = (*Keyring)(nil).Decrypt(resealed)
+	require.Error(t, err)
+
+	tampered := resealed[:len(resealed)-2] + "AA"
+	_, err = rotated.Decrypt(tampered)
+	require.Error(t, err)
+
+	// plaintext from before encryption was enabled passes through and is due for rotation
+	plain, err = rotated.Decrypt("legacy-token")
+	require.NoError(t, err)
+	require.Equal(t, "legacy-token", plain)
+	require.True(t, rotated.NeedsRotation("legacy-token"))
+
+	empty, err := rotated.Encrypt("")
+	require.NoError(t, err)
+	require.Empty(t, empty)
+	require.False(t, rotated.NeedsRotation(""))
+}
+
+func storedTokens(t *testing.T, store *SQLiteStore, userId int64) userTokens {
+	var tokens userTokens
+	err := store.DB.QueryRow(`SELECT strava_refresh_token, strava_access_token, strava_access_code FROM users WHERE id = ?`, userId).
+		Scan(&tokens.RefreshToken, &tokens.AccessToken, &tokens.AccessCode)
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestSQLiteStore_EncryptsAndRotatesTokens(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteTestStore(t).(*SQLiteStore)
+	user := &models.User{TelegramChatId: 555, StravaRefreshToken: "refresh", StravaAccessToken: "access", StravaAccessCode: "code"}
+	require.NoError(t, store.CreateUser(ctx, user))
+	require.Equal(t, "access", storedTokens(t, store, user.ID).AccessToken)
+
+	_, err := RotateKeys(store)
+	require.Error(t, err)
+
+	oldKey := testKey(t)
+	store.Keys, err = NewKeyring("1:" + oldKey)
+	require.NoError(t, err)
+	rotated, err := RotateKeys(store)
+	require.NoError(t, err)
+	require.Equal(t, 1, rotated)
+	tokens := storedTokens(t, store, user.ID)
+	for _, value := range []string{tokens.RefreshToken, tokens.AccessToken, tokens.AccessCode} {
+		require.True(t, strings.HasPrefix(value, "enc1.1."), value)
+	}
+
+	store.Keys, err = NewKeyring("2:" + testKey(t) + ",1:" + oldKey)
+	require.NoError(t, err)
+	stored, err := store.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "access", stored.StravaAccessToken)
+
+	rotated, err = RotateKeys(store)
+	require.NoError(t, err)
+	require.Equal(t, 1, rotated)
+	require.True(t, strings.HasPrefix(storedTokens(t, store, user.ID).RefreshToken, "enc1.2."))
+	rotated, err = RotateKeys(store)
+	require.NoError(t, err)
+	require.Zero(t, rotated)
+
+	stored.StravaAccessToken = "refreshed"
+	require.NoError(t, store.UpdateUser(ctx, stored))
+	require.True(t, strings.HasPrefix(storedTokens(t, store, user.ID).AccessToken, "enc1.2."))
+
+	stored, err = store.GetUserByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.Equal(t, "refresh", stored.StravaRefreshToken)
+	require.Equal(t, "refreshed", stored.StravaAccessToken)
+	require.Equal(t, "code", stored.StravaAccessCode)
+}
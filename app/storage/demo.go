@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"stravach/app/storage/models"
+	"time"
+)
+
+// DemoChatId is the Telegram chat of the first demo user, who has id 1 in an empty store
+// and is the user of the dev login.
+const DemoChatId = 100001
+
+// demoActivityDays is how far back the seeded activities go.
+const demoActivityDays = 90
+
+type demoSport struct {
+	activityType string
+	sportType    string
+	names        []string
+	speed        float64 // meters per second
+	minDistance  float64
+	maxDistance  float64
+}
+
+var demoSports = []demoSport{
+	{"Run", "Run", []string{"Morning Run", "Lunch Run", "Evening Run"}, 3.1, 5000, 15000},
+	{"Run", "TrailRun", []string{"Morning Trail Run", "Afternoon Trail Run"}, 2.4, 8000, 22000},
+	{"Ride", "Ride", []string{"Morning Ride", "Evening Ride"}, 7.5, 20000, 80000},
+	{"Ride", "GravelRide", []string{"Afternoon Gravel Ride"}, 6.2, 25000, 60000},
+	{"Swim", "Swim", []string{"Morning Swim"}, 0.8, 1000, 3000},
+	{"Walk", "Walk", []string{"Lunch Walk", "Evening Walk"}, 1.4, 2000, 8000},
+}
+
+// demoRenames are names the bot gave to some of the seeded activities.
+var demoRenames = []string{
+	"Sunrise Tempo", "Lakeside Loop", "Harbour Dash", "Hill Repeats of Regret", "City Lights Cruise",
+	"Coffee Shop Detour", "Negative Split Hero", "Rainy Day Grind", "Golden Hour Spin", "Recovery Shuffle",
+}
+
+// SeedDemo fills store with two demo users and their activities of the last months before now,
+// some of them renamed, so the client can be used without a Strava account. The first user
+// is an admin. Activities are generated from a fixed seed, so every run looks the same.
+func SeedDemo(ctx context.Context, store Store, now time.Time) error {
+	rnd := rand.New(rand.NewSource(1))
+	expiresAt := now.Add(24 * time.Hour).Unix()
+	users := []*models.User{
+		{TelegramChatId: DemoChatId, Username: "demo", Language: "English", IsAdmin: true, TokenExpiresAt: &expiresAt},
+		{TelegramChatId: DemoChatId + 1, Username: "demo_friend", Language: "German", TokenExpiresAt: &expiresAt},
+	}
+	for i, user := range users {
+		stravaId := int64(9000 + i)
+		user.StravaId = &stravaId
+		user.StravaAccessToken = "demo-access"
+		user.StravaRefreshToken = "demo-refresh"
+		if err := store.CreateUser(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	activityId := int64(1000)
+	for _, user := range users {
+		var activities []*models.UserActivity
+		for day := demoActivityDays; day > 0; day-- {
+			if rnd.Intn(3) == 0 {
+				continue
+			}
+			activityId++
+			activities = append(activities, demoActivity(rnd, activityId, user.ID, now.AddDate(0, 0, -day)))
+		}
+		for _, a := range activities {
+			if rnd.Intn(3) != 0 {
+				continue
+			}
+			oldName := a.Name
+			a.Name = demoRenames[rnd.Intn(len(demoRenames))]
+			a.IsUpdated = true
+			err := store.AddNameChange(ctx, &models.NameChange{
+				ActivityID: a.ID, UserID: user.ID, OldName: oldName, NewName: a.Name,
+				Source: models.NameSourceAIOption, CreatedAt: a.StartDate.Add(time.Duration(a.ElapsedTime) * time.Second).Unix(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := store.CreateUserActivities(ctx, activities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func demoActivity(rnd *rand.Rand, id int64, userId int64, day time.Time) *models.UserActivity {
+	sport := demoSports[rnd.Intn(len(demoSports))]
+	distance := sport.minDistance + rnd.Float64()*(sport.maxDistance-sport.minDistance)
+	speed := sport.speed * (0.85 + rnd.Float64()*0.3)
+	movingTime := int64(distance / speed)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 6+rnd.Intn(14), rnd.Intn(60), 0, 0, time.UTC)
+	lat, lng := 52.52+rnd.Float64()*0.1-0.05, 13.405+rnd.Float64()*0.1-0.05
+	a := &models.UserActivity{
+		ID:                 id,
+		UserID:             userId,
+		Name:               sport.names[rnd.Intn(len(sport.names))],
+		Distance:           float64(int(distance)),
+		MovingTime:         movingTime,
+		ElapsedTime:        movingTime + int64(rnd.Intn(600)),
+		ActivityType:       sport.activityType,
+		SportType:          sport.sportType,
+		StartDate:          start,
+		AverageSpeed:       speed,
+		MaxSpeed:           speed * 1.4,
+		AverageHeartrate:   float64(125 + rnd.Intn(40)),
+		MaxHeartrate:       float64(165 + rnd.Intn(25)),
+		TotalElevationGain: float64(rnd.Intn(400)),
+		Description:        fmt.Sprintf("Demo %s", sport.sportType),
+		DeviceName:         "Demo Watch",
+		Timezone:           "(GMT+01:00) Europe/Berlin",
+		Calories:           distance / 1000 * 60,
+	}
+	if sport.activityType != "Swim" {
+		a.StartLatLng = []float64{lat, lng}
+		a.EndLatLng = []float64{lat + 0.002, lng - 0.003}
+	}
+	return a
+}
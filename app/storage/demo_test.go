@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedDemo(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	require.NoError(t, SeedDemo(ctx, store, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)))
+
+	demo, err := store.GetUserById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(DemoChatId), demo.TelegramChatId)
+	require.True(t, demo.IsAdmin)
+
+	page, err := store.QueryActivities(ctx, ActivityQuery{UserID: demo.ID, Limit: MaxActivityQueryLimit})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Activities)
+	require.True(t, page.Activities[0].StartDate.Before(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)))
+
+	renamed := true
+	page, err = store.QueryActivities(ctx, ActivityQuery{UserID: demo.ID, Renamed: &renamed})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Activities)
+	last, err := store.GetLastNameChange(ctx, demo.ID, page.Activities[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	require.Equal(t, page.Activities[0].Name, last.NewName)
+}
@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"stravach/app/storage/models"
+	"strings"
+	"sync"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+type webhookEventKey struct {
+	objectId   int64
+	aspectType string
+	eventTime  int64
+}
+
+// MemoryStore is a Store kept in memory, for tests and the demo mode. It behaves like
+// SQLiteStore, including sql.ErrNoRows for missing users and activities, and is safe
+// for concurrent use. Values are copied in and out, so callers can't change stored state.
+type MemoryStore struct {
+	*MemoryConversations
+
+	mu            sync.RWMutex
+	users         map[int64]models.User
+	activities    map[int64]models.UserActivity
+	webhookEvents []models.WebhookEvent
+	eventKeys     map[webhookEventKey]bool
+	syncStates    map[int64]models.SyncState
+	settings      map[int64]models.UserSettings
+	nameHistory   []models.NameChange
+	lastUserId    int64
+	lastEventId   int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryConversations: NewMemoryConversations(),
+		users:               map[int64]models.User{},
+		activities:          map[int64]models.UserActivity{},
+		eventKeys:           map[webhookEventKey]bool{},
+		syncStates:          map[int64]models.SyncState{},
+		settings:            map[int64]models.UserSettings{},
+	}
+}
+
+// Connect does nothing, the store is ready once created.
+func (m *MemoryStore) Connect() error {
+	return nil
+}
+
+func copyUser(u models.User) *models.User {
+	if u.StravaId != nil {
+		stravaId := *u.StravaId
+		u.StravaId = &stravaId
+	}
+	if u.TokenExpiresAt != nil {
+		expiresAt := *u.TokenExpiresAt
+		u.TokenExpiresAt = &expiresAt
+	}
+	return &u
+}
+
+// copyActivity copies a, dropping coordinates the SQL stores can't keep either.
+func copyActivity(a models.UserActivity) models.UserActivity {
+	a.StartLatLng = latLng(latLngValues(a.StartLatLng))
+	a.EndLatLng = latLng(latLngValues(a.EndLatLng))
+	return a
+}
+
+// sortedUsers returns the users in id order. The caller holds m.mu.
+func (m *MemoryStore) sortedUsers() []models.User {
+	users := make([]models.User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	slices.SortFunc(users, func(a, b models.User) int { return cmp.Compare(a.ID, b.ID) })
+	return users
+}
+
+func (m *MemoryStore) GetAllUsers(_ context.Context) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var users []*models.User
+	for _, u := range m.sortedUsers() {
+		users = append(users, copyUser(u))
+	}
+	return users, nil
+}
+
+// findUser returns the first user, in id order, matching. The caller holds m.mu.
+func (m *MemoryStore) findUser(matches func(u models.User) bool) (*models.User, error) {
+	for _, u := range m.sortedUsers() {
+		if matches(u) {
+			return copyUser(u), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetUserByChatId(_ context.Context, chatId int64) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.findUser(func(u models.User) bool { return u.TelegramChatId == chatId })
+}
+
+func (m *MemoryStore) GetUserById(_ context.Context, id int64) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyUser(u), nil
+}
+
+func (m *MemoryStore) GetUserByStravaId(_ context.Context, stravaId int64) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.findUser(func(u models.User) bool { return u.StravaId != nil && *u.StravaId == stravaId })
+}
+
+func (m *MemoryStore) IsUserExistsByChatId(ctx context.Context, chatId int64) (bool, error) {
+	_, err := m.GetUserByChatId(ctx, chatId)
+	return err == nil, nil
+}
+
+// CreateUser adds the user, or updates the user of the same chat like SQLiteStore does,
+// keeping its id and Strava id.
+func (m *MemoryStore) CreateUser(_ context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *copyUser(*user)
+	if stored.Username == "" {
+		stored.Username = "anonymous"
+	}
+	existing, err := m.findUser(func(u models.User) bool { return u.TelegramChatId == user.TelegramChatId })
+	if err == nil {
+		stored.ID = existing.ID
+		stored.StravaId = existing.StravaId
+	} else {
+		m.lastUserId++
+		stored.ID = m.lastUserId
+	}
+	m.users[stored.ID] = stored
+	user.ID = stored.ID
+	return nil
+}
+
+func (m *MemoryStore) UpdateUser(_ context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.ID]; ok {
+		m.users[user.ID] = *copyUser(*user)
+	}
+	return nil
+}
+
+// upsertActivity stores a for userId. A merge keeps the is_updated flag and the details of a
+// stored activity like upsertActivityQuery. The caller holds m.mu.
+func (m *MemoryStore) upsertActivity(a *models.UserActivity, userId int64, merge bool) {
+	stored := copyActivity(*a)
+	stored.UserID = userId
+	if stored.ID == 0 {
+		for id := range m.activities {
+			stored.ID = max(stored.ID, id)
+		}
+		stored.ID++
+	}
+	if existing, ok := m.activities[stored.ID]; ok && merge {
+		stored.IsUpdated = stored.IsUpdated || existing.IsUpdated
+		stored.Description = cmp.Or(stored.Description, existing.Description)
+		stored.Calories = cmp.Or(stored.Calories, existing.Calories)
+		stored.DeviceName = cmp.Or(stored.DeviceName, existing.DeviceName)
+	}
+	m.activities[stored.ID] = stored
+	a.ID = stored.ID
+}
+
+func (m *MemoryStore) CreateUserActivities(ctx context.Context, activities []*models.UserActivity) error {
+	return m.UpsertActivities(ctx, activities, BatchOptions{ChunkSize: len(activities)})
+}
+
+// UpsertActivities stores every chunk of activities at once, so readers see whole chunks.
+// It stops before the next chunk once ctx is done, like the SQL stores.
+func (m *MemoryStore) UpsertActivities(ctx context.Context, activities []*models.UserActivity, opts BatchOptions) error {
+	size := opts.chunkSize()
+	for written := 0; written < len(activities); {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := activities[written:min(written+size, len(activities))]
+		m.mu.Lock()
+		for _, a := range chunk {
+			m.upsertActivity(a, a.UserID, true)
+		}
+		m.mu.Unlock()
+		written += len(chunk)
+		if opts.Progress != nil {
+			opts.Progress(written, len(activities))
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateUserActivity(_ context.Context, activity *models.UserActivity, userId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upsertActivity(activity, userId, false)
+	return nil
+}
+
+// userActivities returns the activities of the user matching, newest first. The caller holds m.mu.
+func (m *MemoryStore) userActivities(userId int64, matches func(a models.UserActivity) bool) []models.UserActivity {
+	activities := []models.UserActivity{}
+	for _, a := range m.activities {
+		if a.UserID == userId && matches(a) {
+			activities = append(activities, copyActivity(a))
+		}
+	}
+	slices.SortFunc(activities, func(a, b models.UserActivity) int {
+		if c := b.StartDate.Compare(a.StartDate); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return activities
+}
+
+func (m *MemoryStore) GetUserActivities(_ context.Context, userId int64, limit int) ([]models.UserActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var activities []models.UserActivity
+	for _, a := range m.userActivities(userId, func(models.UserActivity) bool { return true }) {
+		if len(activities) == limit {
+			break
+		}
+		activities = append(activities, a)
+	}
+	return activities, nil
+}
+
+// QueryActivities matches text like the LIKE fallback of SQLiteStore, as case-insensitive substrings.
+func (m *MemoryStore) QueryActivities(_ context.Context, q ActivityQuery) (*ActivityPage, error) {
+	var cursor *activityCursor
+	if q.Cursor != "" {
+		var err error
+		if cursor, err = decodeActivityCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	words := searchWords(strings.ToLower(q.Text))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	activities := m.userActivities(q.UserID, func(a models.UserActivity) bool {
+		switch {
+		case q.Type != "" && a.ActivityType != q.Type && a.SportType != q.Type,
+			!q.From.IsZero() && a.StartDate.Before(q.From),
+			!q.To.IsZero() && !a.StartDate.Before(q.To),
+			q.MinDistance > 0 && a.Distance < q.MinDistance,
+			q.MaxDistance > 0 && a.Distance > q.MaxDistance,
+			q.MinDuration > 0 && a.MovingTime < q.MinDuration,
+			q.MaxDuration > 0 && a.MovingTime > q.MaxDuration,
+			q.Renamed != nil && a.IsUpdated != *q.Renamed:
+			return false
+		}
+		if cursor != nil {
+			if c := a.StartDate.Compare(cursor.StartDate); c > 0 || (c == 0 && a.ID >= cursor.ID) {
+				return false
+			}
+		}
+		name, description := strings.ToLower(a.Name), strings.ToLower(a.Description)
+		for _, word := range words {
+			if !strings.Contains(name, word) && !strings.Contains(description, word) {
+				return false
+			}
+		}
+		return true
+	})
+	limit := activityQueryLimit(q.Limit)
+	if len(activities) > limit+1 {
+		activities = activities[:limit+1]
+	}
+	return newActivityPage(activities, limit), nil
+}
+
+func (m *MemoryStore) GetActivityById(_ context.Context, activityId int64) (*models.UserActivity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.activities[activityId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	a = copyActivity(a)
+	return &a, nil
+}
+
+func (m *MemoryStore) IsActivityExists(_ context.Context, activityId int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.activities[activityId]
+	return ok, nil
+}
+
+// UpdateUserActivity sets all fields but the owner of the stored activity.
+func (m *MemoryStore) UpdateUserActivity(_ context.Context, activity *models.UserActivity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.activities[activity.ID]
+	if !ok {
+		return nil
+	}
+	stored := copyActivity(*activity)
+	stored.UserID = existing.UserID
+	m.activities[activity.ID] = stored
+	return nil
+}
+
+func (m *MemoryStore) DeleteUserActivity(_ context.Context, activityId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.activities, activityId)
+	return nil
+}
+
+func (m *MemoryStore) EnqueueWebhookEvent(_ context.Context, event *models.WebhookEvent) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := webhookEventKey{event.ObjectId, event.AspectType, event.EventTime}
+	if m.eventKeys[key] {
+		return false, nil
+	}
+	m.eventKeys[key] = true
+	m.lastEventId++
+	event.ID = m.lastEventId
+	event.Status = models.WebhookEventPending
+	stored := *event
+	stored.Attempts = 0
+	stored.LastError = ""
+	m.webhookEvents = append(m.webhookEvents, stored)
+	return true, nil
+}
+
+func (m *MemoryStore) ClaimWebhookEvent(_ context.Context, now int64, leaseUntil int64) (*models.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var claimed *models.WebhookEvent
+	for i := range m.webhookEvents {
+		e := &m.webhookEvents[i]
+		due := (e.Status == models.WebhookEventPending || e.Status == models.WebhookEventProcessing) && e.NextAttemptAt <= now
+		if due && (claimed == nil || e.NextAttemptAt < claimed.NextAttemptAt) {
+			claimed = e
+		}
+	}
+	if claimed == nil {
+		return nil, nil
+	}
+	claimed.Status = models.WebhookEventProcessing
+	claimed.Attempts++
+	claimed.NextAttemptAt = leaseUntil
+	event := *claimed
+	return &event, nil
+}
+
+func (m *MemoryStore) UpdateWebhookEvent(_ context.Context, event *models.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.webhookEvents {
+		if e := &m.webhookEvents[i]; e.ID == event.ID {
+			e.Status, e.Attempts, e.NextAttemptAt, e.LastError = event.Status, event.Attempts, event.NextAttemptAt, event.LastError
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSyncState(_ context.Context, userId int64) (*models.SyncState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, ok := m.syncStates[userId]
+	if !ok {
+		return &models.SyncState{UserID: userId}, nil
+	}
+	return &state, nil
+}
+
+func (m *MemoryStore) SaveSyncState(_ context.Context, state *models.SyncState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncStates[state.UserID] = *state
+	return nil
+}
+
+func (m *MemoryStore) GetUserSettings(_ context.Context, userId int64) (*models.UserSettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	settings, ok := m.settings[userId]
+	if !ok {
+		settings = *models.DefaultUserSettings(userId)
+	}
+	settings.ActivityTypes = append([]string{}, settings.ActivityTypes...)
+	settings.Language = models.LanguageOrDefault(m.users[userId].Language)
+	return &settings, nil
+}
+
+func (m *MemoryStore) SaveUserSettings(_ context.Context, settings *models.UserSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *settings
+	stored.ActivityTypes = append([]string{}, settings.ActivityTypes...)
+	m.settings[settings.UserID] = stored
+	if u, ok := m.users[settings.UserID]; ok {
+		u.Language = settings.Language
+		m.users[settings.UserID] = u
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddNameChange(_ context.Context, change *models.NameChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change.ID = int64(len(m.nameHistory)) + 1
+	m.nameHistory = append(m.nameHistory, *change)
+	return nil
+}
+
+// newestNameChanges returns the recorded renames matching, newest first. The caller holds m.mu.
+func (m *MemoryStore) newestNameChanges(matches func(c models.NameChange) bool) []models.NameChange {
+	var changes []models.NameChange
+	for _, c := range m.nameHistory {
+		if matches(c) {
+			changes = append(changes, c)
+		}
+	}
+	slices.SortFunc(changes, func(a, b models.NameChange) int {
+		if c := cmp.Compare(b.CreatedAt, a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return changes
+}
+
+func (m *MemoryStore) GetNameHistory(_ context.Context, activityId int64) ([]models.NameChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.newestNameChanges(func(c models.NameChange) bool { return c.ActivityID == activityId }), nil
+}
+
+func (m *MemoryStore) GetLastNameChange(_ context.Context, userId int64, activityId int64) (*models.NameChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	changes := m.newestNameChanges(func(c models.NameChange) bool {
+		return c.UserID == userId && (activityId == 0 || c.ActivityID == activityId) &&
+			c.RevertedAt == 0 && c.Source != models.NameSourceRevert
+	})
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return &changes[0], nil
+}
+
+func (m *MemoryStore) MarkNameChangeReverted(_ context.Context, id int64, revertedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.nameHistory {
+		if m.nameHistory[i].ID == id {
+			m.nameHistory[i].RevertedAt = revertedAt
+		}
+	}
+	return nil
+}
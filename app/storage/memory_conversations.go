@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"stravach/app/storage/models"
+	"sync"
+)
+
+var _ ConversationRepo = (*MemoryConversations)(nil)
+
+type nameOptionsKey struct {
+	chatId     int64
+	activityId int64
+}
+
+// MemoryConversations is a ConversationRepo for a single process, e.g. tests and local runs.
+type MemoryConversations struct {
+	mu            sync.Mutex
+	conversations map[int64]models.Conversation
+	nameOptions   map[nameOptionsKey]models.NameOptions
+}
+
+func NewMemoryConversations() *MemoryConversations {
+	return &MemoryConversations{
+		conversations: map[int64]models.Conversation{},
+		nameOptions:   map[nameOptionsKey]models.NameOptions{},
+	}
+}
+
+func (m *MemoryConversations) GetConversation(_ context.Context, chatId int64, now int64) (*models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.conversations[chatId]
+	if !ok || c.ExpiresAt <= now {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+func (m *MemoryConversations) SaveConversation(_ context.Context, c *models.Conversation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversations[c.ChatID] = *c
+	return nil
+}
+
+func (m *MemoryConversations) GetNameOptions(_ context.Context, chatId int64, activityId int64, now int64) (*models.NameOptions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	options, ok := m.nameOptions[nameOptionsKey{chatId, activityId}]
+	if !ok || options.ExpiresAt <= now {
+		return nil, nil
+	}
+	options.Names = append([]string(nil), options.Names...)
+	return &options, nil
+}
+
+func (m *MemoryConversations) SaveNameOptions(_ context.Context, options *models.NameOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *options
+	stored.Names = append([]string(nil), options.Names...)
+	m.nameOptions[nameOptionsKey{options.ChatID, options.ActivityID}] = stored
+	return nil
+}
+
+func (m *MemoryConversations) DeleteNameOptions(_ context.Context, chatId int64, activityId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nameOptions, nameOptionsKey{chatId, activityId})
+	return nil
+}
+
+func (m *MemoryConversations) TakeDueNameOptions(_ context.Context, now int64) ([]models.NameOptions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []models.NameOptions
+	for key, options := range m.nameOptions {
+		if options.AutoApplyAt > 0 && options.AutoApplyAt <= now && options.ExpiresAt > now {
+			due = append(due, options)
+			delete(m.nameOptions, key)
+		}
+	}
+	return due, nil
+}
+
+func (m *MemoryConversations) DeleteExpiredConversations(_ context.Context, now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for chatId, c := range m.conversations {
+		if c.ExpiresAt <= now {
+			delete(m.conversations, chatId)
+		}
+	}
+	for key, options := range m.nameOptions {
+		if options.ExpiresAt <= now {
+			delete(m.nameOptions, key)
+		}
+	}
+	return nil
+}
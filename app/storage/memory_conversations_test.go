@@ -0,0 +1,7 @@
+package storage
+
+import "testing"
+
+func TestMemoryConversations(t *testing.T) {
+	testConversationRepo(t, NewMemoryConversations())
+}
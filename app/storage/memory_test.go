@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"stravach/app/storage/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+func TestMemoryStore_ConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	user := createTestUser(t, store, 555)
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			activity := &models.UserActivity{ID: id, UserID: user.ID, Name: fmt.Sprintf("Run %d", id), StartDate: start.Add(time.Duration(id) * time.Hour)}
+			require.NoError(t, store.CreateUserActivities(ctx, []*models.UserActivity{activity}))
+			_, err := store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Text: "run"})
+			require.NoError(t, err)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	page, err := store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Limit: MaxActivityQueryLimit})
+	require.NoError(t, err)
+	require.Len(t, page.Activities, 50)
+}
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	user := createTestUser(t, store, 555)
+	activity := &models.UserActivity{ID: 1, UserID: user.ID, Name: "Morning Run", StartLatLng: []float64{52.52, 13.405}}
+	require.NoError(t, store.CreateUserActivity(ctx, activity, user.ID))
+	activity.StartLatLng[0] = 0
+
+	stored, err := store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	stored.Name = "Changed"
+	*user.StravaId = 1
+
+	again, err := store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "Morning Run", again.Name)
+	require.Equal(t, []float64{52.52, 13.405}, again.StartLatLng)
+	storedUser, err := store.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(5550), *storedUser.StravaId)
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const (
+	dialectSQLite   = "sqlite"
+	dialectPostgres = "postgres"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer build.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change, read from migrations/<dialect>/<version>_<name>.{up,down}.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration with the time it was applied, 0 while pending.
+// Known is false for versions the database has but this build doesn't.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt int64
+	Known     bool
+}
+
+// Migrator applies the embedded migrations of a dialect and records them in schema_migrations.
+type Migrator struct {
+	DB         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+func newMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// NewMigrator opens the database selected by dsn like NewStore, without migrating it.
+func NewMigrator(dsn string) (*Migrator, error) {
+	store := storeForDSN(dsn, nil)
+	if err := store.open(); err != nil {
+		return nil, err
+	}
+	return store.migrator()
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", dir, entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the newest version this build knows.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the newest applied version, 0 for an empty database.
+func (m *Migrator) Version() (int, error) {
+	if err := m.createMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// Status lists the known migrations and any unknown ones the database has applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name, Known: true}
+		if a, ok := applied[migration.Version]; ok {
+			status.AppliedAt = a.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range applied {
+		statuses = append(statuses, a)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies pending migrations up to target, or all of them when target is 0.
+// It returns the applied migrations and fails with ErrSchemaTooNew on a newer database.
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if target == 0 {
+		target = m.Latest()
+	}
+	version, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version > m.Latest() {
+		return nil, fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, version, m.Latest())
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		ok, err := m.run(migration, true)
+		if err != nil {
+			return done, err
+		}
+		if ok {
+			slog.Info("applied migration", "version", migration.Version, "name", migration.Name)
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down reverts the newest steps applied migrations and returns them.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		ok, err := m.run(migration, false)
+		if err != nil {
+			return done, err
+		}
+		if ok {
+			slog.Info("reverted migration", "version", migration.Version, "name", migration.Name)
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// run applies or reverts one migration in a transaction. It returns false when another
+// process did it first.
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if m.dialect == dialectPostgres {
+		if _, err = tx.Exec(`LOCK TABLE schema_migrations IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return false, err
+		}
+	}
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(1) FROM schema_migrations WHERE version = `+m.placeholder(1), migration.Version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if (count > 0) == up {
+		return false, nil
+	}
+	script := migration.Up
+	if !up {
+		script = migration.Down
+	}
+	if _, err = tx.Exec(script); err != nil {
+		return false, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (`+m.placeholder(1)+`, `+m.placeholder(2)+`, `+m.placeholder(3)+`)`,
+			migration.Version, migration.Name, time.Now().Unix())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = `+m.placeholder(1), migration.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (m *Migrator) applied() (map[int]MigrationStatus, error) {
+	if err := m.createMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var s MigrationStatus
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) createMigrationsTable() error {
+	_, err := m.DB.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+      version INTEGER PRIMARY KEY,
+      name TEXT NOT NULL,
+      applied_at BIGINT NOT NULL
+    );
+  `)
+	return err
+}
+
+func (m *Migrator) placeholder(n int) string {
+	if m.dialect == dialectPostgres {
+		return postgresPlaceholder(n)
+	}
+	return sqlitePlaceholder(n)
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSQLiteTestMigrator(t *testing.T) *Migrator {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	db.SetMaxOpenConns(1)
+	m, err := newMigrator(db, dialectSQLite)
+	require.NoError(t, err)
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count))
+	return count > 0
+}
+
+func TestLoadMigrations_DialectsInStep(t *testing.T) {
+	sqlite, err := loadMigrations(dialectSQLite)
+	require.NoError(t, err)
+	postgres, err := loadMigrations(dialectPostgres)
+	require.NoError(t, err)
+	require.Equal(t, len(sqlite), len(postgres))
+	for i := range sqlite {
+		require.Equal(t, i+1, sqlite[i].Version)
+		require.Equal(t, sqlite[i].Version, postgres[i].Version)
+		require.Equal(t, sqlite[i].Name, postgres[i].Name)
+	}
+}
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+	m := newSQLiteTestMigrator(t)
+
+	applied, err := m.Up(1)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	version, err := m.Version()
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, m.Latest())
+	require.NotZero(t, statuses[0].AppliedAt)
+	require.Zero(t, statuses[1].AppliedAt)
+
+	applied, err = m.Up(0)
+	require.NoError(t, err)
+	require.Len(t, applied, m.Latest()-1)
+	require.True(t, tableExists(t, m.DB, "webhook_events"))
+
+	applied, err = m.Up(0)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	reverted, err := m.Down(m.Latest() - 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, m.Latest()-1)
+	require.False(t, tableExists(t, m.DB, "webhook_events"))
+	require.True(t, tableExists(t, m.DB, "users"))
+	version, err = m.Version()
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+}
+
+func TestMigrator_RefusesNewerSchema(t *testing.T) {
+	m := newSQLiteTestMigrator(t)
+	_, err := m.Up(0)
+	require.NoError(t, err)
+	_, err = m.DB.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', 1)`, m.Latest()+1)
+	require.NoError(t, err)
+
+	_, err = m.Up(0)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+	require.ErrorIs(t, migrate(&SQLiteStore{DB: m.DB}), ErrSchemaTooNew)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.False(t, statuses[len(statuses)-1].Known)
+}
+
+func TestMigrator_AdoptsDatabaseWithoutMigrations(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteTestMigrator(t)
+	_, err := m.DB.Exec(`
+    CREATE TABLE users (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      strava_id INTEGER,
+      telegram_chat_id INTEGER UNIQUE NOT NULL,
+      username TEXT,
+      email TEXT,
+      strava_refresh_token TEXT,
+      strava_access_token TEXT,
+      strava_access_code TEXT,
+      token_expires_at INTEGER,
+      language TEXT,
+      is_admin INTEGER DEFAULT 0
+    );
+    INSERT INTO users (telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, language)
+    VALUES (555, 'runner', '', '', '', '', 'English');
+  `)
+	require.NoError(t, err)
+
+	require.NoError(t, migrate(&SQLiteStore{DB: m.DB}))
+	user, err := (&SQLiteStore{DB: m.DB}).GetUserByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.Equal(t, "runner", user.Username)
+}
@@ -0,0 +1,2 @@
+DROP TABLE user_activities;
+DROP TABLE users;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS users (
+  id BIGSERIAL PRIMARY KEY,
+  strava_id BIGINT,
+  telegram_chat_id BIGINT UNIQUE NOT NULL,
+  username TEXT,
+  email TEXT,
+  strava_refresh_token TEXT,
+  strava_access_token TEXT,
+  strava_access_code TEXT,
+  token_expires_at BIGINT,
+  language TEXT,
+  is_admin BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS user_activities (
+  id BIGINT PRIMARY KEY,
+  name TEXT,
+  user_id BIGINT NOT NULL REFERENCES users(id),
+  distance DOUBLE PRECISION,
+  moving_time BIGINT,
+  elapsed_time BIGINT,
+  type TEXT,
+  start_date TIMESTAMPTZ,
+  average_heartrate DOUBLE PRECISION,
+  average_speed DOUBLE PRECISION,
+  is_updated BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS webhook_events (
+  id BIGSERIAL PRIMARY KEY,
+  object_type TEXT NOT NULL,
+  object_id BIGINT NOT NULL,
+  aspect_type TEXT NOT NULL,
+  owner_id BIGINT NOT NULL,
+  event_time BIGINT NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at BIGINT NOT NULL,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at BIGINT NOT NULL,
+  UNIQUE(object_id, aspect_type, event_time)
+);
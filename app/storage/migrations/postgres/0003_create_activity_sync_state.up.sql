@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS activity_sync_state (
+  user_id BIGINT PRIMARY KEY REFERENCES users(id),
+  latest_start_date BIGINT NOT NULL DEFAULT 0,
+  backfill_before BIGINT NOT NULL DEFAULT 0,
+  backfill_completed_at BIGINT NOT NULL DEFAULT 0,
+  updated_at BIGINT NOT NULL
+);
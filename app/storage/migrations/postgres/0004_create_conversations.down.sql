@@ -0,0 +1,2 @@
+DROP TABLE name_options;
+DROP TABLE conversations;
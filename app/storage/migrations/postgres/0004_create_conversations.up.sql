@@ -0,0 +1,17 @@
+CREATE TABLE conversations (
+  chat_id BIGINT PRIMARY KEY,
+  activity_id BIGINT NOT NULL,
+  awaiting_prompt BOOLEAN NOT NULL DEFAULT FALSE,
+  expires_at BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE name_options (
+  chat_id BIGINT NOT NULL,
+  activity_id BIGINT NOT NULL,
+  names TEXT NOT NULL,
+  expires_at BIGINT NOT NULL,
+  PRIMARY KEY (chat_id, activity_id)
+);
+
+CREATE INDEX name_options_expires_at ON name_options(expires_at);
@@ -0,0 +1,15 @@
+CREATE TABLE activity_name_history (
+  id BIGSERIAL PRIMARY KEY,
+  activity_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  old_name TEXT NOT NULL,
+  new_name TEXT NOT NULL,
+  source TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  reverted_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX activity_name_history_user ON activity_name_history(user_id, created_at);
+CREATE INDEX activity_name_history_activity ON activity_name_history(activity_id, created_at);
+
+ALTER TABLE name_options ADD COLUMN source TEXT NOT NULL DEFAULT 'ai_option';
@@ -0,0 +1,24 @@
+ALTER TABLE user_activities DROP COLUMN private;
+ALTER TABLE user_activities DROP COLUMN manual;
+ALTER TABLE user_activities DROP COLUMN commute;
+ALTER TABLE user_activities DROP COLUMN trainer;
+ALTER TABLE user_activities DROP COLUMN timezone;
+ALTER TABLE user_activities DROP COLUMN device_name;
+ALTER TABLE user_activities DROP COLUMN gear_id;
+ALTER TABLE user_activities DROP COLUMN calories;
+ALTER TABLE user_activities DROP COLUMN kilojoules;
+ALTER TABLE user_activities DROP COLUMN weighted_average_watts;
+ALTER TABLE user_activities DROP COLUMN average_watts;
+ALTER TABLE user_activities DROP COLUMN average_cadence;
+ALTER TABLE user_activities DROP COLUMN max_heartrate;
+ALTER TABLE user_activities DROP COLUMN max_speed;
+ALTER TABLE user_activities DROP COLUMN summary_polyline;
+ALTER TABLE user_activities DROP COLUMN end_lng;
+ALTER TABLE user_activities DROP COLUMN end_lat;
+ALTER TABLE user_activities DROP COLUMN start_lng;
+ALTER TABLE user_activities DROP COLUMN start_lat;
+ALTER TABLE user_activities DROP COLUMN elev_low;
+ALTER TABLE user_activities DROP COLUMN elev_high;
+ALTER TABLE user_activities DROP COLUMN total_elevation_gain;
+ALTER TABLE user_activities DROP COLUMN sport_type;
+ALTER TABLE user_activities DROP COLUMN description;
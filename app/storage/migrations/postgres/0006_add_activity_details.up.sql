@@ -0,0 +1,24 @@
+ALTER TABLE user_activities ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN sport_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN total_elevation_gain DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN elev_high DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN elev_low DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN start_lat DOUBLE PRECISION;
+ALTER TABLE user_activities ADD COLUMN start_lng DOUBLE PRECISION;
+ALTER TABLE user_activities ADD COLUMN end_lat DOUBLE PRECISION;
+ALTER TABLE user_activities ADD COLUMN end_lng DOUBLE PRECISION;
+ALTER TABLE user_activities ADD COLUMN summary_polyline TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN max_speed DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN max_heartrate DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN average_cadence DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN average_watts DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN weighted_average_watts DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN kilojoules DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN calories DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN gear_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN device_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN trainer BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_activities ADD COLUMN commute BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_activities ADD COLUMN manual BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_activities ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+DROP INDEX user_activities_user_start_date;
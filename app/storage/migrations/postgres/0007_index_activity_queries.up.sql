@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS user_activities_user_start_date ON user_activities(user_id, start_date);
@@ -0,0 +1,9 @@
+CREATE TABLE user_settings (
+  user_id BIGINT PRIMARY KEY,
+  rename_mode TEXT NOT NULL DEFAULT 'manual',
+  rename_timeout INTEGER NOT NULL DEFAULT 30,
+  updated_at BIGINT NOT NULL
+);
+
+ALTER TABLE name_options ADD COLUMN auto_apply_at BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX name_options_auto_apply_at ON name_options(auto_apply_at);
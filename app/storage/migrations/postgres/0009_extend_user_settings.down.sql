@@ -0,0 +1,7 @@
+ALTER TABLE user_settings DROP COLUMN timezone;
+ALTER TABLE user_settings DROP COLUMN quiet_hours_end;
+ALTER TABLE user_settings DROP COLUMN quiet_hours_start;
+ALTER TABLE user_settings DROP COLUMN min_distance;
+ALTER TABLE user_settings DROP COLUMN activity_types;
+ALTER TABLE user_settings DROP COLUMN naming_style;
+ALTER TABLE user_settings DROP COLUMN units;
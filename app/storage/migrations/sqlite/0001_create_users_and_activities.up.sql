@@ -0,0 +1,29 @@
+-- IF NOT EXISTS adopts databases created before migrations existed.
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  strava_id INTEGER,
+  telegram_chat_id INTEGER UNIQUE NOT NULL,
+  username TEXT,
+  email TEXT,
+  strava_refresh_token TEXT,
+  strava_access_token TEXT,
+  strava_access_code TEXT,
+  token_expires_at INTEGER,
+  language TEXT,
+  is_admin INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS user_activities (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR,
+  user_id INTEGER NOT NULL,
+  distance REAL,
+  moving_time INTEGER,
+  elapsed_time INTEGER,
+  type TEXT,
+  start_date DATETIME,
+  average_heartrate REAL,
+  average_speed REAL,
+  is_updated INTEGER DEFAULT 0,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
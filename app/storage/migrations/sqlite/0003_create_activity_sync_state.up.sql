@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS activity_sync_state (
+  user_id INTEGER PRIMARY KEY,
+  latest_start_date INTEGER NOT NULL DEFAULT 0,
+  backfill_before INTEGER NOT NULL DEFAULT 0,
+  backfill_completed_at INTEGER NOT NULL DEFAULT 0,
+  updated_at INTEGER NOT NULL,
+  FOREIGN KEY(user_id) REFERENCES users(id)
+);
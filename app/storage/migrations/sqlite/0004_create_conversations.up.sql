@@ -0,0 +1,17 @@
+CREATE TABLE conversations (
+  chat_id INTEGER PRIMARY KEY,
+  activity_id INTEGER NOT NULL,
+  awaiting_prompt INTEGER NOT NULL DEFAULT 0,
+  expires_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE name_options (
+  chat_id INTEGER NOT NULL,
+  activity_id INTEGER NOT NULL,
+  names TEXT NOT NULL,
+  expires_at INTEGER NOT NULL,
+  PRIMARY KEY (chat_id, activity_id)
+);
+
+CREATE INDEX name_options_expires_at ON name_options(expires_at);
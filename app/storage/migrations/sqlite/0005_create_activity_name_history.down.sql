@@ -0,0 +1,2 @@
+ALTER TABLE name_options DROP COLUMN source;
+DROP TABLE activity_name_history;
@@ -0,0 +1,24 @@
+ALTER TABLE user_activities ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN sport_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN total_elevation_gain REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN elev_high REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN elev_low REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN start_lat REAL;
+ALTER TABLE user_activities ADD COLUMN start_lng REAL;
+ALTER TABLE user_activities ADD COLUMN end_lat REAL;
+ALTER TABLE user_activities ADD COLUMN end_lng REAL;
+ALTER TABLE user_activities ADD COLUMN summary_polyline TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN max_speed REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN max_heartrate REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN average_cadence REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN average_watts REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN weighted_average_watts REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN kilojoules REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN calories REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN gear_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN device_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_activities ADD COLUMN trainer INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN commute INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN manual INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_activities ADD COLUMN private INTEGER NOT NULL DEFAULT 0;
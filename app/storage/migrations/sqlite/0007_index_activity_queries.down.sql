@@ -0,0 +1,6 @@
+-- The full-text index is created at runtime when SQLite has FTS5, see setupActivityFTS.
+DROP TRIGGER IF EXISTS user_activities_fts_insert;
+DROP TRIGGER IF EXISTS user_activities_fts_delete;
+DROP TRIGGER IF EXISTS user_activities_fts_update;
+DROP TABLE IF EXISTS user_activities_fts;
+DROP INDEX user_activities_user_start_date;
@@ -0,0 +1,3 @@
+DROP INDEX name_options_auto_apply_at;
+ALTER TABLE name_options DROP COLUMN auto_apply_at;
+DROP TABLE user_settings;
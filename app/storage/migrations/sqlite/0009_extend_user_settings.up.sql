@@ -0,0 +1,7 @@
+ALTER TABLE user_settings ADD COLUMN units TEXT NOT NULL DEFAULT 'metric';
+ALTER TABLE user_settings ADD COLUMN naming_style TEXT NOT NULL DEFAULT 'funny';
+ALTER TABLE user_settings ADD COLUMN activity_types TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE user_settings ADD COLUMN min_distance REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN quiet_hours_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN quiet_hours_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
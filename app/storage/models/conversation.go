@@ -0,0 +1,23 @@
+package models
+
+// Conversation is the rename dialog of a chat: the activity its next text message refers to.
+type Conversation struct {
+	ChatID     int64
+	ActivityID int64
+	// AwaitingPrompt is set after the Custom button, until the prompt arrives.
+	AwaitingPrompt bool
+	ExpiresAt      int64
+	UpdatedAt      int64
+}
+
+// NameOptions are the generated names offered for an activity, picked by the numbered buttons.
+type NameOptions struct {
+	ChatID     int64
+	ActivityID int64
+	Names      []string
+	// Source is the NameSource* a pick from these names is recorded with.
+	Source    string
+	ExpiresAt int64
+	// AutoApplyAt, when set, is when the first name is applied unless one was picked before.
+	AutoApplyAt int64
+}
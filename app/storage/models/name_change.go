@@ -0,0 +1,27 @@
+package models
+
+// Sources of an activity rename.
+const (
+	// NameSourceAIOption is a generated name, picked with a button or applied by the rename mode.
+	NameSourceAIOption = "ai_option"
+	// NameSourceCustomPrompt is a name generated from a prompt the user wrote.
+	NameSourceCustomPrompt = "custom_prompt"
+	// NameSourceManual is a name the user typed in the chat.
+	NameSourceManual = "manual"
+	// NameSourceRule is a name made from the activity without AI, when names can't be generated.
+	NameSourceRule = "rule"
+	// NameSourceRevert restores the name a previous rename replaced.
+	NameSourceRevert = "revert"
+)
+
+// NameChange is one rename of an activity pushed to Strava. RevertedAt is set once it was undone.
+type NameChange struct {
+	ID         int64  `json:"id"`
+	ActivityID int64  `json:"activity_id"`
+	UserID     int64  `json:"user_id"`
+	OldName    string `json:"old_name"`
+	NewName    string `json:"new_name"`
+	Source     string `json:"source"`
+	CreatedAt  int64  `json:"created_at"`
+	RevertedAt int64  `json:"reverted_at"`
+}
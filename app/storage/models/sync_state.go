@@ -0,0 +1,13 @@
+package models
+
+// SyncState is the per-user progress of importing activities from Strava.
+// Cursors are unix timestamps of activity start dates.
+type SyncState struct {
+	UserID int64 `json:"user_id"`
+	// LatestStartDate is the start of the newest imported activity, the after cursor of incremental syncs.
+	LatestStartDate int64 `json:"latest_start_date"`
+	// BackfillBefore is the before cursor of an unfinished full backfill, 0 when none is running.
+	BackfillBefore      int64 `json:"backfill_before"`
+	BackfillCompletedAt int64 `json:"backfill_completed_at"`
+	UpdatedAt           int64 `json:"updated_at"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"log/slog"
 	"time"
 )
 
@@ -10,9 +11,9 @@ type User struct {
 	TelegramChatId     int64  `json:"telegram_chat_id"`
 	Username           string `json:"username"`
 	Email              string `json:"email"`
-	StravaRefreshToken string `json:"strava_refresh_token"`
-	StravaAccessToken  string `json:"strava_access_token"`
-	StravaAccessCode   string `json:"strava_access_code"`
+	StravaRefreshToken string `json:"-"`
+	StravaAccessToken  string `json:"-"`
+	StravaAccessCode   string `json:"-"`
 	TokenExpiresAt     *int64 `json:"token_expires_at"`
 	Language           string `json:"language"`
 	IsAdmin            bool   `json:"is_admin"`
@@ -23,6 +24,27 @@ func (u User) AuthRequired() bool {
 	return u.TokenExpiresAt == nil || (*u.TokenExpiresAt) < now
 }
 
+// LogValue keeps the Strava tokens out of logs, it only reports whether they are set.
+func (u User) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int64("id", u.ID),
+		slog.Int64("telegram_chat_id", u.TelegramChatId),
+		slog.String("username", u.Username),
+		slog.String("language", u.Language),
+		slog.Bool("is_admin", u.IsAdmin),
+		slog.Bool("has_strava_token", u.StravaAccessToken != "" || u.StravaRefreshToken != ""),
+	}
+	if u.StravaId != nil {
+		attrs = append(attrs, slog.Int64("strava_id", *u.StravaId))
+	}
+	if u.TokenExpiresAt != nil {
+		attrs = append(attrs, slog.Int64("token_expires_at", *u.TokenExpiresAt))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// UserActivity is an activity as Strava returns it, the JSON names follow the Strava API.
+// Distances are meters, times seconds, speeds meters per second.
 type UserActivity struct {
 	ID               int64     `json:"id,omitempty"`
 	UserID           int64     `json:"user_id"`
@@ -35,4 +57,34 @@ type UserActivity struct {
 	AverageHeartrate float64   `json:"average_heartrate"`
 	AverageSpeed     float64   `json:"average_speed"`
 	IsUpdated        bool      `json:"is_updated"`
+
+	Description        string  `json:"description"`
+	SportType          string  `json:"sport_type"`
+	TotalElevationGain float64 `json:"total_elevation_gain"`
+	ElevHigh           float64 `json:"elev_high"`
+	ElevLow            float64 `json:"elev_low"`
+	// StartLatLng and EndLatLng are [latitude, longitude], empty for activities without GPS.
+	StartLatLng          []float64   `json:"start_latlng"`
+	EndLatLng            []float64   `json:"end_latlng"`
+	Map                  ActivityMap `json:"map"`
+	MaxSpeed             float64     `json:"max_speed"`
+	MaxHeartrate         float64     `json:"max_heartrate"`
+	AverageCadence       float64     `json:"average_cadence"`
+	AverageWatts         float64     `json:"average_watts"`
+	WeightedAverageWatts float64     `json:"weighted_average_watts"`
+	Kilojoules           float64     `json:"kilojoules"`
+	Calories             float64     `json:"calories"`
+	GearID               string      `json:"gear_id"`
+	DeviceName           string      `json:"device_name"`
+	// Timezone is the Strava form, e.g. "(GMT+01:00) Europe/Berlin".
+	Timezone string `json:"timezone"`
+	Trainer  bool   `json:"trainer"`
+	Commute  bool   `json:"commute"`
+	Manual   bool   `json:"manual"`
+	Private  bool   `json:"private"`
+}
+
+// ActivityMap is the route of an activity as an encoded polyline.
+type ActivityMap struct {
+	SummaryPolyline string `json:"summary_polyline"`
 }
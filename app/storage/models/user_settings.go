@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	// Location needs the zone of the user also where the system has no zoneinfo
+	_ "time/tzdata"
+)
+
+// Rename modes, how a new activity gets its name.
+const (
+	// RenameModeManual offers the generated names and waits for the user to pick one.
+	RenameModeManual = "manual"
+	// RenameModeAuto applies the first generated name right away.
+	RenameModeAuto = "auto"
+	// RenameModeTimeout offers the generated names and applies the first one when none was
+	// picked within RenameTimeout minutes.
+	RenameModeTimeout = "timeout"
+)
+
+// Units, how distances are shown.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// Naming styles, the tone of the generated names.
+const (
+	NamingStyleFunny   = "funny"
+	NamingStyleSerious = "serious"
+	NamingStylePoetic  = "poetic"
+	NamingStyleShort   = "short"
+)
+
+const (
+	// DefaultRenameTimeout is the RenameTimeout of users who didn't choose one, in minutes.
+	DefaultRenameTimeout = 30
+	// MaxRenameTimeout bounds RenameTimeout, in minutes.
+	MaxRenameTimeout = 24 * 60
+	// DefaultLanguage is the language of users who didn't choose one.
+	DefaultLanguage = "English"
+	// MaxMinDistance bounds MinDistance, in meters.
+	MaxMinDistance = 1_000_000
+	// MetersPerMile converts between the units.
+	MetersPerMile = 1609.344
+)
+
+var (
+	// Languages are the languages names can be generated in.
+	Languages = []string{"English", "German", "French", "Spanish", "Italian", "Portuguese", "Dutch", "Polish", "Ukrainian", "Russian"}
+	// RenameModes are the valid values of UserSettings.RenameMode.
+	RenameModes = []string{RenameModeManual, RenameModeAuto, RenameModeTimeout}
+	// Units are the valid values of UserSettings.Units.
+	Units = []string{UnitsMetric, UnitsImperial}
+	// NamingStyles are the valid values of UserSettings.NamingStyle.
+	NamingStyles = []string{NamingStyleFunny, NamingStyleSerious, NamingStylePoetic, NamingStyleShort}
+	// ActivityTypes are the Strava activity types offered by the settings menu. Settings may
+	// name other types too.
+	ActivityTypes = []string{"Run", "TrailRun", "Ride", "VirtualRide", "Walk", "Hike", "Swim", "WeightTraining", "Yoga", "Workout"}
+)
+
+// UserSettings are the preferences of a user.
+type UserSettings struct {
+	UserID int64 `json:"user_id"`
+	// Language is kept as User.Language, one of Languages.
+	Language    string `json:"language"`
+	Units       string `json:"units"`
+	NamingStyle string `json:"naming_style"`
+	RenameMode  string `json:"rename_mode"`
+	// RenameTimeout is how many minutes RenameModeTimeout waits for a pick.
+	RenameTimeout int `json:"rename_timeout"`
+	// ActivityTypes are the types of the new activities that are renamed, all when empty.
+	ActivityTypes []string `json:"activity_types"`
+	// MinDistance is the distance in meters below which new activities aren't renamed.
+	MinDistance float64 `json:"min_distance"`
+	// QuietHoursStart and QuietHoursEnd are the hours of the day, in Timezone, during which
+	// new activities wait with their names. They are off when both are equal.
+	QuietHoursStart int `json:"quiet_hours_start"`
+	QuietHoursEnd   int `json:"quiet_hours_end"`
+	// Timezone is the IANA zone of the quiet hours, e.g. Europe/Berlin.
+	Timezone  string `json:"timezone"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// DefaultUserSettings are the settings of a user who never changed them.
+func DefaultUserSettings(userId int64) *UserSettings {
+	return &UserSettings{
+		UserID:        userId,
+		Language:      DefaultLanguage,
+		Units:         UnitsMetric,
+		NamingStyle:   NamingStyleFunny,
+		RenameMode:    RenameModeManual,
+		RenameTimeout: DefaultRenameTimeout,
+		ActivityTypes: []string{},
+		Timezone:      "UTC",
+	}
+}
+
+// Validate returns an error describing the first invalid setting.
+func (s *UserSettings) Validate() error {
+	switch {
+	case !slices.Contains(Languages, s.Language):
+		return fmt.Errorf("language must be one of %s", strings.Join(Languages, ", "))
+	case !slices.Contains(Units, s.Units):
+		return fmt.Errorf("units must be one of %s", strings.Join(Units, ", "))
+	case !slices.Contains(NamingStyles, s.NamingStyle):
+		return fmt.Errorf("naming_style must be one of %s", strings.Join(NamingStyles, ", "))
+	case !slices.Contains(RenameModes, s.RenameMode):
+		return fmt.Errorf("rename_mode must be one of %s", strings.Join(RenameModes, ", "))
+	case s.RenameTimeout < 1 || s.RenameTimeout > MaxRenameTimeout:
+		return fmt.Errorf("rename_timeout must be between 1 and %d minutes", MaxRenameTimeout)
+	case s.MinDistance < 0 || s.MinDistance > MaxMinDistance:
+		return fmt.Errorf("min_distance must be between 0 and %d meters", MaxMinDistance)
+	case s.QuietHoursStart < 0 || s.QuietHoursStart > 23 || s.QuietHoursEnd < 0 || s.QuietHoursEnd > 23:
+		return fmt.Errorf("quiet hours must be between 0 and 23")
+	}
+	for _, activityType := range s.ActivityTypes {
+		if activityType == "" || strings.ContainsFunc(activityType, func(r rune) bool { return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') }) {
+			return fmt.Errorf("activity types must be Strava types like Run or WeightTraining")
+		}
+	}
+	// LoadLocation takes "" and "Local" too
+	if _, err := time.LoadLocation(s.Timezone); err != nil || s.Timezone == "" || s.Timezone == "Local" {
+		return fmt.Errorf("timezone must be an IANA time zone, e.g. Europe/Berlin")
+	}
+	return nil
+}
+
+// FindLanguage returns the language of Languages matching name regardless of case.
+func FindLanguage(name string) (string, bool) {
+	for _, language := range Languages {
+		if strings.EqualFold(language, name) {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// LanguageOrDefault returns the language of Languages matching name, DefaultLanguage when
+// none does, e.g. for a language set before languages were validated.
+func LanguageOrDefault(name string) string {
+	if language, ok := FindLanguage(name); ok {
+		return language
+	}
+	return DefaultLanguage
+}
+
+// Renames reports whether new activities like activity are renamed, they are when their type
+// and distance pass ActivityTypes and MinDistance.
+func (s *UserSettings) Renames(activity *UserActivity) bool {
+	if len(s.ActivityTypes) > 0 && !slices.Contains(s.ActivityTypes, activity.ActivityType) {
+		return false
+	}
+	return activity.Distance >= s.MinDistance
+}
+
+// Location returns the zone of Timezone, UTC when it is unknown.
+func (s *UserSettings) Location() *time.Location {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// QuietUntil returns when the quiet hours end if now is within them.
+func (s *UserSettings) QuietUntil(now time.Time) (time.Time, bool) {
+	start, end := s.QuietHoursStart, s.QuietHoursEnd
+	if start == end {
+		return time.Time{}, false
+	}
+	local := now.In(s.Location())
+	hour := local.Hour()
+	quiet := hour >= start && hour < end
+	if start > end {
+		// e.g. 22 to 7, over midnight
+		quiet = hour >= start || hour < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end, 0, 0, 0, local.Location())
+	if !until.After(local) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, end, 0, 0, 0, local.Location())
+	}
+	return until, true
+}
+
+// FormatDistance formats meters in the units, e.g. "10.2 km" or "6.3 mi".
+func FormatDistance(meters float64, units string) string {
+	if units == UnitsImperial {
+		return fmt.Sprintf("%.1f mi", meters/MetersPerMile)
+	}
+	return fmt.Sprintf("%.1f km", meters/1000)
+}
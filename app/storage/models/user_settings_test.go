@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSettings_Validate(t *testing.T) {
+	require.NoError(t, DefaultUserSettings(1).Validate())
+
+	tests := []struct {
+		name   string
+		change func(s *UserSettings)
+	}{
+		{"language", func(s *UserSettings) { s.Language = "Klingon" }},
+		{"units", func(s *UserSettings) { s.Units = "furlongs" }},
+		{"naming style", func(s *UserSettings) { s.NamingStyle = "rude" }},
+		{"rename mode", func(s *UserSettings) { s.RenameMode = "sometimes" }},
+		{"rename timeout", func(s *UserSettings) { s.RenameTimeout = 0 }},
+		{"min distance", func(s *UserSettings) { s.MinDistance = -1 }},
+		{"quiet hours", func(s *UserSettings) { s.QuietHoursEnd = 24 }},
+		{"activity type", func(s *UserSettings) { s.ActivityTypes = []string{"Run", ""} }},
+		{"timezone", func(s *UserSettings) { s.Timezone = "Mars/Olympus" }},
+		{"local timezone", func(s *UserSettings) { s.Timezone = "Local" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := DefaultUserSettings(1)
+			tt.change(settings)
+			assert.Error(t, settings.Validate())
+		})
+	}
+}
+
+func TestUserSettings_Renames(t *testing.T) {
+	settings := DefaultUserSettings(1)
+	assert.True(t, settings.Renames(&UserActivity{ActivityType: "Yoga"}))
+
+	settings.ActivityTypes = []string{"Run", "Ride"}
+	settings.MinDistance = 2000
+	assert.True(t, settings.Renames(&UserActivity{ActivityType: "Run", Distance: 5000}))
+	assert.False(t, settings.Renames(&UserActivity{ActivityType: "Walk", Distance: 5000}))
+	assert.False(t, settings.Renames(&UserActivity{ActivityType: "Ride", Distance: 1500}))
+}
+
+func TestUserSettings_QuietUntil(t *testing.T) {
+	settings := DefaultUserSettings(1)
+	settings.Timezone = "Europe/Berlin"
+	berlin := settings.Location()
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, berlin)
+	}
+
+	_, quiet := settings.QuietUntil(at(1, 23, 0))
+	assert.False(t, quiet, "quiet hours are off by default")
+
+	settings.QuietHoursStart, settings.QuietHoursEnd = 22, 7
+	until, quiet := settings.QuietUntil(at(1, 23, 30).UTC())
+	assert.True(t, quiet)
+	assert.True(t, at(2, 7, 0).Equal(until), until)
+	until, quiet = settings.QuietUntil(at(2, 3, 0))
+	assert.True(t, quiet)
+	assert.True(t, at(2, 7, 0).Equal(until), until)
+	_, quiet = settings.QuietUntil(at(2, 7, 0))
+	assert.False(t, quiet)
+
+	settings.QuietHoursStart, settings.QuietHoursEnd = 13, 15
+	until, quiet = settings.QuietUntil(at(1, 14, 0))
+	assert.True(t, quiet)
+	assert.True(t, at(1, 15, 0).Equal(until), until)
+	_, quiet = settings.QuietUntil(at(1, 12, 59))
+	assert.False(t, quiet)
+}
+
+func TestFindLanguage(t *testing.T) {
+	language, ok := FindLanguage("german")
+	assert.True(t, ok)
+	assert.Equal(t, "German", language)
+	_, ok = FindLanguage("Klingon")
+	assert.False(t, ok)
+	assert.Equal(t, "French", LanguageOrDefault("FRENCH"))
+	assert.Equal(t, DefaultLanguage, LanguageOrDefault("en"))
+}
+
+func TestFormatDistance(t *testing.T) {
+	assert.Equal(t, "10.0 km", FormatDistance(10000, UnitsMetric))
+	assert.Equal(t, "6.2 mi", FormatDistance(10000, UnitsImperial))
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser_LogValueRedactsTokens(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&out, nil))
+	stravaId := int64(42)
+	user := &User{ID: 1, StravaId: &stravaId, TelegramChatId: 555, StravaRefreshToken: "refresh-secret", StravaAccessToken: "access-secret", StravaAccessCode: "code-secret"}
+
+	logger.Info("updating user", "user", user)
+
+	require.NotContains(t, out.String(), "secret")
+	require.Contains(t, out.String(), `"strava_id":42`)
+	require.Contains(t, out.String(), `"has_strava_token":true`)
+}
@@ -0,0 +1,25 @@
+package models
+
+const (
+	WebhookEventPending    = "pending"
+	WebhookEventProcessing = "processing"
+	WebhookEventDone       = "done"
+	WebhookEventDead       = "dead"
+)
+
+// WebhookEvent is a Strava push event persisted for asynchronous processing.
+// Payload keeps the raw JSON body as received from Strava.
+type WebhookEvent struct {
+	ID            int64  `json:"id"`
+	ObjectType    string `json:"object_type"`
+	ObjectId      int64  `json:"object_id"`
+	AspectType    string `json:"aspect_type"`
+	OwnerId       int64  `json:"owner_id"`
+	EventTime     int64  `json:"event_time"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	LastError     string `json:"last_error"`
+	CreatedAt     int64  `json:"created_at"`
+}
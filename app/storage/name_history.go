@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// NameHistoryRepo records the renames pushed to Strava, so they can be undone.
+type NameHistoryRepo interface {
+	// AddNameChange records a rename and sets change.ID.
+	AddNameChange(ctx context.Context, change *models.NameChange) error
+	// GetNameHistory returns the renames of the activity, newest first.
+	GetNameHistory(ctx context.Context, activityId int64) ([]models.NameChange, error)
+	// GetLastNameChange returns the newest rename of the user that can still be undone,
+	// limited to one activity unless activityId is 0. It returns nil when there is none.
+	GetLastNameChange(ctx context.Context, userId int64, activityId int64) (*models.NameChange, error)
+	MarkNameChangeReverted(ctx context.Context, id int64, revertedAt int64) error
+}
+
+const nameChangeColumns = `id, activity_id, user_id, old_name, new_name, source, created_at, reverted_at`
+
+func scanNameChange(row interface{ Scan(...any) error }) (*models.NameChange, error) {
+	c := &models.NameChange{}
+	err := row.Scan(&c.ID, &c.ActivityID, &c.UserID, &c.OldName, &c.NewName, &c.Source, &c.CreatedAt, &c.RevertedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func queryNameHistory(ctx context.Context, db *sql.DB, query string, activityId int64) ([]models.NameChange, error) {
+	rows, err := db.QueryContext(ctx, query, activityId)
+	if err != nil {
+		slog.Error("error while fetching name history", "activityId", activityId)
+		return nil, err
+	}
+	defer rows.Close()
+	var history []models.NameChange
+	for rows.Next() {
+		c, err := scanNameChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *c)
+	}
+	return history, rows.Err()
+}
+
+func queryLastNameChange(row *sql.Row, userId int64) (*models.NameChange, error) {
+	c, err := scanNameChange(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching last name change", "userId", userId)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) AddNameChange(ctx context.Context, change *models.NameChange) error {
+	query := `
+    INSERT INTO activity_name_history (activity_id, user_id, old_name, new_name, source, created_at, reverted_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    RETURNING id
+  `
+	err := s.DB.QueryRowContext(ctx, query, change.ActivityID, change.UserID, change.OldName, change.NewName, change.Source, change.CreatedAt, change.RevertedAt).Scan(&change.ID)
+	if err != nil {
+		slog.Error("error while saving name change", "activityId", change.ActivityID)
+	}
+	return err
+}
+
+func (s *SQLiteStore) GetNameHistory(ctx context.Context, activityId int64) ([]models.NameChange, error) {
+	query := `SELECT ` + nameChangeColumns + ` FROM activity_name_history WHERE activity_id = ? ORDER BY created_at DESC, id DESC`
+	return queryNameHistory(ctx, s.DB, query, activityId)
+}
+
+func (s *SQLiteStore) GetLastNameChange(ctx context.Context, userId int64, activityId int64) (*models.NameChange, error) {
+	query := `
+    SELECT ` + nameChangeColumns + ` FROM activity_name_history
+    WHERE user_id = ? AND (? = 0 OR activity_id = ?) AND reverted_at = 0 AND source <> ?
+    ORDER BY created_at DESC, id DESC
+    LIMIT 1
+  `
+	return queryLastNameChange(s.DB.QueryRowContext(ctx, query, userId, activityId, activityId, models.NameSourceRevert), userId)
+}
+
+func (s *SQLiteStore) MarkNameChangeReverted(ctx context.Context, id int64, revertedAt int64) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE activity_name_history SET reverted_at = ? WHERE id = ?`, revertedAt, id)
+	if err != nil {
+		slog.Error("error while marking name change reverted", "id", id)
+	}
+	return err
+}
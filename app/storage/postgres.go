@@ -0,0 +1,502 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravach/app/storage/models"
+
+	_ "github.com/lib/pq"
+)
+
+var _ Store = (*PostgresStore)(nil)
+
+// PostgresStore keeps the same data as SQLiteStore in Postgres, so several replicas can share it.
+type PostgresStore struct {
+	DB  *sql.DB
+	DSN string
+	// Keys encrypts the Strava tokens of users, nil keeps them in plaintext.
+	Keys *Keyring
+}
+
+func (s *PostgresStore) Connect() error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	return migrate(s)
+}
+
+func (s *PostgresStore) open() error {
+	db, err := sql.Open("postgres", s.DSN)
+	if err != nil {
+		slog.Error("cannot open postgres connection")
+		return err
+	}
+	if err = db.Ping(); err != nil {
+		slog.Error("cannot reach postgres", "err", err)
+		_ = db.Close()
+		return err
+	}
+	s.DB = db
+	return nil
+}
+
+func (s *PostgresStore) migrator() (*Migrator, error) {
+	return newMigrator(s.DB, dialectPostgres)
+}
+
+// RotateKeys re-encrypts user tokens with the primary key of s.Keys.
+func (s *PostgresStore) RotateKeys() (int, error) {
+	return rotateKeys(s.DB, s.Keys, `
+    UPDATE users SET strava_refresh_token = $1, strava_access_token = $2, strava_access_code = $3
+    WHERE id = $4 AND strava_refresh_token = $5 AND strava_access_token = $6 AND strava_access_code = $7
+  `)
+}
+
+func (s *PostgresStore) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []*models.User
+	for rows.Next() {
+		u, err := scanUser(rows, s.Keys)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *PostgresStore) CreateUser(ctx context.Context, user *models.User) error {
+	username := "anonymous"
+	if user.Username != "" {
+		username = user.Username
+	}
+	tokens, err := s.Keys.sealUser(user)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO users (
+			strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT(telegram_chat_id) DO UPDATE SET
+			username = excluded.username,
+			email = excluded.email,
+			strava_refresh_token = excluded.strava_refresh_token,
+			strava_access_token = excluded.strava_access_token,
+			strava_access_code = excluded.strava_access_code,
+			token_expires_at = excluded.token_expires_at,
+			language = excluded.language,
+			is_admin = excluded.is_admin
+		RETURNING id
+	`
+	err = s.DB.QueryRowContext(ctx, query, user.StravaId, user.TelegramChatId, username, user.Email, tokens.RefreshToken, tokens.AccessToken, tokens.AccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin).Scan(&user.ID)
+	if err != nil {
+		slog.Error("error while creating user", "err", err, "strava_id", user.StravaId, "telegram_chat_id", user.TelegramChatId, "username", username)
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetUserByChatId(ctx context.Context, chatId int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE telegram_chat_id = $1`, chatId), s.Keys)
+	if err != nil {
+		slog.Error("error while fetching user chat by id", "id", chatId)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *PostgresStore) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id), s.Keys)
+	if err != nil {
+		slog.Error("error while fetching user by id", "id", id)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *PostgresStore) GetUserByStravaId(ctx context.Context, id int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE strava_id = $1`, id), s.Keys)
+	if err != nil {
+		slog.Error("error while fetching user by strava id", "id", id)
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *PostgresStore) IsUserExistsByChatId(ctx context.Context, chatId int64) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE telegram_chat_id = $1)`, chatId).Scan(&exists)
+	if err != nil {
+		slog.Error("error while checking if user exists", "id", chatId)
+		return false, err
+	}
+	return exists, nil
+}
+
+func (s *PostgresStore) UpdateUser(ctx context.Context, user *models.User) error {
+	tokens, err := s.Keys.sealUser(user)
+	if err != nil {
+		return err
+	}
+	query := `
+    UPDATE users
+    SET strava_id = $1, telegram_chat_id = $2, username = $3, email = $4,
+      strava_refresh_token = $5, strava_access_token = $6, strava_access_code = $7, token_expires_at = $8, language = $9, is_admin = $10
+    WHERE id = $11
+  `
+	_, err = s.DB.ExecContext(ctx, query, user.StravaId, user.TelegramChatId, user.Username, user.Email,
+		tokens.RefreshToken, tokens.AccessToken, tokens.AccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin, user.ID)
+	return err
+}
+
+func (s *PostgresStore) CreateUserActivities(ctx context.Context, activities []*models.UserActivity) error {
+	return s.UpsertActivities(ctx, activities, BatchOptions{ChunkSize: len(activities)})
+}
+
+func (s *PostgresStore) UpsertActivities(ctx context.Context, activities []*models.UserActivity, opts BatchOptions) error {
+	query := upsertActivityQuery(postgresPlaceholder, true)
+	if err := upsertActivities(ctx, s.DB, query, activities, opts); err != nil {
+		return err
+	}
+	slog.Info(fmt.Sprintf("inserted %d activities", len(activities)))
+	return nil
+}
+
+func (s *PostgresStore) CreateUserActivity(ctx context.Context, activity *models.UserActivity, userId int64) error {
+	query := upsertActivityQuery(postgresPlaceholder, false)
+	_, err := s.DB.ExecContext(ctx, query, activityValues(activity, userId)...)
+	if err != nil {
+		slog.Error("error while creating user activitiy")
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetUserActivities(ctx context.Context, userId int64, limit int) ([]models.UserActivity, error) {
+	var activities []models.UserActivity
+	query := `SELECT ` + activityColumns + ` FROM user_activities WHERE user_id = $1 ORDER BY start_date DESC LIMIT $2`
+	rows, err := s.DB.QueryContext(ctx, query, userId, limit)
+	if err != nil {
+		slog.Error("error while fetching user activities", "id", userId)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, *activity)
+	}
+	return activities, rows.Err()
+}
+
+func (s *PostgresStore) GetActivityById(ctx context.Context, activityId int64) (*models.UserActivity, error) {
+	query := `SELECT ` + activityColumns + ` FROM user_activities WHERE id = $1`
+	activity, err := scanActivity(s.DB.QueryRowContext(ctx, query, activityId))
+	if err != nil {
+		slog.Error("error while fetching user activity", "id", activityId)
+		return nil, err
+	}
+	return activity, nil
+}
+
+func (s *PostgresStore) IsActivityExists(ctx context.Context, activityId int64) (bool, error) {
+	var exists bool
+	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM user_activities WHERE id = $1)`, activityId).Scan(&exists)
+	if err != nil {
+		slog.Error("error while checking if activity exists", "id", activityId)
+		return false, err
+	}
+	return exists, nil
+}
+
+func (s *PostgresStore) UpdateUserActivity(ctx context.Context, activity *models.UserActivity) error {
+	_, err := s.DB.ExecContext(ctx, updateActivityQuery(postgresPlaceholder), updateActivityValues(activity)...)
+	if err != nil {
+		slog.Error("error while updating user activity")
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteUserActivity(ctx context.Context, activityId int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM user_activities WHERE id = $1`, activityId)
+	if err != nil {
+		slog.Error("error while deleting user activity", "id", activityId)
+		return err
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent works like SQLiteStore.EnqueueWebhookEvent.
+func (s *PostgresStore) EnqueueWebhookEvent(ctx context.Context, event *models.WebhookEvent) (bool, error) {
+	query := `
+    INSERT INTO webhook_events (
+        object_type, object_id, aspect_type, owner_id, event_time, payload, status, attempts, next_attempt_at, last_error, created_at
+    ) VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, '', $9)
+    ON CONFLICT(object_id, aspect_type, event_time) DO NOTHING
+    RETURNING id
+  `
+	event.Status = models.WebhookEventPending
+	err := s.DB.QueryRowContext(ctx, query, event.ObjectType, event.ObjectId, event.AspectType, event.OwnerId, event.EventTime,
+		event.Payload, event.Status, event.NextAttemptAt, event.CreatedAt).Scan(&event.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		slog.Error("error while enqueueing webhook event", "object_id", event.ObjectId, "aspect_type", event.AspectType)
+		return false, err
+	}
+	return true, nil
+}
+
+// ClaimWebhookEvent works like SQLiteStore.ClaimWebhookEvent. SKIP LOCKED lets workers
+// of several replicas claim events concurrently without handing one out twice.
+func (s *PostgresStore) ClaimWebhookEvent(ctx context.Context, now int64, leaseUntil int64) (*models.WebhookEvent, error) {
+	query := `
+    UPDATE webhook_events
+    SET status = $1, attempts = attempts + 1, next_attempt_at = $2
+    WHERE id = (
+        SELECT id FROM webhook_events
+        WHERE status IN ($3, $4) AND next_attempt_at <= $5
+        ORDER BY next_attempt_at, id
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING ` + webhookEventColumns
+	event := &models.WebhookEvent{}
+	err := s.DB.QueryRowContext(ctx, query, models.WebhookEventProcessing, leaseUntil, models.WebhookEventPending, models.WebhookEventProcessing, now).
+		Scan(&event.ID, &event.ObjectType, &event.ObjectId, &event.AspectType, &event.OwnerId, &event.EventTime, &event.Payload,
+			&event.Status, &event.Attempts, &event.NextAttemptAt, &event.LastError, &event.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while claiming webhook event")
+		return nil, err
+	}
+	return event, nil
+}
+
+func (s *PostgresStore) UpdateWebhookEvent(ctx context.Context, event *models.WebhookEvent) error {
+	query := `
+    UPDATE webhook_events
+    SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4
+    WHERE id = $5
+  `
+	_, err := s.DB.ExecContext(ctx, query, event.Status, event.Attempts, event.NextAttemptAt, event.LastError, event.ID)
+	if err != nil {
+		slog.Error("error while updating webhook event", "id", event.ID)
+		return err
+	}
+	return nil
+}
+
+// GetSyncState works like SQLiteStore.GetSyncState.
+func (s *PostgresStore) GetSyncState(ctx context.Context, userId int64) (*models.SyncState, error) {
+	query := `SELECT user_id, latest_start_date, backfill_before, backfill_completed_at, updated_at FROM activity_sync_state WHERE user_id = $1`
+	state := &models.SyncState{}
+	err := s.DB.QueryRowContext(ctx, query, userId).Scan(&state.UserID, &state.LatestStartDate, &state.BackfillBefore, &state.BackfillCompletedAt, &state.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.SyncState{UserID: userId}, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching sync state", "userId", userId)
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *PostgresStore) SaveSyncState(ctx context.Context, state *models.SyncState) error {
+	query := `
+    INSERT INTO activity_sync_state (user_id, latest_start_date, backfill_before, backfill_completed_at, updated_at)
+    VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT(user_id) DO UPDATE SET
+        latest_start_date = excluded.latest_start_date,
+        backfill_before = excluded.backfill_before,
+        backfill_completed_at = excluded.backfill_completed_at,
+        updated_at = excluded.updated_at
+  `
+	_, err := s.DB.ExecContext(ctx, query, state.UserID, state.LatestStartDate, state.BackfillBefore, state.BackfillCompletedAt, state.UpdatedAt)
+	if err != nil {
+		slog.Error("error while saving sync state", "userId", state.UserID)
+	}
+	return err
+}
+
+var postgresUserSettingsQueries = userSettingsQueries{
+	getLanguage: `SELECT COALESCE(language, '') FROM users WHERE id = $1`,
+	get: `
+    SELECT rename_mode, rename_timeout, units, naming_style, activity_types, min_distance,
+        quiet_hours_start, quiet_hours_end, timezone, updated_at
+    FROM user_settings WHERE user_id = $1`,
+	saveLanguage: `UPDATE users SET language = $1 WHERE id = $2`,
+	save: `
+    INSERT INTO user_settings (user_id, rename_mode, rename_timeout, units, naming_style, activity_types,
+        min_distance, quiet_hours_start, quiet_hours_end, timezone, updated_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    ON CONFLICT(user_id) DO UPDATE SET
+        rename_mode = excluded.rename_mode,
+        rename_timeout = excluded.rename_timeout,
+        units = excluded.units,
+        naming_style = excluded.naming_style,
+        activity_types = excluded.activity_types,
+        min_distance = excluded.min_distance,
+        quiet_hours_start = excluded.quiet_hours_start,
+        quiet_hours_end = excluded.quiet_hours_end,
+        timezone = excluded.timezone,
+        updated_at = excluded.updated_at
+  `,
+}
+
+// GetUserSettings works like SQLiteStore.GetUserSettings.
+func (s *PostgresStore) GetUserSettings(ctx context.Context, userId int64) (*models.UserSettings, error) {
+	return getUserSettings(ctx, s.DB, postgresUserSettingsQueries, userId)
+}
+
+func (s *PostgresStore) SaveUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	return saveUserSettings(ctx, s.DB, postgresUserSettingsQueries, settings)
+}
+
+func (s *PostgresStore) GetConversation(ctx context.Context, chatId int64, now int64) (*models.Conversation, error) {
+	query := `SELECT chat_id, activity_id, awaiting_prompt, expires_at, updated_at FROM conversations WHERE chat_id = $1 AND expires_at > $2`
+	c := &models.Conversation{}
+	err := s.DB.QueryRowContext(ctx, query, chatId, now).Scan(&c.ChatID, &c.ActivityID, &c.AwaitingPrompt, &c.ExpiresAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching conversation", "chatId", chatId)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *PostgresStore) SaveConversation(ctx context.Context, c *models.Conversation) error {
+	query := `
+    INSERT INTO conversations (chat_id, activity_id, awaiting_prompt, expires_at, updated_at)
+    VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT(chat_id) DO UPDATE SET
+        activity_id = excluded.activity_id,
+        awaiting_prompt = excluded.awaiting_prompt,
+        expires_at = excluded.expires_at,
+        updated_at = excluded.updated_at
+  `
+	_, err := s.DB.ExecContext(ctx, query, c.ChatID, c.ActivityID, c.AwaitingPrompt, c.ExpiresAt, c.UpdatedAt)
+	if err != nil {
+		slog.Error("error while saving conversation", "chatId", c.ChatID)
+	}
+	return err
+}
+
+func (s *PostgresStore) GetNameOptions(ctx context.Context, chatId int64, activityId int64, now int64) (*models.NameOptions, error) {
+	query := `SELECT names, source, expires_at, auto_apply_at FROM name_options WHERE chat_id = $1 AND activity_id = $2 AND expires_at > $3`
+	return scanNameOptions(s.DB.QueryRowContext(ctx, query, chatId, activityId, now), chatId, activityId)
+}
+
+func (s *PostgresStore) SaveNameOptions(ctx context.Context, options *models.NameOptions) error {
+	names, err := json.Marshal(options.Names)
+	if err != nil {
+		return err
+	}
+	query := `
+    INSERT INTO name_options (chat_id, activity_id, names, source, expires_at, auto_apply_at)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    ON CONFLICT(chat_id, activity_id) DO UPDATE SET
+        names = excluded.names,
+        source = excluded.source,
+        expires_at = excluded.expires_at,
+        auto_apply_at = excluded.auto_apply_at
+  `
+	_, err = s.DB.ExecContext(ctx, query, options.ChatID, options.ActivityID, string(names), options.Source, options.ExpiresAt, options.AutoApplyAt)
+	if err != nil {
+		slog.Error("error while saving name options", "chatId", options.ChatID, "activityId", options.ActivityID)
+	}
+	return err
+}
+
+func (s *PostgresStore) DeleteNameOptions(ctx context.Context, chatId int64, activityId int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM name_options WHERE chat_id = $1 AND activity_id = $2`, chatId, activityId)
+	if err != nil {
+		slog.Error("error while deleting name options", "chatId", chatId, "activityId", activityId)
+	}
+	return err
+}
+
+func (s *PostgresStore) TakeDueNameOptions(ctx context.Context, now int64) ([]models.NameOptions, error) {
+	query := `
+    DELETE FROM name_options WHERE auto_apply_at > 0 AND auto_apply_at <= $1 AND expires_at > $2
+    RETURNING chat_id, activity_id, names, source, expires_at, auto_apply_at
+  `
+	return queryDueNameOptions(ctx, s.DB, query, now)
+}
+
+func (s *PostgresStore) DeleteExpiredConversations(ctx context.Context, now int64) error {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM conversations WHERE expires_at <= $1`, now); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM name_options WHERE expires_at <= $1`, now)
+	return err
+}
+
+func (s *PostgresStore) AddNameChange(ctx context.Context, change *models.NameChange) error {
+	query := `
+    INSERT INTO activity_name_history (activity_id, user_id, old_name, new_name, source, created_at, reverted_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING id
+  `
+	err := s.DB.QueryRowContext(ctx, query, change.ActivityID, change.UserID, change.OldName, change.NewName, change.Source, change.CreatedAt, change.RevertedAt).Scan(&change.ID)
+	if err != nil {
+		slog.Error("error while saving name change", "activityId", change.ActivityID)
+	}
+	return err
+}
+
+func (s *PostgresStore) GetNameHistory(ctx context.Context, activityId int64) ([]models.NameChange, error) {
+	query := `SELECT ` + nameChangeColumns + ` FROM activity_name_history WHERE activity_id = $1 ORDER BY created_at DESC, id DESC`
+	return queryNameHistory(ctx, s.DB, query, activityId)
+}
+
+func (s *PostgresStore) GetLastNameChange(ctx context.Context, userId int64, activityId int64) (*models.NameChange, error) {
+	query := `
+    SELECT ` + nameChangeColumns + ` FROM activity_name_history
+    WHERE user_id = $1 AND ($2 = 0 OR activity_id = $2) AND reverted_at = 0 AND source <> $3
+    ORDER BY created_at DESC, id DESC
+    LIMIT 1
+  `
+	return queryLastNameChange(s.DB.QueryRowContext(ctx, query, userId, activityId, models.NameSourceRevert), userId)
+}
+
+func (s *PostgresStore) MarkNameChangeReverted(ctx context.Context, id int64, revertedAt int64) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE activity_name_history SET reverted_at = $1 WHERE id = $2`, revertedAt, id)
+	if err != nil {
+		slog.Error("error while marking name change reverted", "id", id)
+	}
+	return err
+}
+
+// QueryActivities works like SQLiteStore.QueryActivities, matching text with ILIKE.
+func (s *PostgresStore) QueryActivities(ctx context.Context, q ActivityQuery) (*ActivityPage, error) {
+	query, args, err := buildActivityQuery(q, postgresPlaceholder, func(b *activityQueryBuilder, words []string) {
+		likeWordsCondition(b, words, "ILIKE")
+	})
+	if err != nil {
+		return nil, err
+	}
+	page, err := queryActivityPage(ctx, s.DB, query, args, q.Limit)
+	if err != nil {
+		slog.Error("error while querying user activities", "userId", q.UserID)
+	}
+	return page, err
+}
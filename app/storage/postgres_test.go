@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newPostgresTestStore connects to POSTGRES_TEST_DSN and empties all tables.
+func newPostgresTestStore(t *testing.T) Store {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	store := &PostgresStore{DSN: dsn}
+	require.NoError(t, store.Connect())
+	t.Cleanup(func() { _ = store.DB.Close() })
+	_, err := store.DB.Exec(`TRUNCATE users, user_activities, webhook_events, activity_sync_state, conversations, name_options, activity_name_history RESTART IDENTITY CASCADE`)
+	require.NoError(t, err)
+	return store
+}
+
+func TestPostgresStore_Conformance(t *testing.T) {
+	testStoreConformance(t, newPostgresTestStore)
+}
@@ -1,42 +1,95 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log/slog"
 	"stravach/app/storage/models"
 	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Store is the whole persistence layer of the bot and the HTTP server. Every repository
+// method takes the context of the request or bot update it serves, so cancellation and
+// deadlines reach the database.
 type Store interface {
-	GetAllUsers() ([]*models.User, error)
 	Connect() error
-	GetActivityById(activityId int64) (*models.UserActivity, error)
-	CreateUserActivity(activity *models.UserActivity, userId int64) error
-	CreateUserActivities(activities []*models.UserActivity) error
-	GetUserActivities(userId int64, limit int) ([]models.UserActivity, error)
-	UpdateUser(user *models.User) error
-	GetUserByStravaId(stravaId int64) (*models.User, error)
-	GetUserByChatId(chatId int64) (*models.User, error)
-	GetUserById(id int64) (*models.User, error)
-	IsActivityExists(activityId int64) (bool, error)
+	UserRepo
+	ActivityRepo
+	WebhookEventRepo
+	SyncStateRepo
+	ConversationRepo
+	NameHistoryRepo
+	UserSettingsRepo
+}
+
+// UserRepo keeps the Telegram users and their Strava tokens.
+type UserRepo interface {
+	GetAllUsers(ctx context.Context) ([]*models.User, error)
+	GetUserById(ctx context.Context, id int64) (*models.User, error)
+	GetUserByChatId(ctx context.Context, chatId int64) (*models.User, error)
+	GetUserByStravaId(ctx context.Context, stravaId int64) (*models.User, error)
+	IsUserExistsByChatId(ctx context.Context, chatId int64) (bool, error)
+	// CreateUser adds the user, or updates the user of the same chat, and sets user.ID.
+	CreateUser(ctx context.Context, user *models.User) error
+	UpdateUser(ctx context.Context, user *models.User) error
 }
 
 var _ Store = (*SQLiteStore)(nil)
 
+// NewStore connects to the store selected by dsn: postgres:// and postgresql:// URLs
+// use Postgres, anything else is a SQLite file path, optionally prefixed with sqlite://.
+// An empty dsn opens DefaultSQLitePath. keys encrypts Strava tokens, nil stores them in plaintext.
+func NewStore(dsn string, keys *Keyring) (Store, error) {
+	store := storeForDSN(dsn, keys)
+	if err := store.Connect(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// sqlStore is a Store on database/sql whose schema is managed by a Migrator.
+type sqlStore interface {
+	Store
+	open() error
+	migrator() (*Migrator, error)
+	RotateKeys() (int, error)
+}
+
+// migrate brings the schema of s up to date, refusing a schema newer than this build.
+func migrate(s sqlStore) error {
+	m, err := s.migrator()
+	if err != nil {
+		return err
+	}
+	if _, err = m.Up(0); err != nil {
+		slog.Error("cannot migrate database", "err", err)
+		return err
+	}
+	return nil
+}
+
+func storeForDSN(dsn string, keys *Keyring) sqlStore {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return &PostgresStore{DSN: dsn, Keys: keys}
+	}
+	return &SQLiteStore{Path: strings.TrimPrefix(dsn, "sqlite://"), Keys: keys}
+}
+
 // GetAllUsers returns all users from the database
-func (s *SQLiteStore) GetAllUsers() ([]*models.User, error) {
-	rows, err := s.DB.Query(`SELECT id, strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin FROM users`)
+func (s *SQLiteStore) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var users []*models.User
 	for rows.Next() {
-		u := &models.User{}
-		err := rows.Scan(&u.ID, &u.StravaId, &u.TelegramChatId, &u.Username, &u.Email, &u.StravaRefreshToken, &u.StravaAccessToken, &u.StravaAccessCode, &u.TokenExpiresAt, &u.Language, &u.IsAdmin)
+		u, err := scanUser(rows, s.Keys)
 		if err != nil {
 			return nil, err
 		}
@@ -45,87 +98,97 @@ func (s *SQLiteStore) GetAllUsers() ([]*models.User, error) {
 	return users, nil
 }
 
+const userColumns = `id, strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin`
+
+// scanUser reads a row of userColumns and decrypts its tokens with keys.
+func scanUser(row interface{ Scan(...any) error }, keys *Keyring) (*models.User, error) {
+	u := &models.User{}
+	err := row.Scan(&u.ID, &u.StravaId, &u.TelegramChatId, &u.Username, &u.Email, &u.StravaRefreshToken, &u.StravaAccessToken, &u.StravaAccessCode, &u.TokenExpiresAt, &u.Language, &u.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if err = keys.openUser(u); err != nil {
+		slog.Error("cannot decrypt user tokens", "user", u, "err", err)
+		return nil, err
+	}
+	return u, nil
+}
+
+const DefaultSQLitePath = "db/stravach.db"
+
 type SQLiteStore struct {
 	DB *sql.DB
+	// Path is the database file, DefaultSQLitePath when empty.
+	Path string
+	// Keys encrypts the Strava tokens of users, nil keeps them in plaintext.
+	Keys *Keyring
+
+	ftsOnce sync.Once
+	fts     bool
 }
 
 func (s *SQLiteStore) Connect() error {
-	db, err := sql.Open("sqlite3", "db/stravach.db")
-	if err != nil {
-		slog.Error("cannot open sqlite file")
+	if err := s.open(); err != nil {
 		return err
 	}
-	s.DB = db
-	if err = s.createTables(); err != nil {
-		slog.Error("cannot create tables", "err", err)
-		return err
-	}
-	return nil
+	return migrate(s)
 }
 
-func (s *SQLiteStore) createTables() error {
-	userTable := `
-		    CREATE TABLE IF NOT EXISTS users (
-		      id INTEGER PRIMARY KEY AUTOINCREMENT,
-		      strava_id INTEGER,
-		      telegram_chat_id INTEGER UNIQUE NOT NULL,
-		      username TEXT,
-		      email TEXT,
-		      strava_refresh_token TEXT,
-		      strava_access_token TEXT,
-		      strava_access_code TEXT,
-		      token_expires_at INTEGER,
-			  language TEXT,
-			  is_admin INTEGER DEFAULT 0
-		    );
-	  `
-	// Migration: Add is_admin column if it does not exist
-	_, err := s.DB.Exec("ALTER TABLE users ADD COLUMN is_admin INTEGER DEFAULT 0;")
-	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
-		return fmt.Errorf("failed to add is_admin column: %w", err)
+// path returns the database file, DefaultSQLitePath when Path is empty.
+func (s *SQLiteStore) path() string {
+	if s.Path == "" {
+		return DefaultSQLitePath
 	}
-	userActivityTable := `
-    CREATE TABLE IF NOT EXISTS user_activities (
-      id INTEGER PRIMARY KEY AUTOINCREMENT,
-      name VARCHAR,
-      user_id INTEGER NOT NULL,
-      distance REAL,
-      moving_time INTEGER,
-      elapsed_time INTEGER,
-      type TEXT,
-      start_date DATETIME,
-      average_heartrate REAL,
-      average_speed REAL,
-      is_updated INTEGER DEFAULT 0,
-      FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-  `
+	return s.Path
+}
 
-	_, err = s.DB.Exec(userTable)
+func (s *SQLiteStore) open() error {
+	db, err := sql.Open("sqlite3", sqliteDSN(s.path()))
 	if err != nil {
+		slog.Error("cannot open sqlite file")
 		return err
 	}
+	s.DB = db
+	return nil
+}
 
-	_, err = s.DB.Exec("ALTER TABLE users ADD COLUMN is_admin INTEGER DEFAULT 0;")
-	if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
-		return fmt.Errorf("failed to add is_admin column: %w", err)
-	}
+// sqliteBusyTimeout is how long a write waits for another connection's write to finish,
+// e.g. the bot's and the HTTP server's, before failing with "database is locked".
+const sqliteBusyTimeout = 5 * time.Second
 
-	_, err = s.DB.Exec(userActivityTable)
-	if err != nil {
-		return err
+// sqliteDSN opens path in WAL mode, so readers don't block the writer, with a busy timeout.
+// Transactions take the write lock when they begin, since a read transaction upgraded to a
+// write fails right away when another connection wrote in between.
+func sqliteDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
 	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, separator, sqliteBusyTimeout.Milliseconds())
+}
 
-	return nil
+func (s *SQLiteStore) migrator() (*Migrator, error) {
+	return newMigrator(s.DB, dialectSQLite)
 }
 
-func (s *SQLiteStore) CreateUser(user *models.User) error {
-	slog.Info("inserting user", "user_struct", fmt.Sprintf("%+v", user))
+// RotateKeys re-encrypts user tokens with the primary key of s.Keys.
+func (s *SQLiteStore) RotateKeys() (int, error) {
+	return rotateKeys(s.DB, s.Keys, `
+    UPDATE users SET strava_refresh_token = ?, strava_access_token = ?, strava_access_code = ?
+    WHERE id = ? AND strava_refresh_token = ? AND strava_access_token = ? AND strava_access_code = ?
+  `)
+}
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, user *models.User) error {
+	slog.Info("inserting user", "user", user)
 	username := "anonymous"
 	if user.Username != "" {
 		username = user.Username
 	}
-	slog.Info("CreateUser values", "strava_id", user.StravaId, "telegram_chat_id", user.TelegramChatId, "username", username, "email", user.Email, "strava_refresh_token", user.StravaRefreshToken, "strava_access_token", user.StravaAccessToken, "strava_access_code", user.StravaAccessCode, "token_expires_at", user.TokenExpiresAt, "language", user.Language)
+	tokens, err := s.Keys.sealUser(user)
+	if err != nil {
+		return err
+	}
 	query := `
 		INSERT INTO users (
 			strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin
@@ -140,20 +203,18 @@ func (s *SQLiteStore) CreateUser(user *models.User) error {
 			token_expires_at = excluded.token_expires_at,
 			language = excluded.language,
 			is_admin = excluded.is_admin
+		RETURNING id
 	`
-	result, err := s.DB.Exec(query, user.StravaId, user.TelegramChatId, username, user.Email, user.StravaRefreshToken, user.StravaAccessToken, user.StravaAccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin)
+	err = s.DB.QueryRowContext(ctx, query, user.StravaId, user.TelegramChatId, username, user.Email, tokens.RefreshToken, tokens.AccessToken, tokens.AccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin).Scan(&user.ID)
 	if err != nil {
 		slog.Error("error while creating user", "err", err, "strava_id", user.StravaId, "telegram_chat_id", user.TelegramChatId, "username", username, "email", user.Email)
 		return err
 	}
-	user.ID, err = result.LastInsertId()
-	return err
+	return nil
 }
 
-func (s *SQLiteStore) GetUserByChatId(chatId int64) (*models.User, error) {
-	user := &models.User{}
-	query := `SELECT id, strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin FROM users WHERE telegram_chat_id = ?`
-	err := s.DB.QueryRow(query, chatId).Scan(&user.ID, &user.StravaId, &user.TelegramChatId, &user.Username, &user.Email, &user.StravaRefreshToken, &user.StravaAccessToken, &user.StravaAccessCode, &user.TokenExpiresAt, &user.Language, &user.IsAdmin)
+func (s *SQLiteStore) GetUserByChatId(ctx context.Context, chatId int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE telegram_chat_id = ?`, chatId), s.Keys)
 	if err != nil {
 		slog.Error("error while fetching user chat by id", "id", chatId)
 		return nil, err
@@ -161,11 +222,8 @@ func (s *SQLiteStore) GetUserByChatId(chatId int64) (*models.User, error) {
 	return user, nil
 }
 
-func (s *SQLiteStore) GetUserById(id int64) (*models.User, error) {
-	user := &models.User{}
-	query := `SELECT id, strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin FROM users WHERE id = ?`
-	fmt.Println(id)
-	err := s.DB.QueryRow(query, id).Scan(&user.ID, &user.StravaId, &user.TelegramChatId, &user.Username, &user.Email, &user.StravaRefreshToken, &user.StravaAccessToken, &user.StravaAccessCode, &user.TokenExpiresAt, &user.Language, &user.IsAdmin)
+func (s *SQLiteStore) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id), s.Keys)
 	if err != nil {
 		slog.Error("error while fetching user by id", "id", id)
 		return nil, err
@@ -173,10 +231,8 @@ func (s *SQLiteStore) GetUserById(id int64) (*models.User, error) {
 	return user, nil
 }
 
-func (s *SQLiteStore) GetUserByStravaId(id int64) (*models.User, error) {
-	user := &models.User{}
-	query := `SELECT id, strava_id, telegram_chat_id, username, email, strava_refresh_token, strava_access_token, strava_access_code, token_expires_at, language, is_admin FROM users WHERE strava_id = ?`
-	err := s.DB.QueryRow(query, id).Scan(&user.ID, &user.StravaId, &user.TelegramChatId, &user.Username, &user.Email, &user.StravaRefreshToken, &user.StravaAccessToken, &user.StravaAccessCode, &user.TokenExpiresAt, &user.Language, &user.IsAdmin)
+func (s *SQLiteStore) GetUserByStravaId(ctx context.Context, id int64) (*models.User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE strava_id = ?`, id), s.Keys)
 	if err != nil {
 		slog.Error("error while fetching user by strava id", "id", id)
 		return nil, err
@@ -184,10 +240,10 @@ func (s *SQLiteStore) GetUserByStravaId(id int64) (*models.User, error) {
 	return user, nil
 }
 
-func (s *SQLiteStore) IsUserExistsByChatId(chatId int64) (bool, error) {
+func (s *SQLiteStore) IsUserExistsByChatId(ctx context.Context, chatId int64) (bool, error) {
 	var exists bool
 	query := `SELECT COUNT(1) FROM users WHERE telegram_chat_id = ?`
-	err := s.DB.QueryRow(query, chatId).Scan(&exists)
+	err := s.DB.QueryRowContext(ctx, query, chatId).Scan(&exists)
 	if err != nil {
 		slog.Error("error while checking if activity exists", "id", chatId)
 		return false, err
@@ -196,65 +252,42 @@ func (s *SQLiteStore) IsUserExistsByChatId(chatId int64) (bool, error) {
 	return exists, nil
 }
 
-func (s *SQLiteStore) UpdateUser(user *models.User) error {
-	slog.Debug("updating user", "usr", fmt.Sprintf("%+v", user))
+func (s *SQLiteStore) UpdateUser(ctx context.Context, user *models.User) error {
+	slog.Debug("updating user", "user", user)
+	tokens, err := s.Keys.sealUser(user)
+	if err != nil {
+		return err
+	}
 	query := `
     UPDATE users
     SET strava_id = ?, telegram_chat_id = ?, username = ?, email = ?,
       strava_refresh_token = ?, strava_access_token = ?, strava_access_code = ?, token_expires_at = ?, language = ?, is_admin = ?
     WHERE id = ?
   `
-	_, err := s.DB.Exec(query, user.StravaId, user.TelegramChatId, user.Username, user.Email,
-		user.StravaRefreshToken, user.StravaAccessToken, user.StravaAccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin, user.ID)
+	_, err = s.DB.ExecContext(ctx, query, user.StravaId, user.TelegramChatId, user.Username, user.Email,
+		tokens.RefreshToken, tokens.AccessToken, tokens.AccessCode, user.TokenExpiresAt, user.Language, user.IsAdmin, user.ID)
 	return err
 }
 
-func (s *SQLiteStore) CreateUserActivities(activities []*models.UserActivity) error {
-	query := `
-    INSERT INTO user_activities (
-        id, name, user_id, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    ON CONFLICT(id) DO UPDATE SET
-        name = excluded.name,
-        user_id = excluded.user_id,
-        distance = excluded.distance,
-        moving_time = excluded.moving_time,
-        elapsed_time = excluded.elapsed_time,
-        type = excluded.type,
-        start_date = excluded.start_date,
-        average_heartrate = excluded.average_heartrate,
-        average_speed = excluded.average_speed,
-		is_updated = excluded.is_updated
-  `
-	for _, a := range activities {
-		_, err := s.DB.Exec(query, a.ID, a.Name, a.UserID, a.Distance, a.MovingTime, a.ElapsedTime, a.ActivityType, a.StartDate, a.AverageHeartrate, a.AverageSpeed, a.IsUpdated)
-		if err != nil {
-			slog.Error("error while creating user activities")
-			return err
-		}
+// CreateUserActivities upserts the activities in one transaction, keeping the is_updated flag
+// of activities renamed by the bot and the details summaries don't have.
+func (s *SQLiteStore) CreateUserActivities(ctx context.Context, activities []*models.UserActivity) error {
+	return s.UpsertActivities(ctx, activities, BatchOptions{ChunkSize: len(activities)})
+}
+
+// UpsertActivities is CreateUserActivities in transactions of opts.ChunkSize activities.
+func (s *SQLiteStore) UpsertActivities(ctx context.Context, activities []*models.UserActivity, opts BatchOptions) error {
+	query := upsertActivityQuery(sqlitePlaceholder, true)
+	if err := upsertActivities(ctx, s.DB, query, activities, opts); err != nil {
+		return err
 	}
 	slog.Info(fmt.Sprintf("inserted %d activities", len(activities)))
 	return nil
 }
 
-func (s *SQLiteStore) CreateUserActivity(activity *models.UserActivity, userId int64) error {
-	query := `
-    INSERT INTO user_activities (
-        id, name, user_id, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    ON CONFLICT(id) DO UPDATE SET
-        name = excluded.name,
-        user_id = excluded.user_id,
-        distance = excluded.distance,
-        moving_time = excluded.moving_time,
-        elapsed_time = excluded.elapsed_time,
-        type = excluded.type,
-        start_date = excluded.start_date,
-        average_heartrate = excluded.average_heartrate,
-        average_speed = excluded.average_speed,
-        is_updated = excluded.is_updated
-  `
-	result, err := s.DB.Exec(query, activity.ID, activity.Name, userId, activity.Distance, activity.MovingTime, activity.ElapsedTime, activity.ActivityType, activity.StartDate, activity.AverageHeartrate, activity.AverageSpeed, activity.IsUpdated)
+func (s *SQLiteStore) CreateUserActivity(ctx context.Context, activity *models.UserActivity, userId int64) error {
+	query := upsertActivityQuery(sqlitePlaceholder, false)
+	result, err := s.DB.ExecContext(ctx, query, activityValues(activity, userId)...)
 	if err != nil {
 		slog.Error("error while creating user activitiy")
 		return err
@@ -263,10 +296,10 @@ func (s *SQLiteStore) CreateUserActivity(activity *models.UserActivity, userId i
 	return err
 }
 
-func (s *SQLiteStore) GetUserActivities(userId int64, limit int) ([]models.UserActivity, error) {
+func (s *SQLiteStore) GetUserActivities(ctx context.Context, userId int64, limit int) ([]models.UserActivity, error) {
 	var activities []models.UserActivity
-	query := `SELECT id, name, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated FROM user_activities WHERE user_id = ? ORDER BY start_date DESC LIMIT ?`
-	rows, err := s.DB.Query(query, userId, limit)
+	query := `SELECT ` + activityColumns + ` FROM user_activities WHERE user_id = ? ORDER BY start_date DESC LIMIT ?`
+	rows, err := s.DB.QueryContext(ctx, query, userId, limit)
 	if err != nil {
 		slog.Error("error while fetching user activities", "id", userId)
 		return nil, err
@@ -276,31 +309,29 @@ func (s *SQLiteStore) GetUserActivities(userId int64, limit int) ([]models.UserA
 	}(rows)
 
 	for rows.Next() {
-		var activity models.UserActivity
-		err := rows.Scan(&activity.ID, &activity.Name, &activity.Distance, &activity.MovingTime, &activity.ElapsedTime, &activity.ActivityType, &activity.StartDate, &activity.AverageHeartrate, &activity.AverageSpeed, &activity.IsUpdated)
+		activity, err := scanActivity(rows)
 		if err != nil {
 			return nil, err
 		}
-		activities = append(activities, activity)
+		activities = append(activities, *activity)
 	}
 	return activities, nil
 }
 
-func (s *SQLiteStore) GetActivityById(activityId int64) (*models.UserActivity, error) {
-	activity := models.UserActivity{}
-	query := `SELECT id, name, user_id, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated FROM user_activities WHERE id = ?`
-	err := s.DB.QueryRow(query, activityId).Scan(&activity.ID, &activity.Name, &activity.UserID, &activity.Distance, &activity.MovingTime, &activity.ElapsedTime, &activity.ActivityType, &activity.StartDate, &activity.AverageHeartrate, &activity.AverageSpeed, &activity.IsUpdated)
+func (s *SQLiteStore) GetActivityById(ctx context.Context, activityId int64) (*models.UserActivity, error) {
+	query := `SELECT ` + activityColumns + ` FROM user_activities WHERE id = ?`
+	activity, err := scanActivity(s.DB.QueryRowContext(ctx, query, activityId))
 	if err != nil {
 		slog.Error("error while fetching user activity", "id", activityId)
 		return nil, err
 	}
-	return &activity, nil
+	return activity, nil
 }
 
-func (s *SQLiteStore) IsActivityExists(activityId int64) (bool, error) {
+func (s *SQLiteStore) IsActivityExists(ctx context.Context, activityId int64) (bool, error) {
 	var exists bool
 	query := `SELECT COUNT(1) FROM user_activities WHERE id = ?`
-	err := s.DB.QueryRow(query, activityId).Scan(&exists)
+	err := s.DB.QueryRowContext(ctx, query, activityId).Scan(&exists)
 	if err != nil {
 		slog.Error("error while checking if activity exists", "id", activityId)
 		return false, err
@@ -308,24 +339,8 @@ func (s *SQLiteStore) IsActivityExists(activityId int64) (bool, error) {
 	return exists, nil
 }
 
-func (s *SQLiteStore) UpdateUserActivity(activity *models.UserActivity) error {
-	fmt.Printf("%+v", activity)
-	query := `
-    UPDATE user_activities
-    SET
-        name = ?,
-        distance = ?,
-        moving_time = ?,
-        elapsed_time = ?,
-        type = ?,
-        start_date = ?,
-        average_heartrate = ?,
-        average_speed = ?,
-        is_updated = ?
-    WHERE id = ?
-  `
-	result, err := s.DB.Exec(query, activity.Name, activity.Distance, activity.MovingTime,
-		activity.ElapsedTime, activity.ActivityType, activity.StartDate, activity.AverageHeartrate, activity.AverageSpeed, activity.IsUpdated, activity.ID)
+func (s *SQLiteStore) UpdateUserActivity(ctx context.Context, activity *models.UserActivity) error {
+	result, err := s.DB.ExecContext(ctx, updateActivityQuery(sqlitePlaceholder), updateActivityValues(activity)...)
 	if err != nil {
 		slog.Error("error while updating user activity")
 		return err
@@ -334,3 +349,12 @@ func (s *SQLiteStore) UpdateUserActivity(activity *models.UserActivity) error {
 	_, err = result.LastInsertId()
 	return err
 }
+
+func (s *SQLiteStore) DeleteUserActivity(ctx context.Context, activityId int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM user_activities WHERE id = ?`, activityId)
+	if err != nil {
+		slog.Error("error while deleting user activity", "id", activityId)
+		return err
+	}
+	return nil
+}
@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"path/filepath"
 	"stravach/app/storage/models"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 )
 
 func TestSQLiteStore_CreateUserActivity(t *testing.T) {
+	ctx := context.Background()
 	// Setup the mock database
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -31,35 +36,189 @@ func TestSQLiteStore_CreateUserActivity(t *testing.T) {
 		AverageHeartrate: 150.5,
 		AverageSpeed:     2.9,
 		IsUpdated:        false,
+		Description:      "Easy one",
+		SportType:        "TrailRun",
+		StartLatLng:      []float64{48.1, 11.5},
+		Map:              models.ActivityMap{SummaryPolyline: "u{~vFvyys@fS]"},
+		GearID:           "g123",
+		Commute:          true,
 	}
 
 	// Define the expected SQL query with the corresponding arguments
-	query := `
-    INSERT INTO user_activities \(
-        id, name, user_id, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated
-    \) VALUES \(\?, \?, \?, \?, \?, \?, \?, \?, \?, \?, \?\)
-    ON CONFLICT\(id\) DO UPDATE SET
-        name = excluded.name,
-        user_id = excluded.user_id,
-        distance = excluded.distance,
-        moving_time = excluded.moving_time,
-        elapsed_time = excluded.elapsed_time,
-        type = excluded.type,
-        start_date = excluded.start_date,
-        average_heartrate = excluded.average_heartrate,
-        average_speed = excluded.average_speed,
-        is_updated = excluded.is_updated
-`
+	query := `INSERT INTO user_activities \(id, user_id, name, distance, moving_time, elapsed_time, type, start_date, average_heartrate, average_speed, is_updated, description, .*, private\) ` +
+		`VALUES \(\?(, \?){34}\) ` +
+		`ON CONFLICT\(id\) DO UPDATE SET user_id = excluded.user_id, name = excluded.name, .*, is_updated = excluded.is_updated`
 	// Mock the expected result from Exec
 	mock.ExpectExec(query).
-		WithArgs(activity.ID, activity.Name, activity.UserID, activity.Distance, activity.MovingTime, activity.ElapsedTime, activity.ActivityType, activity.StartDate, activity.AverageHeartrate, activity.AverageSpeed, activity.IsUpdated).
+		WithArgs(activity.ID, activity.UserID, activity.Name, activity.Distance, activity.MovingTime, activity.ElapsedTime, activity.ActivityType, activity.StartDate, activity.AverageHeartrate, activity.AverageSpeed, activity.IsUpdated,
+			activity.Description, activity.SportType, activity.TotalElevationGain, activity.ElevHigh, activity.ElevLow,
+			float64(48.1), float64(11.5), sql.NullFloat64{}, sql.NullFloat64{}, activity.Map.SummaryPolyline,
+			activity.MaxSpeed, activity.MaxHeartrate, activity.AverageCadence, activity.AverageWatts, activity.WeightedAverageWatts, activity.Kilojoules, activity.Calories,
+			activity.GearID, activity.DeviceName, activity.Timezone, activity.Trainer, activity.Commute, activity.Manual, activity.Private).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Call the function
-	err = sqliteStore.CreateUserActivity(activity, activity.UserID)
+	err = sqliteStore.CreateUserActivity(ctx, activity, activity.UserID)
 	require.NoError(t, err)
 
 	// Ensure all expectations were met
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
 }
+
+func newSQLiteTestStore(t *testing.T) Store {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{DB: db}
+	require.NoError(t, migrate(store))
+	return store
+}
+
+func TestSQLiteStore_Conformance(t *testing.T) {
+	testStoreConformance(t, newSQLiteTestStore)
+}
+
+func TestSQLiteStore_ConformanceWithEncryptedTokens(t *testing.T) {
+	keys, err := NewKeyring("1:" + testKey(t))
+	require.NoError(t, err)
+	testStoreConformance(t, func(t *testing.T) Store {
+		store := newSQLiteTestStore(t).(*SQLiteStore)
+		store.Keys = keys
+		return store
+	})
+}
+
+func TestStoreForDSN(t *testing.T) {
+	require.Equal(t, &SQLiteStore{}, storeForDSN("", nil))
+	require.Equal(t, &SQLiteStore{Path: "/data/stravach.db"}, storeForDSN("/data/stravach.db", nil))
+	require.Equal(t, &SQLiteStore{Path: "/data/stravach.db"}, storeForDSN("sqlite:///data/stravach.db", nil))
+	require.Equal(t, &PostgresStore{DSN: "postgres://u:p@db/stravach"}, storeForDSN("postgres://u:p@db/stravach", nil))
+	require.Equal(t, &PostgresStore{DSN: "postgresql://db/stravach"}, storeForDSN("postgresql://db/stravach", nil))
+}
+
+func TestSQLiteStore_SearchesWithFTSWhenCompiledIn(t *testing.T) {
+	store := newSQLiteTestStore(t).(*SQLiteStore)
+	var compiled bool
+	require.NoError(t, store.DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&compiled))
+
+	require.Equal(t, compiled, store.searchesWithFTS())
+	require.Equal(t, compiled, tableExists(t, store.DB, "user_activities_fts"))
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	require.Equal(t, "db/stravach.db?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("db/stravach.db"))
+	require.Equal(t, "file:test.db?cache=shared&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("file:test.db?cache=shared"))
+}
+
+func TestSQLiteStore_OpensInWALMode(t *testing.T) {
+	store := &SQLiteStore{Path: filepath.Join(t.TempDir(), "stravach.db")}
+	require.NoError(t, store.Connect())
+	defer store.DB.Close()
+
+	var journalMode string
+	require.NoError(t, store.DB.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode))
+	require.Equal(t, "wal", journalMode)
+	var busyTimeout int
+	require.NoError(t, store.DB.QueryRow(`PRAGMA busy_timeout`).Scan(&busyTimeout))
+	require.Equal(t, 5000, busyTimeout)
+}
+
+func TestSQLiteStore_ConcurrentWriters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "stravach.db")
+	bot, server := &SQLiteStore{Path: path}, &SQLiteStore{Path: path}
+	require.NoError(t, bot.Connect())
+	defer bot.DB.Close()
+	require.NoError(t, server.Connect())
+	defer server.DB.Close()
+	user := createTestUser(t, bot, 555)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		store := bot
+		if i%2 == 1 {
+			store = server
+		}
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			activities := []*models.UserActivity{{ID: id, UserID: user.ID, Name: "Morning Run", StartDate: time.Now()}}
+			errs <- store.CreateUserActivities(ctx, activities)
+		}(int64(i + 1))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	all, err := server.GetUserActivities(ctx, user.ID, 100)
+	require.NoError(t, err)
+	require.Len(t, all, 40)
+}
+
+// failOnName makes inserting an activity named "fail" abort its statement.
+func failOnName(t *testing.T, store *SQLiteStore) {
+	_, err := store.DB.Exec(`
+    CREATE TRIGGER fail_on_name BEFORE INSERT ON user_activities WHEN new.name = 'fail'
+    BEGIN SELECT RAISE(ABORT, 'activity rejected'); END
+  `)
+	require.NoError(t, err)
+}
+
+func TestSQLiteStore_CreateUserActivitiesIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteTestStore(t).(*SQLiteStore)
+	failOnName(t, store)
+	user := createTestUser(t, store, 555)
+
+	err := store.CreateUserActivities(ctx, []*models.UserActivity{
+		{ID: 1, UserID: user.ID, Name: "Morning Run"},
+		{ID: 2, UserID: user.ID, Name: "fail"},
+	})
+	require.ErrorContains(t, err, "activity rejected")
+	exists, err := store.IsActivityExists(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestSQLiteStore_UpsertActivitiesKeepsCommittedChunks(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteTestStore(t).(*SQLiteStore)
+	failOnName(t, store)
+	user := createTestUser(t, store, 555)
+
+	var written []int
+	err := store.UpsertActivities(ctx, []*models.UserActivity{
+		{ID: 1, UserID: user.ID, Name: "Morning Run"},
+		{ID: 2, UserID: user.ID, Name: "Evening Run"},
+		{ID: 3, UserID: user.ID, Name: "Lunch Run"},
+		{ID: 4, UserID: user.ID, Name: "fail"},
+	}, BatchOptions{ChunkSize: 2, Progress: func(n int, _ int) { written = append(written, n) }})
+	require.ErrorContains(t, err, "upserting activities 3-4 of 4")
+	require.Equal(t, []int{2}, written)
+	all, err := store.GetUserActivities(ctx, user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+}
+
+func TestSQLiteStore_CancelledContext(t *testing.T) {
+	store := newSQLiteTestStore(t).(*SQLiteStore)
+	user := createTestUser(t, store, 555)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := store.GetUserById(ctx, user.ID)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID})
+	require.ErrorIs(t, err, context.Canceled)
+	err = store.CreateUserActivities(ctx, []*models.UserActivity{{ID: 1, UserID: user.ID, Name: "Morning Run"}})
+	require.ErrorIs(t, err, context.Canceled)
+
+	exists, err := store.IsActivityExists(context.Background(), 1)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
@@ -0,0 +1,498 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"stravach/app/storage/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreConformance checks the behaviour every Store implementation must share.
+// newStore returns an empty, connected store.
+func testStoreConformance(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("Users", func(t *testing.T) { testStoreUsers(t, newStore(t)) })
+	t.Run("Activities", func(t *testing.T) { testStoreActivities(t, newStore(t)) })
+	t.Run("WebhookEventQueue", func(t *testing.T) { testStoreWebhookEventQueue(t, newStore(t)) })
+	t.Run("SyncState", func(t *testing.T) { testStoreSyncState(t, newStore(t)) })
+	t.Run("Conversations", func(t *testing.T) { testConversationRepo(t, newStore(t)) })
+	t.Run("NameHistory", func(t *testing.T) { testStoreNameHistory(t, newStore(t)) })
+	t.Run("QueryActivities", func(t *testing.T) { testStoreQueryActivities(t, newStore(t)) })
+	t.Run("UpsertActivities", func(t *testing.T) { testStoreUpsertActivities(t, newStore(t)) })
+	t.Run("UserSettings", func(t *testing.T) { testStoreUserSettings(t, newStore(t)) })
+}
+
+func createTestUser(t *testing.T, store Store, chatId int64) *models.User {
+	ctx := context.Background()
+	stravaId := chatId * 10
+	expiresAt := int64(1700000000)
+	user := &models.User{
+		StravaId:           &stravaId,
+		TelegramChatId:     chatId,
+		Username:           "runner",
+		StravaRefreshToken: "refresh",
+		StravaAccessToken:  "access",
+		TokenExpiresAt:     &expiresAt,
+		Language:           "English",
+	}
+	require.NoError(t, store.CreateUser(ctx, user))
+	require.NotZero(t, user.ID)
+	return user
+}
+
+// requireActivity compares activities, start dates by instant since stores may return another location.
+func requireActivity(t *testing.T, want models.UserActivity, got *models.UserActivity) {
+	t.Helper()
+	require.NotNil(t, got)
+	require.True(t, want.StartDate.Equal(got.StartDate), "start date %s, want %s", got.StartDate, want.StartDate)
+	gotCopy := *got
+	gotCopy.StartDate = want.StartDate
+	require.Equal(t, want, gotCopy)
+}
+
+func testStoreUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	exists, err := store.IsUserExistsByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.False(t, exists)
+	_, err = store.GetUserByChatId(ctx, 555)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	user := createTestUser(t, store, 555)
+	other := createTestUser(t, store, 777)
+	require.NotEqual(t, user.ID, other.ID)
+
+	exists, err = store.IsUserExistsByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	byChat, err := store.GetUserByChatId(ctx, 555)
+	require.NoError(t, err)
+	require.Equal(t, user, byChat)
+	byId, err := store.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, user, byId)
+	byStrava, err := store.GetUserByStravaId(ctx, *user.StravaId)
+	require.NoError(t, err)
+	require.Equal(t, user, byStrava)
+
+	// creating a user for a known chat updates it in place
+	again := &models.User{StravaId: user.StravaId, TelegramChatId: 555, Username: "renamed", Language: "German"}
+	require.NoError(t, store.CreateUser(ctx, again))
+	require.Equal(t, user.ID, again.ID)
+
+	again.IsAdmin = true
+	again.StravaAccessToken = "new access"
+	require.NoError(t, store.UpdateUser(ctx, again))
+	updated, err := store.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, again, updated)
+
+	users, err := store.GetAllUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+}
+
+func testStoreActivities(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+
+	exists, err := store.IsActivityExists(ctx, 1)
+	require.NoError(t, err)
+	require.False(t, exists)
+	_, err = store.GetActivityById(ctx, 1)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	activity := models.UserActivity{
+		ID: 1, UserID: user.ID, Name: "Morning Run", Distance: 10000.5, MovingTime: 3600, ElapsedTime: 3700,
+		ActivityType: "Run", StartDate: start, AverageHeartrate: 150.5, AverageSpeed: 2.9,
+		Description: "Easy pace along the river", SportType: "TrailRun", TotalElevationGain: 120.4, ElevHigh: 530.2, ElevLow: 410.8,
+		StartLatLng: []float64{52.52, 13.405}, EndLatLng: []float64{52.51, 13.39}, Map: models.ActivityMap{SummaryPolyline: "u{~vFvyys@fS]"},
+		MaxSpeed: 4.1, MaxHeartrate: 172, AverageCadence: 84.5, AverageWatts: 250, WeightedAverageWatts: 262, Kilojoules: 900.5, Calories: 780,
+		GearID: "g12345", DeviceName: "Garmin Forerunner 965", Timezone: "(GMT+01:00) Europe/Berlin", Commute: true, Private: true,
+	}
+	created := activity
+	require.NoError(t, store.CreateUserActivity(ctx, &created, user.ID))
+	require.Equal(t, activity.ID, created.ID)
+
+	exists, err = store.IsActivityExists(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, exists)
+	stored, err := store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	requireActivity(t, activity, stored)
+
+	activity.Name = "Lakeside Loop"
+	activity.IsUpdated = true
+	renamed := activity
+	require.NoError(t, store.UpdateUserActivity(ctx, &renamed))
+	stored, err = store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	requireActivity(t, activity, stored)
+
+	// re-importing a summary of an activity keeps the flag of a rename done by the bot and
+	// the details only the activity itself has
+	require.NoError(t, store.CreateUserActivities(ctx, []*models.UserActivity{
+		{ID: 1, UserID: user.ID, Name: "Lakeside Loop", Distance: 10100, ActivityType: "Run", StartDate: start},
+		{ID: 2, UserID: user.ID, Name: "Evening Ride", ActivityType: "Ride", StartDate: start.Add(10 * time.Hour)},
+		{ID: 3, UserID: user.ID, Name: "Recovery Jog", ActivityType: "Run", StartDate: start.Add(-24 * time.Hour)},
+	}))
+	stored, err = store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, stored.IsUpdated)
+	require.Equal(t, 10100.0, stored.Distance)
+	require.Equal(t, "Easy pace along the river", stored.Description)
+	require.Equal(t, 780.0, stored.Calories)
+	require.Equal(t, "Garmin Forerunner 965", stored.DeviceName)
+	stored, err = store.GetActivityById(ctx, 2)
+	require.NoError(t, err)
+	require.False(t, stored.IsUpdated)
+
+	latest, err := store.GetUserActivities(ctx, user.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	require.Equal(t, int64(2), latest[0].ID)
+	require.Equal(t, int64(1), latest[1].ID)
+
+	require.NoError(t, store.DeleteUserActivity(ctx, 2))
+	exists, err = store.IsActivityExists(ctx, 2)
+	require.NoError(t, err)
+	require.False(t, exists)
+	all, err := store.GetUserActivities(ctx, user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+}
+
+func testStoreWebhookEventQueue(t *testing.T, store Store) {
+	ctx := context.Background()
+	event := &models.WebhookEvent{ObjectType: "activity", ObjectId: 123, AspectType: "create", OwnerId: 42, EventTime: 1700000000, Payload: "{}", NextAttemptAt: 100, CreatedAt: 100}
+	inserted, err := store.EnqueueWebhookEvent(ctx, event)
+	require.NoError(t, err)
+	require.True(t, inserted)
+	require.NotZero(t, event.ID)
+
+	duplicate := *event
+	inserted, err = store.EnqueueWebhookEvent(ctx, &duplicate)
+	require.NoError(t, err)
+	require.False(t, inserted)
+
+	claimed, err := store.ClaimWebhookEvent(ctx, 99, 400)
+	require.NoError(t, err)
+	require.Nil(t, claimed)
+
+	claimed, err = store.ClaimWebhookEvent(ctx, 100, 400)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	require.Equal(t, event.ID, claimed.ID)
+	require.Equal(t, models.WebhookEventProcessing, claimed.Status)
+	require.Equal(t, 1, claimed.Attempts)
+
+	// leased events are not handed out twice until the lease expires
+	again, err := store.ClaimWebhookEvent(ctx, 200, 500)
+	require.NoError(t, err)
+	require.Nil(t, again)
+
+	// an expired lease makes the event claimable again
+	again, err = store.ClaimWebhookEvent(ctx, 400, 700)
+	require.NoError(t, err)
+	require.NotNil(t, again)
+	require.Equal(t, 2, again.Attempts)
+
+	again.Status = models.WebhookEventDone
+	require.NoError(t, store.UpdateWebhookEvent(ctx, again))
+
+	again, err = store.ClaimWebhookEvent(ctx, 1000, 1300)
+	require.NoError(t, err)
+	require.Nil(t, again)
+}
+
+func testStoreSyncState(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+
+	state, err := store.GetSyncState(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, &models.SyncState{UserID: user.ID}, state)
+
+	state.LatestStartDate = 1700000000
+	state.BackfillBefore = 1600000000
+	state.UpdatedAt = 100
+	require.NoError(t, store.SaveSyncState(ctx, state))
+
+	state.BackfillBefore = 0
+	state.BackfillCompletedAt = 200
+	require.NoError(t, store.SaveSyncState(ctx, state))
+
+	stored, err := store.GetSyncState(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, state, stored)
+}
+
+func testConversationRepo(t *testing.T, store ConversationRepo) {
+	ctx := context.Background()
+	c, err := store.GetConversation(ctx, 555, 100)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	conversation := &models.Conversation{ChatID: 555, ActivityID: 1, ExpiresAt: 200, UpdatedAt: 100}
+	require.NoError(t, store.SaveConversation(ctx, conversation))
+	conversation.ActivityID = 2
+	conversation.AwaitingPrompt = true
+	require.NoError(t, store.SaveConversation(ctx, conversation))
+	c, err = store.GetConversation(ctx, 555, 100)
+	require.NoError(t, err)
+	require.Equal(t, conversation, c)
+	c, err = store.GetConversation(ctx, 555, 200)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	options, err := store.GetNameOptions(ctx, 555, 1, 100)
+	require.NoError(t, err)
+	require.Nil(t, options)
+
+	first := &models.NameOptions{ChatID: 555, ActivityID: 1, Names: []string{"Sunrise Tempo", "Lakeside Loop"}, Source: models.NameSourceAIOption, ExpiresAt: 300}
+	second := &models.NameOptions{ChatID: 555, ActivityID: 2, Names: []string{"City Lights"}, Source: models.NameSourceCustomPrompt, ExpiresAt: 150}
+	require.NoError(t, store.SaveNameOptions(ctx, first))
+	require.NoError(t, store.SaveNameOptions(ctx, second))
+	options, err = store.GetNameOptions(ctx, 555, 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, first, options)
+	options, err = store.GetNameOptions(ctx, 555, 2, 100)
+	require.NoError(t, err)
+	require.Equal(t, second, options)
+
+	first.Names = []string{"Harbour Dash"}
+	require.NoError(t, store.SaveNameOptions(ctx, first))
+	options, err = store.GetNameOptions(ctx, 555, 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Harbour Dash"}, options.Names)
+
+	require.NoError(t, store.DeleteNameOptions(ctx, 555, 1))
+	options, err = store.GetNameOptions(ctx, 555, 1, 100)
+	require.NoError(t, err)
+	require.Nil(t, options)
+
+	require.NoError(t, store.DeleteExpiredConversations(ctx, 250))
+	options, err = store.GetNameOptions(ctx, 555, 2, 0)
+	require.NoError(t, err)
+	require.Nil(t, options)
+	c, err = store.GetConversation(ctx, 555, 0)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	due := &models.NameOptions{ChatID: 555, ActivityID: 3, Names: []string{"Sunrise Tempo"}, Source: models.NameSourceAIOption, ExpiresAt: 1000, AutoApplyAt: 400}
+	later := &models.NameOptions{ChatID: 556, ActivityID: 4, Names: []string{"City Lights"}, Source: models.NameSourceAIOption, ExpiresAt: 1000, AutoApplyAt: 600}
+	manual := &models.NameOptions{ChatID: 557, ActivityID: 5, Names: []string{"Harbour Dash"}, Source: models.NameSourceAIOption, ExpiresAt: 1000}
+	for _, o := range []*models.NameOptions{due, later, manual} {
+		require.NoError(t, store.SaveNameOptions(ctx, o))
+	}
+	options, err = store.GetNameOptions(ctx, 555, 3, 300)
+	require.NoError(t, err)
+	require.Equal(t, due, options)
+	taken, err := store.TakeDueNameOptions(ctx, 500)
+	require.NoError(t, err)
+	require.Equal(t, []models.NameOptions{*due}, taken)
+	taken, err = store.TakeDueNameOptions(ctx, 500)
+	require.NoError(t, err)
+	require.Empty(t, taken)
+	options, err = store.GetNameOptions(ctx, 555, 3, 300)
+	require.NoError(t, err)
+	require.Nil(t, options)
+	options, err = store.GetNameOptions(ctx, 557, 5, 300)
+	require.NoError(t, err)
+	require.Equal(t, manual, options)
+}
+
+func testStoreNameHistory(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+	last, err := store.GetLastNameChange(ctx, user.ID, 0)
+	require.NoError(t, err)
+	require.Nil(t, last)
+
+	first := &models.NameChange{ActivityID: 1, UserID: user.ID, OldName: "Morning Run", NewName: "Sunrise Tempo", Source: models.NameSourceAIOption, CreatedAt: 100}
+	second := &models.NameChange{ActivityID: 1, UserID: user.ID, OldName: "Sunrise Tempo", NewName: "Lakeside Loop", Source: models.NameSourceManual, CreatedAt: 200}
+	other := &models.NameChange{ActivityID: 2, UserID: user.ID, OldName: "Evening Ride", NewName: "City Lights", Source: models.NameSourceCustomPrompt, CreatedAt: 150}
+	for _, c := range []*models.NameChange{first, second, other} {
+		require.NoError(t, store.AddNameChange(ctx, c))
+		require.NotZero(t, c.ID)
+	}
+
+	history, err := store.GetNameHistory(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []models.NameChange{*second, *first}, history)
+
+	last, err = store.GetLastNameChange(ctx, user.ID, 0)
+	require.NoError(t, err)
+	require.Equal(t, second, last)
+	last, err = store.GetLastNameChange(ctx, user.ID, 2)
+	require.NoError(t, err)
+	require.Equal(t, other, last)
+
+	// reverts are recorded but are not undone themselves
+	require.NoError(t, store.MarkNameChangeReverted(ctx, second.ID, 300))
+	revert := &models.NameChange{ActivityID: 1, UserID: user.ID, OldName: "Lakeside Loop", NewName: "Sunrise Tempo", Source: models.NameSourceRevert, CreatedAt: 300}
+	require.NoError(t, store.AddNameChange(ctx, revert))
+	last, err = store.GetLastNameChange(ctx, user.ID, 1)
+	require.NoError(t, err)
+	require.Equal(t, first, last)
+
+	history, err = store.GetNameHistory(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	require.Equal(t, int64(300), history[1].RevertedAt)
+
+	last, err = store.GetLastNameChange(ctx, user.ID+1, 0)
+	require.NoError(t, err)
+	require.Nil(t, last)
+}
+
+func activityIds(page *ActivityPage) []int64 {
+	ids := []int64{}
+	for _, a := range page.Activities {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func testStoreQueryActivities(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+	other := createTestUser(t, store, 777)
+	day := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	require.NoError(t, store.CreateUserActivities(ctx, []*models.UserActivity{
+		{ID: 1, UserID: user.ID, Name: "Morning Run", ActivityType: "Run", SportType: "Run", Description: "Easy pace along the river", StartDate: day, Distance: 10000, MovingTime: 3600, IsUpdated: true},
+		{ID: 2, UserID: user.ID, Name: "Lakeside Loop", ActivityType: "Ride", SportType: "GravelRide", StartDate: day.AddDate(0, 0, 1), Distance: 40000, MovingTime: 5400},
+		{ID: 3, UserID: user.ID, Name: "Recovery Jog", ActivityType: "Run", SportType: "TrailRun", Description: "River trail", StartDate: day.AddDate(0, 0, 2), Distance: 5000, MovingTime: 1800},
+		{ID: 4, UserID: user.ID, Name: "Evening Run", ActivityType: "Run", SportType: "Run", StartDate: day.AddDate(0, 0, 3), Distance: 8000, MovingTime: 2700},
+		{ID: 5, UserID: other.ID, Name: "Morning Run", ActivityType: "Run", StartDate: day},
+	}))
+	renamed, notRenamed := true, false
+
+	for name, tc := range map[string]struct {
+		query ActivityQuery
+		want  []int64
+	}{
+		"all":         {ActivityQuery{}, []int64{4, 3, 2, 1}},
+		"type":        {ActivityQuery{Type: "Run"}, []int64{4, 3, 1}},
+		"sport type":  {ActivityQuery{Type: "TrailRun"}, []int64{3}},
+		"date range":  {ActivityQuery{From: day.AddDate(0, 0, 1), To: day.AddDate(0, 0, 3)}, []int64{3, 2}},
+		"distance":    {ActivityQuery{MinDistance: 6000, MaxDistance: 20000}, []int64{4, 1}},
+		"duration":    {ActivityQuery{MinDuration: 3000}, []int64{2, 1}},
+		"renamed":     {ActivityQuery{Renamed: &renamed}, []int64{1}},
+		"not renamed": {ActivityQuery{Renamed: &notRenamed}, []int64{4, 3, 2}},
+		"description": {ActivityQuery{Text: "river"}, []int64{3, 1}},
+		"all words":   {ActivityQuery{Text: "Morn run"}, []int64{1}},
+		"combined":    {ActivityQuery{Type: "Run", Text: "run", MaxDistance: 9000}, []int64{4}},
+		"no match":    {ActivityQuery{Text: "marathon"}, []int64{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tc.query.UserID = user.ID
+			page, err := store.QueryActivities(ctx, tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, activityIds(page))
+			require.Empty(t, page.NextCursor)
+		})
+	}
+
+	page, err := store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Limit: 3})
+	require.NoError(t, err)
+	require.Equal(t, []int64{4, 3, 2}, activityIds(page))
+	requireActivity(t, models.UserActivity{ID: 4, UserID: user.ID, Name: "Evening Run", ActivityType: "Run", SportType: "Run", StartDate: day.AddDate(0, 0, 3), Distance: 8000, MovingTime: 2700}, &page.Activities[0])
+	require.NotEmpty(t, page.NextCursor)
+	page, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Limit: 3, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, activityIds(page))
+	require.Empty(t, page.NextCursor)
+
+	// renames are searchable right away
+	renamedActivity, err := store.GetActivityById(ctx, 2)
+	require.NoError(t, err)
+	renamedActivity.Name = "Harbour Dash"
+	require.NoError(t, store.UpdateUserActivity(ctx, renamedActivity))
+	page, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Text: "harbour"})
+	require.NoError(t, err)
+	require.Equal(t, []int64{2}, activityIds(page))
+	page, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Text: "lakeside"})
+	require.NoError(t, err)
+	require.Empty(t, page.Activities)
+
+	// query syntax in the text is matched as words
+	_, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Text: `"river AND (jog* OR`})
+	require.NoError(t, err)
+
+	_, err = store.QueryActivities(ctx, ActivityQuery{UserID: user.ID, Cursor: "not a cursor"})
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func testStoreUpsertActivities(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+	start := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	require.NoError(t, store.CreateUserActivity(ctx, &models.UserActivity{ID: 1, Name: "Sunrise Tempo", StartDate: start, IsUpdated: true}, user.ID))
+
+	var activities []*models.UserActivity
+	for id := int64(1); id <= 5; id++ {
+		activities = append(activities, &models.UserActivity{ID: id, UserID: user.ID, Name: "Morning Run", StartDate: start.Add(time.Duration(id) * time.Hour)})
+	}
+	var progress [][2]int
+	err := store.UpsertActivities(ctx, activities, BatchOptions{ChunkSize: 2, Progress: func(written int, total int) {
+		progress = append(progress, [2]int{written, total})
+	}})
+	require.NoError(t, err)
+	require.Equal(t, [][2]int{{2, 5}, {4, 5}, {5, 5}}, progress)
+
+	stored, err := store.GetUserActivities(ctx, user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, stored, 5)
+	renamed, err := store.GetActivityById(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "Morning Run", renamed.Name)
+	require.True(t, renamed.IsUpdated)
+
+	require.NoError(t, store.UpsertActivities(ctx, nil, BatchOptions{Progress: func(int, int) { t.Fatal("progress without activities") }}))
+}
+
+func testStoreUserSettings(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := createTestUser(t, store, 555)
+
+	settings, err := store.GetUserSettings(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.DefaultUserSettings(user.ID), settings)
+
+	settings.RenameMode = models.RenameModeTimeout
+	settings.RenameTimeout = 15
+	settings.UpdatedAt = 100
+	require.NoError(t, store.SaveUserSettings(ctx, settings))
+	settings.RenameMode = models.RenameModeAuto
+	settings.Language = "German"
+	settings.Units = models.UnitsImperial
+	settings.NamingStyle = models.NamingStylePoetic
+	settings.ActivityTypes = []string{"Run", "Ride"}
+	settings.MinDistance = 1500.5
+	settings.QuietHoursStart = 22
+	settings.QuietHoursEnd = 7
+	settings.Timezone = "Europe/Berlin"
+	require.NoError(t, store.SaveUserSettings(ctx, settings))
+
+	stored, err := store.GetUserSettings(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, settings, stored)
+
+	// changing the returned settings doesn't change the stored ones
+	stored.ActivityTypes[0] = "Swim"
+	// the language is the user's
+	storedUser, err := store.GetUserById(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "German", storedUser.Language)
+	storedUser.Language = "French"
+	require.NoError(t, store.UpdateUser(ctx, storedUser))
+	stored, err = store.GetUserSettings(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "French", stored.Language)
+	require.Equal(t, []string{"Run", "Ride"}, stored.ActivityTypes)
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// SyncStateRepo keeps how far the activities of every user have been synced from Strava.
+type SyncStateRepo interface {
+	GetSyncState(ctx context.Context, userId int64) (*models.SyncState, error)
+	SaveSyncState(ctx context.Context, state *models.SyncState) error
+}
+
+// GetSyncState returns the activity sync progress of the user, a zero state when nothing was synced yet.
+func (s *SQLiteStore) GetSyncState(ctx context.Context, userId int64) (*models.SyncState, error) {
+	query := `SELECT user_id, latest_start_date, backfill_before, backfill_completed_at, updated_at FROM activity_sync_state WHERE user_id = ?`
+	state := &models.SyncState{}
+	err := s.DB.QueryRowContext(ctx, query, userId).Scan(&state.UserID, &state.LatestStartDate, &state.BackfillBefore, &state.BackfillCompletedAt, &state.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.SyncState{UserID: userId}, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching sync state", "userId", userId)
+		return nil, err
+	}
+	return state, nil
+}
+
+// SaveSyncState stores the sync progress of state.UserID.
+func (s *SQLiteStore) SaveSyncState(ctx context.Context, state *models.SyncState) error {
+	query := `
+    INSERT INTO activity_sync_state (user_id, latest_start_date, backfill_before, backfill_completed_at, updated_at)
+    VALUES (?, ?, ?, ?, ?)
+    ON CONFLICT(user_id) DO UPDATE SET
+        latest_start_date = excluded.latest_start_date,
+        backfill_before = excluded.backfill_before,
+        backfill_completed_at = excluded.backfill_completed_at,
+        updated_at = excluded.updated_at
+  `
+	_, err := s.DB.ExecContext(ctx, query, state.UserID, state.LatestStartDate, state.BackfillBefore, state.BackfillCompletedAt, state.UpdatedAt)
+	if err != nil {
+		slog.Error("error while saving sync state", "userId", state.UserID)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// UserSettingsRepo keeps the preferences of every user.
+type UserSettingsRepo interface {
+	GetUserSettings(ctx context.Context, userId int64) (*models.UserSettings, error)
+	SaveUserSettings(ctx context.Context, settings *models.UserSettings) error
+}
+
+// userSettingsQueries are the statements of one dialect that read and write the settings.
+// The language is kept in users, the other settings in user_settings.
+type userSettingsQueries struct {
+	getLanguage  string
+	get          string
+	saveLanguage string
+	save         string
+}
+
+var sqliteUserSettingsQueries = userSettingsQueries{
+	getLanguage: `SELECT COALESCE(language, '') FROM users WHERE id = ?`,
+	get: `
+    SELECT rename_mode, rename_timeout, units, naming_style, activity_types, min_distance,
+        quiet_hours_start, quiet_hours_end, timezone, updated_at
+    FROM user_settings WHERE user_id = ?`,
+	saveLanguage: `UPDATE users SET language = ? WHERE id = ?`,
+	save: `
+    INSERT INTO user_settings (user_id, rename_mode, rename_timeout, units, naming_style, activity_types,
+        min_distance, quiet_hours_start, quiet_hours_end, timezone, updated_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT(user_id) DO UPDATE SET
+        rename_mode = excluded.rename_mode,
+        rename_timeout = excluded.rename_timeout,
+        units = excluded.units,
+        naming_style = excluded.naming_style,
+        activity_types = excluded.activity_types,
+        min_distance = excluded.min_distance,
+        quiet_hours_start = excluded.quiet_hours_start,
+        quiet_hours_end = excluded.quiet_hours_end,
+        timezone = excluded.timezone,
+        updated_at = excluded.updated_at
+  `,
+}
+
+// GetUserSettings returns the settings of the user, models.DefaultUserSettings when they were never saved.
+// The language is the user's, read with models.LanguageOrDefault.
+func (s *SQLiteStore) GetUserSettings(ctx context.Context, userId int64) (*models.UserSettings, error) {
+	return getUserSettings(ctx, s.DB, sqliteUserSettingsQueries, userId)
+}
+
+// SaveUserSettings stores the settings of settings.UserID, the language as the user's.
+func (s *SQLiteStore) SaveUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	return saveUserSettings(ctx, s.DB, sqliteUserSettingsQueries, settings)
+}
+
+func getUserSettings(ctx context.Context, db *sql.DB, queries userSettingsQueries, userId int64) (*models.UserSettings, error) {
+	settings := models.DefaultUserSettings(userId)
+	var language string
+	err := db.QueryRowContext(ctx, queries.getLanguage, userId).Scan(&language)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("error while fetching user language", "userId", userId)
+		return nil, err
+	}
+	settings.Language = models.LanguageOrDefault(language)
+	var activityTypes string
+	err = db.QueryRowContext(ctx, queries.get, userId).Scan(&settings.RenameMode, &settings.RenameTimeout, &settings.Units,
+		&settings.NamingStyle, &activityTypes, &settings.MinDistance, &settings.QuietHoursStart, &settings.QuietHoursEnd,
+		&settings.Timezone, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+	if err != nil {
+		slog.Error("error while fetching user settings", "userId", userId)
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(activityTypes), &settings.ActivityTypes); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func saveUserSettings(ctx context.Context, db *sql.DB, queries userSettingsQueries, settings *models.UserSettings) error {
+	activityTypes := settings.ActivityTypes
+	if activityTypes == nil {
+		activityTypes = []string{}
+	}
+	encodedTypes, err := json.Marshal(activityTypes)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err = tx.ExecContext(ctx, queries.saveLanguage, settings.Language, settings.UserID); err != nil {
+		slog.Error("error while saving user language", "userId", settings.UserID)
+		return err
+	}
+	_, err = tx.ExecContext(ctx, queries.save, settings.UserID, settings.RenameMode, settings.RenameTimeout, settings.Units,
+		settings.NamingStyle, string(encodedTypes), settings.MinDistance, settings.QuietHoursStart, settings.QuietHoursEnd,
+		settings.Timezone, settings.UpdatedAt)
+	if err != nil {
+		slog.Error("error while saving user settings", "userId", settings.UserID)
+		return err
+	}
+	return tx.Commit()
+}
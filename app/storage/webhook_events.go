@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// WebhookEventRepo is the durable queue of Strava webhook events.
+type WebhookEventRepo interface {
+	// EnqueueWebhookEvent stores a new pending event, reporting false for a redelivery.
+	EnqueueWebhookEvent(ctx context.Context, event *models.WebhookEvent) (bool, error)
+	// ClaimWebhookEvent leases the next due event until leaseUntil, nil when none is due at now.
+	ClaimWebhookEvent(ctx context.Context, now int64, leaseUntil int64) (*models.WebhookEvent, error)
+	UpdateWebhookEvent(ctx context.Context, event *models.WebhookEvent) error
+}
+
+const webhookEventColumns = `id, object_type, object_id, aspect_type, owner_id, event_time, payload, status, attempts, next_attempt_at, last_error, created_at`
+
+// EnqueueWebhookEvent stores a new pending event. It returns false when an event with the same
+// object_id, aspect_type and event_time was already stored, so redeliveries are processed once.
+func (s *SQLiteStore) EnqueueWebhookEvent(ctx context.Context, event *models.WebhookEvent) (bool, error) {
+	query := `
+    INSERT INTO webhook_events (
+        object_type, object_id, aspect_type, owner_id, event_time, payload, status, attempts, next_attempt_at, last_error, created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, '', ?)
+    ON CONFLICT(object_id, aspect_type, event_time) DO NOTHING
+  `
+	event.Status = models.WebhookEventPending
+	result, err := s.DB.ExecContext(ctx, query, event.ObjectType, event.ObjectId, event.AspectType, event.OwnerId, event.EventTime,
+		event.Payload, event.Status, event.NextAttemptAt, event.CreatedAt)
+	if err != nil {
+		slog.Error("error while enqueueing webhook event", "object_id", event.ObjectId, "aspect_type", event.AspectType)
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+	event.ID, err = result.LastInsertId()
+	return true, err
+}
+
+// ClaimWebhookEvent picks the oldest event that is due at now and leases it until leaseUntil.
+// Events left in processing state by a crashed worker become claimable again once the lease expires.
+// It returns nil when there is nothing to process.
+func (s *SQLiteStore) ClaimWebhookEvent(ctx context.Context, now int64, leaseUntil int64) (*models.WebhookEvent, error) {
+	query := `
+    UPDATE webhook_events
+    SET status = ?, attempts = attempts + 1, next_attempt_at = ?
+    WHERE id = (
+        SELECT id FROM webhook_events
+        WHERE status IN (?, ?) AND next_attempt_at <= ?
+        ORDER BY next_attempt_at, id
+        LIMIT 1
+    )
+    RETURNING ` + webhookEventColumns
+	event := &models.WebhookEvent{}
+	err := s.DB.QueryRowContext(ctx, query, models.WebhookEventProcessing, leaseUntil, models.WebhookEventPending, models.WebhookEventProcessing, now).
+		Scan(&event.ID, &event.ObjectType, &event.ObjectId, &event.AspectType, &event.OwnerId, &event.EventTime, &event.Payload,
+			&event.Status, &event.Attempts, &event.NextAttemptAt, &event.LastError, &event.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("error while claiming webhook event")
+		return nil, err
+	}
+	return event, nil
+}
+
+func (s *SQLiteStore) UpdateWebhookEvent(ctx context.Context, event *models.WebhookEvent) error {
+	query := `
+    UPDATE webhook_events
+    SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?
+    WHERE id = ?
+  `
+	_, err := s.DB.ExecContext(ctx, query, event.Status, event.Attempts, event.NextAttemptAt, event.LastError, event.ID)
+	if err != nil {
+		slog.Error("error while updating webhook event", "id", event.ID)
+		return err
+	}
+	return nil
+}
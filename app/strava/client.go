@@ -2,19 +2,27 @@ package strava
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"stravach/app/storage/models"
-	"stravach/app/utils"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Client struct {
 	ClientId     string
 	ClientSecret string
+	// BaseUrl is the Strava host, e.g. https://www.strava.com, without trailing slash.
+	BaseUrl string
+	HTTP    HTTPClient
+	// Limiter guards the app-wide rate limit, DefaultRateLimiter when nil.
+	Limiter *RateLimiter
 }
 
 type AuthReqBody struct {
@@ -46,47 +54,44 @@ type HTTPClient interface {
 }
 
 const (
-	authUrl              = "https://www.strava.com/oauth/token"
-	athleteActivitiesUrl = "https://www.strava.com/api/v3/athlete/activities"
-	activityUrl          = "https://www.strava.com/api/v3/activities"
-)
-
-var Handler HTTPClient
+	DefaultBaseUrl = "https://www.strava.com"
 
-func init() {
-	Handler = &http.Client{}
-}
+	authorizePath         = "/oauth/authorize"
+	authPath              = "/oauth/token"
+	athleteActivitiesPath = "/api/v3/athlete/activities"
+	activityPath          = "/api/v3/activities"
+	// activitiesPerPage is Strava's maximum page size, so backfills use as few calls as possible.
+	activitiesPerPage = 200
+)
 
 type StravaService interface {
 	Authorize(accessCode string) (*AuthResp, error)
 	RefreshAccessToken(refreshToken string) (*AuthResp, error)
 	GetActivity(accessToken string, activityId int64) (*models.UserActivity, error)
-	GetAllActivities(accessToken string) (*[]models.UserActivity, error)
+	ListActivities(ctx context.Context, accessToken string, query ActivitiesQuery) ([]models.UserActivity, error)
 	UpdateActivity(accessToken string, activity models.UserActivity) (*models.UserActivity, error)
-	GetLatestActivities(accessToken string, limit int) ([]models.UserActivity, error)
+	GetLatestActivities(ctx context.Context, accessToken string, limit int) ([]models.UserActivity, error)
+	AuthorizationUrl(redirectUri string, scope string, state string) string
 }
 
 var _ StravaService = (*Client)(nil)
 
 // GetLatestActivities fetches the most recent N activities for the user.
-func (c *Client) GetLatestActivities(accessToken string, limit int) ([]models.UserActivity, error) {
-	url := fmt.Sprintf("%s?per_page=%d&page=1", athleteActivitiesUrl, limit)
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) GetLatestActivities(ctx context.Context, accessToken string, limit int) ([]models.UserActivity, error) {
+	url := fmt.Sprintf("%s?per_page=%d&page=1", c.url(athleteActivitiesPath), limit)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		slog.Error("error occurred during request creation")
 		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	var activities []models.UserActivity
-	resp, err := Handler.Do(req)
+	resp, err := c.do(req, PriorityBackground)
 	if err != nil {
-		slog.Error("error occurred during request handling")
+		slog.Error("error occurred during request handling", "err", err)
 		return nil, err
 	}
-	if resp == nil || resp.StatusCode == 401 {
-		slog.Error("received unsuccessful response")
-		return nil, errors.New(utils.UNAUTHORIZED)
-	}
+	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&activities)
 	if err != nil {
 		slog.Error("error occurred during response decode handling")
@@ -98,10 +103,75 @@ func (c *Client) GetLatestActivities(accessToken string, limit int) ([]models.Us
 func NewStravaClient() *Client {
 	clientId := os.Getenv("STRAVA_CLIENT_ID")
 	clientSecret := os.Getenv("STRAVA_CLIENT_SECRET")
+	baseUrl := os.Getenv("STRAVA_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
 	return &Client{
 		ClientId:     clientId,
 		ClientSecret: clientSecret,
+		BaseUrl:      strings.TrimSuffix(baseUrl, "/"),
+		HTTP:         &http.Client{Timeout: 30 * time.Second},
+		Limiter:      DefaultRateLimiter,
+	}
+}
+
+// url returns the absolute URL of path on the configured Strava host.
+func (c *Client) url(path string) string {
+	if c.BaseUrl == "" {
+		return DefaultBaseUrl + path
 	}
+	return c.BaseUrl + path
+}
+
+// do sends req once the rate limiter admits it. Non-2xx responses are returned as *APIError,
+// 429s as *RateLimitError. On success the caller closes the body.
+func (c *Client) do(req *http.Request, priority Priority) (*http.Response, error) {
+	limiter := c.Limiter
+	if limiter == nil {
+		limiter = DefaultRateLimiter
+	}
+	err := limiter.Acquire(req.Context(), priority)
+	if err != nil {
+		ErrorCounts.Add(ErrorKind(err), 1)
+		slog.Warn("strava call held back by rate limiter", "path", req.URL.Path, "priority", priority, "err", err)
+		return nil, err
+	}
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	limiter.Update(resp.Header)
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := newAPIError(resp)
+	ErrorCounts.Add(ErrorKind(apiErr), 1)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rateErr := limiter.Exceeded(resp.Header)
+		rateErr.Err = apiErr
+		slog.Warn("strava rate limit exceeded", "path", req.URL.Path, "retryAfter", rateErr.RetryAfter)
+		return nil, rateErr
+	}
+	slog.Warn("strava call failed", "path", req.URL.Path, "status", resp.StatusCode, "err", apiErr)
+	return nil, apiErr
+}
+
+// AuthorizationUrl returns the Strava consent page URL that redirects back to redirectUri with state.
+func (c *Client) AuthorizationUrl(redirectUri string, scope string, state string) string {
+	query := url.Values{}
+	query.Set("client_id", c.ClientId)
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", redirectUri)
+	query.Set("approval_prompt", "force")
+	query.Set("scope", scope)
+	query.Set("state", state)
+	return c.url(authorizePath) + "?" + query.Encode()
 }
 
 func (c *Client) Authorize(accessCode string) (*AuthResp, error) {
@@ -115,7 +185,7 @@ func (c *Client) RefreshAccessToken(refreshToken string) (*AuthResp, error) {
 }
 
 func (c *Client) GetActivity(accessToken string, activityId int64) (*models.UserActivity, error) {
-	url := fmt.Sprintf("https://www.strava.com/api/v3/activities/%d?include_all_efforts=", activityId)
+	url := fmt.Sprintf("%s/%d?include_all_efforts=", c.url(activityPath), activityId)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		slog.Error("error occured during request creation")
@@ -123,16 +193,12 @@ func (c *Client) GetActivity(accessToken string, activityId int64) (*models.User
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	var activity models.UserActivity
-	resp, err := Handler.Do(req)
+	resp, err := c.do(req, PriorityUrgent)
 	if err != nil {
-		slog.Error("error occured during request handling")
+		slog.Error("error occured during request handling", "err", err)
 		return nil, err
 	}
-	if resp.StatusCode >= 300 {
-		slog.Error("got bad resp from strava", "status", resp.Status)
-		utils.DebugResponse(resp)
-		return nil, errors.New("bad response from strava")
-	}
+	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&activity)
 	if err != nil {
 		slog.Error("error occured during response decode handling")
@@ -141,27 +207,18 @@ func (c *Client) GetActivity(accessToken string, activityId int64) (*models.User
 	return &activity, nil
 }
 
-func (c *Client) GetAllActivities(accessToken string) (*[]models.UserActivity, error) {
-	curPage := 1
-	var totalActivities []models.UserActivity
-	for {
-		curActivities, err := getActivities(accessToken, curPage)
-		if err != nil {
-			slog.Error("error while fetching activities")
-			return nil, err
-		}
-		if len(curActivities) == 0 {
-			slog.Info("finished fetching activities")
-			break
-		}
-		totalActivities = append(totalActivities, curActivities...)
-		curPage++
-	}
-	return &totalActivities, nil
+// ActivitiesQuery selects a page of the athlete's activities. After and Before are unix
+// timestamps of the activity start, zero means unbounded. With only After set Strava
+// returns the oldest activities first.
+type ActivitiesQuery struct {
+	After   int64
+	Before  int64
+	Page    int
+	PerPage int
 }
 
 func (c *Client) UpdateActivity(accessToken string, activity models.UserActivity) (*models.UserActivity, error) {
-	url := fmt.Sprintf("%s/%d", activityUrl, activity.ID)
+	url := fmt.Sprintf("%s/%d", c.url(activityPath), activity.ID)
 	updActivity := UpdatableActivity{Name: activity.Name}
 	body, err := json.Marshal(updActivity)
 	if err != nil {
@@ -177,16 +234,12 @@ func (c *Client) UpdateActivity(accessToken string, activity models.UserActivity
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := Handler.Do(req)
+	resp, err := c.do(req, PriorityUrgent)
 	if err != nil {
-		slog.Error("error occurred during request creation")
+		slog.Error("error occurred during request creation", "err", err)
 		return nil, err
 	}
-
-	if resp.StatusCode >= 300 {
-		utils.DebugResponse(resp)
-		return nil, errors.New("received unsuccessful response")
-	}
+	defer resp.Body.Close()
 
 	var updatedActivity models.UserActivity
 	err = json.NewDecoder(resp.Body).Decode(&updatedActivity)
@@ -197,24 +250,34 @@ func (c *Client) UpdateActivity(accessToken string, activity models.UserActivity
 	return &updatedActivity, nil
 }
 
-func getActivities(accessToken string, page int) ([]models.UserActivity, error) {
-	url := fmt.Sprintf("%s?page=%d", athleteActivitiesUrl, page)
-	req, err := http.NewRequest("GET", url, nil)
+// ListActivities fetches one page of the athlete's activities.
+func (c *Client) ListActivities(ctx context.Context, accessToken string, query ActivitiesQuery) ([]models.UserActivity, error) {
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(max(query.Page, 1)))
+	perPage := query.PerPage
+	if perPage <= 0 {
+		perPage = activitiesPerPage
+	}
+	params.Set("per_page", strconv.Itoa(perPage))
+	if query.After > 0 {
+		params.Set("after", strconv.FormatInt(query.After, 10))
+	}
+	if query.Before > 0 {
+		params.Set("before", strconv.FormatInt(query.Before, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url(athleteActivitiesPath)+"?"+params.Encode(), nil)
 	if err != nil {
 		slog.Error("error occurred during request creation")
 		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	var activities []models.UserActivity
-	resp, err := Handler.Do(req)
+	resp, err := c.do(req, PriorityBackground)
 	if err != nil {
-		slog.Error("error occurred during request handling")
+		slog.Error("error occurred during request handling", "err", err)
 		return nil, err
 	}
-	if resp == nil || resp.StatusCode == 401 {
-		slog.Error("received unsuccessful response")
-		return nil, errors.New(utils.UNAUTHORIZED)
-	}
+	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&activities)
 	if err != nil {
 		slog.Error("error occurred during response decode handling")
@@ -224,21 +287,23 @@ func getActivities(accessToken string, page int) ([]models.UserActivity, error)
 }
 
 func (c *Client) auth(authPayload AuthReqBody) (*AuthResp, error) {
-	url := fmt.Sprintf("%s?client_id=%s&client_secret=%s&code=%s&refresh_token=%s&grant_type=%s", authUrl, authPayload.ClientId, authPayload.ClientSecret, authPayload.Code, authPayload.RefreshToken, authPayload.GrantType)
-	slog.Debug(url)
-	req, err := http.NewRequest("POST", url, nil)
+	query := url.Values{}
+	query.Set("client_id", authPayload.ClientId)
+	query.Set("client_secret", authPayload.ClientSecret)
+	query.Set("code", authPayload.Code)
+	query.Set("refresh_token", authPayload.RefreshToken)
+	query.Set("grant_type", authPayload.GrantType)
+	req, err := http.NewRequest("POST", c.url(authPath)+"?"+query.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
 	var authResp AuthResp
-	resp, err := Handler.Do(req)
+	resp, err := c.do(req, PriorityUrgent)
 	if err != nil {
-		slog.Error("error while fetching auth request from strava")
+		slog.Error("error while fetching auth request from strava", "err", err)
 		return nil, err
 	}
-	if resp.StatusCode >= 300 {
-		utils.DebugResponse(resp)
-	}
+	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&authResp)
 	if err != nil {
 		return nil, err
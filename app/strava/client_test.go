@@ -1,14 +1,19 @@
 package strava
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"stravach/app/storage/models"
+	"stravach/app/strava/fakestrava"
 )
 
 type roundTripperFunc func(req *http.Request) (*http.Response, error)
@@ -17,37 +22,128 @@ func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req)
 }
 
-func TestGetAllActivities_MultiplePages(t *testing.T) {
-	calledPages := []int{}
-	Handler = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
-		pageStr := req.URL.Query().Get("page")
-		page, _ := strconv.Atoi(pageStr)
-		calledPages = append(calledPages, page)
-		var body string
-		if page == 1 {
-			body = `[{"id":1},{"id":2}]`
-		} else {
-			body = `[]`
-		}
-		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
-	})}
-	defer func() { Handler = &http.Client{} }()
+func TestListActivities_EncodesQuery(t *testing.T) {
+	var query url.Values
+	c := &Client{HTTP: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		query = req.URL.Query()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`[{"id":1},{"id":2}]`))}, nil
+	})}}
 
-	c := &Client{}
-	activities, err := c.GetAllActivities("token")
+	activities, err := c.ListActivities(context.Background(), "token", ActivitiesQuery{After: 1700000000, Page: 2})
 	require.NoError(t, err)
-	require.Len(t, *activities, 2)
-	require.Equal(t, []int{1, 2}, calledPages)
+	require.Len(t, activities, 2)
+	require.Equal(t, "2", query.Get("page"))
+	require.Equal(t, strconv.Itoa(activitiesPerPage), query.Get("per_page"))
+	require.Equal(t, "1700000000", query.Get("after"))
+	require.False(t, query.Has("before"))
 }
 
 func TestUpdateActivity_ReturnsUpdated(t *testing.T) {
-	Handler = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+	c := &Client{HTTP: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
 		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"id":123,"name":"Updated"}`))}, nil
-	})}
-	defer func() { Handler = &http.Client{} }()
+	})}}
 
-	c := &Client{}
 	updated, err := c.UpdateActivity("token", models.UserActivity{ID: 123, Name: "Old"})
 	require.NoError(t, err)
 	require.Equal(t, "Updated", updated.Name)
 }
+
+func TestGetActivity_DecodesDetails(t *testing.T) {
+	body := `{"id":123,"name":"Morning Run","type":"Run","sport_type":"TrailRun","description":"Hills",
+		"total_elevation_gain":312.5,"elev_high":820.1,"elev_low":507.6,"start_latlng":[46.55,7.98],"end_latlng":[],
+		"map":{"id":"a123","summary_polyline":"u{~vFvyys@fS]","resource_state":3},"max_speed":5.2,"max_heartrate":181.0,
+		"average_cadence":86.1,"average_watts":301.4,"weighted_average_watts":315,"kilojoules":1250.7,"calories":1120.3,
+		"gear_id":null,"device_name":"Garmin Fenix 7","timezone":"(GMT+01:00) Europe/Zurich",
+		"trainer":false,"commute":true,"manual":false,"private":true}`
+	c := &Client{HTTP: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})}}
+
+	activity, err := c.GetActivity("token", 123)
+	require.NoError(t, err)
+	require.Equal(t, "TrailRun", activity.SportType)
+	require.Equal(t, "Hills", activity.Description)
+	require.Equal(t, 312.5, activity.TotalElevationGain)
+	require.Equal(t, []float64{46.55, 7.98}, activity.StartLatLng)
+	require.Empty(t, activity.EndLatLng)
+	require.Equal(t, "u{~vFvyys@fS]", activity.Map.SummaryPolyline)
+	require.Equal(t, 315.0, activity.WeightedAverageWatts)
+	require.Empty(t, activity.GearID)
+	require.Equal(t, "Garmin Fenix 7", activity.DeviceName)
+	require.Equal(t, "(GMT+01:00) Europe/Zurich", activity.Timezone)
+	require.True(t, activity.Commute)
+	require.True(t, activity.Private)
+}
+
+func TestAuthorizationUrl_UsesBaseUrl(t *testing.T) {
+	c := &Client{ClientId: "42", BaseUrl: "http://localhost:8081"}
+	authUrl, err := url.Parse(c.AuthorizationUrl("https://stravabot.pro/api/auth-callback", "read,activity:write", "state"))
+	require.NoError(t, err)
+	require.Equal(t, "localhost:8081", authUrl.Host)
+	require.Equal(t, "/oauth/authorize", authUrl.Path)
+	require.Equal(t, "42", authUrl.Query().Get("client_id"))
+	require.Equal(t, "https://stravabot.pro/api/auth-callback", authUrl.Query().Get("redirect_uri"))
+	require.Equal(t, "state", authUrl.Query().Get("state"))
+}
+
+func TestClient_AgainstFakeStrava(t *testing.T) {
+	fake := fakestrava.New("client", "secret")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := &Client{ClientId: "client", ClientSecret: "secret", BaseUrl: srv.URL, HTTP: srv.Client()}
+
+	fake.AddAthlete(fakestrava.Athlete{Id: 7, Username: "runner"})
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	for i := 0; i < 35; i++ {
+		fake.AddActivity(7, fakestrava.Activity{Name: "Morning Run", Type: "Run", StartDate: start.Add(time.Duration(i) * time.Hour)})
+	}
+	token := fake.IssueToken(7)
+
+	refreshed, err := c.RefreshAccessToken(token.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, token.AccessToken, refreshed.AccessToken)
+
+	activities, err := c.ListActivities(context.Background(), refreshed.AccessToken, ActivitiesQuery{PerPage: 50})
+	require.NoError(t, err)
+	require.Len(t, activities, 35)
+
+	latest := activities[0]
+	latest.Name = "Renamed"
+	_, err = c.UpdateActivity(refreshed.AccessToken, latest)
+	require.NoError(t, err)
+	stored, ok := fake.Activity(latest.ID)
+	require.True(t, ok)
+	require.Equal(t, "Renamed", stored.Name)
+
+	fetched, err := c.GetActivity(refreshed.AccessToken, latest.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Renamed", fetched.Name)
+
+	_, err = c.GetLatestActivities(context.Background(), "bogus", 10)
+	require.Error(t, err)
+}
+
+func TestListActivities_AfterCursor(t *testing.T) {
+	fake := fakestrava.New("client", "secret")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := &Client{BaseUrl: srv.URL, HTTP: srv.Client(), Limiter: NewRateLimiter()}
+
+	fake.AddAthlete(fakestrava.Athlete{Id: 7})
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		fake.AddActivity(7, fakestrava.Activity{Id: int64(i + 1), StartDate: start.Add(time.Duration(i) * time.Hour)})
+	}
+	token := fake.IssueToken(7)
+
+	activities, err := c.ListActivities(context.Background(), token.AccessToken, ActivitiesQuery{After: start.Add(time.Hour).Unix(), PerPage: 2})
+	require.NoError(t, err)
+	require.Len(t, activities, 2)
+	require.Equal(t, int64(3), activities[0].ID)
+	require.Equal(t, int64(4), activities[1].ID)
+
+	activities, err = c.ListActivities(context.Background(), token.AccessToken, ActivitiesQuery{Before: start.Add(2 * time.Hour).Unix()})
+	require.NoError(t, err)
+	require.Len(t, activities, 2)
+	require.Equal(t, int64(2), activities[0].ID)
+}
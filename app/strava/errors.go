@@ -0,0 +1,116 @@
+package strava
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Sentinels for errors.Is. *APIError and *RateLimitError match the one for their status.
+var (
+	ErrUnauthorized = errors.New("strava: unauthorized")
+	ErrForbidden    = errors.New("strava: forbidden")
+	ErrNotFound     = errors.New("strava: not found")
+	ErrServer       = errors.New("strava: server error")
+)
+
+// ErrorCounts counts failed Strava calls by kind, published as the strava_errors expvar.
+var ErrorCounts = expvar.NewMap("strava_errors")
+
+const maxErrorBody = 64 << 10
+
+// FaultError is one entry of the errors list in Strava's fault body.
+type FaultError struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+}
+
+// APIError is a non-2xx response from Strava with its fault body.
+type APIError struct {
+	StatusCode int          `json:"-"`
+	Message    string       `json:"message"`
+	Errors     []FaultError `json:"errors"`
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	_ = json.Unmarshal(body, apiErr)
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "strava responded %d: %s", e.StatusCode, e.Message)
+	for _, f := range e.Errors {
+		fmt.Fprintf(&b, " (%s %s %s)", f.Resource, f.Field, f.Code)
+	}
+	return b.String()
+}
+
+// MissingScope reports whether the token lacks a permission, e.g. activity:write.
+// Strava answers these with 401, but refreshing the token doesn't help.
+func (e *APIError) MissingScope() bool {
+	for _, f := range e.Errors {
+		if f.Code == "missing" && strings.HasSuffix(f.Field, "_permission") {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidGrant reports a refresh token or authorization code the token endpoint no longer accepts.
+func (e *APIError) invalidGrant() bool {
+	if e.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, f := range e.Errors {
+		if f.Resource == "RefreshToken" || f.Resource == "AuthorizationCode" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return (e.StatusCode == http.StatusUnauthorized && !e.MissingScope()) || e.invalidGrant()
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden || e.MissingScope()
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// ErrorKind names the class of a Strava error for logs and metrics.
+func ErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrServer):
+		return "server"
+	default:
+		return "other"
+	}
+}
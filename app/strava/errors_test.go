@@ -0,0 +1,68 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"stravach/app/strava/fakestrava"
+)
+
+func TestAPIError_Is(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+		not    error
+	}{
+		{"invalid token", 401, `{"message":"Authorization Error","errors":[{"resource":"Athlete","field":"access_token","code":"invalid"}]}`, ErrUnauthorized, ErrForbidden},
+		{"missing scope", 401, `{"message":"Authorization Error","errors":[{"resource":"AccessToken","field":"activity:write_permission","code":"missing"}]}`, ErrForbidden, ErrUnauthorized},
+		{"forbidden", 403, `{"message":"Forbidden"}`, ErrForbidden, ErrUnauthorized},
+		{"not found", 404, `{"message":"Record Not Found"}`, ErrNotFound, ErrServer},
+		{"server error", 502, `<html>bad gateway</html>`, ErrServer, ErrNotFound},
+		{"revoked refresh token", 400, `{"message":"Bad Request","errors":[{"resource":"RefreshToken","field":"refresh_token","code":"invalid"}]}`, ErrUnauthorized, ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Limiter: NewRateLimiter(), HTTP: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tt.body))}, nil
+			})}}
+
+			_, err := c.GetActivity("token", 1)
+			require.ErrorIs(t, err, tt.want)
+			require.False(t, errors.Is(err, tt.not))
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			require.Equal(t, tt.status, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestClient_TypedErrorsFromFakeStrava(t *testing.T) {
+	fake := fakestrava.New("client", "secret")
+	fake.AddAthlete(fakestrava.Athlete{Id: 7})
+	token := fake.IssueToken(7)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := &Client{ClientId: "client", ClientSecret: "secret", BaseUrl: srv.URL, HTTP: srv.Client(), Limiter: NewRateLimiter()}
+
+	_, err := c.GetActivity(token.AccessToken, 404)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, "Record Not Found", apiErr.Message)
+	require.Equal(t, "Activity", apiErr.Errors[0].Resource)
+
+	_, err = c.GetLatestActivities(context.Background(), "expired", 10)
+	require.ErrorIs(t, err, ErrUnauthorized)
+	require.Equal(t, "unauthorized", ErrorKind(err))
+
+	_, err = c.RefreshAccessToken("revoked")
+	require.ErrorIs(t, err, ErrUnauthorized)
+}
@@ -0,0 +1,570 @@
+// Package fakestrava is an in-memory stand-in for the parts of the Strava API used by the bot:
+// OAuth, athlete activities, activity GET/PUT, push subscriptions and the X-RateLimit headers.
+// It is used by end-to-end tests and can be run locally with `stravach fake-strava`.
+package fakestrava
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 200
+	apiPrefix      = "/api/v3/"
+)
+
+type Athlete struct {
+	Id       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type AthleteRef struct {
+	Id int64 `json:"id"`
+}
+
+type Activity struct {
+	Id               int64      `json:"id"`
+	Athlete          AthleteRef `json:"athlete"`
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	SportType        string     `json:"sport_type"`
+	Distance         float64    `json:"distance"`
+	MovingTime       int64      `json:"moving_time"`
+	ElapsedTime      int64      `json:"elapsed_time"`
+	StartDate        time.Time  `json:"start_date"`
+	AverageHeartrate float64    `json:"average_heartrate"`
+	AverageSpeed     float64    `json:"average_speed"`
+}
+
+type Subscription struct {
+	Id            int64  `json:"id"`
+	ApplicationId int64  `json:"application_id"`
+	CallbackUrl   string `json:"callback_url"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// Event is a push event as delivered to the subscription callback.
+type Event struct {
+	ObjectType     string            `json:"object_type"`
+	ObjectId       int64             `json:"object_id"`
+	AspectType     string            `json:"aspect_type"`
+	Updates        map[string]string `json:"updates"`
+	OwnerId        int64             `json:"owner_id"`
+	SubscriptionId int64             `json:"subscription_id"`
+	EventTime      int64             `json:"event_time"`
+}
+
+// Token is an issued access/refresh token pair.
+type Token struct {
+	TokenType    string   `json:"token_type"`
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresAt    int64    `json:"expires_at"`
+	ExpiresIn    int64    `json:"expires_in"`
+	Athlete      *Athlete `json:"athlete,omitempty"`
+}
+
+type accessToken struct {
+	athleteId int64
+	expiresAt int64
+}
+
+// Server implements http.Handler. When ClientId is set, OAuth and subscription calls
+// must present matching client credentials.
+type Server struct {
+	ClientId     string
+	ClientSecret string
+	TokenTTL     time.Duration
+	// HTTP is used to verify subscription callbacks and deliver push events.
+	HTTP *http.Client
+
+	mu             sync.Mutex
+	mux            *http.ServeMux
+	seq            int64
+	defaultAthlete int64
+	athletes       map[int64]*Athlete
+	codes          map[string]int64
+	accessTokens   map[string]accessToken
+	refreshTokens  map[string]int64
+	activities     map[int64]*Activity
+	subscription   *Subscription
+	shortLimit     int
+	longLimit      int
+	shortUsage     int
+	longUsage      int
+}
+
+func New(clientId string, clientSecret string) *Server {
+	s := &Server{
+		ClientId:      clientId,
+		ClientSecret:  clientSecret,
+		TokenTTL:      6 * time.Hour,
+		HTTP:          &http.Client{Timeout: 10 * time.Second},
+		athletes:      map[int64]*Athlete{},
+		codes:         map[string]int64{},
+		accessTokens:  map[string]accessToken{},
+		refreshTokens: map[string]int64{},
+		activities:    map[int64]*Activity{},
+		shortLimit:    200,
+		longLimit:     2000,
+	}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /oauth/authorize", s.authorize)
+	s.mux.HandleFunc("POST /oauth/token", s.token)
+	s.mux.HandleFunc("GET /api/v3/athlete/activities", s.withAthlete(s.listActivities))
+	s.mux.HandleFunc("GET /api/v3/activities/{id}", s.withAthlete(s.getActivity))
+	s.mux.HandleFunc("PUT /api/v3/activities/{id}", s.withAthlete(s.updateActivity))
+	s.mux.HandleFunc("GET /api/v3/push_subscriptions", s.withClient(s.listSubscriptions))
+	s.mux.HandleFunc("POST /api/v3/push_subscriptions", s.withClient(s.createSubscription))
+	s.mux.HandleFunc("DELETE /api/v3/push_subscriptions/{id}", s.withClient(s.deleteSubscription))
+	s.mux.HandleFunc("POST /fake/athletes/{id}/activities", s.createActivity)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix) && !s.countRequest(w) {
+		writeFault(w, http.StatusTooManyRequests, "Rate Limit Exceeded", "Application", "rate limit", "exceeded")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetRateLimit sets the 15-minute and daily request limits and resets the usage.
+func (s *Server) SetRateLimit(short int, long int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shortLimit, s.longLimit = short, long
+	s.shortUsage, s.longUsage = 0, 0
+}
+
+// countRequest counts an API request, writes the X-RateLimit headers and reports whether
+// the request is within the limits.
+func (s *Server) countRequest(w http.ResponseWriter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shortUsage++
+	s.longUsage++
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d,%d", s.shortLimit, s.longLimit))
+	w.Header().Set("X-RateLimit-Usage", fmt.Sprintf("%d,%d", s.shortUsage, s.longUsage))
+	return s.shortUsage <= s.shortLimit && s.longUsage <= s.longLimit
+}
+
+// AddAthlete registers an athlete. The first athlete is the one approved by /oauth/authorize
+// unless the request names another one with athlete_id.
+func (s *Server) AddAthlete(athlete Athlete) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.athletes[athlete.Id] = &athlete
+	if s.defaultAthlete == 0 {
+		s.defaultAthlete = athlete.Id
+	}
+}
+
+// AddActivity stores an activity for the athlete, assigning an id when it has none.
+func (s *Server) AddActivity(athleteId int64, activity Activity) Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if activity.Id == 0 {
+		activity.Id = s.next()
+	}
+	if activity.StartDate.IsZero() {
+		activity.StartDate = time.Now().UTC()
+	}
+	if activity.SportType == "" {
+		activity.SportType = activity.Type
+	}
+	activity.Athlete = AthleteRef{Id: athleteId}
+	s.activities[activity.Id] = &activity
+	return activity
+}
+
+// Activity returns the current state of an activity.
+func (s *Server) Activity(id int64) (Activity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, ok := s.activities[id]
+	if !ok {
+		return Activity{}, false
+	}
+	return *activity, true
+}
+
+// IssueToken creates tokens for the athlete without going through the OAuth redirect.
+func (s *Server) IssueToken(athleteId int64) Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issueToken(athleteId)
+}
+
+// Subscription returns the registered push subscription, if any.
+func (s *Server) Subscription() (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscription == nil {
+		return Subscription{}, false
+	}
+	return *s.subscription, true
+}
+
+// PushEvent delivers event to the subscription callback like Strava does.
+func (s *Server) PushEvent(event Event) error {
+	subscription, ok := s.Subscription()
+	if !ok {
+		return errors.New("no push subscription")
+	}
+	event.SubscriptionId = subscription.Id
+	if event.EventTime == 0 {
+		event.EventTime = time.Now().Unix()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := s.HTTP.Post(subscription.CallbackUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Server) next() int64 {
+	s.seq++
+	return s.seq
+}
+
+func (s *Server) issueToken(athleteId int64) Token {
+	access := fmt.Sprintf("access-%d-%d", athleteId, s.next())
+	expiresAt := time.Now().Add(s.TokenTTL).Unix()
+	s.accessTokens[access] = accessToken{athleteId: athleteId, expiresAt: expiresAt}
+	refresh := ""
+	for token, id := range s.refreshTokens {
+		if id == athleteId {
+			refresh = token
+		}
+	}
+	if refresh == "" {
+		refresh = fmt.Sprintf("refresh-%d-%d", athleteId, s.next())
+		s.refreshTokens[refresh] = athleteId
+	}
+	return Token{
+		TokenType:    "Bearer",
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    expiresAt,
+		ExpiresIn:    int64(s.TokenTTL.Seconds()),
+	}
+}
+
+func (s *Server) validClient(r *http.Request) bool {
+	if s.ClientId == "" {
+		return true
+	}
+	return r.FormValue("client_id") == s.ClientId && r.FormValue("client_secret") == s.ClientSecret
+}
+
+func (s *Server) withClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.validClient(r) {
+			writeFault(w, http.StatusUnauthorized, "Authorization Error", "Application", "client_id", "invalid")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type athleteHandler func(w http.ResponseWriter, r *http.Request, athleteId int64)
+
+func (s *Server) withAthlete(next athleteHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		access, ok := s.accessTokens[token]
+		s.mu.Unlock()
+		if !ok || access.expiresAt < time.Now().Unix() {
+			writeFault(w, http.StatusUnauthorized, "Authorization Error", "Athlete", "access_token", "invalid")
+			return
+		}
+		next(w, r, access.athleteId)
+	}
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if s.ClientId != "" && query.Get("client_id") != s.ClientId {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Application", "client_id", "invalid")
+		return
+	}
+	redirectUri, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectUri.Host == "" {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Application", "redirect_uri", "invalid")
+		return
+	}
+
+	s.mu.Lock()
+	athleteId := s.defaultAthlete
+	if id, err := strconv.ParseInt(query.Get("athlete_id"), 10, 64); err == nil {
+		athleteId = id
+	}
+	_, ok := s.athletes[athleteId]
+	code := fmt.Sprintf("code-%d-%d", athleteId, s.next())
+	if ok {
+		s.codes[code] = athleteId
+	}
+	s.mu.Unlock()
+
+	callback := redirectUri.Query()
+	callback.Set("state", query.Get("state"))
+	if ok {
+		callback.Set("code", code)
+		callback.Set("scope", query.Get("scope"))
+	} else {
+		callback.Set("error", "access_denied")
+	}
+	redirectUri.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if !s.validClient(r) {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Application", "client_id", "invalid")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.FormValue("grant_type") {
+	case "authorization_code":
+		athleteId, ok := s.codes[r.FormValue("code")]
+		if !ok {
+			writeFault(w, http.StatusBadRequest, "Bad Request", "AuthorizationCode", "code", "invalid")
+			return
+		}
+		delete(s.codes, r.FormValue("code"))
+		token := s.issueToken(athleteId)
+		token.Athlete = s.athletes[athleteId]
+		writeJSON(w, http.StatusOK, token)
+	case "refresh_token":
+		athleteId, ok := s.refreshTokens[r.FormValue("refresh_token")]
+		if !ok {
+			writeFault(w, http.StatusBadRequest, "Bad Request", "RefreshToken", "refresh_token", "invalid")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.issueToken(athleteId))
+	default:
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Application", "grant_type", "invalid")
+	}
+}
+
+// listActivities returns the athlete's activities newest first, or oldest first when only
+// after is given, which matches how Strava pages through a time window.
+func (s *Server) listActivities(w http.ResponseWriter, r *http.Request, athleteId int64) {
+	query := r.URL.Query()
+	page := intParam(query, "page", 1)
+	perPage := intParam(query, "per_page", defaultPerPage)
+	if page < 1 || perPage < 1 || perPage > maxPerPage {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Activity", "per_page", "invalid")
+		return
+	}
+	before := intParam(query, "before", 0)
+	after := intParam(query, "after", 0)
+
+	s.mu.Lock()
+	activities := []Activity{}
+	for _, a := range s.activities {
+		if a.Athlete.Id != athleteId {
+			continue
+		}
+		start := a.StartDate.Unix()
+		if (before > 0 && start >= int64(before)) || (after > 0 && start <= int64(after)) {
+			continue
+		}
+		activities = append(activities, *a)
+	}
+	s.mu.Unlock()
+
+	ascending := after > 0 && before == 0
+	sort.Slice(activities, func(i, j int) bool {
+		if ascending {
+			return activities[i].StartDate.Before(activities[j].StartDate)
+		}
+		return activities[i].StartDate.After(activities[j].StartDate)
+	})
+	from := min((page-1)*perPage, len(activities))
+	to := min(from+perPage, len(activities))
+	writeJSON(w, http.StatusOK, activities[from:to])
+}
+
+func (s *Server) getActivity(w http.ResponseWriter, r *http.Request, athleteId int64) {
+	activity, ok := s.ownedActivity(r, athleteId)
+	if !ok {
+		writeFault(w, http.StatusNotFound, "Record Not Found", "Activity", "id", "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, activity)
+}
+
+func (s *Server) updateActivity(w http.ResponseWriter, r *http.Request, athleteId int64) {
+	var upd struct {
+		Name      *string `json:"name"`
+		Type      *string `json:"type"`
+		SportType *string `json:"sport_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Activity", "body", "invalid")
+		return
+	}
+	if _, ok := s.ownedActivity(r, athleteId); !ok {
+		writeFault(w, http.StatusNotFound, "Record Not Found", "Activity", "id", "not found")
+		return
+	}
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	activity := s.activities[id]
+	if upd.Name != nil {
+		activity.Name = *upd.Name
+	}
+	if upd.Type != nil {
+		activity.Type = *upd.Type
+	}
+	if upd.SportType != nil {
+		activity.SportType = *upd.SportType
+	}
+	updated := *activity
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) ownedActivity(r *http.Request, athleteId int64) (Activity, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return Activity{}, false
+	}
+	activity, ok := s.Activity(id)
+	if !ok || activity.Athlete.Id != athleteId {
+		return Activity{}, false
+	}
+	return activity, true
+}
+
+// createActivity is a fake-only endpoint that adds an activity and pushes a create event,
+// so a locally running bot can be driven without Strava.
+func (s *Server) createActivity(w http.ResponseWriter, r *http.Request) {
+	athleteId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Athlete", "id", "invalid")
+		return
+	}
+	var activity Activity
+	if err := json.NewDecoder(r.Body).Decode(&activity); err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "Activity", "body", "invalid")
+		return
+	}
+	activity = s.AddActivity(athleteId, activity)
+	if _, ok := s.Subscription(); ok {
+		err = s.PushEvent(Event{ObjectType: "activity", ObjectId: activity.Id, AspectType: "create", OwnerId: athleteId})
+		if err != nil {
+			writeFault(w, http.StatusBadGateway, err.Error(), "PushSubscription", "callback_url", "unreachable")
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, activity)
+}
+
+func (s *Server) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions := []Subscription{}
+	if subscription, ok := s.Subscription(); ok {
+		subscriptions = append(subscriptions, subscription)
+	}
+	writeJSON(w, http.StatusOK, subscriptions)
+}
+
+func (s *Server) createSubscription(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.Subscription(); ok {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "PushSubscription", "", "already exists")
+		return
+	}
+	callbackUrl := r.FormValue("callback_url")
+	if err := s.verifyCallback(callbackUrl, r.FormValue("verify_token")); err != nil {
+		writeFault(w, http.StatusBadRequest, "Bad Request", "PushSubscription", "callback url", "not verifiable")
+		return
+	}
+	s.mu.Lock()
+	now := time.Now().UTC().Format(time.RFC3339)
+	s.subscription = &Subscription{Id: s.next(), ApplicationId: 1, CallbackUrl: callbackUrl, CreatedAt: now, UpdatedAt: now}
+	subscription := *s.subscription
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]int64{"id": subscription.Id})
+}
+
+func (s *Server) deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscription == nil || s.subscription.Id != id {
+		writeFault(w, http.StatusNotFound, "Resource Not Found", "PushSubscription", "id", "not found")
+		return
+	}
+	s.subscription = nil
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyCallback performs the subscription validation request: the callback must echo hub.challenge.
+func (s *Server) verifyCallback(callbackUrl string, verifyToken string) error {
+	challenge := fmt.Sprintf("challenge-%d", time.Now().UnixNano())
+	query := url.Values{}
+	query.Set("hub.mode", "subscribe")
+	query.Set("hub.challenge", challenge)
+	query.Set("hub.verify_token", verifyToken)
+	resp, err := s.HTTP.Get(callbackUrl + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback responded with %s", resp.Status)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if body["hub.challenge"] != challenge {
+		return errors.New("challenge mismatch")
+	}
+	return nil
+}
+
+func intParam(query url.Values, key string, def int) int {
+	v, err := strconv.Atoi(query.Get(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeFault writes an error in Strava's fault format.
+func writeFault(w http.ResponseWriter, status int, message string, resource string, field string, code string) {
+	writeJSON(w, status, map[string]any{
+		"message": message,
+		"errors":  []map[string]string{{"resource": resource, "field": field, "code": code}},
+	})
+}
@@ -0,0 +1,208 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultShortLimit = 200
+	DefaultLongLimit  = 2000
+
+	rateLimitLimitHeader = "X-RateLimit-Limit"
+	rateLimitUsageHeader = "X-RateLimit-Usage"
+	shortWindow          = 15 * time.Minute
+)
+
+// Priority decides which calls give way when the rate limit budget runs low.
+type Priority int
+
+const (
+	// PriorityUrgent is for calls a user is waiting on: webhook fetches, renames and token exchanges.
+	PriorityUrgent Priority = iota
+	// PriorityBackground is for bulk calls like backfills. They may only use the budget outside the reserve.
+	PriorityBackground
+)
+
+func (p Priority) String() string {
+	if p == PriorityBackground {
+		return "background"
+	}
+	return "urgent"
+}
+
+var ErrRateLimited = errors.New("strava: rate limit exceeded")
+
+// RateLimitError is returned when Strava answered 429 or the local budget is used up.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	// Err is Strava's 429 response, nil when the call was held back locally.
+	Err *APIError
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+// Unwrap returns ErrRateLimited and, when Strava answered 429, its response.
+func (e *RateLimitError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrRateLimited}
+	}
+	return []error{ErrRateLimited, e.Err}
+}
+
+// DefaultRateLimiter is shared by all clients that don't set their own, so the budget is process-wide.
+var DefaultRateLimiter = NewRateLimiter()
+
+type rateWindow struct {
+	limit   int
+	usage   int
+	resetAt time.Time
+}
+
+// RateLimiter tracks Strava's 15-minute and daily windows. Usage is counted locally
+// and corrected from the X-RateLimit-* headers of every response.
+type RateLimiter struct {
+	// Reserve is the share of each window only urgent calls may use.
+	Reserve float64
+	// MaxWait is how long a background call may wait for a window to reset before it is rejected.
+	MaxWait time.Duration
+
+	now   func() time.Time
+	mu    sync.Mutex
+	short rateWindow
+	long  rateWindow
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Reserve: 0.2,
+		MaxWait: 30 * time.Second,
+		now:     time.Now,
+		short:   rateWindow{limit: DefaultShortLimit},
+		long:    rateWindow{limit: DefaultLongLimit},
+	}
+}
+
+// Acquire takes one call from the budget. Urgent calls are only rejected when a window is
+// exhausted; background calls are held back once they would eat into the reserve, waiting
+// up to MaxWait for the window to reset unless ctx is done first.
+func (l *RateLimiter) Acquire(ctx context.Context, priority Priority) error {
+	for {
+		l.mu.Lock()
+		retryAfter := l.take(priority)
+		l.mu.Unlock()
+		if retryAfter == 0 {
+			return nil
+		}
+		if priority == PriorityUrgent || retryAfter > l.MaxWait {
+			return &RateLimitError{RetryAfter: retryAfter}
+		}
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Update applies the usage reported by Strava.
+func (l *RateLimiter) Update(header http.Header) {
+	limitShort, limitLong, ok := parseRateLimitHeader(header.Get(rateLimitLimitHeader))
+	if !ok {
+		return
+	}
+	usageShort, usageLong, ok := parseRateLimitHeader(header.Get(rateLimitUsageHeader))
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.roll(l.now())
+	l.short.limit, l.short.usage = limitShort, usageShort
+	l.long.limit, l.long.usage = limitLong, usageLong
+}
+
+// Exceeded records a 429 response and returns the error to hand to the caller.
+func (l *RateLimiter) Exceeded(header http.Header) *RateLimitError {
+	l.Update(header)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.roll(now)
+	window := &l.short
+	if l.long.usage >= l.long.limit {
+		window = &l.long
+	}
+	window.usage = window.limit
+	retryAfter := window.resetAt.Sub(now)
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return &RateLimitError{RetryAfter: retryAfter}
+}
+
+// take counts a call and returns 0, or how long until the budget for priority frees up.
+func (l *RateLimiter) take(priority Priority) time.Duration {
+	now := l.now()
+	l.roll(now)
+	var retryAfter time.Duration
+	for _, w := range []*rateWindow{&l.short, &l.long} {
+		if w.usage >= l.threshold(w.limit, priority) {
+			retryAfter = max(retryAfter, w.resetAt.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	l.short.usage++
+	l.long.usage++
+	return 0
+}
+
+func (l *RateLimiter) threshold(limit int, priority Priority) int {
+	if priority == PriorityUrgent {
+		return limit
+	}
+	return int(float64(limit) * (1 - l.Reserve))
+}
+
+// roll starts new windows once they have passed. Strava resets the short window every
+// quarter hour and the daily one at midnight UTC.
+func (l *RateLimiter) roll(now time.Time) {
+	if !now.Before(l.short.resetAt) {
+		l.short.usage = 0
+		l.short.resetAt = now.UTC().Truncate(shortWindow).Add(shortWindow)
+	}
+	if !now.Before(l.long.resetAt) {
+		l.long.usage = 0
+		y, m, d := now.UTC().Date()
+		l.long.resetAt = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// parseRateLimitHeader parses "short,long" values, e.g. "200,2000".
+func parseRateLimitHeader(value string) (int, int, bool) {
+	shortValue, longValue, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, false
+	}
+	short, err := strconv.Atoi(strings.TrimSpace(shortValue))
+	if err != nil {
+		return 0, 0, false
+	}
+	long, err := strconv.Atoi(strings.TrimSpace(longValue))
+	if err != nil {
+		return 0, 0, false
+	}
+	return short, long, true
+}
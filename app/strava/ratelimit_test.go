@@ -0,0 +1,113 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"stravach/app/strava/fakestrava"
+)
+
+func newTestLimiter(now time.Time) (*RateLimiter, *time.Time) {
+	l := NewRateLimiter()
+	l.MaxWait = 0
+	clock := now
+	l.now = func() time.Time { return clock }
+	return l, &clock
+}
+
+func TestRateLimiter_BackgroundYieldsToUrgent(t *testing.T) {
+	l, _ := newTestLimiter(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC))
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "10,100")
+	header.Set("X-RateLimit-Usage", "7,40")
+	l.Update(header)
+
+	// 20% of the short window is reserved for urgent calls, so background stops at 8.
+	require.NoError(t, l.Acquire(context.Background(), PriorityBackground))
+	err := l.Acquire(context.Background(), PriorityBackground)
+	var rateErr *RateLimitError
+	require.ErrorAs(t, err, &rateErr)
+	require.Equal(t, 10*time.Minute, rateErr.RetryAfter)
+
+	require.NoError(t, l.Acquire(context.Background(), PriorityUrgent))
+	require.NoError(t, l.Acquire(context.Background(), PriorityUrgent))
+	require.ErrorIs(t, l.Acquire(context.Background(), PriorityUrgent), ErrRateLimited)
+}
+
+func TestRateLimiter_WindowResets(t *testing.T) {
+	l, clock := newTestLimiter(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC))
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "10,100")
+	header.Set("X-RateLimit-Usage", "10,40")
+	l.Update(header)
+	require.Error(t, l.Acquire(context.Background(), PriorityUrgent))
+
+	*clock = clock.Add(10 * time.Minute)
+	require.NoError(t, l.Acquire(context.Background(), PriorityBackground))
+}
+
+func TestRateLimiter_BackgroundWaitStopsWithContext(t *testing.T) {
+	l, _ := newTestLimiter(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC))
+	l.MaxWait = time.Hour
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "10,100")
+	header.Set("X-RateLimit-Usage", "10,40")
+	l.Update(header)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, l.Acquire(ctx, PriorityBackground), context.Canceled)
+}
+
+func TestRateLimiter_DailyLimit(t *testing.T) {
+	l, _ := newTestLimiter(time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC))
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "100,1000")
+	header.Set("X-RateLimit-Usage", "3,1000")
+	l.Update(header)
+
+	var rateErr *RateLimitError
+	require.ErrorAs(t, l.Acquire(context.Background(), PriorityUrgent), &rateErr)
+	require.Equal(t, 2*time.Hour, rateErr.RetryAfter)
+}
+
+func TestClient_TooManyRequests(t *testing.T) {
+	fake := fakestrava.New("client", "secret")
+	fake.AddAthlete(fakestrava.Athlete{Id: 7})
+	activity := fake.AddActivity(7, fakestrava.Activity{Name: "Lunch Run", Type: "Run"})
+	token := fake.IssueToken(7)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	c := &Client{BaseUrl: srv.URL, HTTP: srv.Client(), Limiter: NewRateLimiter()}
+
+	_, err := c.GetActivity(token.AccessToken, activity.Id)
+	require.NoError(t, err)
+
+	// Another process used up the window in the meantime.
+	fake.SetRateLimit(1, 100)
+	_, err = c.GetActivity(token.AccessToken, activity.Id)
+	require.NoError(t, err)
+	_, err = c.GetActivity(token.AccessToken, activity.Id)
+	require.True(t, errors.Is(err, ErrRateLimited))
+	var rateErr *RateLimitError
+	require.ErrorAs(t, err, &rateErr)
+	require.Positive(t, rateErr.RetryAfter)
+
+	// The limiter now knows the window is exhausted and doesn't call Strava at all.
+	_, err = c.ListActivities(context.Background(), token.AccessToken, ActivitiesQuery{})
+	require.ErrorIs(t, err, ErrRateLimited)
+	var apiErr *APIError
+	require.False(t, errors.As(err, &apiErr))
+
+	// A limiter that doesn't know yet gets Strava's 429.
+	c.Limiter = NewRateLimiter()
+	_, err = c.GetActivity(token.AccessToken, activity.Id)
+	require.ErrorAs(t, err, &rateErr)
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
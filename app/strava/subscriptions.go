@@ -0,0 +1,98 @@
+package strava
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	pushSubscriptionsPath = "/api/v3/push_subscriptions"
+	webhookCallbackPath   = "/api/webhook"
+)
+
+// PushSubscription is a webhook subscription registered for the application.
+// Strava allows a single subscription per application.
+type PushSubscription struct {
+	Id            int64  `json:"id"`
+	ApplicationId int64  `json:"application_id"`
+	CallbackUrl   string `json:"callback_url"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// WebhookCallbackUrl returns the webhook endpoint served for the given public server URL.
+func WebhookCallbackUrl(serverUrl string) string {
+	return strings.TrimSuffix(serverUrl, "/") + webhookCallbackPath
+}
+
+// ListSubscriptions returns the push subscriptions of the application.
+func (c *Client) ListSubscriptions() ([]PushSubscription, error) {
+	query := url.Values{}
+	query.Set("client_id", c.ClientId)
+	query.Set("client_secret", c.ClientSecret)
+	req, err := http.NewRequest(http.MethodGet, c.url(pushSubscriptionsPath)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, PriorityUrgent)
+	if err != nil {
+		slog.Error("error while listing push subscriptions")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var subscriptions []PushSubscription
+	err = json.NewDecoder(resp.Body).Decode(&subscriptions)
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// CreateSubscription registers callbackUrl for push events. Strava validates the callback
+// synchronously by calling it with verifyToken, so the server has to be running.
+func (c *Client) CreateSubscription(callbackUrl string, verifyToken string) (*PushSubscription, error) {
+	form := url.Values{}
+	form.Set("client_id", c.ClientId)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("callback_url", callbackUrl)
+	form.Set("verify_token", verifyToken)
+	req, err := http.NewRequest(http.MethodPost, c.url(pushSubscriptionsPath), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.do(req, PriorityUrgent)
+	if err != nil {
+		slog.Error("error while creating push subscription")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	subscription := PushSubscription{CallbackUrl: callbackUrl}
+	err = json.NewDecoder(resp.Body).Decode(&subscription)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// DeleteSubscription removes the push subscription with the given id.
+func (c *Client) DeleteSubscription(id int64) error {
+	query := url.Values{}
+	query.Set("client_id", c.ClientId)
+	query.Set("client_secret", c.ClientSecret)
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%d?%s", c.url(pushSubscriptionsPath), id, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, PriorityUrgent)
+	if err != nil {
+		slog.Error("error while deleting push subscription")
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
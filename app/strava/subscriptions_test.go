@@ -0,0 +1,67 @@
+package strava
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"stravach/app/strava/fakestrava"
+)
+
+func newFakeStravaClient(t *testing.T, clientSecret string) *Client {
+	srv := httptest.NewServer(fakestrava.New("client", "secret"))
+	t.Cleanup(srv.Close)
+	return &Client{ClientId: "client", ClientSecret: clientSecret, BaseUrl: srv.URL, HTTP: srv.Client()}
+}
+
+// newChallengeServer answers Strava's callback validation like the webhook endpoint does.
+func newChallengeServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hub.verify_token") != "verify" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"hub.challenge": r.URL.Query().Get("hub.challenge")})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPushSubscriptions_Lifecycle(t *testing.T) {
+	c := newFakeStravaClient(t, "secret")
+	callback := newChallengeServer(t)
+
+	require.Equal(t, "https://stravabot.pro/api/webhook", WebhookCallbackUrl("https://stravabot.pro/"))
+	callbackUrl := WebhookCallbackUrl(callback.URL)
+
+	_, err := c.CreateSubscription(callbackUrl, "wrong")
+	require.Error(t, err)
+
+	created, err := c.CreateSubscription(callbackUrl, "verify")
+	require.NoError(t, err)
+	require.NotZero(t, created.Id)
+
+	_, err = c.CreateSubscription(callbackUrl, "verify")
+	require.Error(t, err)
+
+	subscriptions, err := c.ListSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	require.Equal(t, callbackUrl, subscriptions[0].CallbackUrl)
+
+	require.NoError(t, c.DeleteSubscription(created.Id))
+	require.Error(t, c.DeleteSubscription(created.Id))
+
+	subscriptions, err = c.ListSubscriptions()
+	require.NoError(t, err)
+	require.Empty(t, subscriptions)
+}
+
+func TestPushSubscriptions_BadCredentials(t *testing.T) {
+	c := newFakeStravaClient(t, "wrong")
+
+	_, err := c.ListSubscriptions()
+	require.Error(t, err)
+}
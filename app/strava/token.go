@@ -0,0 +1,58 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"stravach/app/storage/models"
+)
+
+// TokenRefresher exchanges a refresh token for a new access token, e.g. StravaService.
+type TokenRefresher interface {
+	RefreshAccessToken(refreshToken string) (*AuthResp, error)
+}
+
+// UserUpdater saves the refreshed tokens of a user.
+type UserUpdater interface {
+	UpdateUser(ctx context.Context, user *models.User) error
+}
+
+// RefreshTokenIfNeeded refreshes the user's access token when it expired and saves it.
+func RefreshTokenIfNeeded(ctx context.Context, refresher TokenRefresher, db UserUpdater, user *models.User) error {
+	if !user.AuthRequired() {
+		return nil
+	}
+	return RefreshToken(ctx, refresher, db, user)
+}
+
+// RefreshToken exchanges the user's refresh token for a new access token and saves it.
+func RefreshToken(ctx context.Context, refresher TokenRefresher, db UserUpdater, user *models.User) error {
+	slog.Info("refreshing strava token", "userID", user.ID)
+	resp, err := refresher.RefreshAccessToken(user.StravaRefreshToken)
+	if err != nil {
+		return err
+	}
+	user.StravaAccessToken = resp.AccessToken
+	user.StravaRefreshToken = resp.RefreshToken
+	user.TokenExpiresAt = &resp.ExpiresAt
+	return db.UpdateUser(ctx, user)
+}
+
+// WithToken runs fn with a fresh access token of the user. When Strava still rejects the
+// token it is refreshed once and fn is retried.
+func WithToken(ctx context.Context, refresher TokenRefresher, db UserUpdater, user *models.User, fn func(accessToken string) error) error {
+	err := RefreshTokenIfNeeded(ctx, refresher, db, user)
+	if err != nil {
+		return err
+	}
+	err = fn(user.StravaAccessToken)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	slog.Info("strava rejected access token, refreshing", "userID", user.ID)
+	err = RefreshToken(ctx, refresher, db, user)
+	if err != nil {
+		return err
+	}
+	return fn(user.StravaAccessToken)
+}
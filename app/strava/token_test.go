@@ -0,0 +1,63 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"stravach/app/storage/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRefresher struct{ calls int }
+
+func (f *fakeRefresher) RefreshAccessToken(refreshToken string) (*AuthResp, error) {
+	f.calls++
+	return &AuthResp{AccessToken: "fresh", RefreshToken: refreshToken, ExpiresAt: time.Now().Add(time.Hour).Unix()}, nil
+}
+
+type fakeUserUpdater struct{ saved []models.User }
+
+func (f *fakeUserUpdater) UpdateUser(_ context.Context, user *models.User) error {
+	f.saved = append(f.saved, *user)
+	return nil
+}
+
+func TestWithToken_RefreshesRejectedToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	user := &models.User{ID: 1, StravaAccessToken: "revoked", StravaRefreshToken: "refresh", TokenExpiresAt: &expiresAt}
+	refresher, db := &fakeRefresher{}, &fakeUserUpdater{}
+
+	var tokens []string
+	err := WithToken(context.Background(), refresher, db, user, func(accessToken string) error {
+		tokens = append(tokens, accessToken)
+		if accessToken == "revoked" {
+			return &APIError{StatusCode: http.StatusUnauthorized}
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"revoked", "fresh"}, tokens)
+	require.Equal(t, 1, refresher.calls)
+	require.Len(t, db.saved, 1)
+}
+
+func TestWithToken_KeepsOtherErrors(t *testing.T) {
+	user := &models.User{ID: 1, StravaRefreshToken: "refresh"}
+	refresher, db := &fakeRefresher{}, &fakeUserUpdater{}
+	notFound := &APIError{StatusCode: http.StatusNotFound}
+
+	calls := 0
+	err := WithToken(context.Background(), refresher, db, user, func(accessToken string) error {
+		calls++
+		return notFound
+	})
+
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.Equal(t, 1, calls)
+	// the expired token was refreshed up front, but not again
+	require.Equal(t, 1, refresher.calls)
+}
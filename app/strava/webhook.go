@@ -0,0 +1,27 @@
+package strava
+
+const (
+	ObjectTypeActivity = "activity"
+	ObjectTypeAthlete  = "athlete"
+
+	AspectTypeCreate = "create"
+	AspectTypeUpdate = "update"
+	AspectTypeDelete = "delete"
+)
+
+// WebhookEvent is a push notification sent by Strava to the subscription callback.
+// See https://developers.strava.com/docs/webhooks/
+type WebhookEvent struct {
+	ObjectType     string            `json:"object_type"`
+	ObjectId       int64             `json:"object_id"`
+	AspectType     string            `json:"aspect_type"`
+	Updates        map[string]string `json:"updates"`
+	OwnerId        int64             `json:"owner_id"`
+	SubscriptionId int64             `json:"subscription_id"`
+	EventTime      int64             `json:"event_time"`
+}
+
+// IsDeauthorization reports whether the athlete revoked access for the application.
+func (e WebhookEvent) IsDeauthorization() bool {
+	return e.ObjectType == ObjectTypeAthlete && e.Updates["authorized"] == "false"
+}
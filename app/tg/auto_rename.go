@@ -0,0 +1,198 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	dbModels "stravach/app/storage/models"
+	"stravach/app/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// autoRenameTick is how often names whose rename timeout passed are applied.
+	autoRenameTick = time.Minute
+
+	autoRenamedMessage       = "Renamed '%s' to '%s'."
+	autoRenameTimeoutMessage = "If you don't choose within %d minutes, I'll use the first name."
+	renameModeUsageMessage   = "Usage: /rename_mode manual | auto | timeout <minutes>\nmanual: I offer names and you pick one.\nauto: I apply the first name right away, you can undo it.\ntimeout: I offer names and apply the first one if you don't pick within the given minutes."
+	renameModeSetMessage     = "Rename mode set to %s."
+	renameModeTimeoutMessage = "Rename mode set to timeout, I'll pick a name after %d minutes."
+)
+
+// userSettings returns the settings of the user, the defaults when they can't be read.
+func (tg *Telegram) userSettings(ctx context.Context, userID int64) *dbModels.UserSettings {
+	settings, err := tg.DB.GetUserSettings(ctx, userID)
+	if err != nil {
+		slog.Error("error while fetching user settings, using defaults", "err", err, "userID", userID)
+		return dbModels.DefaultUserSettings(userID)
+	}
+	return settings
+}
+
+// autoRename applies name without asking the user, recorded with source, and offers to undo it
+// or choose another name.
+func (tg *Telegram) autoRename(ctx context.Context, chatID int64, activityID int64, name string, source string) {
+	activity, originalName, ok := tg.renameActivity(ctx, chatID, activityID, name, source)
+	if !ok {
+		return
+	}
+	_, err := tg.Bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf(autoRenamedMessage, originalName, activity.Name),
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: makeAutoRenameKeyboard(activityID),
+		},
+	})
+	if err != nil {
+		slog.Error("error while sending auto rename notification", "err", err, "chatID", chatID)
+	}
+}
+
+// applyDueNames applies the first offered name of the activities whose rename timeout passed.
+// Activities renamed another way in the meantime are left alone.
+func (tg *Telegram) applyDueNames(ctx context.Context) {
+	due, err := tg.Conversations.TakeDueNameOptions(ctx, time.Now().Unix())
+	if err != nil {
+		slog.Error("error while fetching due name options", "err", err)
+		return
+	}
+	for _, options := range due {
+		activity, err := tg.DB.GetActivityById(ctx, options.ActivityID)
+		if err != nil {
+			slog.Error("error while fetching activity for auto rename", "err", err, "activityID", options.ActivityID)
+			continue
+		}
+		// names stored before they were cleaned may still start with a blank line or a number
+		names := utils.CleanActivityNames(options.Names)
+		if activity.IsUpdated || len(names) == 0 {
+			continue
+		}
+		// the buttons keep working for Choose another
+		options.AutoApplyAt = 0
+		if err = tg.Conversations.SaveNameOptions(ctx, &options); err != nil {
+			slog.Error("error while saving name options", "err", err, "chatID", options.ChatID, "activityID", options.ActivityID)
+		}
+		slog.Info("Rename timeout passed, applying first name", "chatID", options.ChatID, "activityID", options.ActivityID)
+		tg.autoRename(ctx, options.ChatID, options.ActivityID, names[0], options.Source)
+	}
+}
+
+// cancelAutoRename keeps the names offered for the activity from being applied on timeout,
+// e.g. once the user started writing a custom prompt.
+func (tg *Telegram) cancelAutoRename(ctx context.Context, chatID int64, activityID int64) {
+	options, err := tg.Conversations.GetNameOptions(ctx, chatID, activityID, time.Now().Unix())
+	if err != nil || options == nil || options.AutoApplyAt == 0 {
+		return
+	}
+	options.AutoApplyAt = 0
+	if err = tg.Conversations.SaveNameOptions(ctx, options); err != nil {
+		slog.Error("error while saving name options", "err", err, "chatID", chatID, "activityID", activityID)
+	}
+}
+
+// handleChooseAnother offers the names generated for the activity again, or new ones when
+// they expired.
+func (tg *Telegram) handleChooseAnother(ctx context.Context, chatID int64, activityID int64) {
+	options, err := tg.Conversations.GetNameOptions(ctx, chatID, activityID, time.Now().Unix())
+	if err != nil {
+		slog.Error("error while fetching name options", "err", err, "chatID", chatID, "activityID", activityID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	if options == nil {
+		tg.handleRegenerateNames(ctx, chatID, activityID)
+		return
+	}
+	tg.saveConversation(ctx, chatID, activityID, false)
+	tg.sendNameOptions(ctx, chatID, activityID, options.Names, choosePromptMessage)
+}
+
+// renameModeHandler sets the rename mode of the user: /rename_mode manual, auto or timeout <minutes>.
+func (tg *Telegram) renameModeHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		tg.SendMessage(ctx, chatID, renameModeUsageMessage)
+		return
+	}
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to get user for rename mode", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	settings := tg.userSettings(ctx, usr.ID)
+	mode := strings.ToLower(args[0])
+	switch {
+	case (mode == dbModels.RenameModeManual || mode == dbModels.RenameModeAuto) && len(args) == 1:
+	case mode == dbModels.RenameModeTimeout && len(args) <= 2:
+		if len(args) == 2 {
+			minutes, err := strconv.Atoi(args[1])
+			if err != nil || minutes < 1 || minutes > dbModels.MaxRenameTimeout {
+				tg.SendMessage(ctx, chatID, renameModeUsageMessage)
+				return
+			}
+			settings.RenameTimeout = minutes
+		}
+	default:
+		tg.SendMessage(ctx, chatID, renameModeUsageMessage)
+		return
+	}
+	settings.RenameMode = mode
+	settings.UpdatedAt = time.Now().Unix()
+	if err = tg.DB.SaveUserSettings(ctx, settings); err != nil {
+		slog.Error("failed to save rename mode", "err", err, "userID", usr.ID, "mode", mode)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	slog.Info("Rename mode set", "userID", usr.ID, "mode", mode, "timeout", settings.RenameTimeout)
+	if mode == dbModels.RenameModeTimeout {
+		tg.SendMessage(ctx, chatID, fmt.Sprintf(renameModeTimeoutMessage, settings.RenameTimeout))
+		return
+	}
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(renameModeSetMessage, mode))
+}
+
+func makeAutoRenameKeyboard(activityID int64) [][]models.InlineKeyboardButton {
+	return [][]models.InlineKeyboardButton{{
+		{Text: "↩️ Undo", CallbackData: fmt.Sprintf("%s:%d:U", callbackPrefixActivity, activityID)},
+		{Text: "🔢 Choose another", CallbackData: fmt.Sprintf("%s:%d:L", callbackPrefixActivity, activityID)},
+	}}
+}
+
+// ruleBasedName names the activity by its local start time, type and distance, e.g.
+// "Saturday Morning Run, 10.2 km" in units. It is used when no names could be generated.
+func ruleBasedName(activity dbModels.UserActivity, units string) string {
+	start := activity.StartDate
+	if i := strings.LastIndex(activity.Timezone, " "); i >= 0 {
+		if location, err := time.LoadLocation(activity.Timezone[i+1:]); err == nil {
+			start = start.In(location)
+		}
+	}
+	var partOfDay string
+	switch hour := start.Hour(); {
+	case hour >= 5 && hour < 12:
+		partOfDay = "Morning"
+	case hour >= 12 && hour < 17:
+		partOfDay = "Afternoon"
+	case hour >= 17 && hour < 21:
+		partOfDay = "Evening"
+	default:
+		partOfDay = "Night"
+	}
+	activityType := activity.ActivityType
+	if activityType == "" {
+		activityType = "Activity"
+	}
+	name := fmt.Sprintf("%s %s %s", start.Weekday(), partOfDay, activityType)
+	if activity.Distance > 0 {
+		name += ", " + dbModels.FormatDistance(activity.Distance, units)
+	}
+	return name
+}
@@ -0,0 +1,322 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/mocks"
+	"strings"
+	"testing"
+	"time"
+
+	bot "github.com/go-telegram/bot"
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newAutoRenameTest returns a bot on a memory store with a connected user of chat 123 in the
+// rename mode and an unnamed activity 99.
+func newAutoRenameTest(t *testing.T, mode string) (*Telegram, *storage.MemoryStore, *mocks.BotSender, *mocks.StravaService) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	usr := &dbModels.User{TelegramChatId: 123, StravaAccessToken: "access", TokenExpiresAt: &expiresAt, Language: "English"}
+	require.NoError(t, store.CreateUser(ctx, usr))
+	require.NoError(t, store.CreateUserActivity(ctx, &dbModels.UserActivity{ID: 99, Name: "Morning Run", ActivityType: "Run"}, usr.ID))
+	settings := dbModels.DefaultUserSettings(usr.ID)
+	settings.RenameMode = mode
+	settings.RenameTimeout = 15
+	require.NoError(t, store.SaveUserSettings(ctx, settings))
+
+	mbot := &mocks.BotSender{}
+	mstrava := &mocks.StravaService{}
+	mstrava.On("UpdateActivity", "access", mock.Anything).Return(&dbModels.UserActivity{}, nil)
+	mai := &mocks.AI{}
+	mai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return("Sunrise Tempo\nLakeside Loop", nil)
+	return &Telegram{Bot: mbot, DB: store, Strava: mstrava, AI: mai, Conversations: store}, store, mbot, mstrava
+}
+
+// sentKeyboard matches a message with an inline keyboard that has a button with callback data.
+func sentKeyboard(text string, callbackData string) any {
+	return mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		markup, ok := p.ReplyMarkup.(*botModels.InlineKeyboardMarkup)
+		if !ok || !strings.HasPrefix(p.Text, text) {
+			return false
+		}
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData == callbackData {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+func storedName(t *testing.T, store storage.Store) string {
+	activity, err := store.GetActivityById(context.Background(), 99)
+	require.NoError(t, err)
+	return activity.Name
+}
+
+func TestUpdateActivity_AutoModeAppliesFirstName(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, mstrava := newAutoRenameTest(t, dbModels.RenameModeAuto)
+	mbot.On("SendMessage", mock.Anything, sentKeyboard(fmt.Sprintf(autoRenamedMessage, "Morning Run", "Sunrise Tempo"), "activity:99:U")).Return(&botModels.Message{}, nil).Once()
+
+	activity, err := store.GetActivityById(ctx, 99)
+	require.NoError(t, err)
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: *activity, ChatId: 123})
+
+	assert.Equal(t, "Sunrise Tempo", storedName(t, store))
+	history, err := store.GetNameHistory(ctx, 99)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, dbModels.NameSourceAIOption, history[0].Source)
+	mbot.AssertExpectations(t)
+	mstrava.AssertNumberOfCalls(t, "UpdateActivity", 1)
+
+	// Choose another offers the generated names again
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return strings.Contains(p.Text, "2. Lakeside Loop")
+	})).Return(&botModels.Message{}, nil).Once()
+	mbot.On("SendMessage", mock.Anything, sentKeyboard(choosePromptMessage, "activity:99:2")).Return(&botModels.Message{}, nil).Once()
+	tgInstance.handleCallbackQuery(ctx, nil, &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{From: botModels.User{ID: 123}, Data: "activity:99:L"},
+	})
+	mbot.AssertExpectations(t)
+}
+
+func TestUpdateActivity_AutoModeCleansNames(t *testing.T) {
+	for _, aiResp := range []string{"\nSunrise Tempo\nLakeside Loop", "1. Sunrise Tempo\n2. Lakeside Loop"} {
+		t.Run(aiResp, func(t *testing.T) {
+			ctx := context.Background()
+			tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeAuto)
+			mai := &mocks.AI{}
+			mai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return(aiResp, nil)
+			tgInstance.AI = mai
+			mbot.On("SendMessage", mock.Anything, sentKeyboard(fmt.Sprintf(autoRenamedMessage, "Morning Run", "Sunrise Tempo"), "activity:99:U")).Return(&botModels.Message{}, nil).Once()
+
+			activity, err := store.GetActivityById(ctx, 99)
+			require.NoError(t, err)
+			tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: *activity, ChatId: 123})
+
+			assert.Equal(t, "Sunrise Tempo", storedName(t, store))
+			options, err := store.GetNameOptions(ctx, 123, 99, time.Now().Unix())
+			require.NoError(t, err)
+			require.NotNil(t, options)
+			assert.Equal(t, []string{"Sunrise Tempo", "Lakeside Loop"}, options.Names)
+			mbot.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateActivity_AutoModeFallsBackWithoutNames(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeAuto)
+	mai := &mocks.AI{}
+	mai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return("\n1.\n  \n", nil)
+	tgInstance.AI = mai
+	mbot.On("SendMessage", mock.Anything, sentKeyboard("Renamed", "activity:99:L")).Return(&botModels.Message{}, nil).Once()
+
+	start := time.Date(2024, time.June, 1, 7, 30, 0, 0, time.UTC)
+	activity := dbModels.UserActivity{ID: 99, Name: "Morning Run", ActivityType: "Run", Distance: 10240, StartDate: start}
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: activity, ChatId: 123})
+
+	assert.Equal(t, "Saturday Morning Run, 10.2 km", storedName(t, store))
+	mbot.AssertExpectations(t)
+}
+
+func TestUpdateActivity_AutoModeUndo(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeAuto)
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	activity, err := store.GetActivityById(ctx, 99)
+	require.NoError(t, err)
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: *activity, ChatId: 123})
+	require.Equal(t, "Sunrise Tempo", storedName(t, store))
+
+	tgInstance.handleCallbackQuery(ctx, nil, &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{From: botModels.User{ID: 123}, Data: "activity:99:U"},
+	})
+	assert.Equal(t, "Morning Run", storedName(t, store))
+}
+
+func TestUpdateActivity_AutoModeFallsBackToRuleBasedName(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeAuto)
+	mai := &mocks.AI{}
+	mai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return("", errors.New("timeout"))
+	tgInstance.AI = mai
+	mbot.On("SendMessage", mock.Anything, sentKeyboard("Renamed", "activity:99:L")).Return(&botModels.Message{}, nil).Once()
+
+	start := time.Date(2024, time.June, 1, 7, 30, 0, 0, time.UTC)
+	activity := dbModels.UserActivity{ID: 99, Name: "Morning Run", ActivityType: "Run", Distance: 10240, StartDate: start}
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: activity, ChatId: 123})
+
+	assert.Equal(t, "Saturday Morning Run, 10.2 km", storedName(t, store))
+	history, err := store.GetNameHistory(ctx, 99)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, dbModels.NameSourceRule, history[0].Source)
+	mbot.AssertExpectations(t)
+}
+
+func TestUpdateActivity_TimeoutModeOffersRuleBasedName(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeTimeout)
+	mai := &mocks.AI{}
+	mai.On("GenerateBetterNames", mock.Anything, "English", "funny").Return("", errors.New("timeout"))
+	tgInstance.AI = mai
+	mbot.On("SendMessage", mock.Anything, sentKeyboard(choosePromptMessage+"\n"+fmt.Sprintf(autoRenameTimeoutMessage, 15), "activity:99:1")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	start := time.Date(2024, time.June, 1, 7, 30, 0, 0, time.UTC)
+	activity := dbModels.UserActivity{ID: 99, Name: "Morning Run", ActivityType: "Run", Distance: 10240, StartDate: start}
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: activity, ChatId: 123})
+
+	options, err := store.GetNameOptions(ctx, 123, 99, time.Now().Unix())
+	require.NoError(t, err)
+	require.NotNil(t, options)
+	assert.Equal(t, []string{"Saturday Morning Run, 10.2 km"}, options.Names)
+	assert.Equal(t, dbModels.NameSourceRule, options.Source)
+	assert.NotZero(t, options.AutoApplyAt)
+	mbot.AssertExpectations(t)
+}
+
+func TestUpdateActivity_TimeoutModeAppliesFirstNameWhenDue(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, mstrava := newAutoRenameTest(t, dbModels.RenameModeTimeout)
+	mbot.On("SendMessage", mock.Anything, sentKeyboard(choosePromptMessage+"\n"+fmt.Sprintf(autoRenameTimeoutMessage, 15), "activity:99:1")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	activity, err := store.GetActivityById(ctx, 99)
+	require.NoError(t, err)
+	tgInstance.updateActivity(ctx, &ActivityForUpdate{Activity: *activity, ChatId: 123})
+	options, err := store.GetNameOptions(ctx, 123, 99, time.Now().Unix())
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), options.AutoApplyAt, 5)
+
+	tgInstance.applyDueNames(ctx)
+	assert.Equal(t, "Morning Run", storedName(t, store))
+	mstrava.AssertNotCalled(t, "UpdateActivity", mock.Anything, mock.Anything)
+
+	options.AutoApplyAt = time.Now().Add(-time.Minute).Unix()
+	require.NoError(t, store.SaveNameOptions(ctx, options))
+	tgInstance.applyDueNames(ctx)
+	assert.Equal(t, "Sunrise Tempo", storedName(t, store))
+	mbot.AssertCalled(t, "SendMessage", mock.Anything, sentKeyboard(fmt.Sprintf(autoRenamedMessage, "Morning Run", "Sunrise Tempo"), "activity:99:U"))
+	history, err := store.GetNameHistory(ctx, 99)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, dbModels.NameSourceAIOption, history[0].Source)
+
+	// applied once, the options stay for Choose another
+	tgInstance.applyDueNames(ctx)
+	mstrava.AssertNumberOfCalls(t, "UpdateActivity", 1)
+	options, err = store.GetNameOptions(ctx, 123, 99, time.Now().Unix())
+	require.NoError(t, err)
+	require.NotNil(t, options)
+	assert.Zero(t, options.AutoApplyAt)
+}
+
+func TestApplyDueNames_SkipsActivityRenamedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, mstrava := newAutoRenameTest(t, dbModels.RenameModeTimeout)
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	tgInstance.rememberNamesWithDeadline(ctx, 123, 99, []string{"Sunrise Tempo"}, dbModels.NameSourceAIOption, time.Now().Add(-time.Minute))
+	tgInstance.handleActivitySelection(ctx, 123, 99, "Harbour Dash", dbModels.NameSourceManual)
+	tgInstance.applyDueNames(ctx)
+
+	assert.Equal(t, "Harbour Dash", storedName(t, store))
+	mstrava.AssertNumberOfCalls(t, "UpdateActivity", 1)
+}
+
+func TestHandleCustomPromptSetup_CancelsAutoRename(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, _ := newAutoRenameTest(t, dbModels.RenameModeTimeout)
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	tgInstance.rememberNamesWithDeadline(ctx, 123, 99, []string{"Sunrise Tempo"}, dbModels.NameSourceAIOption, time.Now().Add(-time.Minute))
+	tgInstance.handleCallbackQuery(ctx, nil, &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{From: botModels.User{ID: 123}, Data: "activity:99:C"},
+	})
+	tgInstance.applyDueNames(ctx)
+
+	assert.Equal(t, "Morning Run", storedName(t, store))
+}
+
+func TestRenameModeHandler(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantMode    string
+		wantTimeout int
+		wantMessage string
+	}{
+		{text: "/rename_mode auto", wantMode: dbModels.RenameModeAuto, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: fmt.Sprintf(renameModeSetMessage, "auto")},
+		{text: "/rename_mode Manual", wantMode: dbModels.RenameModeManual, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: fmt.Sprintf(renameModeSetMessage, "manual")},
+		{text: "/rename_mode timeout", wantMode: dbModels.RenameModeTimeout, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: fmt.Sprintf(renameModeTimeoutMessage, dbModels.DefaultRenameTimeout)},
+		{text: "/rename_mode timeout 10", wantMode: dbModels.RenameModeTimeout, wantTimeout: 10, wantMessage: fmt.Sprintf(renameModeTimeoutMessage, 10)},
+		{text: "/rename_mode", wantMode: dbModels.RenameModeManual, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: renameModeUsageMessage},
+		{text: "/rename_mode timeout 0", wantMode: dbModels.RenameModeManual, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: renameModeUsageMessage},
+		{text: "/rename_mode auto 10", wantMode: dbModels.RenameModeManual, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: renameModeUsageMessage},
+		{text: "/rename_mode sometimes", wantMode: dbModels.RenameModeManual, wantTimeout: dbModels.DefaultRenameTimeout, wantMessage: renameModeUsageMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ctx := context.Background()
+			store := storage.NewMemoryStore()
+			usr := &dbModels.User{TelegramChatId: 123}
+			require.NoError(t, store.CreateUser(ctx, usr))
+			mbot := &mocks.BotSender{}
+			mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+				return p.Text == tt.wantMessage
+			})).Return(&botModels.Message{}, nil).Once()
+
+			tgInstance := &Telegram{Bot: mbot, DB: store}
+			tgInstance.renameModeHandler(ctx, nil, &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: tt.text}})
+
+			settings, err := store.GetUserSettings(ctx, usr.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMode, settings.RenameMode)
+			assert.Equal(t, tt.wantTimeout, settings.RenameTimeout)
+			mbot.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRuleBasedName(t *testing.T) {
+	tests := []struct {
+		activity dbModels.UserActivity
+		units    string
+		want     string
+	}{
+		{
+			activity: dbModels.UserActivity{ActivityType: "Ride", Distance: 42195, StartDate: time.Date(2024, time.June, 2, 16, 0, 0, 0, time.UTC), Timezone: "(GMT+02:00) Europe/Berlin"},
+			want:     "Sunday Evening Ride, 42.2 km",
+		},
+		{
+			activity: dbModels.UserActivity{ActivityType: "Run", Distance: 10000, StartDate: time.Date(2024, time.June, 1, 7, 0, 0, 0, time.UTC)},
+			units:    dbModels.UnitsImperial,
+			want:     "Saturday Morning Run, 6.2 mi",
+		},
+		{
+			activity: dbModels.UserActivity{ActivityType: "Yoga", StartDate: time.Date(2024, time.June, 3, 13, 0, 0, 0, time.UTC), Timezone: "unknown"},
+			want:     "Monday Afternoon Yoga",
+		},
+		{
+			activity: dbModels.UserActivity{StartDate: time.Date(2024, time.June, 3, 23, 0, 0, 0, time.UTC)},
+			want:     "Monday Night Activity",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ruleBasedName(tt.activity, tt.units))
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
 	"regexp"
 	"stravach/app/openai"
 	"stravach/app/storage"
@@ -12,6 +14,7 @@ import (
 	"stravach/app/utils"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -19,44 +22,68 @@ import (
 
 const (
 	callbackPrefixActivity       = "activity"
+	callbackPrefixSettings       = "settings"
 	commandStart                 = "/start"
 	commandRefreshActivities     = "/refresh_activities"
+	commandBackfillActivities    = "/backfill_activities"
 	commandSetLanguage           = "/set_language"
 	commandTestPrompt            = "/test_prompt"
+	commandUndo                  = "/undo"
+	commandFind                  = "/find"
+	commandRenameMode            = "/rename_mode"
+	commandSettings              = "/settings"
+	commandTimezone              = "/timezone"
 	defaultBotErrorMessage       = "An error occurred. Please try again later."
 	languageSetSuccessMessage    = "Your language was set to %s"
-	activitiesRefreshedMessage   = "Activities are refreshed."
+	unknownLanguageMessage       = "I can't name activities in %s yet, please choose one of: %s"
+	activitiesRefreshedMessage   = "Activities are refreshed, %d new."
+	backfillStartedMessage       = "Importing all your activities from Strava, this can take a while..."
+	backfillFinishedMessage      = "All activities are imported (%d)."
+	backfillPausedMessage        = "%s Imported %d activities so far, send /backfill_activities to continue."
 	authLinkMessage              = "Please authorize yourself in Strava %s"
-	setLanguageUsageMessage      = "Message should be /set_language Language"
+	setLanguageUsageMessage      = "Message should be /set_language Language, /settings lists the languages"
 	chooseOptionMessage          = "Please choose an option:"
+	choosePromptMessage          = "Please choose by pressing a button below:"
 	generatingMessage            = "Generating..."
+	renamesBusyMessage           = "Too many names are being generated right now, please try again in a minute."
 	customPromptInstruction      = "Please send me your custom prompt for the activity: %s"
-	noActivitiesFoundMessage     = "No activities found to update."
 	updateSuccessfulMessage      = "Activity '%s' updated successfully!"
 	updateFailedMessage          = "Failed to update activity '%s'."
 	customPromptSuccessMessage   = "Custom prompt applied. New names generated for '%s'."
 	customPromptFailedMessage    = "Failed to apply custom prompt for '%s'."
 	generatingBetterNamesMessage = "Generating better names for activity: %s (%d)"
+	rateLimitedMessage           = "Strava is busy right now, please try again in %s."
+	stravaReconnectMessage       = "Your Strava connection has expired. Please send /start to reconnect."
+	stravaMissingScopeMessage    = "Stravach is not allowed to edit your activities. Please send /start and allow all requested permissions."
+	stravaNotFoundMessage        = "This activity no longer exists on Strava."
+	stravaUnavailableMessage     = "Strava is having trouble right now. Please try again later."
+	noPendingActivityMessage     = "There is no activity waiting for a name. New activities will show up here."
+	nothingToUndoMessage         = "There is no rename to undo."
+	undoSuccessfulMessage        = "Activity renamed back to '%s'."
+	undoFailedMessage            = "Failed to rename '%s' back."
+	undoNotRecordedMessage       = "Activity renamed back to '%s' on Strava, but the name history couldn't be updated. Please don't send /undo for it again."
+	findUsageMessage             = "Usage: /find <words in the name or description>"
+	nothingFoundMessage          = "No activities found for '%s'."
+	stravaAuthLinkTTL            = time.Hour
+	// updateWorkers is how many updates are handled at once.
+	updateWorkers = 8
+	// updateTimeout bounds the handling of a single update.
+	updateTimeout = 2 * time.Minute
 )
 
 type BotSender interface {
 	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+	EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error)
 	RegisterHandler(handlerType bot.HandlerType, command string, matchType bot.MatchType, handlerFunc bot.HandlerFunc, middleware ...bot.Middleware) string
 	RegisterHandlerMatchFunc(matchFunc bot.MatchFunc, handlerFunc bot.HandlerFunc, middleware ...bot.Middleware) string
 	Start(ctx context.Context)
-}
-type DBStore interface {
-	GetUserByChatId(chatID int64) (*dbModels.User, error)
-	GetActivityById(activityID int64) (*dbModels.UserActivity, error)
-	UpdateUserActivity(activity *dbModels.UserActivity) error
-	UpdateUser(user *dbModels.User) error
-	IsUserExistsByChatId(chatID int64) (bool, error)
-	CreateUser(user *dbModels.User) error
-	CreateUserActivities(activities []*dbModels.UserActivity) error
-	GetAllUsers() ([]*dbModels.User, error)
+	StartWebhook(ctx context.Context)
+	WebhookHandler() http.HandlerFunc
+	SetWebhook(ctx context.Context, params *bot.SetWebhookParams) (bool, error)
+	DeleteWebhook(ctx context.Context, params *bot.DeleteWebhookParams) (bool, error)
 }
 type AI interface {
-	GenerateBetterNames(activity dbModels.UserActivity, lang string) (string, error)
+	GenerateBetterNames(activity dbModels.UserActivity, lang string, style string) (string, error)
 	GenerateBetterNamesWithCustomizedPrompt(activity dbModels.UserActivity, lang, prompt string) (string, error)
 	CheckIfItsAName(msg string) (bool, error)
 	FormatActivityName(name string) (string, error)
@@ -66,88 +93,169 @@ type BroadcastMessage struct {
 	Text string
 }
 
+// Notification is a plain text message addressed to a single chat.
+type Notification struct {
+	ChatId int64
+	Text   string
+}
+
 type Telegram struct {
-	APIKey            string
-	Bot               BotSender
-	DB                DBStore
-	Strava            strava.StravaService
-	AI                AI
-	ActivitiesChannel chan ActivityForUpdate
-	BroadcastChannel  chan BroadcastMessage
-	LastActivity      map[int64]int64              // chatID -> activityID
-	NameOptions       map[int64]map[int64][]string // chatID -> activityID -> []options
+	APIKey               string
+	Bot                  BotSender
+	DB                   storage.Store
+	Strava               strava.StravaService
+	AI                   AI
+	BroadcastChannel     chan BroadcastMessage
+	NotificationsChannel chan Notification
+	JWT                  *utils.JWT
+	// BotOptions are appended to the bot options in Start, e.g. to point the bot at another server.
+	BotOptions []bot.Option
+	// Conversations keeps the pending activity and offered names of every chat.
+	Conversations storage.ConversationRepo
+	// Webhook, when set, receives updates by webhook instead of long polling.
+	Webhook *WebhookConfig
+	// Renames offers names for new activities, Start runs it and sets its Handle when nil.
+	Renames *RenamePool
+	// ActivityBatchSize is how many activities /sync and /backfill write per transaction,
+	// storage.DefaultActivityBatchSize when 0.
+	ActivityBatchSize int
 }
 
 type ActivityForUpdate struct {
 	Activity dbModels.UserActivity
 	ChatId   int64
+	// Manual offers the names even when the user renames automatically, e.g. after Regenerate.
+	Manual bool
 }
 
-func NewTelegramClient(apiKey string) (*Telegram, error) {
-	return newTelegramClientInternal(apiKey, nil, nil)
+// NewTelegramClient creates the bot client on top of db, the store shared with the HTTP server,
+// keeping rename conversations in conversations.
+func NewTelegramClient(apiKey string, db storage.Store, conversations storage.ConversationRepo) *Telegram {
+	return newTelegramClientInternal(apiKey, db, conversations, nil)
 }
 
-func newTelegramClientInternal(apiKey string, activities chan ActivityForUpdate, broadcasts chan BroadcastMessage) (*Telegram, error) {
-	db := &storage.SQLiteStore{}
-	err := db.Connect()
-	if err != nil {
-		slog.Error("error while connecting to DB", "err", err)
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
+func newTelegramClientInternal(apiKey string, db storage.Store, conversations storage.ConversationRepo, broadcasts chan BroadcastMessage) *Telegram {
 	stravaClient := strava.NewStravaClient()
 	ai := openai.NewClient()
-	if activities == nil {
-		activities = make(chan ActivityForUpdate, 10)
-	}
 	if broadcasts == nil {
 		broadcasts = make(chan BroadcastMessage, 10)
 	}
-	return &Telegram{
-		DB:                db,
-		Strava:            stravaClient,
-		AI:                ai,
-		APIKey:            apiKey,
-		LastActivity:      make(map[int64]int64),
-		ActivitiesChannel: activities,
-		BroadcastChannel:  broadcasts,
-		NameOptions:       make(map[int64]map[int64][]string),
-	}, nil
+	tg := &Telegram{
+		DB:                   db,
+		Strava:               stravaClient,
+		AI:                   ai,
+		APIKey:               apiKey,
+		BroadcastChannel:     broadcasts,
+		NotificationsChannel: make(chan Notification, 10),
+		JWT:                  &utils.JWT{Key: []byte(os.Getenv("JWT_KEY"))},
+		Conversations:        conversations,
+	}
+	tg.Renames = NewRenamePool(tg.updateActivity)
+	if workers, err := strconv.Atoi(os.Getenv("RENAME_WORKERS")); err == nil && workers > 0 {
+		tg.Renames.Workers = workers
+	}
+	if size, err := strconv.Atoi(os.Getenv("ACTIVITY_BATCH_SIZE")); err == nil && size > 0 {
+		tg.ActivityBatchSize = size
+	}
+	return tg
 }
 
-func (tg *Telegram) Start(ctx context.Context) {
+// Connect creates the bot and registers the command handlers. Start connects when it wasn't
+// done before, webhook mode connects first so WebhookHandler can be mounted.
+func (tg *Telegram) Connect() error {
 	options := []bot.Option{
 		bot.WithCallbackQueryDataHandler(callbackPrefixActivity, bot.MatchTypePrefix, tg.handleCallbackQuery),
+		bot.WithCallbackQueryDataHandler(callbackPrefixSettings, bot.MatchTypePrefix, tg.handleSettingsCallback),
+		// handlers run on the workers, so stopping the bot waits for the running updates
+		bot.WithWorkers(updateWorkers),
+		bot.WithNotAsyncHandlers(),
+		bot.WithMiddlewares(detachUpdate),
+	}
+	if tg.Webhook != nil {
+		options = append(options, bot.WithWebhookSecretToken(tg.Webhook.Secret))
 	}
+	options = append(options, tg.BotOptions...)
 	b, err := bot.New(tg.APIKey, options...)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	tg.Bot = b
 
 	defaultHandler := func(upd *models.Update) bool {
-		slog.Info(upd.Message.Text)
-		return !strings.HasPrefix(upd.Message.Text, "/")
+		return upd.Message != nil && !strings.HasPrefix(upd.Message.Text, "/")
 	}
 	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandStart, bot.MatchTypeExact, tg.startHandler)
 	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandRefreshActivities, bot.MatchTypeExact, tg.refreshActivitiesHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandBackfillActivities, bot.MatchTypeExact, tg.backfillActivitiesHandler)
 	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandSetLanguage, bot.MatchTypePrefix, tg.setLanguageHandler)
 	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandTestPrompt, bot.MatchTypePrefix, tg.testPromptHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandUndo, bot.MatchTypeExact, tg.undoHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandFind, bot.MatchTypePrefix, tg.findHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandRenameMode, bot.MatchTypePrefix, tg.renameModeHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandSettings, bot.MatchTypeExact, tg.settingsHandler)
+	tg.Bot.RegisterHandler(bot.HandlerTypeMessageText, commandTimezone, bot.MatchTypePrefix, tg.timezoneHandler)
 	tg.Bot.RegisterHandlerMatchFunc(defaultHandler, tg.messageHandler)
-	go tg.Bot.Start(ctx)
-	slog.Info("Telegram bot started and listening for updates.")
+	return nil
+}
+
+// detachUpdate runs the handler of an update with its own deadline instead of the context of
+// the bot, so an update that is running when the bot stops still completes.
+func detachUpdate(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), updateTimeout)
+		defer cancel()
+		next(ctx, b, update)
+	}
+}
+
+// Start receives updates by polling or webhook, runs Renames and handles the channels of the
+// server until ctx is done. It returns once the running updates and renames are handled.
+func (tg *Telegram) Start(ctx context.Context) {
+	if tg.Bot == nil {
+		if err := tg.Connect(); err != nil {
+			panic(err)
+		}
+	}
+	if tg.Renames == nil {
+		tg.Renames = NewRenamePool(nil)
+	}
+	if tg.Renames.Handle == nil {
+		tg.Renames.Handle = tg.updateActivity
+	}
+	updatesDone, err := tg.receiveUpdates(ctx)
+	if err != nil {
+		panic(err)
+	}
+	renamesDone := make(chan struct{})
+	go func() {
+		defer close(renamesDone)
+		tg.Renames.Run(ctx)
+	}()
+	sweep := time.NewTicker(conversationsSweepTick)
+	defer sweep.Stop()
+	autoRenames := time.NewTicker(autoRenameTick)
+	defer autoRenames.Stop()
 	for {
 		select {
-		case activity := <-tg.ActivitiesChannel:
-			slog.Info("Received activity to update from channel", "activityID", activity.Activity.ID, "chatID", activity.ChatId)
-			tg.updateActivity(&activity)
 		case broadcast := <-tg.BroadcastChannel:
 			tg.handleBroadcast(ctx, broadcast)
+		case notification := <-tg.NotificationsChannel:
+			tg.SendMessage(ctx, notification.ChatId, notification.Text)
+		case <-sweep.C:
+			tg.deleteExpiredConversations(ctx)
+		case <-autoRenames.C:
+			tg.applyDueNames(ctx)
+		case <-ctx.Done():
+			<-updatesDone
+			<-renamesDone
+			slog.Info("Telegram bot stopped.")
+			return
 		}
 	}
 }
 
 func (tg *Telegram) handleBroadcast(ctx context.Context, msg BroadcastMessage) {
-	users, err := tg.DB.GetAllUsers()
+	users, err := tg.DB.GetAllUsers(ctx)
 	if err != nil {
 		slog.Error("failed to fetch users for broadcast", "err", err)
 		return
@@ -192,21 +300,27 @@ func (tg *Telegram) SendNotification(chatID int64, messages ...string) {
 
 func (tg *Telegram) messageHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	chatID := update.Message.Chat.ID
-	activityID, ok := tg.LastActivity[chatID]
-	if ok {
-		if tg.NameOptions[chatID] == nil {
-			tg.NameOptions[chatID] = make(map[int64][]string)
-		}
-	}
-
 	if strings.HasPrefix(update.Message.Text, "/") {
 		slog.Debug("this is a command, skipping message handler", "text", update.Message.Text)
 		return
 	}
 
+	conversation, err := tg.pendingConversation(ctx, chatID)
+	if err != nil {
+		slog.Error("error while fetching conversation", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	// text is only taken as a prompt after the Custom button
+	if conversation == nil || !conversation.AwaitingPrompt {
+		tg.SendMessage(ctx, chatID, noPendingActivityMessage)
+		return
+	}
+	activityID := conversation.ActivityID
 	customPrompt := update.Message.Text
+	tg.saveConversation(ctx, chatID, activityID, false)
 
-	activity, err := tg.DB.GetActivityById(activityID)
+	activity, err := tg.DB.GetActivityById(ctx, activityID)
 	if err != nil {
 		slog.Error("error while fetching activity for custom prompt", "err", err, "activityID", activityID)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
@@ -227,13 +341,13 @@ func (tg *Telegram) messageHandler(ctx context.Context, b *bot.Bot, update *mode
 			tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 			return
 		}
-		tg.handleActivitySelection(ctx, chatID, activityID, formattedName)
+		tg.handleActivitySelection(ctx, chatID, activityID, formattedName, dbModels.NameSourceManual)
 		return
 	}
 
 	slog.Info("Generating names with custom prompt", "activityID", activity.ID, "prompt", customPrompt)
 	tg.SendMessage(ctx, chatID, fmt.Sprintf(generatingMessage))
-	usr, err := tg.DB.GetUserByChatId(chatID)
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil || usr == nil {
 		slog.Error("error fetching user for custom prompt language", "err", err, "chatID", chatID)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
@@ -251,8 +365,7 @@ func (tg *Telegram) messageHandler(ctx context.Context, b *bot.Bot, update *mode
 	slog.Info("Generated names with custom prompt", "activityID", activity.ID, "names", names)
 	tg.SendMessage(ctx, chatID, fmt.Sprintf(customPromptSuccessMessage, activity.Name))
 
-	tg.NameOptions[chatID][activityID] = names
-	tg.LastActivity[chatID] = activityID
+	tg.rememberNames(ctx, chatID, activityID, names, dbModels.NameSourceCustomPrompt)
 
 	var listText string
 	maxOptions := 9
@@ -266,7 +379,7 @@ func (tg *Telegram) messageHandler(ctx context.Context, b *bot.Bot, update *mode
 
 	msgText := "*Select a number with new name:*\n\n" + listText
 
-	tg.SendMessage(context.Background(), chatID, msgText)
+	tg.SendMessage(ctx, chatID, msgText)
 	if len(names) < maxOptions {
 		maxOptions = len(names)
 	}
@@ -312,46 +425,88 @@ func (tg *Telegram) messageHandler(ctx context.Context, b *bot.Bot, update *mode
 	}
 }
 
-func (tg *Telegram) updateActivity(activity *ActivityForUpdate) {
-	// store generated names in memory for this chatID/activityID
-	if tg.NameOptions[activity.ChatId] == nil {
-		tg.NameOptions[activity.ChatId] = make(map[int64][]string)
-	}
-	usr, err := tg.DB.GetUserByChatId(activity.ChatId)
+// updateActivity generates names for the activity and, depending on the rename mode of the user,
+// offers them or applies the first one.
+func (tg *Telegram) updateActivity(ctx context.Context, activity *ActivityForUpdate) {
+	usr, err := tg.DB.GetUserByChatId(ctx, activity.ChatId)
 	if err != nil {
 		slog.Error("error while fetching user")
 		return
 	}
+	settings := tg.userSettings(ctx, usr.ID)
+	mode := settings.RenameMode
+	if activity.Manual {
+		mode = dbModels.RenameModeManual
+	}
 
-	aiResp, err := tg.AI.GenerateBetterNames(activity.Activity, usr.Language)
+	aiResp, err := tg.AI.GenerateBetterNames(activity.Activity, settings.Language, settings.NamingStyle)
 	if err != nil {
 		slog.Error("error while generating names", "err", err)
+		tg.offerRuleBasedName(ctx, activity, mode, settings)
 		return
 	}
-	names := strings.Split(aiResp, "\n")
-	tg.NameOptions[activity.ChatId][activity.Activity.ID] = names
-	tg.LastActivity[activity.ChatId] = activity.Activity.ID
+	// the first name may be applied without the user seeing it, so it must not be a blank line or a list number
+	names := utils.CleanActivityNames(strings.Split(aiResp, "\n"))
+	if len(names) == 0 {
+		slog.Error("no names in the AI response", "activityID", activity.Activity.ID, "response", aiResp)
+		tg.offerRuleBasedName(ctx, activity, mode, settings)
+		return
+	}
+	slog.Info("Generated names for activity", "activityID", activity.Activity.ID, "names", names, "mode", mode)
 
-	slog.Info("Generated names for activity", "activityID", activity.Activity.ID, "names", names)
-	tg.SendMessage(context.Background(), activity.ChatId, fmt.Sprintf(generatingBetterNamesMessage, activity.Activity.Name, activity.Activity.ID))
+	if mode == dbModels.RenameModeAuto {
+		// kept for Choose another
+		tg.rememberNames(ctx, activity.ChatId, activity.Activity.ID, names, dbModels.NameSourceAIOption)
+		tg.autoRename(ctx, activity.ChatId, activity.Activity.ID, names[0], dbModels.NameSourceAIOption)
+		return
+	}
+	tg.offerNames(ctx, activity, names, dbModels.NameSourceAIOption, mode, settings.RenameTimeout)
+}
 
-	msgText := makeNamesListMessage(aiResp)
-	tg.SendMessage(context.Background(), activity.ChatId, msgText)
+// offerRuleBasedName falls back to a name made without AI in the modes that rename without the user.
+func (tg *Telegram) offerRuleBasedName(ctx context.Context, activity *ActivityForUpdate, mode string, settings *dbModels.UserSettings) {
+	name := ruleBasedName(activity.Activity, settings.Units)
+	switch mode {
+	case dbModels.RenameModeAuto:
+		tg.autoRename(ctx, activity.ChatId, activity.Activity.ID, name, dbModels.NameSourceRule)
+	case dbModels.RenameModeTimeout:
+		tg.offerNames(ctx, activity, []string{name}, dbModels.NameSourceRule, mode, settings.RenameTimeout)
+	}
+}
 
-	inlineKeyboard := makeInlineKeyboardForNames(activity.Activity.ID, aiResp)
+// offerNames sends the names for the user to pick one, recorded with source. In timeout mode
+// the first one is applied after timeout minutes.
+func (tg *Telegram) offerNames(ctx context.Context, activity *ActivityForUpdate, names []string, source string, mode string, timeout int) {
+	prompt := choosePromptMessage
+	if mode == dbModels.RenameModeTimeout {
+		deadline := time.Now().Add(time.Duration(timeout) * time.Minute)
+		tg.rememberNamesWithDeadline(ctx, activity.ChatId, activity.Activity.ID, names, source, deadline)
+		prompt += "\n" + fmt.Sprintf(autoRenameTimeoutMessage, timeout)
+	} else {
+		tg.rememberNames(ctx, activity.ChatId, activity.Activity.ID, names, source)
+	}
+
+	tg.SendMessage(ctx, activity.ChatId, fmt.Sprintf(generatingBetterNamesMessage, activity.Activity.Name, activity.Activity.ID))
+	tg.sendNameOptions(ctx, activity.ChatId, activity.Activity.ID, names, prompt)
+}
+
+// sendNameOptions lists the names and sends the keyboard to pick one of them with prompt.
+func (tg *Telegram) sendNameOptions(ctx context.Context, chatID int64, activityID int64, names []string, prompt string) {
+	aiResp := strings.Join(names, "\n")
+	tg.SendMessage(ctx, chatID, makeNamesListMessage(aiResp))
 
 	msg := &bot.SendMessageParams{
-		ChatID: activity.ChatId,
-		Text:   "Please choose by pressing a button below:",
+		ChatID: chatID,
+		Text:   prompt,
 		ReplyMarkup: &models.InlineKeyboardMarkup{
-			InlineKeyboard: inlineKeyboard,
+			InlineKeyboard: makeInlineKeyboardForNames(activityID, aiResp),
 		},
 	}
 
-	_, err = tg.Bot.SendMessage(context.Background(), msg)
+	_, err := tg.Bot.SendMessage(ctx, msg)
 	if err != nil {
-		slog.Error("error while sending activity names with options: ", "err", err, "chatID", activity.ChatId)
-		tg.SendMessage(context.Background(), activity.ChatId, defaultBotErrorMessage)
+		slog.Error("error while sending activity names with options: ", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 	}
 }
 
@@ -395,6 +550,14 @@ func (tg *Telegram) handleCallbackQuery(ctx context.Context, _ *bot.Bot, update
 		tg.handleCustomPromptSetup(ctx, chatID, activityID)
 		return
 	}
+	if option == "U" {
+		tg.revertLastRename(ctx, chatID, activityID)
+		return
+	}
+	if option == "L" {
+		tg.handleChooseAnother(ctx, chatID, activityID)
+		return
+	}
 
 	idx, err := strconv.Atoi(option)
 	if err != nil || idx < 1 {
@@ -402,151 +565,115 @@ func (tg *Telegram) handleCallbackQuery(ctx context.Context, _ *bot.Bot, update
 		return
 	}
 
-	nameOptions, ok := tg.NameOptions[chatID]
-	if !ok {
+	nameOptions, err := tg.Conversations.GetNameOptions(ctx, chatID, activityID, time.Now().Unix())
+	if err != nil {
+		slog.Error("error while fetching name options", "err", err, "chatID", chatID, "activityID", activityID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	if nameOptions == nil {
 		tg.SendMessage(ctx, chatID, "No name options found. Please regenerate.")
 		return
 	}
-	options, ok := nameOptions[activityID]
-	if !ok || idx > len(options) {
+	if idx > len(nameOptions.Names) {
 		tg.SendMessage(ctx, chatID, "Invalid selection.")
 		return
 	}
-	selectedName := options[idx-1]
+	selectedName := nameOptions.Names[idx-1]
 	// Clean up after selection
-	delete(nameOptions, activityID)
-	if len(nameOptions) == 0 {
-		delete(tg.NameOptions, chatID)
+	if err = tg.Conversations.DeleteNameOptions(ctx, chatID, activityID); err != nil {
+		slog.Error("error while deleting name options", "err", err, "chatID", chatID, "activityID", activityID)
 	}
-	tg.handleActivitySelection(ctx, chatID, activityID, selectedName)
+	tg.handleActivitySelection(ctx, chatID, activityID, selectedName, nameOptions.Source)
 }
 
 func (tg *Telegram) handleCustomPromptSetup(ctx context.Context, chatID int64, activityID int64) {
-	activity, err := tg.DB.GetActivityById(activityID)
+	activity, err := tg.DB.GetActivityById(ctx, activityID)
 	if err != nil {
 		slog.Error("Failed to get activity for custom prompt setup", "activityID", activityID, "err", err)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 		return
 	}
-	tg.LastActivity[chatID] = activityID
+	tg.cancelAutoRename(ctx, chatID, activityID)
+	tg.awaitPrompt(ctx, chatID, activityID)
 	msg := fmt.Sprintf(customPromptInstruction, activity.Name)
 	tg.SendMessage(ctx, chatID, msg)
 	slog.Info("Set custom prompt state for user", "chatID", chatID, "activityID", activityID)
 }
 
 func (tg *Telegram) handleRegenerateNames(ctx context.Context, chatID int64, activityID int64) {
-	activity, err := tg.DB.GetActivityById(activityID)
+	activity, err := tg.DB.GetActivityById(ctx, activityID)
 	if err != nil {
 		slog.Error("Failed to get activity for regeneration", "activityID", activityID, "err", err)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 		return
 	}
 
-	tg.ActivitiesChannel <- ActivityForUpdate{
-		Activity: *activity,
-		ChatId:   chatID,
+	if err = tg.Renames.Submit(ActivityForUpdate{Activity: *activity, ChatId: chatID, Manual: true}); err != nil {
+		tg.SendMessage(ctx, chatID, renamesBusyMessage)
+		return
 	}
-	slog.Info("Sent activity for name regeneration to channel", "chatID", chatID, "activityID", activityID)
-	tg.SendMessage(ctx, chatID, fmt.Sprintf(generatingMessage))
+	slog.Info("Queued activity for name regeneration", "chatID", chatID, "activityID", activityID)
+	tg.SendMessage(ctx, chatID, generatingMessage)
 }
 
-func (tg *Telegram) handleActivitySelection(ctx context.Context, chatID int64, activityID int64, newName string) {
-	usr, err := tg.DB.GetUserByChatId(chatID)
+// handleActivitySelection renames the activity on Strava and records the rename with source.
+func (tg *Telegram) handleActivitySelection(ctx context.Context, chatID int64, activityID int64, newName string, source string) {
+	activity, _, ok := tg.renameActivity(ctx, chatID, activityID, newName, source)
+	if !ok {
+		return
+	}
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(updateSuccessfulMessage, activity.Name))
+}
+
+// renameActivity renames the activity on Strava and records the rename with source. It returns
+// the renamed activity and its previous name, or false after telling the user what failed.
+func (tg *Telegram) renameActivity(ctx context.Context, chatID int64, activityID int64, newName string, source string) (*dbModels.UserActivity, string, bool) {
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil {
 		slog.Error("Failed to get user for activity update", "chatID", chatID, "err", err)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
-		return
+		return nil, "", false
 	}
 
-	activity, err := tg.DB.GetActivityById(activityID)
+	activity, err := tg.DB.GetActivityById(ctx, activityID)
 	if err != nil {
 		slog.Error("Failed to get activity for update", "activityID", activityID, "err", err)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
-		return
+		return nil, "", false
 	}
 
 	originalName := activity.Name
 	activity.Name = cleanName(newName)
 	activity.IsUpdated = true
 
-	err = tg.refreshAuthForUser(usr)
-	if err != nil {
-		slog.Error("Failed to refresh auth for user before updating activity", "userID", usr.ID, "err", err)
-		tg.SendMessage(ctx, chatID, "Authentication error. Please try /start again.")
-		return
-	}
-
-	_, err = tg.Strava.UpdateActivity(usr.StravaAccessToken, *activity)
+	err = strava.WithToken(ctx, tg.Strava, tg.DB, usr, func(accessToken string) error {
+		_, err := tg.Strava.UpdateActivity(accessToken, *activity)
+		return err
+	})
 	if err != nil {
-		slog.Error("Failed to update activity name on Strava", "activityID", activity.ID, "newName", activity.Name, "err", err)
-		tg.SendMessage(ctx, chatID, fmt.Sprintf(updateFailedMessage, originalName))
-		return
+		slog.Error("Failed to update activity name on Strava", "activityID", activity.ID, "newName", activity.Name, "kind", strava.ErrorKind(err), "err", err)
+		tg.SendMessage(ctx, chatID, stravaErrorMessage(err, fmt.Sprintf(updateFailedMessage, originalName)))
+		return nil, "", false
 	}
 
-	err = tg.DB.UpdateUserActivity(activity)
+	err = tg.DB.UpdateUserActivity(ctx, activity)
 	if err != nil {
 		slog.Error("Failed to update activity in DB after Strava update", "activityID", activity.ID, "err", err)
 		tg.SendMessage(ctx, chatID, fmt.Sprintf("Activity '%s' updated on Strava, but local sync failed. Please try /refresh_activities.", activity.Name))
-		return
-	}
-
-	slog.Info("Activity name updated successfully", "activityID", activity.ID, "newName", activity.Name)
-	tg.SendMessage(ctx, chatID, fmt.Sprintf(updateSuccessfulMessage, activity.Name))
-}
-
-func (tg *Telegram) refreshActivitiesForUser(usr *dbModels.User) error {
-	err := tg.refreshAuthForUser(usr)
-	if err != nil {
-		return err
-	}
-
-	activities, err := tg.Strava.GetAllActivities(usr.StravaAccessToken)
-	if err != nil && err.Error() == utils.UNAUTHORIZED {
-		err = tg.refreshAuthForUser(usr)
-		if err != nil {
-			return err
-		}
-		activities, err = tg.Strava.GetAllActivities(usr.StravaAccessToken)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
-	}
-
-	if activities == nil || len(*activities) == 0 {
-		slog.Info("No activities found for user on Strava", "userID", usr.ID)
-		tg.SendMessage(context.Background(), usr.TelegramChatId, noActivitiesFoundMessage)
-		return nil
+		return nil, "", false
 	}
 
-	slog.Info("Fetched activities from Strava", "count", len(*activities), "userID", usr.ID)
-	var activityPtrs []*dbModels.UserActivity
-	for _, a := range *activities {
-		a.UserID = usr.ID
-		activityPtrs = append(activityPtrs, &a)
-	}
-	err = tg.DB.CreateUserActivities(activityPtrs)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (tg *Telegram) refreshAuthForUser(usr *dbModels.User) error {
-	if !usr.AuthRequired() {
-		return nil
-	}
-	slog.Info("Refreshing Strava token for user", "userID", usr.ID)
-	authResp, err := tg.Strava.RefreshAccessToken(usr.StravaRefreshToken)
-	if err != nil {
-		return err
-	}
-	usr.StravaAccessToken = authResp.AccessToken
-	usr.StravaRefreshToken = authResp.RefreshToken
-	usr.TokenExpiresAt = &authResp.ExpiresAt
-	return tg.DB.UpdateUser(usr)
+	tg.recordNameChange(ctx, &dbModels.NameChange{
+		ActivityID: activity.ID,
+		UserID:     usr.ID,
+		OldName:    originalName,
+		NewName:    activity.Name,
+		Source:     source,
+		CreatedAt:  time.Now().Unix(),
+	})
+	slog.Info("Activity name updated successfully", "activityID", activity.ID, "newName", activity.Name, "source", source)
+	return activity, originalName, true
 }
 
 // cleanName removes leading/trailing spaces and special characters from the activity name.
@@ -2,31 +2,39 @@ package tg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"stravach/app/storage"
 	dbModels "stravach/app/storage/models"
 	strava "stravach/app/strava"
 	"stravach/mocks"
 	"testing"
+	"time"
 
 	bot "github.com/go-telegram/bot"
 	botModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestHandleCallbackQuery_NumberSelection(t *testing.T) {
+	ctx := context.Background()
 	mbot := &mocks.BotSender{}
-	mdb := &mocks.DBStore{}
+	mdb := &mocks.Store{}
 	mai := &mocks.AI{}
 	mstrava := &mocks.StravaService{}
 
 	oldActivity := &dbModels.UserActivity{ID: 99, Name: "Old Name"}
 
-	mdb.On("GetUserByChatId", int64(123)).Return(&dbModels.User{TelegramChatId: 123, Language: "en"}, nil)
-	mdb.On("GetActivityById", int64(99)).Return(oldActivity, nil)
-	mdb.On("UpdateUser", mock.Anything).Return(nil)
-	mdb.On("UpdateUserActivity", mock.Anything).Return(nil)
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{TelegramChatId: 123, Language: "en"}, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(oldActivity, nil)
+	mdb.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("UpdateUserActivity", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("AddNameChange", mock.Anything, mock.MatchedBy(func(c *dbModels.NameChange) bool {
+		return c.ActivityID == 99 && c.OldName == "Old Name" && c.NewName == "Evening Run" && c.Source == dbModels.NameSourceAIOption
+	})).Return(nil)
 
-	mai.On("GenerateBetterNames", *oldActivity, "en").Return([]string{"Morning Ride", "Evening Run"}, nil)
+	mai.On("GenerateBetterNames", *oldActivity, "en", "funny").Return([]string{"Morning Ride", "Evening Run"}, nil)
 
 	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
 	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
@@ -37,15 +45,15 @@ func TestHandleCallbackQuery_NumberSelection(t *testing.T) {
 		return a.ID == 99 && a.Name == "Evening Run"
 	})).Return(&dbModels.UserActivity{}, nil)
 
+	conversations := storage.NewMemoryConversations()
 	tgInstance := &Telegram{
-		Bot:    mbot,
-		DB:     mdb,
-		AI:     mai,
-		Strava: mstrava,
-		NameOptions: map[int64]map[int64][]string{
-			123: {99: {"Morning Ride", "Evening Run"}},
-		},
+		Bot:           mbot,
+		DB:            mdb,
+		AI:            mai,
+		Strava:        mstrava,
+		Conversations: conversations,
 	}
+	tgInstance.rememberNames(ctx, 123, 99, []string{"Morning Ride", "Evening Run"}, dbModels.NameSourceAIOption)
 	update := &botModels.Update{
 		CallbackQuery: &botModels.CallbackQuery{
 			From: botModels.User{ID: 123},
@@ -56,32 +64,67 @@ func TestHandleCallbackQuery_NumberSelection(t *testing.T) {
 	mstrava.AssertCalled(t, "UpdateActivity", mock.Anything, mock.MatchedBy(func(a dbModels.UserActivity) bool {
 		return a.ID == 99 && a.Name == "Evening Run"
 	}))
+	mdb.AssertCalled(t, "AddNameChange", mock.Anything, mock.Anything)
+	options, err := conversations.GetNameOptions(ctx, 123, 99, time.Now().Unix())
+	assert.NoError(t, err)
+	assert.Nil(t, options)
+}
+
+func TestHandleCallbackQuery_SelectionAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
 
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{TelegramChatId: 123, StravaAccessToken: "access", TokenExpiresAt: &expiresAt}, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(&dbModels.UserActivity{ID: 99, Name: "Old Name"}, nil)
+	mdb.On("UpdateUserActivity", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("AddNameChange", mock.Anything, mock.MatchedBy(func(c *dbModels.NameChange) bool {
+		return c.Source == dbModels.NameSourceCustomPrompt
+	})).Return(nil)
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+	mstrava.On("UpdateActivity", "access", mock.MatchedBy(func(a dbModels.UserActivity) bool {
+		return a.ID == 99 && a.Name == "Lakeside Loop"
+	})).Return(&dbModels.UserActivity{}, nil)
+
+	// the names were offered by a process that is gone, only the store is shared
+	conversations := storage.NewMemoryConversations()
+	(&Telegram{Conversations: conversations}).rememberNames(ctx, 123, 99, []string{"Sunrise Tempo", "Lakeside Loop"}, dbModels.NameSourceCustomPrompt)
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Strava: mstrava, Conversations: conversations}
+	update := &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{
+			From: botModels.User{ID: 123},
+			Data: "activity:99:2",
+		},
+	}
+	tgInstance.handleCallbackQuery(context.Background(), nil, update)
+
+	mstrava.AssertExpectations(t)
+	mdb.AssertExpectations(t)
 }
 
 func TestHandleCallbackQuery_Regenerate(t *testing.T) {
 	mbot := &mocks.BotSender{}
-	mdb := &mocks.DBStore{}
+	mdb := &mocks.Store{}
 	mai := &mocks.AI{}
 	mstrava := &mocks.StravaService{}
 
 	activity := &dbModels.UserActivity{ID: 99, Name: "Old Name"}
 
-	mdb.On("GetActivityById", int64(99)).Return(activity, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(activity, nil)
 
 	mbot.On("SendMessage", context.Background(), mock.AnythingOfType("*bot.SendMessageParams")).Return(&botModels.Message{}, nil).Maybe()
 	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
 
 	tgInstance := &Telegram{
-		Bot:               mbot,
-		DB:                mdb,
-		AI:                mai,
-		Strava:            mstrava,
-		LastActivity:      make(map[int64]int64),
-		ActivitiesChannel: make(chan ActivityForUpdate, 1), // Add channel if needed by flow
-		NameOptions: map[int64]map[int64][]string{
-			123: {},
-		},
+		Bot:           mbot,
+		DB:            mdb,
+		AI:            mai,
+		Strava:        mstrava,
+		Renames:       NewRenamePool(nil),
+		Conversations: storage.NewMemoryConversations(),
 	}
 	update := &botModels.Update{
 		CallbackQuery: &botModels.CallbackQuery{
@@ -90,35 +133,59 @@ func TestHandleCallbackQuery_Regenerate(t *testing.T) {
 		},
 	}
 	tgInstance.handleCallbackQuery(context.Background(), nil, update)
+	assert.Equal(t, []ActivityForUpdate{{Activity: *activity, ChatId: 123, Manual: true}}, tgInstance.Renames.pending[123])
 
 	mdb.AssertExpectations(t)
 	mbot.AssertExpectations(t)
 	mstrava.AssertExpectations(t)
 }
 
+func TestHandleCallbackQuery_RegenerateWhenRenamesAreBusy(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(&dbModels.UserActivity{ID: 99, Name: "Old Name"}, nil)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(params *bot.SendMessageParams) bool {
+		return params.ChatID == int64(123) && params.Text == renamesBusyMessage
+	})).Return(&botModels.Message{}, nil).Once()
+
+	renames := NewRenamePool(nil)
+	renames.MaxQueued = 0
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Renames: renames, Conversations: storage.NewMemoryConversations()}
+	update := &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{
+			From: botModels.User{ID: 123},
+			Data: "activity:99:0",
+		},
+	}
+	tgInstance.handleCallbackQuery(context.Background(), nil, update)
+
+	mdb.AssertExpectations(t)
+	mbot.AssertExpectations(t)
+}
+
 func TestHandleCallbackQuery_CustomPrompt(t *testing.T) {
+	ctx := context.Background()
 	mbot := &mocks.BotSender{}
-	mdb := &mocks.DBStore{}
+	mdb := &mocks.Store{}
 	mai := &mocks.AI{}
 	mstrava := &mocks.StravaService{}
 
 	activity := &dbModels.UserActivity{ID: 99, Name: "Old Name"}
 
-	mdb.On("GetActivityById", int64(99)).Return(activity, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(activity, nil)
 	expectedMsgText := fmt.Sprintf(customPromptInstruction, activity.Name)
 	mbot.On("SendMessage", context.Background(), mock.MatchedBy(func(params *bot.SendMessageParams) bool {
 		return params.ChatID == int64(123) && params.Text == expectedMsgText
 	})).Return(&botModels.Message{}, nil)
 	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+	conversations := storage.NewMemoryConversations()
 	tgInstance := &Telegram{
-		Bot:          mbot,
-		DB:           mdb,
-		AI:           mai,
-		Strava:       mstrava,
-		LastActivity: make(map[int64]int64),
-		NameOptions: map[int64]map[int64][]string{
-			123: {},
-		},
+		Bot:           mbot,
+		DB:            mdb,
+		AI:            mai,
+		Strava:        mstrava,
+		Conversations: conversations,
 	}
 	update := &botModels.Update{
 		CallbackQuery: &botModels.CallbackQuery{
@@ -127,6 +194,10 @@ func TestHandleCallbackQuery_CustomPrompt(t *testing.T) {
 		},
 	}
 	tgInstance.handleCallbackQuery(context.Background(), nil, update)
+	conversation, err := conversations.GetConversation(ctx, 123, time.Now().Unix())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(99), conversation.ActivityID)
+	assert.True(t, conversation.AwaitingPrompt)
 
 	mdb.AssertExpectations(t)
 	mbot.AssertExpectations(t)
@@ -134,9 +205,62 @@ func TestHandleCallbackQuery_CustomPrompt(t *testing.T) {
 	mstrava.AssertExpectations(t)
 }
 
+func TestMessageHandler_IgnoresTextWithoutCustomPrompt(t *testing.T) {
+	ctx := context.Background()
+	mbot := &mocks.BotSender{}
+	mai := &mocks.AI{}
+	conversations := storage.NewMemoryConversations()
+	tgInstance := &Telegram{Bot: mbot, DB: &mocks.Store{}, AI: mai, Conversations: conversations}
+	tgInstance.rememberNames(ctx, 123, 99, []string{"Morning Run"}, dbModels.NameSourceAIOption)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(params *bot.SendMessageParams) bool {
+		return params.Text == noPendingActivityMessage
+	})).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance.messageHandler(ctx, nil, &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: "hello"}})
+
+	mbot.AssertExpectations(t)
+	mai.AssertExpectations(t)
+}
+
+func TestMessageHandler_TakesOnePrompt(t *testing.T) {
+	ctx := context.Background()
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mai := &mocks.AI{}
+	conversations := storage.NewMemoryConversations()
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, AI: mai, Conversations: conversations}
+	activity := &dbModels.UserActivity{ID: 99, Name: "Old Name"}
+	tgInstance.awaitPrompt(ctx, 123, 99)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(activity, nil).Once()
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{Language: "English"}, nil).Once()
+	mai.On("CheckIfItsAName", "make it epic").Return(false, nil).Once()
+	mai.On("GenerateBetterNamesWithCustomizedPrompt", *activity, "English", "make it epic").Return("", errors.New("ai is down")).Once()
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(params *bot.SendMessageParams) bool {
+		return params.Text == generatingMessage
+	})).Return(&botModels.Message{}, nil).Once()
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(params *bot.SendMessageParams) bool {
+		return params.Text == fmt.Sprintf(customPromptFailedMessage, "Old Name")
+	})).Return(&botModels.Message{}, nil).Once()
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(params *bot.SendMessageParams) bool {
+		return params.Text == noPendingActivityMessage
+	})).Return(&botModels.Message{}, nil).Once()
+
+	update := &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: "make it epic"}}
+	tgInstance.messageHandler(ctx, nil, update)
+	conversation, err := conversations.GetConversation(ctx, 123, time.Now().Unix())
+	assert.NoError(t, err)
+	assert.False(t, conversation.AwaitingPrompt)
+	// the next message is not a prompt anymore
+	tgInstance.messageHandler(ctx, nil, update)
+
+	mdb.AssertExpectations(t)
+	mbot.AssertExpectations(t)
+	mai.AssertExpectations(t)
+}
+
 func TestHandleCallbackQuery_InvalidData(t *testing.T) {
 	mbot := &mocks.BotSender{}
-	mdb := &mocks.DBStore{}
+	mdb := &mocks.Store{}
 	mai := &mocks.AI{}
 	// No need to set up expectations for this test, as invalid callback data should result in an early return
 	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
@@ -153,3 +277,73 @@ func TestHandleCallbackQuery_InvalidData(t *testing.T) {
 	mdb.AssertExpectations(t)
 	mai.AssertExpectations(t)
 }
+
+func TestHandleActivitySelection_RefreshesRejectedToken(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{TelegramChatId: 123, StravaAccessToken: "revoked", StravaRefreshToken: "refresh", TokenExpiresAt: &expiresAt}, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(&dbModels.UserActivity{ID: 99, Name: "Old Name"}, nil)
+	mdb.On("UpdateUser", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("UpdateUserActivity", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("AddNameChange", mock.Anything, mock.Anything).Return(nil)
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+
+	mstrava.On("UpdateActivity", "revoked", mock.Anything).Return(nil, &strava.APIError{StatusCode: 401, Message: "Authorization Error"}).Once()
+	mstrava.On("RefreshAccessToken", "refresh").Return(&strava.AuthResp{AccessToken: "fresh", RefreshToken: "refresh", ExpiresAt: expiresAt}, nil).Once()
+	mstrava.On("UpdateActivity", "fresh", mock.Anything).Return(&dbModels.UserActivity{}, nil).Once()
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Strava: mstrava}
+	tgInstance.handleActivitySelection(context.Background(), 123, 99, "Evening Run", dbModels.NameSourceManual)
+
+	mstrava.AssertExpectations(t)
+	mdb.AssertCalled(t, "UpdateUserActivity", mock.Anything, mock.Anything)
+}
+
+func TestStravaErrorMessage(t *testing.T) {
+	assert.Equal(t, stravaReconnectMessage, stravaErrorMessage(&strava.APIError{StatusCode: 401}, "fallback"))
+	assert.Equal(t, stravaMissingScopeMessage, stravaErrorMessage(&strava.APIError{StatusCode: 401, Errors: []strava.FaultError{{Resource: "AccessToken", Field: "activity:write_permission", Code: "missing"}}}, "fallback"))
+	assert.Equal(t, stravaNotFoundMessage, stravaErrorMessage(fmt.Errorf("wrapped: %w", &strava.APIError{StatusCode: 404}), "fallback"))
+	assert.Equal(t, fmt.Sprintf(rateLimitedMessage, "1m0s"), stravaErrorMessage(&strava.RateLimitError{RetryAfter: 10 * time.Second}, "fallback"))
+	assert.Equal(t, "fallback", stravaErrorMessage(errors.New("boom"), "fallback"))
+}
+
+func TestFindHandler_ListsMatchingActivities(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{ID: 7, TelegramChatId: 123}, nil)
+	mdb.On("QueryActivities", mock.Anything, storage.ActivityQuery{UserID: 7, Text: "river loop", Limit: findResultsLimit}).Return(&storage.ActivityPage{
+		Activities: []dbModels.UserActivity{{ID: 99, Name: "River Loop", Distance: 10240, StartDate: time.Date(2024, 5, 12, 7, 0, 0, 0, time.UTC)}},
+	}, nil)
+	settings := dbModels.DefaultUserSettings(7)
+	settings.Units = dbModels.UnitsImperial
+	mdb.On("GetUserSettings", mock.Anything, int64(7)).Return(settings, nil)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return p.Text == "12 May 2024 · River Loop · 6.4 mi (99)"
+	})).Return(&botModels.Message{}, nil)
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb}
+	update := &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: "/find river loop"}}
+	tgInstance.findHandler(context.Background(), nil, update)
+
+	mdb.AssertExpectations(t)
+	mbot.AssertExpectations(t)
+}
+
+func TestFindHandler_WithoutText(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return p.Text == findUsageMessage
+	})).Return(&botModels.Message{}, nil)
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb}
+	update := &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: "/find  "}}
+	tgInstance.findHandler(context.Background(), nil, update)
+
+	mbot.AssertExpectations(t)
+	mdb.AssertNotCalled(t, "QueryActivities", mock.Anything, mock.Anything)
+}
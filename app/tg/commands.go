@@ -7,7 +7,9 @@ import (
 	"github.com/go-telegram/bot/models"
 	"log/slog"
 	"os"
+	"stravach/app/storage"
 	dbModels "stravach/app/storage/models"
+	"stravach/app/strava"
 	"strings"
 )
 
@@ -20,7 +22,7 @@ func (tg *Telegram) startHandler(ctx context.Context, b *bot.Bot, update *models
 		return
 	}
 	chatID := update.Message.Chat.ID
-	userExists, err := tg.DB.IsUserExistsByChatId(chatID)
+	userExists, err := tg.DB.IsUserExistsByChatId(ctx, chatID)
 	if err != nil {
 		slog.Error("failed to check if user exists", "err", err, "chatID", chatID)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
@@ -28,7 +30,7 @@ func (tg *Telegram) startHandler(ctx context.Context, b *bot.Bot, update *models
 	}
 	if !userExists {
 		usr := &dbModels.User{TelegramChatId: chatID, StravaId: nil}
-		err = tg.DB.CreateUser(usr)
+		err = tg.DB.CreateUser(ctx, usr)
 		if err != nil {
 			slog.Error("failed to create user", "err", err, "chatID", chatID)
 			tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
@@ -37,10 +39,16 @@ func (tg *Telegram) startHandler(ctx context.Context, b *bot.Bot, update *models
 		slog.Info("New user created", "chatID", chatID)
 	}
 
-	link := fmt.Sprintf("%s/api/auth/%d", url, chatID)
+	state, err := tg.JWT.GenerateOAuthState(chatID, "", stravaAuthLinkTTL)
+	if err != nil {
+		slog.Error("failed to generate oauth state", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	link := fmt.Sprintf("%s/api/auth?state=%s", url, state)
 	escapedLink := bot.EscapeMarkdownUnescaped(link)
 	replyMsg := fmt.Sprintf(authLinkMessage, escapedLink)
-	slog.Info("Sending auth link", "link", link, "chatID", chatID)
+	slog.Info("Sending auth link", "chatID", chatID)
 	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    chatID,
 		Text:      replyMsg,
@@ -53,30 +61,50 @@ func (tg *Telegram) startHandler(ctx context.Context, b *bot.Bot, update *models
 
 func (tg *Telegram) refreshActivitiesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	chatID := update.Message.Chat.ID
-	usr, err := tg.DB.GetUserByChatId(chatID)
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil {
 		slog.Error("failed to get user for refresh activities", "err", err, "chatID", chatID)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 		return
 	}
-	err = tg.refreshActivitiesForUser(usr)
+	synced, err := tg.syncActivities(ctx, usr)
 	if err != nil {
-		slog.Error("error while refreshing activities for user", "err", err, "userID", usr.ID)
-		tg.SendMessage(ctx, chatID, "Failed to refresh activities. Please try again.")
+		slog.Error("error while refreshing activities for user", "err", err, "kind", strava.ErrorKind(err), "userID", usr.ID, "synced", synced)
+		tg.SendMessage(ctx, chatID, stravaErrorMessage(err, "Failed to refresh activities. Please try again."))
 		return
 	}
 	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: usr.TelegramChatId,
-		Text:   activitiesRefreshedMessage,
+		Text:   fmt.Sprintf(activitiesRefreshedMessage, synced),
 	})
 	if err != nil {
 		slog.Error("failed to send activities refreshed message", "err", err, "chatID", chatID)
 	}
 }
 
-func (tg *Telegram) setLanguageHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+// backfillActivitiesHandler imports the whole activity history. It can be sent again to resume
+// a backfill that stopped, e.g. on the rate limit.
+func (tg *Telegram) backfillActivitiesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	chatID := update.Message.Chat.ID
-	usr, err := tg.DB.GetUserByChatId(chatID)
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to get user for backfill", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	tg.SendMessage(ctx, chatID, backfillStartedMessage)
+	imported, err := tg.backfillActivities(ctx, usr)
+	if err != nil {
+		slog.Error("activities backfill stopped", "err", err, "kind", strava.ErrorKind(err), "userID", usr.ID, "imported", imported)
+		tg.SendMessage(ctx, chatID, fmt.Sprintf(backfillPausedMessage, stravaErrorMessage(err, "Import stopped."), imported))
+		return
+	}
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(backfillFinishedMessage, imported))
+}
+
+func (tg *Telegram) setLanguageHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil {
 		slog.Error("failed to get user for set language", "err", err, "chatID", chatID)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
@@ -87,26 +115,51 @@ func (tg *Telegram) setLanguageHandler(ctx context.Context, b *bot.Bot, update *
 		tg.SendMessage(ctx, chatID, setLanguageUsageMessage)
 		return
 	}
-	language := msgArr[1]
+	language, ok := dbModels.FindLanguage(msgArr[1])
+	if !ok {
+		tg.SendMessage(ctx, chatID, fmt.Sprintf(unknownLanguageMessage, msgArr[1], strings.Join(dbModels.Languages, ", ")))
+		return
+	}
 	usr.Language = language
-	err = tg.DB.UpdateUser(usr)
+	err = tg.DB.UpdateUser(ctx, usr)
 	if err != nil {
 		slog.Error("failed to update user language", "err", err, "userID", usr.ID, "language", language)
 		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
 		return
 	}
-	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: usr.TelegramChatId,
-		Text:   fmt.Sprintf(languageSetSuccessMessage, language),
-	})
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(languageSetSuccessMessage, language))
+}
+
+// findHandler lists the user's newest activities whose name or description has all the words after /find.
+func (tg *Telegram) findHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	text := strings.TrimSpace(strings.TrimPrefix(update.Message.Text, commandFind))
+	if text == "" {
+		tg.SendMessage(ctx, chatID, findUsageMessage)
+		return
+	}
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil {
-		slog.Error("failed to send language set confirmation", "err", err, "chatID", chatID)
+		slog.Error("failed to get user for find", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	page, err := tg.DB.QueryActivities(ctx, storage.ActivityQuery{UserID: usr.ID, Text: text, Limit: findResultsLimit})
+	if err != nil {
+		slog.Error("failed to search activities", "err", err, "userID", usr.ID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	if len(page.Activities) == 0 {
+		tg.SendMessage(ctx, chatID, fmt.Sprintf(nothingFoundMessage, text))
+		return
 	}
+	tg.SendMessage(ctx, chatID, makeFoundActivitiesMessage(page, tg.userSettings(ctx, usr.ID).Units))
 }
 
 func (tg *Telegram) testPromptHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
 	chatID := update.Message.Chat.ID
-	user, err := tg.DB.GetUserByChatId(chatID)
+	user, err := tg.DB.GetUserByChatId(ctx, chatID)
 	if err != nil {
 		tg.SendMessage(ctx, chatID, "User not found. Please authenticate first.")
 		return
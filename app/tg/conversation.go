@@ -0,0 +1,74 @@
+package tg
+
+import (
+	"context"
+	"log/slog"
+	dbModels "stravach/app/storage/models"
+	"time"
+)
+
+const (
+	// nameOptionsTTL keeps the buttons of a names message working for a week.
+	nameOptionsTTL = 7 * 24 * time.Hour
+	// conversationTTL bounds how long a reply after the Custom button is taken as a name or prompt.
+	conversationTTL        = 24 * time.Hour
+	conversationsSweepTick = time.Hour
+)
+
+// rememberNames stores the names offered for the activity and makes it the chat's pending activity.
+// source is recorded when one of the names is picked.
+func (tg *Telegram) rememberNames(ctx context.Context, chatID int64, activityID int64, names []string, source string) {
+	tg.rememberNamesWithDeadline(ctx, chatID, activityID, names, source, time.Time{})
+}
+
+// rememberNamesWithDeadline works like rememberNames, and unless deadline is zero the first name
+// is applied at deadline when none was picked before, see applyDueNames.
+func (tg *Telegram) rememberNamesWithDeadline(ctx context.Context, chatID int64, activityID int64, names []string, source string, deadline time.Time) {
+	now := time.Now()
+	options := &dbModels.NameOptions{
+		ChatID:     chatID,
+		ActivityID: activityID,
+		Names:      names,
+		Source:     source,
+		ExpiresAt:  now.Add(nameOptionsTTL).Unix(),
+	}
+	if !deadline.IsZero() {
+		options.AutoApplyAt = deadline.Unix()
+	}
+	err := tg.Conversations.SaveNameOptions(ctx, options)
+	if err != nil {
+		slog.Error("error while saving name options", "err", err, "chatID", chatID, "activityID", activityID)
+	}
+	tg.saveConversation(ctx, chatID, activityID, false)
+}
+
+// awaitPrompt makes the next text message of the chat a custom prompt for the activity.
+// messageHandler takes only that one message.
+func (tg *Telegram) awaitPrompt(ctx context.Context, chatID int64, activityID int64) {
+	tg.saveConversation(ctx, chatID, activityID, true)
+}
+
+func (tg *Telegram) saveConversation(ctx context.Context, chatID int64, activityID int64, awaitingPrompt bool) {
+	now := time.Now()
+	err := tg.Conversations.SaveConversation(ctx, &dbModels.Conversation{
+		ChatID:         chatID,
+		ActivityID:     activityID,
+		AwaitingPrompt: awaitingPrompt,
+		ExpiresAt:      now.Add(conversationTTL).Unix(),
+		UpdatedAt:      now.Unix(),
+	})
+	if err != nil {
+		slog.Error("error while saving conversation", "err", err, "chatID", chatID, "activityID", activityID)
+	}
+}
+
+// pendingConversation returns the chat's unexpired conversation, nil when there is none.
+func (tg *Telegram) pendingConversation(ctx context.Context, chatID int64) (*dbModels.Conversation, error) {
+	return tg.Conversations.GetConversation(ctx, chatID, time.Now().Unix())
+}
+
+func (tg *Telegram) deleteExpiredConversations(ctx context.Context) {
+	if err := tg.Conversations.DeleteExpiredConversations(ctx, time.Now().Unix()); err != nil {
+		slog.Error("error while deleting expired conversations", "err", err)
+	}
+}
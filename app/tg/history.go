@@ -0,0 +1,88 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	dbModels "stravach/app/storage/models"
+	"stravach/app/strava"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// recordNameChange adds a rename to the activity name history. The rename already happened
+// on Strava, so a failure is only logged.
+func (tg *Telegram) recordNameChange(ctx context.Context, change *dbModels.NameChange) {
+	if err := tg.DB.AddNameChange(ctx, change); err != nil {
+		slog.Error("error while recording name change", "err", err, "activityID", change.ActivityID, "source", change.Source)
+	}
+}
+
+// undoHandler renames the activity of the user's latest rename back to its previous name.
+// Sending it again walks further back through the history.
+func (tg *Telegram) undoHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	tg.revertLastRename(ctx, update.Message.Chat.ID, 0)
+}
+
+// revertLastRename renames the activity of the user's latest rename back to its previous name,
+// limited to one activity unless activityID is 0.
+func (tg *Telegram) revertLastRename(ctx context.Context, chatID int64, activityID int64) {
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to get user for undo", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	change, err := tg.DB.GetLastNameChange(ctx, usr.ID, activityID)
+	if err != nil {
+		slog.Error("failed to get last name change", "err", err, "userID", usr.ID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	if change == nil {
+		tg.SendMessage(ctx, chatID, nothingToUndoMessage)
+		return
+	}
+	activity, err := tg.DB.GetActivityById(ctx, change.ActivityID)
+	if err != nil {
+		slog.Error("failed to get activity for undo", "err", err, "activityID", change.ActivityID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+
+	currentName := activity.Name
+	activity.Name = change.OldName
+	err = strava.WithToken(ctx, tg.Strava, tg.DB, usr, func(accessToken string) error {
+		_, err := tg.Strava.UpdateActivity(accessToken, *activity)
+		return err
+	})
+	if err != nil {
+		slog.Error("failed to revert activity name on Strava", "activityID", activity.ID, "kind", strava.ErrorKind(err), "err", err)
+		tg.SendMessage(ctx, chatID, stravaErrorMessage(err, fmt.Sprintf(undoFailedMessage, currentName)))
+		return
+	}
+	err = tg.DB.UpdateUserActivity(ctx, activity)
+	if err != nil {
+		slog.Error("failed to update activity in DB after revert", "activityID", activity.ID, "err", err)
+	}
+
+	now := time.Now().Unix()
+	// a change that isn't marked reverted would be undone again, so the revert isn't recorded either
+	if err = tg.DB.MarkNameChangeReverted(ctx, change.ID, now); err != nil {
+		slog.Error("error while marking name change reverted", "err", err, "id", change.ID)
+		tg.SendMessage(ctx, chatID, fmt.Sprintf(undoNotRecordedMessage, activity.Name))
+		return
+	}
+	tg.recordNameChange(ctx, &dbModels.NameChange{
+		ActivityID: activity.ID,
+		UserID:     usr.ID,
+		OldName:    currentName,
+		NewName:    activity.Name,
+		Source:     dbModels.NameSourceRevert,
+		CreatedAt:  now,
+	})
+	slog.Info("Activity name reverted", "activityID", activity.ID, "name", activity.Name)
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(undoSuccessfulMessage, activity.Name))
+}
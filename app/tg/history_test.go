@@ -0,0 +1,130 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	bot "github.com/go-telegram/bot"
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func undoUpdate(chatID int64) *botModels.Update {
+	return &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: chatID}, Text: commandUndo}}
+}
+
+func TestUndoHandler_RevertsLastRename(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{ID: 7, TelegramChatId: 123, StravaAccessToken: "access", TokenExpiresAt: &expiresAt}, nil)
+	mdb.On("GetLastNameChange", mock.Anything, int64(7), int64(0)).Return(&dbModels.NameChange{ID: 3, ActivityID: 99, UserID: 7, OldName: "Morning Run", NewName: "Sunrise Tempo"}, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(&dbModels.UserActivity{ID: 99, Name: "Sunrise Tempo", IsUpdated: true}, nil)
+	mstrava.On("UpdateActivity", "access", mock.MatchedBy(func(a dbModels.UserActivity) bool {
+		return a.ID == 99 && a.Name == "Morning Run"
+	})).Return(&dbModels.UserActivity{}, nil)
+	mdb.On("UpdateUserActivity", mock.Anything, mock.MatchedBy(func(a *dbModels.UserActivity) bool { return a.Name == "Morning Run" })).Return(nil)
+	mdb.On("MarkNameChangeReverted", mock.Anything, int64(3), mock.Anything).Return(nil)
+	mdb.On("AddNameChange", mock.Anything, mock.MatchedBy(func(c *dbModels.NameChange) bool {
+		return c.ActivityID == 99 && c.OldName == "Sunrise Tempo" && c.NewName == "Morning Run" && c.Source == dbModels.NameSourceRevert
+	})).Return(nil)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return p.Text == fmt.Sprintf(undoSuccessfulMessage, "Morning Run")
+	})).Return(&botModels.Message{}, nil)
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Strava: mstrava}
+	tgInstance.undoHandler(context.Background(), nil, undoUpdate(123))
+
+	mdb.AssertExpectations(t)
+	mstrava.AssertExpectations(t)
+	mbot.AssertExpectations(t)
+}
+
+func TestUndoHandler_DoesNotRecordUnmarkedRevert(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{ID: 7, TelegramChatId: 123, StravaAccessToken: "access", TokenExpiresAt: &expiresAt}, nil)
+	mdb.On("GetLastNameChange", mock.Anything, int64(7), int64(0)).Return(&dbModels.NameChange{ID: 3, ActivityID: 99, UserID: 7, OldName: "Morning Run", NewName: "Sunrise Tempo"}, nil)
+	mdb.On("GetActivityById", mock.Anything, int64(99)).Return(&dbModels.UserActivity{ID: 99, Name: "Sunrise Tempo", IsUpdated: true}, nil)
+	mstrava.On("UpdateActivity", "access", mock.Anything).Return(&dbModels.UserActivity{}, nil)
+	mdb.On("UpdateUserActivity", mock.Anything, mock.Anything).Return(nil)
+	mdb.On("MarkNameChangeReverted", mock.Anything, int64(3), mock.Anything).Return(errors.New("database is locked"))
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return p.Text == fmt.Sprintf(undoNotRecordedMessage, "Morning Run")
+	})).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Strava: mstrava}
+	tgInstance.undoHandler(context.Background(), nil, undoUpdate(123))
+
+	mdb.AssertNotCalled(t, "AddNameChange", mock.Anything, mock.Anything)
+	mdb.AssertExpectations(t)
+	mbot.AssertExpectations(t)
+}
+
+func TestUndoHandler_NothingToUndo(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+
+	mdb.On("GetUserByChatId", mock.Anything, int64(123)).Return(&dbModels.User{ID: 7, TelegramChatId: 123}, nil)
+	mdb.On("GetLastNameChange", mock.Anything, int64(7), int64(0)).Return(nil, nil)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		return p.Text == nothingToUndoMessage
+	})).Return(&botModels.Message{}, nil)
+
+	tgInstance := &Telegram{Bot: mbot, DB: mdb, Strava: mstrava}
+	tgInstance.undoHandler(context.Background(), nil, undoUpdate(123))
+
+	mbot.AssertExpectations(t)
+	mstrava.AssertNotCalled(t, "UpdateActivity", mock.Anything, mock.Anything)
+}
+
+func TestUndoHandler_RevertsSelectedName(t *testing.T) {
+	ctx := context.Background()
+	mbot := &mocks.BotSender{}
+	mstrava := &mocks.StravaService{}
+	store := storage.NewMemoryStore()
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	usr := &dbModels.User{TelegramChatId: 123, StravaAccessToken: "access", TokenExpiresAt: &expiresAt}
+	require.NoError(t, store.CreateUser(ctx, usr))
+	require.NoError(t, store.CreateUserActivity(ctx, &dbModels.UserActivity{ID: 99, Name: "Morning Run"}, usr.ID))
+	mbot.On("SendMessage", mock.Anything, mock.Anything).Return(&botModels.Message{}, nil)
+	mstrava.On("UpdateActivity", "access", mock.Anything).Return(&dbModels.UserActivity{}, nil)
+
+	tgInstance := &Telegram{Bot: mbot, DB: store, Strava: mstrava, Conversations: store}
+	tgInstance.rememberNames(ctx, 123, 99, []string{"Sunrise Tempo", "Lakeside Loop"}, dbModels.NameSourceAIOption)
+	tgInstance.handleCallbackQuery(context.Background(), nil, &botModels.Update{
+		CallbackQuery: &botModels.CallbackQuery{From: botModels.User{ID: 123}, Data: "activity:99:1"},
+	})
+	activity, err := store.GetActivityById(ctx, 99)
+	require.NoError(t, err)
+	require.Equal(t, "Sunrise Tempo", activity.Name)
+
+	tgInstance.undoHandler(context.Background(), nil, undoUpdate(123))
+	activity, err = store.GetActivityById(ctx, 99)
+	require.NoError(t, err)
+	require.Equal(t, "Morning Run", activity.Name)
+	history, err := store.GetNameHistory(ctx, 99)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, dbModels.NameSourceRevert, history[0].Source)
+	require.NotZero(t, history[1].RevertedAt)
+
+	// the revert itself can't be undone
+	last, err := store.GetLastNameChange(ctx, usr.ID, 0)
+	require.NoError(t, err)
+	require.Nil(t, last)
+}
@@ -1,9 +1,14 @@
 package tg
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-telegram/bot/models"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/app/strava"
 	"strings"
+	"time"
 )
 
 func makeNamesListMessage(aiResp string) string {
@@ -20,6 +25,21 @@ func makeNamesListMessage(aiResp string) string {
 	return "*Select a number with new name:*\n\n" + listText
 }
 
+// findResultsLimit is how many activities /find lists.
+const findResultsLimit = 10
+
+// makeFoundActivitiesMessage lists the activities of a /find page, one per line, with distances in units.
+func makeFoundActivitiesMessage(page *storage.ActivityPage, units string) string {
+	var b strings.Builder
+	for _, a := range page.Activities {
+		fmt.Fprintf(&b, "%s · %s · %s (%d)\n", a.StartDate.Format("2 Jan 2006"), a.Name, dbModels.FormatDistance(a.Distance, units), a.ID)
+	}
+	if page.NextCursor != "" {
+		fmt.Fprintf(&b, "Showing the newest %d, add more words to narrow it down.", len(page.Activities))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
 func makeInlineKeyboardForNames(activityID int64, aiResp string) [][]models.InlineKeyboardButton {
 	names := strings.Split(aiResp, "\n")
 	maxOptions := 9
@@ -72,3 +92,22 @@ func parseTestPromptCommand(text string) (activityType, prompt string, ok bool)
 
 	return activityType, prompt, true
 }
+
+// stravaErrorMessage explains a failed Strava call to the user, or returns fallback
+// when there's nothing more specific to say.
+func stravaErrorMessage(err error, fallback string) string {
+	var rateErr *strava.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		return fmt.Sprintf(rateLimitedMessage, max(rateErr.RetryAfter.Round(time.Minute), time.Minute))
+	case errors.Is(err, strava.ErrUnauthorized):
+		return stravaReconnectMessage
+	case errors.Is(err, strava.ErrForbidden):
+		return stravaMissingScopeMessage
+	case errors.Is(err, strava.ErrNotFound):
+		return stravaNotFoundMessage
+	case errors.Is(err, strava.ErrServer):
+		return stravaUnavailableMessage
+	}
+	return fallback
+}
@@ -0,0 +1,155 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"sync"
+)
+
+// ErrRenameQueueFull is returned by RenamePool.Submit when the pool, or the chat, has
+// as many renames waiting as it takes, or the pool is stopped.
+var ErrRenameQueueFull = errors.New("rename queue is full")
+
+// RenameQueueStats describes the rename pool, published as the rename_queue expvar:
+// queued and running are the current renames, chats the chats waiting for a worker.
+var RenameQueueStats = expvar.NewMap("rename_queue")
+
+// RenamePool generates names for activities in the background. Renames of one chat run one
+// at a time in the order they were submitted, renames of different chats run concurrently
+// on up to Workers goroutines, so a slow AI response only holds up its own chat.
+type RenamePool struct {
+	Handle func(ctx context.Context, activity *ActivityForUpdate)
+	// Workers is how many renames run at once.
+	Workers int
+	// MaxQueued bounds the waiting renames of all chats, MaxQueuedPerChat those of one chat.
+	MaxQueued        int
+	MaxQueuedPerChat int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[int64][]ActivityForUpdate
+	// ready are the chats with waiting renames and none running, in the order they can run.
+	ready   []int64
+	running map[int64]bool
+	queued  int
+	stopped bool
+}
+
+func NewRenamePool(handle func(ctx context.Context, activity *ActivityForUpdate)) *RenamePool {
+	p := &RenamePool{
+		Handle:           handle,
+		Workers:          4,
+		MaxQueued:        100,
+		MaxQueuedPerChat: 10,
+		pending:          map[int64][]ActivityForUpdate{},
+		running:          map[int64]bool{},
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Submit queues the activity without waiting, it returns ErrRenameQueueFull instead of
+// blocking when the pool can't take it.
+func (p *RenamePool) Submit(activity ActivityForUpdate) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	chatId := activity.ChatId
+	if p.stopped || p.queued >= p.MaxQueued || len(p.pending[chatId]) >= p.MaxQueuedPerChat {
+		RenameQueueStats.Add("rejected", 1)
+		slog.Warn("rename queue is full", "chatID", chatId, "activityID", activity.Activity.ID, "queued", p.queued)
+		return ErrRenameQueueFull
+	}
+	if len(p.pending[chatId]) == 0 && !p.running[chatId] {
+		p.ready = append(p.ready, chatId)
+		p.cond.Signal()
+	}
+	p.pending[chatId] = append(p.pending[chatId], activity)
+	p.queued++
+	RenameQueueStats.Add("submitted", 1)
+	p.publish()
+	return nil
+}
+
+// Run starts the workers and returns once ctx is done and the running renames finished.
+// Renames still waiting then are dropped.
+func (p *RenamePool) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for i := 0; i < p.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			p.work(ctx)
+		}()
+	}
+	<-ctx.Done()
+	p.mu.Lock()
+	p.stopped = true
+	if p.queued > 0 {
+		slog.Warn("dropping waiting renames", "queued", p.queued)
+	}
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	workers.Wait()
+}
+
+func (p *RenamePool) work(ctx context.Context) {
+	for {
+		activity, ok := p.next()
+		if !ok {
+			return
+		}
+		// a rename that started is finished even when the pool stops
+		runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), updateTimeout)
+		p.Handle(runCtx, &activity)
+		cancel()
+		p.done(activity.ChatId)
+	}
+}
+
+// next waits for a rename of a chat without a running one, false when the pool stopped.
+func (p *RenamePool) next() (ActivityForUpdate, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ready) == 0 && !p.stopped {
+		p.cond.Wait()
+	}
+	if p.stopped {
+		return ActivityForUpdate{}, false
+	}
+	chatId := p.ready[0]
+	p.ready = p.ready[1:]
+	activity := p.pending[chatId][0]
+	if len(p.pending[chatId]) == 1 {
+		delete(p.pending, chatId)
+	} else {
+		p.pending[chatId] = p.pending[chatId][1:]
+	}
+	p.running[chatId] = true
+	p.queued--
+	p.publish()
+	return activity, true
+}
+
+// done lets the next rename of the chat run.
+func (p *RenamePool) done(chatId int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.running, chatId)
+	if len(p.pending[chatId]) > 0 {
+		p.ready = append(p.ready, chatId)
+		p.cond.Signal()
+	}
+	RenameQueueStats.Add("completed", 1)
+	p.publish()
+}
+
+// publish updates the gauges of RenameQueueStats. The caller holds p.mu.
+func (p *RenamePool) publish() {
+	for name, value := range map[string]int{"queued": p.queued, "running": len(p.running), "chats": len(p.ready)} {
+		gauge := new(expvar.Int)
+		gauge.Set(int64(value))
+		RenameQueueStats.Set(name, gauge)
+	}
+}
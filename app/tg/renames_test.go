@@ -0,0 +1,166 @@
+package tg
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	dbModels "stravach/app/storage/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func renameOf(chatId, activityId int64) ActivityForUpdate {
+	return ActivityForUpdate{Activity: dbModels.UserActivity{ID: activityId}, ChatId: chatId}
+}
+
+// runPool runs the pool until the test ends.
+func runPool(t *testing.T, p *RenamePool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func TestRenamePool_KeepsOrderOfChat(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[int64][]int64{}
+	running := map[int64]int{}
+	done := make(chan struct{}, 20)
+	p := NewRenamePool(func(_ context.Context, activity *ActivityForUpdate) {
+		mu.Lock()
+		running[activity.ChatId]++
+		assert.Equal(t, 1, running[activity.ChatId], "two renames of chat %d at once", activity.ChatId)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running[activity.ChatId]--
+		handled[activity.ChatId] = append(handled[activity.ChatId], activity.Activity.ID)
+		mu.Unlock()
+		done <- struct{}{}
+	})
+	runPool(t, p)
+
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, p.Submit(renameOf(1, i)))
+		require.NoError(t, p.Submit(renameOf(2, 10+i)))
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	assert.Equal(t, map[int64][]int64{1: {1, 2, 3, 4, 5}, 2: {11, 12, 13, 14, 15}}, handled)
+}
+
+func TestRenamePool_LimitsWorkers(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	started := make(chan struct{}, 6)
+	p := NewRenamePool(func(_ context.Context, activity *ActivityForUpdate) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	p.Workers = 2
+	runPool(t, p)
+
+	for chatId := int64(1); chatId <= 6; chatId++ {
+		require.NoError(t, p.Submit(renameOf(chatId, chatId)))
+	}
+	<-started
+	<-started
+	select {
+	case <-started:
+		t.Fatal("more renames running than workers")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for i := 0; i < 4; i++ {
+		<-started
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, maxRunning)
+}
+
+func TestRenamePool_SlowChatDoesNotHoldUpOthers(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	renamed := make(chan int64, 1)
+	p := NewRenamePool(func(_ context.Context, activity *ActivityForUpdate) {
+		if activity.ChatId == 1 {
+			<-release
+			return
+		}
+		renamed <- activity.ChatId
+	})
+	runPool(t, p)
+
+	require.NoError(t, p.Submit(renameOf(1, 1)))
+	require.NoError(t, p.Submit(renameOf(2, 2)))
+	select {
+	case chatId := <-renamed:
+		assert.Equal(t, int64(2), chatId)
+	case <-time.After(time.Second):
+		t.Fatal("rename of chat 2 waited for chat 1")
+	}
+}
+
+func TestRenamePool_RejectsWhenFull(t *testing.T) {
+	p := NewRenamePool(nil)
+	p.MaxQueued = 3
+	p.MaxQueuedPerChat = 2
+
+	require.NoError(t, p.Submit(renameOf(1, 1)))
+	require.NoError(t, p.Submit(renameOf(1, 2)))
+	assert.ErrorIs(t, p.Submit(renameOf(1, 3)), ErrRenameQueueFull)
+	require.NoError(t, p.Submit(renameOf(2, 4)))
+	assert.ErrorIs(t, p.Submit(renameOf(3, 5)), ErrRenameQueueFull)
+	assert.Equal(t, "3", RenameQueueStats.Get("queued").String())
+}
+
+func TestRenamePool_StopFinishesRunningRename(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished bool
+	p := NewRenamePool(func(ctx context.Context, activity *ActivityForUpdate) {
+		close(started)
+		<-release
+		finished = ctx.Err() == nil
+	})
+	p.Workers = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.Run(ctx)
+	}()
+
+	require.NoError(t, p.Submit(renameOf(1, 1)))
+	require.NoError(t, p.Submit(renameOf(1, 2)))
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("stopped before the running rename finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+	assert.True(t, finished)
+	assert.ErrorIs(t, p.Submit(renameOf(2, 3)), ErrRenameQueueFull)
+}
@@ -0,0 +1,358 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	dbModels "stravach/app/storage/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	settingsMessage        = "Your settings:\nLanguage: %s\nUnits: %s\nNaming style: %s\nRename mode: %s\nActivities: %s\nMinimum distance: %s\nQuiet hours: %s\nTimezone: %s\n\nChoose what to change:"
+	settingsChooseMessage  = "Choose the %s:"
+	settingsInvalidMessage = "This setting is not available anymore, please open /settings again."
+	timezoneUsageMessage   = "Usage: /timezone <Area/City>, e.g. /timezone Europe/Berlin"
+	timezoneSetMessage     = "Your timezone was set to %s"
+)
+
+// settingsTimezones are offered by the timezone menu, /timezone sets any other.
+var settingsTimezones = []string{"UTC", "Europe/London", "Europe/Berlin", "Europe/Kyiv", "America/New_York",
+	"America/Chicago", "America/Denver", "America/Los_Angeles", "Asia/Tokyo", "Australia/Sydney"}
+
+// settingsQuietHours are offered by the quiet hours menu as start and end hours.
+var settingsQuietHours = [][2]int{{22, 7}, {23, 8}, {21, 6}, {0, 6}}
+
+// settingsDistances are offered by the minimum distance menu, in the units of the user.
+var settingsDistances = []float64{1, 2, 5, 10}
+
+// settingsOption is a button of a settings menu, Value is passed to the apply of the menu.
+type settingsOption struct {
+	Text     string
+	Value    string
+	Selected bool
+}
+
+// settingsMenu changes one setting. Its callback data is settings:<key> to open it and
+// settings:<key>:<value> to apply a value.
+type settingsMenu struct {
+	Key    string
+	Button string
+	Title  string
+	// KeepOpen shows the menu again after a value was applied, to choose several values.
+	KeepOpen bool
+	Options  func(s *dbModels.UserSettings) []settingsOption
+	Apply    func(s *dbModels.UserSettings, value string) error
+}
+
+// settingsMenus are the menus of /settings, in the order of their buttons.
+var settingsMenus = []settingsMenu{
+	{
+		Key: "language", Button: "🌐 Language", Title: "language",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			return choiceOptions(dbModels.Languages, s.Language)
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			s.Language = value
+			return nil
+		},
+	},
+	{
+		Key: "units", Button: "📏 Units", Title: "units",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			return choiceOptions(dbModels.Units, s.Units)
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			s.Units = value
+			return nil
+		},
+	},
+	{
+		Key: "style", Button: "🎨 Naming style", Title: "naming style",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			return choiceOptions(dbModels.NamingStyles, s.NamingStyle)
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			s.NamingStyle = value
+			return nil
+		},
+	},
+	{
+		Key: "mode", Button: "⚙️ Rename mode", Title: "rename mode, /rename_mode sets the timeout",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			return choiceOptions(dbModels.RenameModes, s.RenameMode)
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			s.RenameMode = value
+			return nil
+		},
+	},
+	{
+		Key: "types", Button: "🏃 Activities", Title: "activities to rename, none selected renames all", KeepOpen: true,
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			options := []settingsOption{{Text: "All", Value: "all", Selected: len(s.ActivityTypes) == 0}}
+			for _, activityType := range dbModels.ActivityTypes {
+				options = append(options, settingsOption{Text: activityType, Value: activityType, Selected: slices.Contains(s.ActivityTypes, activityType)})
+			}
+			return options
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			switch {
+			case value == "all":
+				s.ActivityTypes = []string{}
+			case slices.Contains(s.ActivityTypes, value):
+				s.ActivityTypes = slices.DeleteFunc(s.ActivityTypes, func(t string) bool { return t == value })
+			default:
+				s.ActivityTypes = append(s.ActivityTypes, value)
+			}
+			return nil
+		},
+	},
+	{
+		Key: "distance", Button: "📐 Minimum distance", Title: "minimum distance of activities to rename",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			options := []settingsOption{{Text: "Off", Value: "0", Selected: s.MinDistance == 0}}
+			unit, meters := "km", 1000.0
+			if s.Units == dbModels.UnitsImperial {
+				unit, meters = "mi", dbModels.MetersPerMile
+			}
+			for _, distance := range settingsDistances {
+				value := math.Round(distance * meters)
+				options = append(options, settingsOption{
+					Text:     fmt.Sprintf("%g %s", distance, unit),
+					Value:    strconv.FormatFloat(value, 'f', -1, 64),
+					Selected: s.MinDistance == value,
+				})
+			}
+			return options
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			meters, err := strconv.ParseFloat(value, 64)
+			s.MinDistance = meters
+			return err
+		},
+	},
+	{
+		Key: "quiet", Button: "🌙 Quiet hours", Title: "hours during which new activities wait for their names",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			options := []settingsOption{{Text: "Off", Value: "off", Selected: s.QuietHoursStart == s.QuietHoursEnd}}
+			for _, hours := range settingsQuietHours {
+				options = append(options, settingsOption{
+					Text:     formatQuietHours(hours[0], hours[1]),
+					Value:    fmt.Sprintf("%d-%d", hours[0], hours[1]),
+					Selected: s.QuietHoursStart == hours[0] && s.QuietHoursEnd == hours[1],
+				})
+			}
+			return options
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			if value == "off" {
+				s.QuietHoursStart, s.QuietHoursEnd = 0, 0
+				return nil
+			}
+			_, err := fmt.Sscanf(value, "%d-%d", &s.QuietHoursStart, &s.QuietHoursEnd)
+			return err
+		},
+	},
+	{
+		Key: "tz", Button: "🕒 Timezone", Title: "timezone, /timezone sets any other",
+		Options: func(s *dbModels.UserSettings) []settingsOption {
+			return choiceOptions(settingsTimezones, s.Timezone)
+		},
+		Apply: func(s *dbModels.UserSettings, value string) error {
+			s.Timezone = value
+			return nil
+		},
+	},
+}
+
+// settingsHandler shows the settings of the user with buttons to change them.
+func (tg *Telegram) settingsHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	_, settings, ok := tg.settingsOfChat(ctx, chatID)
+	if !ok {
+		return
+	}
+	tg.showSettings(ctx, chatID, 0, makeSettingsMessage(settings), makeSettingsKeyboard())
+}
+
+// handleSettingsCallback opens a settings menu or applies the value chosen in it. The menus
+// replace each other in the message of the buttons.
+func (tg *Telegram) handleSettingsCallback(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	// callback data is settings[:<key>[:<value>]]
+	chatID := update.CallbackQuery.From.ID
+	var messageID int
+	if msg := update.CallbackQuery.Message.Message; msg != nil {
+		messageID = msg.ID
+	}
+	parts := strings.SplitN(update.CallbackQuery.Data, ":", 3)
+	if parts[0] != callbackPrefixSettings {
+		tg.SendMessage(ctx, chatID, "Invalid callback data.")
+		return
+	}
+	usr, settings, ok := tg.settingsOfChat(ctx, chatID)
+	if !ok {
+		return
+	}
+	if len(parts) == 1 {
+		tg.showSettings(ctx, chatID, messageID, makeSettingsMessage(settings), makeSettingsKeyboard())
+		return
+	}
+	i := slices.IndexFunc(settingsMenus, func(m settingsMenu) bool { return m.Key == parts[1] })
+	if i < 0 {
+		tg.SendMessage(ctx, chatID, settingsInvalidMessage)
+		return
+	}
+	menu := settingsMenus[i]
+	if len(parts) == 2 {
+		tg.showSettings(ctx, chatID, messageID, fmt.Sprintf(settingsChooseMessage, menu.Title), makeSettingsMenuKeyboard(menu, settings))
+		return
+	}
+
+	value := parts[2]
+	if err := menu.Apply(settings, value); err != nil || settings.Validate() != nil {
+		slog.Warn("invalid setting chosen", "userID", usr.ID, "setting", menu.Key, "value", value)
+		tg.SendMessage(ctx, chatID, settingsInvalidMessage)
+		return
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := tg.DB.SaveUserSettings(ctx, settings); err != nil {
+		slog.Error("failed to save user settings", "err", err, "userID", usr.ID, "setting", menu.Key)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	slog.Info("User setting changed", "userID", usr.ID, "setting", menu.Key, "value", value)
+	if menu.KeepOpen {
+		tg.showSettings(ctx, chatID, messageID, fmt.Sprintf(settingsChooseMessage, menu.Title), makeSettingsMenuKeyboard(menu, settings))
+		return
+	}
+	tg.showSettings(ctx, chatID, messageID, makeSettingsMessage(settings), makeSettingsKeyboard())
+}
+
+// timezoneHandler sets the timezone of the quiet hours: /timezone Europe/Berlin.
+func (tg *Telegram) timezoneHandler(ctx context.Context, _ *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) != 1 {
+		tg.SendMessage(ctx, chatID, timezoneUsageMessage)
+		return
+	}
+	usr, settings, ok := tg.settingsOfChat(ctx, chatID)
+	if !ok {
+		return
+	}
+	settings.Timezone = args[0]
+	if settings.Validate() != nil {
+		tg.SendMessage(ctx, chatID, timezoneUsageMessage)
+		return
+	}
+	settings.UpdatedAt = time.Now().Unix()
+	if err := tg.DB.SaveUserSettings(ctx, settings); err != nil {
+		slog.Error("failed to save timezone", "err", err, "userID", usr.ID, "timezone", settings.Timezone)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return
+	}
+	tg.SendMessage(ctx, chatID, fmt.Sprintf(timezoneSetMessage, settings.Timezone))
+}
+
+// settingsOfChat returns the user of the chat and their settings. Unlike userSettings it
+// doesn't fall back to the defaults, so they aren't saved over the stored settings.
+func (tg *Telegram) settingsOfChat(ctx context.Context, chatID int64) (*dbModels.User, *dbModels.UserSettings, bool) {
+	usr, err := tg.DB.GetUserByChatId(ctx, chatID)
+	if err != nil {
+		slog.Error("failed to get user for settings", "err", err, "chatID", chatID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return nil, nil, false
+	}
+	settings, err := tg.DB.GetUserSettings(ctx, usr.ID)
+	if err != nil {
+		slog.Error("failed to get user settings", "err", err, "userID", usr.ID)
+		tg.SendMessage(ctx, chatID, defaultBotErrorMessage)
+		return nil, nil, false
+	}
+	return usr, settings, true
+}
+
+// showSettings replaces the menu in messageID, or sends it when messageID is 0.
+func (tg *Telegram) showSettings(ctx context.Context, chatID int64, messageID int, text string, keyboard [][]models.InlineKeyboardButton) {
+	markup := &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	var err error
+	if messageID != 0 {
+		_, err = tg.Bot.EditMessageText(ctx, &bot.EditMessageTextParams{ChatID: chatID, MessageID: messageID, Text: text, ReplyMarkup: markup})
+	} else {
+		_, err = tg.Bot.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text, ReplyMarkup: markup})
+	}
+	if err != nil {
+		slog.Error("error while sending settings", "err", err, "chatID", chatID)
+	}
+}
+
+func makeSettingsMessage(s *dbModels.UserSettings) string {
+	mode := s.RenameMode
+	if mode == dbModels.RenameModeTimeout {
+		mode = fmt.Sprintf("timeout after %d minutes", s.RenameTimeout)
+	}
+	activityTypes := "all"
+	if len(s.ActivityTypes) > 0 {
+		activityTypes = strings.Join(s.ActivityTypes, ", ")
+	}
+	distance := "off"
+	if s.MinDistance > 0 {
+		distance = dbModels.FormatDistance(s.MinDistance, s.Units)
+	}
+	quietHours := "off"
+	if s.QuietHoursStart != s.QuietHoursEnd {
+		quietHours = formatQuietHours(s.QuietHoursStart, s.QuietHoursEnd)
+	}
+	return fmt.Sprintf(settingsMessage, s.Language, s.Units, s.NamingStyle, mode, activityTypes, distance, quietHours, s.Timezone)
+}
+
+func makeSettingsKeyboard() [][]models.InlineKeyboardButton {
+	var keyboard [][]models.InlineKeyboardButton
+	for i, menu := range settingsMenus {
+		button := models.InlineKeyboardButton{Text: menu.Button, CallbackData: callbackPrefixSettings + ":" + menu.Key}
+		if i%2 == 0 {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+		} else {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
+	}
+	return keyboard
+}
+
+func makeSettingsMenuKeyboard(menu settingsMenu, s *dbModels.UserSettings) [][]models.InlineKeyboardButton {
+	var keyboard [][]models.InlineKeyboardButton
+	for i, option := range menu.Options(s) {
+		text := option.Text
+		if option.Selected {
+			text = "✅ " + text
+		}
+		button := models.InlineKeyboardButton{Text: text, CallbackData: fmt.Sprintf("%s:%s:%s", callbackPrefixSettings, menu.Key, option.Value)}
+		if i%2 == 0 {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+		} else {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
+	}
+	return append(keyboard, []models.InlineKeyboardButton{{Text: "⬅️ Back", CallbackData: callbackPrefixSettings}})
+}
+
+// choiceOptions offers each of values, the current one selected.
+func choiceOptions(values []string, current string) []settingsOption {
+	options := make([]settingsOption, 0, len(values))
+	for _, value := range values {
+		options = append(options, settingsOption{Text: value, Value: value, Selected: value == current})
+	}
+	return options
+}
+
+func formatQuietHours(start, end int) string {
+	return fmt.Sprintf("%02d:00-%02d:00", start, end)
+}
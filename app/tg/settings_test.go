@@ -0,0 +1,190 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/mocks"
+	"strings"
+	"testing"
+
+	bot "github.com/go-telegram/bot"
+	botModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newSettingsTest returns a bot on a memory store with a user of chat 123.
+func newSettingsTest(t *testing.T) (*Telegram, *storage.MemoryStore, *mocks.BotSender, int64) {
+	store := storage.NewMemoryStore()
+	usr := &dbModels.User{TelegramChatId: 123, Language: "English"}
+	require.NoError(t, store.CreateUser(context.Background(), usr))
+	mbot := &mocks.BotSender{}
+	return &Telegram{Bot: mbot, DB: store}, store, mbot, usr.ID
+}
+
+func settingsCallback(data string) *botModels.Update {
+	return &botModels.Update{CallbackQuery: &botModels.CallbackQuery{
+		From:    botModels.User{ID: 123},
+		Data:    data,
+		Message: botModels.MaybeInaccessibleMessage{Message: &botModels.Message{ID: 5}},
+	}}
+}
+
+// editedMenu matches the edit of the menu message to text that has a button labelled buttonText.
+func editedMenu(text string, buttonText string) any {
+	return mock.MatchedBy(func(p *bot.EditMessageTextParams) bool {
+		markup, ok := p.ReplyMarkup.(*botModels.InlineKeyboardMarkup)
+		if !ok || p.MessageID != 5 || !strings.HasPrefix(p.Text, text) {
+			return false
+		}
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				if button.Text == buttonText {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+func TestSettingsHandler_ShowsSettings(t *testing.T) {
+	tgInstance, _, mbot, _ := newSettingsTest(t)
+	mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+		markup, ok := p.ReplyMarkup.(*botModels.InlineKeyboardMarkup)
+		return ok && len(markup.InlineKeyboard) == 4 &&
+			strings.HasPrefix(p.Text, "Your settings:\nLanguage: English\nUnits: metric\nNaming style: funny\nRename mode: manual\nActivities: all\nMinimum distance: off\nQuiet hours: off\nTimezone: UTC")
+	})).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance.settingsHandler(context.Background(), nil, &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: "/settings"}})
+
+	mbot.AssertExpectations(t)
+}
+
+func TestHandleSettingsCallback_OpensMenu(t *testing.T) {
+	tgInstance, _, mbot, _ := newSettingsTest(t)
+	mbot.On("EditMessageText", mock.Anything, editedMenu(fmt.Sprintf(settingsChooseMessage, "units"), "✅ metric")).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance.handleSettingsCallback(context.Background(), nil, settingsCallback("settings:units"))
+
+	mbot.AssertExpectations(t)
+}
+
+func TestHandleSettingsCallback_AppliesValue(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, userID := newSettingsTest(t)
+	summary := "Your settings:\nLanguage: English\nUnits: imperial\nNaming style: funny\nRename mode: manual\nActivities: all\n"
+	mbot.On("EditMessageText", mock.Anything, editedMenu(summary+"Minimum distance: off\nQuiet hours: off", "📏 Units")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("EditMessageText", mock.Anything, editedMenu(summary+"Minimum distance: 5.0 mi\nQuiet hours: off", "📐 Minimum distance")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("EditMessageText", mock.Anything, editedMenu(summary+"Minimum distance: 5.0 mi\nQuiet hours: 22:00-07:00", "🌙 Quiet hours")).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:units:imperial"))
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:distance:8047"))
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:quiet:22-7"))
+
+	settings, err := store.GetUserSettings(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, dbModels.UnitsImperial, settings.Units)
+	assert.Equal(t, 8047.0, settings.MinDistance)
+	assert.Equal(t, 22, settings.QuietHoursStart)
+	assert.Equal(t, 7, settings.QuietHoursEnd)
+	assert.NotZero(t, settings.UpdatedAt)
+	mbot.AssertExpectations(t)
+}
+
+func TestHandleSettingsCallback_TogglesActivityTypes(t *testing.T) {
+	ctx := context.Background()
+	tgInstance, store, mbot, userID := newSettingsTest(t)
+	mbot.On("EditMessageText", mock.Anything, editedMenu("Choose the activities", "✅ Run")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("EditMessageText", mock.Anything, editedMenu("Choose the activities", "✅ Ride")).Return(&botModels.Message{}, nil).Once()
+	mbot.On("EditMessageText", mock.Anything, editedMenu("Choose the activities", "Run")).Return(&botModels.Message{}, nil).Once()
+
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:types:Run"))
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:types:Ride"))
+	settings, err := store.GetUserSettings(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Run", "Ride"}, settings.ActivityTypes)
+
+	tgInstance.handleSettingsCallback(ctx, nil, settingsCallback("settings:types:Run"))
+	settings, err = store.GetUserSettings(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ride"}, settings.ActivityTypes)
+	mbot.AssertExpectations(t)
+}
+
+func TestHandleSettingsCallback_RejectsInvalidValue(t *testing.T) {
+	for _, data := range []string{"settings:language:Klingon", "settings:quiet:25-7", "settings:distance:far", "settings:colour:blue"} {
+		t.Run(data, func(t *testing.T) {
+			ctx := context.Background()
+			tgInstance, store, mbot, userID := newSettingsTest(t)
+			mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+				return p.Text == settingsInvalidMessage
+			})).Return(&botModels.Message{}, nil).Once()
+
+			tgInstance.handleSettingsCallback(ctx, nil, settingsCallback(data))
+
+			settings, err := store.GetUserSettings(ctx, userID)
+			require.NoError(t, err)
+			assert.Zero(t, settings.UpdatedAt)
+			mbot.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTimezoneHandler(t *testing.T) {
+	tests := []struct {
+		text         string
+		wantTimezone string
+		wantMessage  string
+	}{
+		{text: "/timezone Asia/Kolkata", wantTimezone: "Asia/Kolkata", wantMessage: fmt.Sprintf(timezoneSetMessage, "Asia/Kolkata")},
+		{text: "/timezone Mars/Olympus", wantTimezone: "UTC", wantMessage: timezoneUsageMessage},
+		{text: "/timezone", wantTimezone: "UTC", wantMessage: timezoneUsageMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ctx := context.Background()
+			tgInstance, store, mbot, userID := newSettingsTest(t)
+			mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+				return p.Text == tt.wantMessage
+			})).Return(&botModels.Message{}, nil).Once()
+
+			tgInstance.timezoneHandler(ctx, nil, &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: tt.text}})
+
+			settings, err := store.GetUserSettings(ctx, userID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTimezone, settings.Timezone)
+			mbot.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetLanguageHandler_ValidatesLanguage(t *testing.T) {
+	tests := []struct {
+		text         string
+		wantLanguage string
+		wantMessage  string
+	}{
+		{text: "/set_language german", wantLanguage: "German", wantMessage: fmt.Sprintf(languageSetSuccessMessage, "German")},
+		{text: "/set_language Klingon", wantLanguage: "English", wantMessage: fmt.Sprintf(unknownLanguageMessage, "Klingon", strings.Join(dbModels.Languages, ", "))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ctx := context.Background()
+			tgInstance, store, mbot, userID := newSettingsTest(t)
+			mbot.On("SendMessage", mock.Anything, mock.MatchedBy(func(p *bot.SendMessageParams) bool {
+				return p.Text == tt.wantMessage
+			})).Return(&botModels.Message{}, nil).Once()
+
+			tgInstance.setLanguageHandler(ctx, nil, &botModels.Update{Message: &botModels.Message{Chat: botModels.Chat{ID: 123}, Text: tt.text}})
+
+			usr, err := store.GetUserById(ctx, userID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLanguage, usr.Language)
+			mbot.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package tg
+
+import (
+	"context"
+	"log/slog"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/app/strava"
+	"time"
+)
+
+const syncPageSize = 200
+
+// syncActivities imports the activities that started since the user's sync cursor, oldest first.
+// Strava only pages oldest first when after is set, so a first sync asks for after=1. after is
+// exclusive, so pages start a second before the cursor and the activities of that second are
+// upserted again, they aren't counted as synced. The cursor is saved after every page, so an
+// interrupted sync picks up where it stopped.
+func (tg *Telegram) syncActivities(ctx context.Context, usr *dbModels.User) (int, error) {
+	state, err := tg.DB.GetSyncState(ctx, usr.ID)
+	if err != nil {
+		return 0, err
+	}
+	synced := 0
+	for {
+		cursor := state.LatestStartDate
+		page, err := tg.listActivities(ctx, usr, strava.ActivitiesQuery{After: max(cursor-1, 1), PerPage: syncPageSize})
+		if err != nil {
+			return synced, err
+		}
+		if len(page) > 0 {
+			err = tg.saveActivities(ctx, usr, page, nil)
+			if err != nil {
+				return synced, err
+			}
+		}
+		for _, a := range page {
+			if a.StartDate.Unix() > cursor {
+				synced++
+			}
+			state.LatestStartDate = max(state.LatestStartDate, a.StartDate.Unix())
+		}
+		if state.LatestStartDate == cursor {
+			slog.Info("activities synced", "userID", usr.ID, "count", synced, "cursor", state.LatestStartDate)
+			return synced, nil
+		}
+		state.UpdatedAt = time.Now().Unix()
+		err = tg.DB.SaveSyncState(ctx, state)
+		if err != nil {
+			return synced, err
+		}
+	}
+}
+
+// backfillActivities imports the user's whole history, newest first, walking back with a before
+// cursor. The cursor is checkpointed after every page; a later call resumes an unfinished backfill.
+func (tg *Telegram) backfillActivities(ctx context.Context, usr *dbModels.User) (int, error) {
+	state, err := tg.DB.GetSyncState(ctx, usr.ID)
+	if err != nil {
+		return 0, err
+	}
+	if state.BackfillBefore == 0 {
+		state.BackfillBefore = time.Now().Unix()
+	} else {
+		slog.Info("resuming activities backfill", "userID", usr.ID, "before", state.BackfillBefore)
+	}
+	imported := 0
+	for {
+		page, err := tg.listActivities(ctx, usr, strava.ActivitiesQuery{Before: state.BackfillBefore, PerPage: syncPageSize})
+		if err != nil {
+			return imported, err
+		}
+		if len(page) > 0 {
+			err = tg.saveActivities(ctx, usr, page, func(written int, _ int) {
+				slog.Info("activities backfill progress", "userID", usr.ID, "imported", imported+written)
+			})
+			if err != nil {
+				return imported, err
+			}
+			imported += len(page)
+		}
+
+		before := state.BackfillBefore
+		for _, a := range page {
+			state.BackfillBefore = min(state.BackfillBefore, a.StartDate.Unix())
+			state.LatestStartDate = max(state.LatestStartDate, a.StartDate.Unix())
+		}
+		done := state.BackfillBefore == before
+		if done {
+			state.BackfillBefore = 0
+			state.BackfillCompletedAt = time.Now().Unix()
+		}
+		state.UpdatedAt = time.Now().Unix()
+		err = tg.DB.SaveSyncState(ctx, state)
+		if err != nil {
+			return imported, err
+		}
+		if done {
+			slog.Info("activities backfill finished", "userID", usr.ID, "count", imported)
+			return imported, nil
+		}
+	}
+}
+
+func (tg *Telegram) listActivities(ctx context.Context, usr *dbModels.User, query strava.ActivitiesQuery) ([]dbModels.UserActivity, error) {
+	var activities []dbModels.UserActivity
+	err := strava.WithToken(ctx, tg.Strava, tg.DB, usr, func(accessToken string) error {
+		var err error
+		activities, err = tg.Strava.ListActivities(ctx, accessToken, query)
+		return err
+	})
+	return activities, err
+}
+
+// saveActivities upserts the activities of usr in chunks of ActivityBatchSize, calling progress,
+// unless nil, after every chunk.
+func (tg *Telegram) saveActivities(ctx context.Context, usr *dbModels.User, activities []dbModels.UserActivity, progress func(written int, total int)) error {
+	activityPtrs := make([]*dbModels.UserActivity, len(activities))
+	for i := range activities {
+		activities[i].UserID = usr.ID
+		activityPtrs[i] = &activities[i]
+	}
+	return tg.DB.UpsertActivities(ctx, activityPtrs, storage.BatchOptions{ChunkSize: tg.ActivityBatchSize, Progress: progress})
+}
@@ -0,0 +1,122 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"stravach/app/storage"
+	dbModels "stravach/app/storage/models"
+	"stravach/app/strava"
+	"stravach/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func syncTestUser() *dbModels.User {
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	return &dbModels.User{ID: 1, StravaAccessToken: "token", TokenExpiresAt: &expiresAt}
+}
+
+func TestSyncActivities_PullsAfterCursorAndCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+	tgInstance := &Telegram{DB: mdb, Strava: mstrava}
+
+	mdb.On("GetSyncState", mock.Anything, int64(1)).Return(&dbModels.SyncState{UserID: 1, LatestStartDate: 100}, nil)
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{After: 99, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 9, StartDate: time.Unix(100, 0)},
+		{ID: 10, StartDate: time.Unix(200, 0)},
+		{ID: 11, StartDate: time.Unix(300, 0)},
+	}, nil).Once()
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{After: 299, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 11, StartDate: time.Unix(300, 0)},
+	}, nil).Once()
+	mdb.On("UpsertActivities", mock.Anything, mock.MatchedBy(func(activities []*dbModels.UserActivity) bool {
+		return len(activities) == 3 && activities[1].ID == 10 && activities[2].ID == 11 && activities[0].UserID == 1
+	}), storage.BatchOptions{}).Return(nil).Once()
+	mdb.On("UpsertActivities", mock.Anything, mock.MatchedBy(func(activities []*dbModels.UserActivity) bool {
+		return len(activities) == 1 && activities[0].ID == 11
+	}), storage.BatchOptions{}).Return(nil).Once()
+	mdb.On("SaveSyncState", mock.Anything, mock.MatchedBy(func(state *dbModels.SyncState) bool {
+		return state.LatestStartDate == 300
+	})).Return(nil).Once()
+
+	synced, err := tgInstance.syncActivities(ctx, syncTestUser())
+	require.NoError(t, err)
+	assert.Equal(t, 2, synced)
+
+	mdb.AssertExpectations(t)
+	mstrava.AssertExpectations(t)
+}
+
+func TestSyncActivities_FirstSyncPagesFromTheOldest(t *testing.T) {
+	ctx := context.Background()
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+	tgInstance := &Telegram{DB: mdb, Strava: mstrava}
+
+	state := &dbModels.SyncState{UserID: 1}
+	mdb.On("GetSyncState", mock.Anything, int64(1)).Return(state, nil)
+	mdb.On("UpsertActivities", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mdb.On("SaveSyncState", mock.Anything, mock.Anything).Return(nil)
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{After: 1, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 1, StartDate: time.Unix(100, 0)},
+		{ID: 2, StartDate: time.Unix(200, 0)},
+	}, nil).Once()
+	// the page ended within second 200, the next one starts with it again
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{After: 199, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 2, StartDate: time.Unix(200, 0)},
+		{ID: 3, StartDate: time.Unix(200, 0)},
+		{ID: 4, StartDate: time.Unix(300, 0)},
+	}, nil).Once()
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{After: 299, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 4, StartDate: time.Unix(300, 0)},
+	}, nil).Once()
+
+	synced, err := tgInstance.syncActivities(ctx, syncTestUser())
+	require.NoError(t, err)
+	assert.Equal(t, 3, synced)
+	assert.Equal(t, int64(300), state.LatestStartDate)
+	mdb.AssertNumberOfCalls(t, "UpsertActivities", 3)
+	mdb.AssertNumberOfCalls(t, "SaveSyncState", 2)
+
+	mstrava.AssertExpectations(t)
+}
+
+func TestBackfillActivities_ResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	mdb := &mocks.Store{}
+	mstrava := &mocks.StravaService{}
+	tgInstance := &Telegram{DB: mdb, Strava: mstrava, ActivityBatchSize: 50}
+
+	state := &dbModels.SyncState{UserID: 1, LatestStartDate: 900, BackfillBefore: 500}
+	mdb.On("GetSyncState", mock.Anything, int64(1)).Return(state, nil)
+	mdb.On("UpsertActivities", mock.Anything, mock.Anything, mock.MatchedBy(func(opts storage.BatchOptions) bool {
+		return opts.ChunkSize == 50 && opts.Progress != nil
+	})).Return(nil)
+	mdb.On("SaveSyncState", mock.Anything, mock.Anything).Return(nil)
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{Before: 500, PerPage: syncPageSize}).Return([]dbModels.UserActivity{
+		{ID: 4, StartDate: time.Unix(400, 0)},
+		{ID: 3, StartDate: time.Unix(350, 0)},
+	}, nil).Once()
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{Before: 350, PerPage: syncPageSize}).Return(nil, &strava.RateLimitError{RetryAfter: time.Minute}).Once()
+
+	imported, err := tgInstance.backfillActivities(ctx, syncTestUser())
+	require.True(t, errors.Is(err, strava.ErrRateLimited))
+	assert.Equal(t, 2, imported)
+	assert.Equal(t, int64(350), state.BackfillBefore)
+
+	mstrava.On("ListActivities", mock.Anything, "token", strava.ActivitiesQuery{Before: 350, PerPage: syncPageSize}).Return([]dbModels.UserActivity{}, nil).Once()
+	imported, err = tgInstance.backfillActivities(ctx, syncTestUser())
+	require.NoError(t, err)
+	assert.Equal(t, 0, imported)
+	assert.Zero(t, state.BackfillBefore)
+	assert.NotZero(t, state.BackfillCompletedAt)
+	assert.Equal(t, int64(900), state.LatestStartDate)
+
+	mstrava.AssertExpectations(t)
+}
@@ -0,0 +1,105 @@
+package tg
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-telegram/bot"
+)
+
+// Update modes of the bot, selected with TELEGRAM_UPDATE_MODE.
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+)
+
+// WebhookPath is the route of the HTTP server that receives updates in webhook mode.
+const WebhookPath = "/api/telegram/webhook"
+
+// webhookSecretHeader carries the secret_token of setWebhook on every update Telegram posts.
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookSecretPattern is what Telegram accepts as secret_token.
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// WebhookConfig makes Telegram post updates to URL instead of the bot long polling them,
+// so any replica behind URL can receive them.
+type WebhookConfig struct {
+	URL string
+	// Secret is sent back by Telegram with every update, requests without it are rejected.
+	Secret string
+}
+
+// WebhookConfigFromEnv reads TELEGRAM_UPDATE_MODE, polling when unset, and returns nil for
+// polling. Webhook mode registers TELEGRAM_WEBHOOK_URL, by default WebhookPath on URL, and
+// needs TELEGRAM_WEBHOOK_SECRET.
+func WebhookConfigFromEnv() (*WebhookConfig, error) {
+	switch mode := os.Getenv("TELEGRAM_UPDATE_MODE"); mode {
+	case "", UpdateModePolling:
+		return nil, nil
+	case UpdateModeWebhook:
+	default:
+		return nil, fmt.Errorf("unknown TELEGRAM_UPDATE_MODE %q, use %s or %s", mode, UpdateModePolling, UpdateModeWebhook)
+	}
+	config := &WebhookConfig{URL: os.Getenv("TELEGRAM_WEBHOOK_URL"), Secret: os.Getenv("TELEGRAM_WEBHOOK_SECRET")}
+	if config.URL == "" {
+		base := os.Getenv("URL")
+		if base == "" {
+			return nil, fmt.Errorf("webhook mode needs TELEGRAM_WEBHOOK_URL or URL")
+		}
+		config.URL = strings.TrimSuffix(base, "/") + WebhookPath
+	}
+	if !webhookSecretPattern.MatchString(config.Secret) {
+		return nil, fmt.Errorf("TELEGRAM_WEBHOOK_SECRET must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+	return config, nil
+}
+
+// receiveUpdates registers the webhook, or removes it for polling since Telegram refuses
+// getUpdates while one is set, and handles updates in the background until ctx is done.
+// done is closed once the running updates are handled.
+func (tg *Telegram) receiveUpdates(ctx context.Context) (done chan struct{}, err error) {
+	done = make(chan struct{})
+	if tg.Webhook == nil {
+		if _, err = tg.Bot.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+			return nil, fmt.Errorf("deleting webhook: %w", err)
+		}
+		go func() {
+			defer close(done)
+			tg.Bot.Start(ctx)
+		}()
+		slog.Info("Telegram bot started and polling for updates.")
+		return done, nil
+	}
+	_, err = tg.Bot.SetWebhook(ctx, &bot.SetWebhookParams{URL: tg.Webhook.URL, SecretToken: tg.Webhook.Secret})
+	if err != nil {
+		return nil, fmt.Errorf("setting webhook: %w", err)
+	}
+	go func() {
+		defer close(done)
+		tg.Bot.StartWebhook(ctx)
+	}()
+	slog.Info("Telegram bot started and receiving updates by webhook.", "url", tg.Webhook.URL)
+	return done, nil
+}
+
+// WebhookHandler accepts the updates Telegram posts in webhook mode and passes them to the
+// bot, which must be connected. Requests without the secret of Webhook are rejected.
+func (tg *Telegram) WebhookHandler() http.HandlerFunc {
+	updates := tg.Bot.WebhookHandler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(tg.Webhook.Secret)) != 1 {
+			slog.Warn("telegram webhook request with invalid secret token", "remote", r.RemoteAddr)
+			http.Error(w, "invalid secret token", http.StatusUnauthorized)
+			return
+		}
+		updates(w, r)
+	}
+}
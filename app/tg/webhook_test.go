@@ -0,0 +1,108 @@
+package tg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"stravach/mocks"
+	"testing"
+
+	bot "github.com/go-telegram/bot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    *WebhookConfig
+		wantErr string
+	}{
+		{name: "polling by default", env: map[string]string{}},
+		{name: "polling", env: map[string]string{"TELEGRAM_UPDATE_MODE": "polling", "TELEGRAM_WEBHOOK_SECRET": "ignored"}},
+		{
+			name: "webhook on URL",
+			env:  map[string]string{"TELEGRAM_UPDATE_MODE": "webhook", "URL": "https://stravach.example/", "TELEGRAM_WEBHOOK_SECRET": "s3cret_token-1"},
+			want: &WebhookConfig{URL: "https://stravach.example/api/telegram/webhook", Secret: "s3cret_token-1"},
+		},
+		{
+			name: "explicit webhook URL",
+			env:  map[string]string{"TELEGRAM_UPDATE_MODE": "webhook", "URL": "https://stravach.example", "TELEGRAM_WEBHOOK_URL": "https://bot.example/hook", "TELEGRAM_WEBHOOK_SECRET": "secret"},
+			want: &WebhookConfig{URL: "https://bot.example/hook", Secret: "secret"},
+		},
+		{name: "unknown mode", env: map[string]string{"TELEGRAM_UPDATE_MODE": "push"}, wantErr: "unknown TELEGRAM_UPDATE_MODE"},
+		{name: "no URL", env: map[string]string{"TELEGRAM_UPDATE_MODE": "webhook", "TELEGRAM_WEBHOOK_SECRET": "secret"}, wantErr: "needs TELEGRAM_WEBHOOK_URL or URL"},
+		{name: "no secret", env: map[string]string{"TELEGRAM_UPDATE_MODE": "webhook", "URL": "https://stravach.example"}, wantErr: "TELEGRAM_WEBHOOK_SECRET"},
+		{name: "invalid secret", env: map[string]string{"TELEGRAM_UPDATE_MODE": "webhook", "URL": "https://stravach.example", "TELEGRAM_WEBHOOK_SECRET": "not allowed!"}, wantErr: "TELEGRAM_WEBHOOK_SECRET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TELEGRAM_UPDATE_MODE", "URL", "TELEGRAM_WEBHOOK_URL", "TELEGRAM_WEBHOOK_SECRET"} {
+				t.Setenv(key, tt.env[key])
+			}
+			config, err := WebhookConfigFromEnv()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, config)
+		})
+	}
+}
+
+func TestWebhookHandler_ChecksSecret(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	delivered := 0
+	mbot.On("WebhookHandler").Return(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { delivered++ }))
+	tgInstance := &Telegram{Bot: mbot, Webhook: &WebhookConfig{URL: "https://stravach.example/api/telegram/webhook", Secret: "secret"}}
+	handler := tgInstance.WebhookHandler()
+
+	for _, secret := range []string{"", "wrong", "secret2"} {
+		req := httptest.NewRequest(http.MethodPost, WebhookPath, nil)
+		if secret != "" {
+			req.Header.Set(webhookSecretHeader, secret)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, secret)
+	}
+	assert.Equal(t, 0, delivered)
+
+	req := httptest.NewRequest(http.MethodPost, WebhookPath, nil)
+	req.Header.Set(webhookSecretHeader, "secret")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, delivered)
+}
+
+func TestStart_SetsWebhook(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mbot.On("SetWebhook", mock.Anything, &bot.SetWebhookParams{URL: "https://stravach.example/api/telegram/webhook", SecretToken: "secret"}).Return(true, nil)
+	mbot.On("StartWebhook", mock.Anything).Return()
+	tgInstance := &Telegram{Bot: mbot, Webhook: &WebhookConfig{URL: "https://stravach.example/api/telegram/webhook", Secret: "secret"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tgInstance.Start(ctx)
+
+	mbot.AssertExpectations(t)
+	mbot.AssertNotCalled(t, "Start", mock.Anything)
+}
+
+func TestStart_PollingDeletesWebhook(t *testing.T) {
+	mbot := &mocks.BotSender{}
+	mbot.On("DeleteWebhook", mock.Anything, &bot.DeleteWebhookParams{}).Return(true, nil)
+	mbot.On("Start", mock.Anything).Return()
+	tgInstance := &Telegram{Bot: mbot}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tgInstance.Start(ctx)
+
+	mbot.AssertExpectations(t)
+	mbot.AssertNotCalled(t, "SetWebhook", mock.Anything, mock.Anything)
+}
@@ -1,3 +0,0 @@
-package utils
-
-const UNAUTHORIZED = "unauthorized"
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
 	"log"
 	"log/slog"
@@ -88,3 +91,56 @@ func (j JWT) GetChatIdFromToken(tokenString string) (*int64, error) {
 	}
 	return &chatId, nil
 }
+
+const stravaOAuthAudience = "strava_oauth"
+
+type stateClaims struct {
+	ChatId int64 `json:"chat_id"`
+	// Nonce binds the flow to the browser that holds it in a cookie, empty in the links of the bot.
+	Nonce string `json:"nonce,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateOAuthState returns a signed token binding a Strava OAuth flow to the Telegram chat that
+// started it and, unless nonce is empty, to the browser that holds nonce.
+func (j JWT) GenerateOAuthState(chatId int64, nonce string, ttl time.Duration) (string, error) {
+	claims := &stateClaims{
+		ChatId: chatId,
+		Nonce:  nonce,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  stravaOAuthAudience,
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.Key)
+}
+
+// GetChatIdFromOAuthState validates a token created by GenerateOAuthState with nonce and returns its chat id.
+func (j JWT) GetChatIdFromOAuthState(state string, nonce string) (int64, error) {
+	claims := &stateClaims{}
+	tkn, err := jwt.ParseWithClaims(state, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return j.Key, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !tkn.Valid || !claims.VerifyAudience(stravaOAuthAudience, true) || claims.ChatId == 0 {
+		return 0, errors.New("invalid oauth state")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return 0, errors.New("oauth state was issued to another browser")
+	}
+	return claims.ChatId, nil
+}
+
+// NewOAuthNonce returns a random nonce for GenerateOAuthState.
+func NewOAuthNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
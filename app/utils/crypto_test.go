@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthState(t *testing.T) {
+	j := JWT{Key: []byte("secret")}
+
+	state, err := j.GenerateOAuthState(212439945, "", time.Hour)
+	require.NoError(t, err)
+	chatId, err := j.GetChatIdFromOAuthState(state, "")
+	require.NoError(t, err)
+	require.Equal(t, int64(212439945), chatId)
+
+	_, err = JWT{Key: []byte("other")}.GetChatIdFromOAuthState(state, "")
+	require.Error(t, err)
+
+	expired, err := j.GenerateOAuthState(212439945, "", -time.Minute)
+	require.NoError(t, err)
+	_, err = j.GetChatIdFromOAuthState(expired, "")
+	require.Error(t, err)
+
+	// auth cookies must not be usable as oauth state
+	authToken, err := j.GenerateJWTForUser(1)
+	require.NoError(t, err)
+	_, err = j.GetChatIdFromOAuthState(authToken.Value, "")
+	require.Error(t, err)
+}
+
+func TestOAuthState_Nonce(t *testing.T) {
+	j := JWT{Key: []byte("secret")}
+	nonce, err := NewOAuthNonce()
+	require.NoError(t, err)
+	other, err := NewOAuthNonce()
+	require.NoError(t, err)
+	require.NotEqual(t, nonce, other)
+
+	state, err := j.GenerateOAuthState(212439945, nonce, time.Hour)
+	require.NoError(t, err)
+	chatId, err := j.GetChatIdFromOAuthState(state, nonce)
+	require.NoError(t, err)
+	require.Equal(t, int64(212439945), chatId)
+
+	_, err = j.GetChatIdFromOAuthState(state, other)
+	require.Error(t, err)
+	_, err = j.GetChatIdFromOAuthState(state, "")
+	require.Error(t, err)
+
+	// a link of the bot isn't bound to a browser, so it can't finish a flow
+	link, err := j.GenerateOAuthState(212439945, "", time.Hour)
+	require.NoError(t, err)
+	_, err = j.GetChatIdFromOAuthState(link, nonce)
+	require.Error(t, err)
+}
@@ -2,28 +2,19 @@ package utils
 
 import (
 	"fmt"
-	"log/slog"
 	"regexp"
 	"strings"
 )
 
-func GetCodeFromUrl(url string) string {
-	slog.Debug(url)
-	re := regexp.MustCompile("code=[a-z0-9]*")
-	codeString := re.FindString(url)
-	slog.Debug(codeString)
-	return codeString[5:]
-}
+// activityNamePrefix matches the leading numbers, punctuation and whitespace of a listed name.
+var activityNamePrefix = regexp.MustCompile(`^\s*[\d\.\-\)\(\s]*`)
 
 func FormatActivityNames(activityNames []string) []string {
 	var formattedList []string
 
-	// Regular expression to remove leading numbers, punctuation, and whitespace
-	re := regexp.MustCompile(`^\s*[\d\.\-\)\(\s]*`)
-
 	for i, str := range activityNames {
 		// Clean the string by removing leading numbers, dashes, or other characters
-		cleanedStr := re.ReplaceAllString(str, "")
+		cleanedStr := activityNamePrefix.ReplaceAllString(str, "")
 		// Format the string with the proper index and append it to the formatted list
 		formattedStr := fmt.Sprintf("%d. %s", i+1, strings.TrimSpace(cleanedStr))
 		formattedList = append(formattedList, formattedStr)
@@ -31,3 +22,16 @@ func FormatActivityNames(activityNames []string) []string {
 
 	return formattedList
 }
+
+// CleanActivityNames strips the list numbering and whitespace around the names and drops
+// the names left empty, e.g. the blank lines of an AI response.
+func CleanActivityNames(activityNames []string) []string {
+	var cleaned []string
+	for _, str := range activityNames {
+		name := strings.TrimSpace(activityNamePrefix.ReplaceAllString(str, ""))
+		if name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTelegramHashMismatch = errors.New("telegram auth hash mismatch")
+	ErrTelegramAuthExpired  = errors.New("telegram auth data is too old")
+)
+
+// VerifyTelegramLogin checks data received from the Telegram Login Widget.
+// The hash must be the HMAC-SHA256 of the data-check-string keyed by SHA256(bot token),
+// and auth_date must not be older than maxAge.
+// See https://core.telegram.org/widgets/login#checking-authorization
+func VerifyTelegramLogin(data map[string]string, botToken string, maxAge time.Duration, now time.Time) error {
+	secret := sha256.Sum256([]byte(botToken))
+	return verifyTelegramData(data, secret[:], maxAge, now)
+}
+
+// VerifyTelegramWebAppInitData checks the initData string of a Telegram Mini App and returns its fields.
+// The secret key is the HMAC-SHA256 of the bot token keyed by "WebAppData".
+// See https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func VerifyTelegramWebAppInitData(initData string, botToken string, maxAge time.Duration, now time.Time) (map[string]string, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(values))
+	for k := range values {
+		data[k] = values.Get(k)
+	}
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(botToken))
+	err = verifyTelegramData(data, mac.Sum(nil), maxAge, now)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func verifyTelegramData(data map[string]string, secret []byte, maxAge time.Duration, now time.Time) error {
+	hash, err := hex.DecodeString(data["hash"])
+	if err != nil || len(hash) == 0 {
+		return ErrTelegramHashMismatch
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(telegramDataCheckString(data)))
+	if !hmac.Equal(mac.Sum(nil), hash) {
+		return ErrTelegramHashMismatch
+	}
+
+	authDate, err := strconv.ParseInt(data["auth_date"], 10, 64)
+	if err != nil {
+		return ErrTelegramAuthExpired
+	}
+	if now.Sub(time.Unix(authDate, 0)) > maxAge {
+		return ErrTelegramAuthExpired
+	}
+	return nil
+}
+
+// telegramDataCheckString joins all fields except hash as sorted key=value lines.
+func telegramDataCheckString(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if k == "hash" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = k + "=" + data[k]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBotToken = "123456:test-bot-token"
+
+func signTelegramLogin(data map[string]string) string {
+	secret := sha256.Sum256([]byte(testBotToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(telegramDataCheckString(data)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := func() map[string]string {
+		data := map[string]string{
+			"id":         "212439945",
+			"first_name": "Dev",
+			"username":   "devuser",
+			"auth_date":  strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+		}
+		data["hash"] = signTelegramLogin(data)
+		return data
+	}
+
+	require.NoError(t, VerifyTelegramLogin(valid(), testBotToken, time.Hour, now))
+
+	tampered := valid()
+	tampered["id"] = "1"
+	require.ErrorIs(t, VerifyTelegramLogin(tampered, testBotToken, time.Hour, now), ErrTelegramHashMismatch)
+
+	require.ErrorIs(t, VerifyTelegramLogin(valid(), "other-token", time.Hour, now), ErrTelegramHashMismatch)
+
+	missingHash := valid()
+	delete(missingHash, "hash")
+	require.ErrorIs(t, VerifyTelegramLogin(missingHash, testBotToken, time.Hour, now), ErrTelegramHashMismatch)
+
+	require.ErrorIs(t, VerifyTelegramLogin(valid(), testBotToken, time.Hour, now.Add(2*time.Hour)), ErrTelegramAuthExpired)
+}
+
+func TestVerifyTelegramWebAppInitData(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	data := map[string]string{
+		"query_id":  "AAHdF6IQAAAAAN0XohDhrOrc",
+		"user":      `{"id":212439945,"first_name":"Dev","username":"devuser"}`,
+		"auth_date": strconv.FormatInt(now.Unix(), 10),
+	}
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(testBotToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(telegramDataCheckString(data)))
+
+	values := url.Values{}
+	for k, v := range data {
+		values.Set(k, v)
+	}
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+
+	got, err := VerifyTelegramWebAppInitData(values.Encode(), testBotToken, time.Hour, now)
+	require.NoError(t, err)
+	require.Equal(t, data["user"], got["user"])
+
+	// Login Widget signature must not be accepted for Mini App data
+	values.Set("hash", signTelegramLogin(data))
+	_, err = VerifyTelegramWebAppInitData(values.Encode(), testBotToken, time.Hour, now)
+	require.ErrorIs(t, err, ErrTelegramHashMismatch)
+}
@@ -5,6 +5,7 @@ import { Routes, Route, Link, useNavigate } from "react-router-dom";
 import ActivitiesPage from "../pages/ActivitiesPage";
 import UserProfilePage from "../pages/UserProfilePage";
 import BroadcastPage from "../pages/BroadcastPage";
+import SettingsPage from "../pages/SettingsPage";
 
 // TODO: Replace with real admin check or context
 function useIsAdmin() {
@@ -17,14 +18,8 @@ function onTelegramAuth(
   user: TelegramUser,
   navigate: ReturnType<typeof useNavigate>,
 ) {
-  const payload = {
-    user: {
-      id: user.id,
-      first_name: user.first_name,
-      last_name: user.last_name,
-      username: user.username,
-    },
-  };
+  // send the widget data untouched, the server verifies its hash
+  const payload = { user };
 
   fetch("/api/tg-auth", {
     method: "POST",
@@ -229,6 +224,7 @@ function App() {
         <Route path="/" element={<HomePage />} />
         <Route path="/activities/:userId" element={<ActivitiesPage />} />
         <Route path="/user/:userId" element={<UserProfilePage />} />
+        <Route path="/settings" element={<SettingsPage />} />
         {useIsAdmin() && (
           <Route path="/broadcast" element={<BroadcastPage />} />
         )}
@@ -12,6 +12,23 @@ interface Activity {
   moving_time?: number;
   elapsed_time?: number;
   is_updated?: boolean;
+  description?: string;
+  sport_type?: string;
+  total_elevation_gain?: number;
+  start_latlng?: number[] | null;
+  end_latlng?: number[] | null;
+  map?: { summary_polyline: string };
+  max_speed?: number;
+  max_heartrate?: number;
+  average_cadence?: number;
+  average_watts?: number;
+  kilojoules?: number;
+  calories?: number;
+  gear_id?: string;
+  device_name?: string;
+  timezone?: string;
+  trainer?: boolean;
+  commute?: boolean;
   generationStatus?: "idle" | "pending" | "success" | "error";
   generationMessage?: string;
 }
@@ -27,7 +44,7 @@ const ActivitiesPage: React.FC = () => {
     if (!userId) return;
     setLoading(true);
     try {
-      const res = await fetch(`/api/activities/${userId}`);
+      const res = await fetch("/api/me/activities");
       if (!res.ok) throw new Error("Failed to fetch activities");
       const data = await res.json();
       setActivities(
@@ -50,7 +67,7 @@ const ActivitiesPage: React.FC = () => {
     setRefreshing(true);
     setError(null);
     try {
-      const res = await fetch(`/api/activities-refresh-last-10/${userId}`, {
+      const res = await fetch("/api/me/activities/refresh", {
         method: "POST"
       });
       if (!res.ok) throw new Error("Failed to refresh last 10 activities");
@@ -70,7 +87,7 @@ const ActivitiesPage: React.FC = () => {
   useEffect(() => {
     if (!userId) return;
     setLoading(true);
-    fetch(`/api/activities/${userId}`)
+    fetch("/api/me/activities")
       .then(async (res) => {
         if (!res.ok) throw new Error("Failed to fetch activities");
         const data = await res.json();
@@ -105,7 +122,7 @@ const ActivitiesPage: React.FC = () => {
     );
 
     try {
-      const response = await fetch(`/api/activity/${activityId}`, {
+      const response = await fetch(`/api/activities/${activityId}/rename`, {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
@@ -219,6 +236,12 @@ const ActivitiesPage: React.FC = () => {
                     <strong>Distance:</strong>{" "}
                     {(activity.distance / 1000).toFixed(2)} km
                   </p>
+                  {activity.total_elevation_gain ? (
+                    <p className="text-gray-600 mb-1">
+                      <strong>Elevation:</strong>{" "}
+                      {Math.round(activity.total_elevation_gain)} m
+                    </p>
+                  ) : null}
                   {activity.average_heartrate && (
                     <p className="text-gray-600 mb-1">
                       <strong>Avg HR:</strong> {activity.average_heartrate} bpm
@@ -0,0 +1,189 @@
+import React, { useEffect, useState } from "react";
+import { Button } from "../components/ui/button";
+
+interface Settings {
+  language: string;
+  units: "metric" | "imperial";
+  naming_style: string;
+  rename_mode: string;
+  rename_timeout: number;
+  activity_types: string[];
+  min_distance: number;
+  quiet_hours_start: number;
+  quiet_hours_end: number;
+  timezone: string;
+}
+
+// the values the server accepts, see app/storage/models/user_settings.go
+const LANGUAGES = ["English", "German", "French", "Spanish", "Italian", "Portuguese", "Dutch", "Polish", "Ukrainian", "Russian"];
+const NAMING_STYLES = ["funny", "serious", "poetic", "short"];
+const RENAME_MODES = ["manual", "auto", "timeout"];
+const ACTIVITY_TYPES = ["Run", "TrailRun", "Ride", "VirtualRide", "Walk", "Hike", "Swim", "WeightTraining", "Yoga", "Workout"];
+const HOURS = Array.from({ length: 24 }, (_, hour) => hour);
+const METERS_PER_UNIT = { metric: 1000, imperial: 1609.344 };
+
+const SettingsPage: React.FC = () => {
+  const [settings, setSettings] = useState<Settings | null>(null);
+  const [status, setStatus] = useState<string | null>(null);
+  const [saving, setSaving] = useState(false);
+
+  useEffect(() => {
+    fetch("/api/me/settings", { credentials: "include" })
+      .then(async (res) => {
+        if (!res.ok) throw new Error("Failed to fetch settings");
+        setSettings(await res.json());
+      })
+      .catch((e) => setStatus(e.message || "Failed to fetch settings"));
+  }, []);
+
+  if (!settings) {
+    return <div className="text-center mt-10">{status || "Loading settings..."}</div>;
+  }
+
+  const update = (change: Partial<Settings>) => setSettings({ ...settings, ...change });
+
+  const toggleType = (type: string) =>
+    update({
+      activity_types: settings.activity_types.includes(type)
+        ? settings.activity_types.filter((t) => t !== type)
+        : [...settings.activity_types, type],
+    });
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setSaving(true);
+    setStatus(null);
+    try {
+      const res = await fetch("/api/me/settings", {
+        method: "PATCH",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+          language: settings.language,
+          units: settings.units,
+          naming_style: settings.naming_style,
+          rename_mode: settings.rename_mode,
+          rename_timeout: settings.rename_timeout,
+          activity_types: settings.activity_types,
+          min_distance: settings.min_distance,
+          quiet_hours_start: settings.quiet_hours_start,
+          quiet_hours_end: settings.quiet_hours_end,
+          timezone: settings.timezone,
+        }),
+        credentials: "include",
+      });
+      const data = await res.json();
+      if (!res.ok) throw new Error(data.error || "Failed to save settings");
+      setSettings(data);
+      setStatus("Settings saved!");
+    } catch (error: any) {
+      setStatus(error.message || "Failed to save settings");
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  const unitLabel = settings.units === "imperial" ? "mi" : "km";
+  const metersPerUnit = METERS_PER_UNIT[settings.units];
+
+  return (
+    <div className="min-h-screen flex flex-col items-center justify-center bg-gradient-to-br from-blue-50 to-blue-200 py-12 px-4">
+      <div className="bg-white shadow-lg rounded-xl p-8 w-full max-w-md">
+        <h1 className="text-3xl font-bold text-blue-700 mb-6 text-center">Settings</h1>
+        <form onSubmit={handleSubmit} className="flex flex-col gap-4">
+          <label className="flex flex-col gap-1">
+            Language
+            <select className="border rounded-lg p-2" value={settings.language} onChange={(e) => update({ language: e.target.value })}>
+              {LANGUAGES.map((language) => <option key={language}>{language}</option>)}
+            </select>
+          </label>
+          <label className="flex flex-col gap-1">
+            Units
+            <select className="border rounded-lg p-2" value={settings.units} onChange={(e) => update({ units: e.target.value as Settings["units"] })}>
+              <option value="metric">metric</option>
+              <option value="imperial">imperial</option>
+            </select>
+          </label>
+          <label className="flex flex-col gap-1">
+            Naming style
+            <select className="border rounded-lg p-2" value={settings.naming_style} onChange={(e) => update({ naming_style: e.target.value })}>
+              {NAMING_STYLES.map((style) => <option key={style}>{style}</option>)}
+            </select>
+          </label>
+          <label className="flex flex-col gap-1">
+            Rename mode
+            <select className="border rounded-lg p-2" value={settings.rename_mode} onChange={(e) => update({ rename_mode: e.target.value })}>
+              {RENAME_MODES.map((mode) => <option key={mode}>{mode}</option>)}
+            </select>
+          </label>
+          {settings.rename_mode === "timeout" && (
+            <label className="flex flex-col gap-1">
+              Apply the first name after (minutes)
+              <input
+                type="number"
+                min={1}
+                max={1440}
+                className="border rounded-lg p-2"
+                value={settings.rename_timeout}
+                onChange={(e) => update({ rename_timeout: Number(e.target.value) })}
+              />
+            </label>
+          )}
+          <fieldset className="flex flex-col gap-1">
+            <legend>Activities to rename (none selected renames all)</legend>
+            <div className="grid grid-cols-2 gap-1">
+              {ACTIVITY_TYPES.map((type) => (
+                <label key={type} className="flex items-center gap-2">
+                  <input type="checkbox" checked={settings.activity_types.includes(type)} onChange={() => toggleType(type)} />
+                  {type}
+                </label>
+              ))}
+            </div>
+          </fieldset>
+          <label className="flex flex-col gap-1">
+            Minimum distance ({unitLabel})
+            <input
+              type="number"
+              min={0}
+              step={0.1}
+              className="border rounded-lg p-2"
+              value={Math.round((settings.min_distance / metersPerUnit) * 10) / 10}
+              onChange={(e) => update({ min_distance: Math.round(Number(e.target.value) * metersPerUnit) })}
+            />
+          </label>
+          <div className="flex gap-2 items-end">
+            <label className="flex flex-col gap-1 flex-1">
+              Quiet from
+              <select className="border rounded-lg p-2" value={settings.quiet_hours_start} onChange={(e) => update({ quiet_hours_start: Number(e.target.value) })}>
+                {HOURS.map((hour) => <option key={hour} value={hour}>{`${hour}:00`}</option>)}
+              </select>
+            </label>
+            <label className="flex flex-col gap-1 flex-1">
+              until
+              <select className="border rounded-lg p-2" value={settings.quiet_hours_end} onChange={(e) => update({ quiet_hours_end: Number(e.target.value) })}>
+                {HOURS.map((hour) => <option key={hour} value={hour}>{`${hour}:00`}</option>)}
+              </select>
+            </label>
+          </div>
+          <p className="text-sm text-gray-500">Quiet hours are off when both are the same.</p>
+          <label className="flex flex-col gap-1">
+            Timezone
+            <input
+              className="border rounded-lg p-2"
+              value={settings.timezone}
+              onChange={(e) => update({ timezone: e.target.value })}
+              placeholder="Europe/Berlin"
+            />
+          </label>
+          <Button type="submit" disabled={saving}>
+            {saving ? "Saving..." : "Save Settings"}
+          </Button>
+        </form>
+        {status && <div className="mt-4 text-center text-sm text-blue-600">{status}</div>}
+      </div>
+    </div>
+  );
+};
+
+export default SettingsPage;
@@ -20,6 +20,12 @@ const UserProfilePage: React.FC = () => {
         >
           View Activities
         </Link>
+        <Link
+          to="/settings"
+          className="inline-block ml-3 bg-white hover:bg-blue-50 text-blue-700 font-semibold py-3 px-6 rounded-lg border border-blue-600 shadow transition duration-200"
+        >
+          Settings
+        </Link>
       </div>
     </div>
   );
@@ -61,23 +61,23 @@ func (_m *AI) FormatActivityName(name string) (string, error) {
 	return r0, r1
 }
 
-// GenerateBetterNames provides a mock function with given fields: activity, lang
-func (_m *AI) GenerateBetterNames(activity models.UserActivity, lang string) (string, error) {
-	ret := _m.Called(activity, lang)
+// GenerateBetterNames provides a mock function with given fields: activity, lang, style
+func (_m *AI) GenerateBetterNames(activity models.UserActivity, lang string, style string) (string, error) {
+	ret := _m.Called(activity, lang, style)
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(models.UserActivity, string) (string, error)); ok {
-		return rf(activity, lang)
+	if rf, ok := ret.Get(0).(func(models.UserActivity, string, string) (string, error)); ok {
+		return rf(activity, lang, style)
 	}
-	if rf, ok := ret.Get(0).(func(models.UserActivity, string) string); ok {
-		r0 = rf(activity, lang)
+	if rf, ok := ret.Get(0).(func(models.UserActivity, string, string) string); ok {
+		r0 = rf(activity, lang, style)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(models.UserActivity, string) error); ok {
-		r1 = rf(activity, lang)
+	if rf, ok := ret.Get(1).(func(models.UserActivity, string, string) error); ok {
+		r1 = rf(activity, lang, style)
 	} else {
 		r1 = ret.Error(1)
 	}
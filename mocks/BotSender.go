@@ -10,6 +10,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	models "github.com/go-telegram/bot/models"
+
+	http "net/http"
 )
 
 // BotSender is an autogenerated mock type for the BotSender type
@@ -17,6 +19,56 @@ type BotSender struct {
 	mock.Mock
 }
 
+// DeleteWebhook provides a mock function with given fields: ctx, params
+func (_m *BotSender) DeleteWebhook(ctx context.Context, params *bot.DeleteWebhookParams) (bool, error) {
+	ret := _m.Called(ctx, params)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.DeleteWebhookParams) (bool, error)); ok {
+		return rf(ctx, params)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.DeleteWebhookParams) bool); ok {
+		r0 = rf(ctx, params)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *bot.DeleteWebhookParams) error); ok {
+		r1 = rf(ctx, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EditMessageText provides a mock function with given fields: ctx, params
+func (_m *BotSender) EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	ret := _m.Called(ctx, params)
+
+	var r0 *models.Message
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.EditMessageTextParams) (*models.Message, error)); ok {
+		return rf(ctx, params)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.EditMessageTextParams) *models.Message); ok {
+		r0 = rf(ctx, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Message)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *bot.EditMessageTextParams) error); ok {
+		r1 = rf(ctx, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // RegisterHandler provides a mock function with given fields: handlerType, command, matchType, handlerFunc, middleware
 func (_m *BotSender) RegisterHandler(handlerType bot.HandlerType, command string, matchType bot.MatchType, handlerFunc bot.HandlerFunc, middleware ...bot.Middleware) string {
 	_va := make([]interface{}, len(middleware))
@@ -85,11 +137,56 @@ func (_m *BotSender) SendMessage(ctx context.Context, params *bot.SendMessagePar
 	return r0, r1
 }
 
+// SetWebhook provides a mock function with given fields: ctx, params
+func (_m *BotSender) SetWebhook(ctx context.Context, params *bot.SetWebhookParams) (bool, error) {
+	ret := _m.Called(ctx, params)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.SetWebhookParams) (bool, error)); ok {
+		return rf(ctx, params)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *bot.SetWebhookParams) bool); ok {
+		r0 = rf(ctx, params)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *bot.SetWebhookParams) error); ok {
+		r1 = rf(ctx, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Start provides a mock function with given fields: ctx
 func (_m *BotSender) Start(ctx context.Context) {
 	_m.Called(ctx)
 }
 
+// StartWebhook provides a mock function with given fields: ctx
+func (_m *BotSender) StartWebhook(ctx context.Context) {
+	_m.Called(ctx)
+}
+
+// WebhookHandler provides a mock function with given fields:
+func (_m *BotSender) WebhookHandler() http.HandlerFunc {
+	ret := _m.Called()
+
+	var r0 http.HandlerFunc
+	if rf, ok := ret.Get(0).(func() http.HandlerFunc); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(http.HandlerFunc)
+		}
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewBotSender interface {
 	mock.TestingT
 	Cleanup(func())
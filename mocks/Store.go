@@ -3,6 +3,9 @@
 package mocks
 
 import (
+	context "context"
+
+	storage "stravach/app/storage"
 	models "stravach/app/storage/models"
 
 	mock "github.com/stretchr/testify/mock"
@@ -13,6 +16,46 @@ type Store struct {
 	mock.Mock
 }
 
+// AddNameChange provides a mock function with given fields: ctx, change
+func (_m *Store) AddNameChange(ctx context.Context, change *models.NameChange) error {
+	ret := _m.Called(ctx, change)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.NameChange) error); ok {
+		r0 = rf(ctx, change)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimWebhookEvent provides a mock function with given fields: ctx, now, leaseUntil
+func (_m *Store) ClaimWebhookEvent(ctx context.Context, now int64, leaseUntil int64) (*models.WebhookEvent, error) {
+	ret := _m.Called(ctx, now, leaseUntil)
+
+	var r0 *models.WebhookEvent
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) (*models.WebhookEvent, error)); ok {
+		return rf(ctx, now, leaseUntil)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) *models.WebhookEvent); ok {
+		r0 = rf(ctx, now, leaseUntil)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.WebhookEvent)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, now, leaseUntil)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Connect provides a mock function with given fields:
 func (_m *Store) Connect() error {
 	ret := _m.Called()
@@ -27,13 +70,69 @@ func (_m *Store) Connect() error {
 	return r0
 }
 
-// CreateUserActivities provides a mock function with given fields: activities
-func (_m *Store) CreateUserActivities(activities []*models.UserActivity) error {
-	ret := _m.Called(activities)
+// CreateUser provides a mock function with given fields: ctx, user
+func (_m *Store) CreateUser(ctx context.Context, user *models.User) error {
+	ret := _m.Called(ctx, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUserActivities provides a mock function with given fields: ctx, activities
+func (_m *Store) CreateUserActivities(ctx context.Context, activities []*models.UserActivity) error {
+	ret := _m.Called(ctx, activities)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []*models.UserActivity) error); ok {
+		r0 = rf(ctx, activities)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUserActivity provides a mock function with given fields: ctx, activity, userId
+func (_m *Store) CreateUserActivity(ctx context.Context, activity *models.UserActivity, userId int64) error {
+	ret := _m.Called(ctx, activity, userId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.UserActivity, int64) error); ok {
+		r0 = rf(ctx, activity, userId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteExpiredConversations provides a mock function with given fields: ctx, now
+func (_m *Store) DeleteExpiredConversations(ctx context.Context, now int64) error {
+	ret := _m.Called(ctx, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteNameOptions provides a mock function with given fields: ctx, chatId, activityId
+func (_m *Store) DeleteNameOptions(ctx context.Context, chatId int64, activityId int64) error {
+	ret := _m.Called(ctx, chatId, activityId)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func([]*models.UserActivity) error); ok {
-		r0 = rf(activities)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) error); ok {
+		r0 = rf(ctx, chatId, activityId)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -41,13 +140,13 @@ func (_m *Store) CreateUserActivities(activities []*models.UserActivity) error {
 	return r0
 }
 
-// CreateUserActivity provides a mock function with given fields: activity, userId
-func (_m *Store) CreateUserActivity(activity *models.UserActivity, userId int64) error {
-	ret := _m.Called(activity, userId)
+// DeleteUserActivity provides a mock function with given fields: ctx, activityId
+func (_m *Store) DeleteUserActivity(ctx context.Context, activityId int64) error {
+	ret := _m.Called(ctx, activityId)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.UserActivity, int64) error); ok {
-		r0 = rf(activity, userId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, activityId)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -55,25 +154,49 @@ func (_m *Store) CreateUserActivity(activity *models.UserActivity, userId int64)
 	return r0
 }
 
-// GetActivityById provides a mock function with given fields: activityId
-func (_m *Store) GetActivityById(activityId int64) (*models.UserActivity, error) {
-	ret := _m.Called(activityId)
+// EnqueueWebhookEvent provides a mock function with given fields: ctx, event
+func (_m *Store) EnqueueWebhookEvent(ctx context.Context, event *models.WebhookEvent) (bool, error) {
+	ret := _m.Called(ctx, event)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.WebhookEvent) (bool, error)); ok {
+		return rf(ctx, event)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.WebhookEvent) bool); ok {
+		r0 = rf(ctx, event)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *models.WebhookEvent) error); ok {
+		r1 = rf(ctx, event)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetActivityById provides a mock function with given fields: ctx, activityId
+func (_m *Store) GetActivityById(ctx context.Context, activityId int64) (*models.UserActivity, error) {
+	ret := _m.Called(ctx, activityId)
 
 	var r0 *models.UserActivity
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64) (*models.UserActivity, error)); ok {
-		return rf(activityId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.UserActivity, error)); ok {
+		return rf(ctx, activityId)
 	}
-	if rf, ok := ret.Get(0).(func(int64) *models.UserActivity); ok {
-		r0 = rf(activityId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.UserActivity); ok {
+		r0 = rf(ctx, activityId)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.UserActivity)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(activityId)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, activityId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -81,25 +204,77 @@ func (_m *Store) GetActivityById(activityId int64) (*models.UserActivity, error)
 	return r0, r1
 }
 
-// GetAllUsers provides a mock function with given fields:
-func (_m *Store) GetAllUsers() ([]*models.User, error) {
-	ret := _m.Called()
+// GetAllUsers provides a mock function with given fields: ctx
+func (_m *Store) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	ret := _m.Called(ctx)
 
 	var r0 []*models.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func() ([]*models.User, error)); ok {
-		return rf()
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*models.User, error)); ok {
+		return rf(ctx)
 	}
-	if rf, ok := ret.Get(0).(func() []*models.User); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) []*models.User); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*models.User)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetConversation provides a mock function with given fields: ctx, chatId, now
+func (_m *Store) GetConversation(ctx context.Context, chatId int64, now int64) (*models.Conversation, error) {
+	ret := _m.Called(ctx, chatId, now)
+
+	var r0 *models.Conversation
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) (*models.Conversation, error)); ok {
+		return rf(ctx, chatId, now)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) *models.Conversation); ok {
+		r0 = rf(ctx, chatId, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Conversation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, chatId, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLastNameChange provides a mock function with given fields: ctx, userId, activityId
+func (_m *Store) GetLastNameChange(ctx context.Context, userId int64, activityId int64) (*models.NameChange, error) {
+	ret := _m.Called(ctx, userId, activityId)
+
+	var r0 *models.NameChange
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) (*models.NameChange, error)); ok {
+		return rf(ctx, userId, activityId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) *models.NameChange); ok {
+		r0 = rf(ctx, userId, activityId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.NameChange)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, userId, activityId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -107,25 +282,103 @@ func (_m *Store) GetAllUsers() ([]*models.User, error) {
 	return r0, r1
 }
 
-// GetUserActivities provides a mock function with given fields: userId, limit
-func (_m *Store) GetUserActivities(userId int64, limit int) ([]models.UserActivity, error) {
-	ret := _m.Called(userId, limit)
+// GetNameHistory provides a mock function with given fields: ctx, activityId
+func (_m *Store) GetNameHistory(ctx context.Context, activityId int64) ([]models.NameChange, error) {
+	ret := _m.Called(ctx, activityId)
+
+	var r0 []models.NameChange
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]models.NameChange, error)); ok {
+		return rf(ctx, activityId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []models.NameChange); ok {
+		r0 = rf(ctx, activityId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.NameChange)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, activityId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNameOptions provides a mock function with given fields: ctx, chatId, activityId, now
+func (_m *Store) GetNameOptions(ctx context.Context, chatId int64, activityId int64, now int64) (*models.NameOptions, error) {
+	ret := _m.Called(ctx, chatId, activityId, now)
+
+	var r0 *models.NameOptions
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, int64) (*models.NameOptions, error)); ok {
+		return rf(ctx, chatId, activityId, now)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, int64) *models.NameOptions); ok {
+		r0 = rf(ctx, chatId, activityId, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.NameOptions)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, int64) error); ok {
+		r1 = rf(ctx, chatId, activityId, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSyncState provides a mock function with given fields: ctx, userId
+func (_m *Store) GetSyncState(ctx context.Context, userId int64) (*models.SyncState, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.SyncState
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.SyncState, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.SyncState); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.SyncState)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserActivities provides a mock function with given fields: ctx, userId, limit
+func (_m *Store) GetUserActivities(ctx context.Context, userId int64, limit int) ([]models.UserActivity, error) {
+	ret := _m.Called(ctx, userId, limit)
 
 	var r0 []models.UserActivity
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64, int) ([]models.UserActivity, error)); ok {
-		return rf(userId, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]models.UserActivity, error)); ok {
+		return rf(ctx, userId, limit)
 	}
-	if rf, ok := ret.Get(0).(func(int64, int) []models.UserActivity); ok {
-		r0 = rf(userId, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []models.UserActivity); ok {
+		r0 = rf(ctx, userId, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.UserActivity)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int64, int) error); ok {
-		r1 = rf(userId, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, userId, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -133,25 +386,25 @@ func (_m *Store) GetUserActivities(userId int64, limit int) ([]models.UserActivi
 	return r0, r1
 }
 
-// GetUserByChatId provides a mock function with given fields: chatId
-func (_m *Store) GetUserByChatId(chatId int64) (*models.User, error) {
-	ret := _m.Called(chatId)
+// GetUserByChatId provides a mock function with given fields: ctx, chatId
+func (_m *Store) GetUserByChatId(ctx context.Context, chatId int64) (*models.User, error) {
+	ret := _m.Called(ctx, chatId)
 
 	var r0 *models.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64) (*models.User, error)); ok {
-		return rf(chatId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.User, error)); ok {
+		return rf(ctx, chatId)
 	}
-	if rf, ok := ret.Get(0).(func(int64) *models.User); ok {
-		r0 = rf(chatId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.User); ok {
+		r0 = rf(ctx, chatId)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.User)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(chatId)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, chatId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -159,25 +412,25 @@ func (_m *Store) GetUserByChatId(chatId int64) (*models.User, error) {
 	return r0, r1
 }
 
-// GetUserById provides a mock function with given fields: id
-func (_m *Store) GetUserById(id int64) (*models.User, error) {
-	ret := _m.Called(id)
+// GetUserById provides a mock function with given fields: ctx, id
+func (_m *Store) GetUserById(ctx context.Context, id int64) (*models.User, error) {
+	ret := _m.Called(ctx, id)
 
 	var r0 *models.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64) (*models.User, error)); ok {
-		return rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.User, error)); ok {
+		return rf(ctx, id)
 	}
-	if rf, ok := ret.Get(0).(func(int64) *models.User); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.User); ok {
+		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.User)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(id)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -185,25 +438,51 @@ func (_m *Store) GetUserById(id int64) (*models.User, error) {
 	return r0, r1
 }
 
-// GetUserByStravaId provides a mock function with given fields: stravaId
-func (_m *Store) GetUserByStravaId(stravaId int64) (*models.User, error) {
-	ret := _m.Called(stravaId)
+// GetUserByStravaId provides a mock function with given fields: ctx, stravaId
+func (_m *Store) GetUserByStravaId(ctx context.Context, stravaId int64) (*models.User, error) {
+	ret := _m.Called(ctx, stravaId)
 
 	var r0 *models.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64) (*models.User, error)); ok {
-		return rf(stravaId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.User, error)); ok {
+		return rf(ctx, stravaId)
 	}
-	if rf, ok := ret.Get(0).(func(int64) *models.User); ok {
-		r0 = rf(stravaId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.User); ok {
+		r0 = rf(ctx, stravaId)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.User)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(stravaId)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, stravaId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserSettings provides a mock function with given fields: ctx, userId
+func (_m *Store) GetUserSettings(ctx context.Context, userId int64) (*models.UserSettings, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 *models.UserSettings
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*models.UserSettings, error)); ok {
+		return rf(ctx, userId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *models.UserSettings); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.UserSettings)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, userId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -211,23 +490,169 @@ func (_m *Store) GetUserByStravaId(stravaId int64) (*models.User, error) {
 	return r0, r1
 }
 
-// IsActivityExists provides a mock function with given fields: activityId
-func (_m *Store) IsActivityExists(activityId int64) (bool, error) {
-	ret := _m.Called(activityId)
+// IsActivityExists provides a mock function with given fields: ctx, activityId
+func (_m *Store) IsActivityExists(ctx context.Context, activityId int64) (bool, error) {
+	ret := _m.Called(ctx, activityId)
 
 	var r0 bool
 	var r1 error
-	if rf, ok := ret.Get(0).(func(int64) (bool, error)); ok {
-		return rf(activityId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (bool, error)); ok {
+		return rf(ctx, activityId)
 	}
-	if rf, ok := ret.Get(0).(func(int64) bool); ok {
-		r0 = rf(activityId)
+	if rf, ok := ret.Get(0).(func(context.Context, int64) bool); ok {
+		r0 = rf(ctx, activityId)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
 
-	if rf, ok := ret.Get(1).(func(int64) error); ok {
-		r1 = rf(activityId)
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, activityId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IsUserExistsByChatId provides a mock function with given fields: ctx, chatId
+func (_m *Store) IsUserExistsByChatId(ctx context.Context, chatId int64) (bool, error) {
+	ret := _m.Called(ctx, chatId)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (bool, error)); ok {
+		return rf(ctx, chatId)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) bool); ok {
+		r0 = rf(ctx, chatId)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, chatId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MarkNameChangeReverted provides a mock function with given fields: ctx, id, revertedAt
+func (_m *Store) MarkNameChangeReverted(ctx context.Context, id int64, revertedAt int64) error {
+	ret := _m.Called(ctx, id, revertedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) error); ok {
+		r0 = rf(ctx, id, revertedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// QueryActivities provides a mock function with given fields: ctx, query
+func (_m *Store) QueryActivities(ctx context.Context, query storage.ActivityQuery) (*storage.ActivityPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *storage.ActivityPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ActivityQuery) (*storage.ActivityPage, error)); ok {
+		return rf(ctx, query)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ActivityQuery) *storage.ActivityPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.ActivityPage)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, storage.ActivityQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveConversation provides a mock function with given fields: ctx, conversation
+func (_m *Store) SaveConversation(ctx context.Context, conversation *models.Conversation) error {
+	ret := _m.Called(ctx, conversation)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Conversation) error); ok {
+		r0 = rf(ctx, conversation)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveNameOptions provides a mock function with given fields: ctx, options
+func (_m *Store) SaveNameOptions(ctx context.Context, options *models.NameOptions) error {
+	ret := _m.Called(ctx, options)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.NameOptions) error); ok {
+		r0 = rf(ctx, options)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveSyncState provides a mock function with given fields: ctx, state
+func (_m *Store) SaveSyncState(ctx context.Context, state *models.SyncState) error {
+	ret := _m.Called(ctx, state)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.SyncState) error); ok {
+		r0 = rf(ctx, state)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveUserSettings provides a mock function with given fields: ctx, settings
+func (_m *Store) SaveUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	ret := _m.Called(ctx, settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.UserSettings) error); ok {
+		r0 = rf(ctx, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TakeDueNameOptions provides a mock function with given fields: ctx, now
+func (_m *Store) TakeDueNameOptions(ctx context.Context, now int64) ([]models.NameOptions, error) {
+	ret := _m.Called(ctx, now)
+
+	var r0 []models.NameOptions
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]models.NameOptions, error)); ok {
+		return rf(ctx, now)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []models.NameOptions); ok {
+		r0 = rf(ctx, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.NameOptions)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, now)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -235,13 +660,55 @@ func (_m *Store) IsActivityExists(activityId int64) (bool, error) {
 	return r0, r1
 }
 
-// UpdateUser provides a mock function with given fields: user
-func (_m *Store) UpdateUser(user *models.User) error {
-	ret := _m.Called(user)
+// UpdateUser provides a mock function with given fields: ctx, user
+func (_m *Store) UpdateUser(ctx context.Context, user *models.User) error {
+	ret := _m.Called(ctx, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateUserActivity provides a mock function with given fields: ctx, activity
+func (_m *Store) UpdateUserActivity(ctx context.Context, activity *models.UserActivity) error {
+	ret := _m.Called(ctx, activity)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.UserActivity) error); ok {
+		r0 = rf(ctx, activity)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateWebhookEvent provides a mock function with given fields: ctx, event
+func (_m *Store) UpdateWebhookEvent(ctx context.Context, event *models.WebhookEvent) error {
+	ret := _m.Called(ctx, event)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.WebhookEvent) error); ok {
+		r0 = rf(ctx, event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpsertActivities provides a mock function with given fields: ctx, activities, opts
+func (_m *Store) UpsertActivities(ctx context.Context, activities []*models.UserActivity, opts storage.BatchOptions) error {
+	ret := _m.Called(ctx, activities, opts)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.User) error); ok {
-		r0 = rf(user)
+	if rf, ok := ret.Get(0).(func(context.Context, []*models.UserActivity, storage.BatchOptions) error); ok {
+		r0 = rf(ctx, activities, opts)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	context "context"
+
 	models "stravach/app/storage/models"
 
 	mock "github.com/stretchr/testify/mock"
@@ -15,6 +17,20 @@ type StravaService struct {
 	mock.Mock
 }
 
+// AuthorizationUrl provides a mock function with given fields: redirectUri, scope, state
+func (_m *StravaService) AuthorizationUrl(redirectUri string, scope string, state string) string {
+	ret := _m.Called(redirectUri, scope, state)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, string) string); ok {
+		r0 = rf(redirectUri, scope, state)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
 // Authorize provides a mock function with given fields: accessCode
 func (_m *StravaService) Authorize(accessCode string) (*strava.AuthResp, error) {
 	ret := _m.Called(accessCode)
@@ -67,25 +83,25 @@ func (_m *StravaService) GetActivity(accessToken string, activityId int64) (*mod
 	return r0, r1
 }
 
-// GetAllActivities provides a mock function with given fields: accessToken
-func (_m *StravaService) GetAllActivities(accessToken string) (*[]models.UserActivity, error) {
-	ret := _m.Called(accessToken)
+// GetLatestActivities provides a mock function with given fields: ctx, accessToken, limit
+func (_m *StravaService) GetLatestActivities(ctx context.Context, accessToken string, limit int) ([]models.UserActivity, error) {
+	ret := _m.Called(ctx, accessToken, limit)
 
-	var r0 *[]models.UserActivity
+	var r0 []models.UserActivity
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (*[]models.UserActivity, error)); ok {
-		return rf(accessToken)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) ([]models.UserActivity, error)); ok {
+		return rf(ctx, accessToken, limit)
 	}
-	if rf, ok := ret.Get(0).(func(string) *[]models.UserActivity); ok {
-		r0 = rf(accessToken)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []models.UserActivity); ok {
+		r0 = rf(ctx, accessToken, limit)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*[]models.UserActivity)
+			r0 = ret.Get(0).([]models.UserActivity)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(accessToken)
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, accessToken, limit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -93,25 +109,25 @@ func (_m *StravaService) GetAllActivities(accessToken string) (*[]models.UserAct
 	return r0, r1
 }
 
-// GetLatestActivities provides a mock function with given fields: accessToken, limit
-func (_m *StravaService) GetLatestActivities(accessToken string, limit int) ([]models.UserActivity, error) {
-	ret := _m.Called(accessToken, limit)
+// ListActivities provides a mock function with given fields: ctx, accessToken, query
+func (_m *StravaService) ListActivities(ctx context.Context, accessToken string, query strava.ActivitiesQuery) ([]models.UserActivity, error) {
+	ret := _m.Called(ctx, accessToken, query)
 
 	var r0 []models.UserActivity
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, int) ([]models.UserActivity, error)); ok {
-		return rf(accessToken, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, strava.ActivitiesQuery) ([]models.UserActivity, error)); ok {
+		return rf(ctx, accessToken, query)
 	}
-	if rf, ok := ret.Get(0).(func(string, int) []models.UserActivity); ok {
-		r0 = rf(accessToken, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, strava.ActivitiesQuery) []models.UserActivity); ok {
+		r0 = rf(ctx, accessToken, query)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]models.UserActivity)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, int) error); ok {
-		r1 = rf(accessToken, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, string, strava.ActivitiesQuery) error); ok {
+		r1 = rf(ctx, accessToken, query)
 	} else {
 		r1 = ret.Error(1)
 	}